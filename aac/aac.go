@@ -23,6 +23,7 @@
 package aac
 
 import (
+	"github.com/ossrs/go-oryx-lib/avc"
 	"github.com/ossrs/go-oryx-lib/errors"
 )
 
@@ -59,6 +60,13 @@ const (
 
 	ObjectTypeHE   ObjectType = 5  // HE=LC+SBR
 	ObjectTypeHEv2 ObjectType = 29 // HEv2=LC+SBR+PS
+
+	// The escape value, the object type is 32+audioObjectTypeExt.
+	ObjectTypeEscape ObjectType = 31
+
+	// The escaped object types, whose specific config is not parsed.
+	ObjectTypeELD  ObjectType = 39 // ER AAC ELD
+	ObjectTypeUSAC ObjectType = 42 // USAC
 )
 
 func (v ObjectType) String() string {
@@ -73,11 +81,20 @@ func (v ObjectType) String() string {
 		return "HE"
 	case ObjectTypeHEv2:
 		return "HEv2"
+	case ObjectTypeELD:
+		return "ELD"
+	case ObjectTypeUSAC:
+		return "USAC"
 	default:
 		return "Forbidden"
 	}
 }
 
+// Whether the object type is escaped, that is 32+.
+func (v ObjectType) escaped() bool {
+	return v > ObjectTypeEscape
+}
+
 func (v ObjectType) ToProfile() Profile {
 	switch v {
 	case ObjectTypeMain:
@@ -153,6 +170,10 @@ const (
 	SampleRateIndexForbidden
 )
 
+// The escape value of samplingFrequencyIndex, the sampling frequency is explicit in 24bits.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.6.3.4 samplingFrequencyIndex
+const SampleRateIndexEscape SampleRateIndex = 0x0f
+
 func (v SampleRateIndex) String() string {
 	switch v {
 	case SampleRateIndex96kHz:
@@ -200,6 +221,25 @@ func (v SampleRateIndex) ToHz() int {
 	return aacSR[v]
 }
 
+// Whether the sample rate is valid, the frequency is required for the escape index.
+func (v SampleRateIndex) valid(frequency uint32) bool {
+	if v == SampleRateIndexEscape {
+		return frequency > 0
+	}
+	return v <= SampleRateIndex7kHz
+}
+
+// The sample rate in Hz, the frequency is used for the escape index.
+func (v SampleRateIndex) hz(frequency uint32) int {
+	if v == SampleRateIndexEscape {
+		return int(frequency)
+	}
+	if v > SampleRateIndex7kHz {
+		return 0
+	}
+	return v.ToHz()
+}
+
 // The aac channel.
 // Refer to @doc ISO_IEC_13818-7-AAC-2004.pdf, @page 72, @section Table 42 – Implicit speaker mapping
 type Channels uint8
@@ -285,9 +325,12 @@ func (v *ADTSImpl) SetASC(asc []byte) (err error) {
 }
 
 func (v *ADTSImpl) Encode(raw []byte) (data []byte, err error) {
-	if err = v.asc.validate(); err != nil {
+	if err = v.asc.validateEncode(); err != nil {
 		return nil, errors.WithMessage(err, "adts encode")
 	}
+	if v.asc.SampleRate == SampleRateIndexEscape {
+		return nil, errors.Errorf("adts encode explicit sample-rate %v", v.asc.SamplingFrequency)
+	}
 
 	// write the ADTS header.
 	// Refer to @doc ISO_IEC_13818-7-AAC-2004.pdf, @page 26, @section 6.2 Audio Data Transport Stream, ADTS
@@ -427,6 +470,7 @@ func (v *ADTSImpl) Decode(data []byte) (raw, left []byte, err error) {
 		p = p[2:]
 	}
 
+	v.asc = AudioSpecificConfig{}
 	v.asc.Object = profile.ToObjectType()
 	v.asc.Channels = Channels(channelConfiguration)
 	v.asc.SampleRate = SampleRateIndex(samplingFrequencyIndex)
@@ -455,62 +499,586 @@ type AudioSpecificConfig struct {
 	Object     ObjectType      // AAC object type.
 	SampleRate SampleRateIndex // AAC sample rate, not the FLV sampling rate.
 	Channels   Channels        // AAC channel configuration.
+
+	// The explicit sampling frequency in Hz, when SampleRate is SampleRateIndexEscape.
+	SamplingFrequency uint32
+	// The program_config_element, when Channels is ChannelForbidden(0).
+	PCE *ProgramConfigElement
+
+	// Whether the SBR or PS present, by the explicit signalling.
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.6.5 Signaling of SBR
+	SBR, PS bool
+	// The core object type of explicit hierarchical signalling, when Object is HE or HEv2.
+	CoreObject ObjectType
+	// The sample rate of SBR, generally twice the core sample rate.
+	ExtensionSampleRate        SampleRateIndex
+	ExtensionSamplingFrequency uint32
+
+	// The GASpecificConfig.
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 4.4.1 GA bitstream payloads
+	FrameLengthFlag    bool   // Whether use 960 samples per frame, default to 1024.
+	DependsOnCoreCoder bool   // Whether depends on the core coder.
+	CoreCoderDelay     uint16 // The delay in samples, when depends on the core coder.
+	ExtensionFlag      bool   // Whether the extensionFlag3 present.
+}
+
+// The syncExtensionType of the backward compatible explicit signalling.
+const (
+	ascSyncExtensionSBR = 0x2b7
+	ascSyncExtensionPS  = 0x548
+)
+
+// The audioObjectType of the GASpecificConfig, the core of HE or HEv2.
+func (v *AudioSpecificConfig) coreObject() ObjectType {
+	if v.Object == ObjectTypeHE || v.Object == ObjectTypeHEv2 {
+		return v.CoreObject
+	}
+	return v.Object
 }
 
+// Validate the ASC, the escaped object type is valid without the specific config.
 func (v *AudioSpecificConfig) validate() (err error) {
 	switch v.Object {
 	case ObjectTypeMain, ObjectTypeLC, ObjectTypeSSR, ObjectTypeHE, ObjectTypeHEv2:
 	default:
-		return errors.Errorf("invalid object %#x", uint8(v.Object))
+		if !v.Object.escaped() {
+			return errors.Errorf("invalid object %#x", uint8(v.Object))
+		}
 	}
 
-	if v.SampleRate < SampleRateIndex88kHz || v.SampleRate > SampleRateIndex7kHz {
+	if !v.SampleRate.valid(v.SamplingFrequency) {
 		return errors.Errorf("invalid sample-rate %#x", uint8(v.SampleRate))
 	}
 
-	if v.Channels < ChannelMono || v.Channels > Channel7_1 {
+	// For escaped object, the channels maybe in the specific config, for example, the UsacConfig.
+	if v.Object.escaped() {
+		return
+	}
+
+	switch v.coreObject() {
+	case ObjectTypeMain, ObjectTypeLC, ObjectTypeSSR:
+	default:
+		return errors.Errorf("invalid core object %#x", uint8(v.coreObject()))
+	}
+
+	if v.SBR && !v.ExtensionSampleRate.valid(v.ExtensionSamplingFrequency) {
+		return errors.Errorf("invalid extension sample-rate %#x", uint8(v.ExtensionSampleRate))
+	}
+
+	if v.Channels == ChannelForbidden {
+		if v.PCE == nil {
+			return errors.New("no program config element")
+		}
+		if err = v.PCE.validate(); err != nil {
+			return errors.WithMessage(err, "pce")
+		}
+	} else if v.Channels < ChannelMono || v.Channels > Channel7_1 {
 		return errors.Errorf("invalid channels %#x", uint8(v.Channels))
 	}
 	return
 }
 
+// The sample rate in Hz, which is the SBR sample rate for HE-AAC.
+func (v *AudioSpecificConfig) SampleRateHz() int {
+	if v.SBR {
+		return v.ExtensionSampleRate.hz(v.ExtensionSamplingFrequency)
+	}
+	return v.SampleRate.hz(v.SamplingFrequency)
+}
+
+// The number of output channels, for PS the mono core outputs stereo.
+func (v *AudioSpecificConfig) NumChannels() int {
+	var n int
+	if v.Channels == ChannelForbidden {
+		if v.PCE != nil {
+			n = v.PCE.NumChannels()
+		}
+	} else if v.Channels == Channel7_1 {
+		n = 8
+	} else {
+		n = int(v.Channels)
+	}
+
+	if v.PS && n == 1 {
+		return 2
+	}
+	return n
+}
+
 func (v *AudioSpecificConfig) UnmarshalBinary(data []byte) (err error) {
 	// AudioSpecificConfig
 	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 33, @section 1.6.2.1 AudioSpecificConfig
 	//
-	// only need to decode the first 2bytes:
+	// The basic config is 2bytes:
 	// audioObjectType, 5bits.
 	// samplingFrequencyIndex, aac_sample_rate, 4bits.
 	// channelConfiguration, aac_channels, 4bits
+	// GASpecificConfig, 3bits.
 	//
 	// @see SrsAacTransmuxer::write_audio
 	if len(data) < 2 {
 		return errors.Errorf("requires 2 but only %v bytes", len(data))
 	}
 
-	t0, t1 := uint8(data[0]), uint8(data[1])
+	*v = AudioSpecificConfig{}
+	return v.decode(avc.NewBitParser(data), len(data)*8)
+}
+
+// Decode the AudioSpecificConfig from bits, which may not be byte aligned, for example, in LATM.
+// The size is the number of bits of ASC, or 0 if unknown, and the backward compatible signalling
+// of SBR and PS is only parsed when the size is known.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 33, @section 1.6.2.1 AudioSpecificConfig
+func (v *AudioSpecificConfig) decode(p *avc.BitParser, size int) (err error) {
+	start := p.Left()
+
+	// audioObjectType 5 uimsbf
+	// samplingFrequencyIndex 4 bslbf
+	// channelConfiguration 4 bslbf
+	v.Object = audioObjectType(p)
+	v.SampleRate, v.SamplingFrequency = samplingFrequency(p)
+	v.Channels = Channels(p.U(4))
+
+	// For the explicit hierarchical signalling, the core object type follows.
+	if v.Object == ObjectTypeHE || v.Object == ObjectTypeHEv2 {
+		v.SBR, v.PS = true, v.Object == ObjectTypeHEv2
+		// extensionSamplingFrequencyIndex 4 uimsbf
+		v.ExtensionSampleRate, v.ExtensionSamplingFrequency = samplingFrequency(p)
+		// audioObjectType 5 uimsbf
+		v.CoreObject = audioObjectType(p)
+	}
+	if p.Err() != nil {
+		return p.Err()
+	}
+
+	// For escaped object, the specific config is not parsed, for example, the ELDSpecificConfig
+	// and UsacConfig, so the size of ASC must be known to skip it.
+	if v.Object.escaped() {
+		if size == 0 {
+			return errors.Errorf("unknown size of object %v", uint8(v.Object))
+		}
+		return v.validate()
+	}
+
+	// GASpecificConfig()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 4.4.1 GA bitstream payloads
+	switch object := v.coreObject(); object {
+	case ObjectTypeMain, ObjectTypeLC, ObjectTypeSSR:
+		// frameLengthFlag 1 bslbf
+		v.FrameLengthFlag = p.Flag()
+		// dependsOnCoreCoder 1 bslbf
+		if v.DependsOnCoreCoder = p.Flag(); v.DependsOnCoreCoder {
+			// coreCoderDelay 14 uimsbf
+			v.CoreCoderDelay = uint16(p.U(14))
+		}
+		// extensionFlag 1 bslbf
+		v.ExtensionFlag = p.Flag()
+		if v.Channels == ChannelForbidden && p.Err() == nil {
+			// program_config_element()
+			v.PCE = &ProgramConfigElement{}
+			if err = v.PCE.decode(p, start); err != nil {
+				return errors.WithMessage(err, "pce")
+			}
+		}
+		if v.ExtensionFlag {
+			// extensionFlag3 1 bslbf
+			_ = p.Flag()
+		}
+	default:
+		return errors.Errorf("invalid object %#x", uint8(object))
+	}
+
+	// The backward compatible explicit signalling of SBR and PS.
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.6.5.2 Explicit signaling
+	left := func() int {
+		return size - (start - p.Left())
+	}
+	if size > 0 && !v.SBR && p.Err() == nil && left() >= 16 {
+		// syncExtensionType 11 bslbf
+		if syncExtensionType := p.U(11); syncExtensionType == ascSyncExtensionSBR {
+			// extensionAudioObjectType 5 uimsbf
+			// sbrPresentFlag 1 uimsbf
+			if extensionObject := audioObjectType(p); extensionObject == ObjectTypeHE && p.Flag() {
+				v.SBR = true
+				// extensionSamplingFrequencyIndex 4 uimsbf
+				v.ExtensionSampleRate, v.ExtensionSamplingFrequency = samplingFrequency(p)
 
-	v.Object = ObjectType((t0 >> 3) & 0x1f)
-	v.SampleRate = SampleRateIndex(((t0 << 1) & 0x0e) | ((t1 >> 7) & 0x01))
-	v.Channels = Channels((t1 >> 3) & 0x0f)
+				if p.Err() == nil && left() >= 12 {
+					// syncExtensionType 11 bslbf
+					// psPresentFlag 1 uimsbf
+					if syncExtensionType = p.U(11); syncExtensionType == ascSyncExtensionPS {
+						v.PS = p.Flag()
+					}
+				}
+			}
+		}
+	}
+
+	if p.Err() != nil {
+		return p.Err()
+	}
 
 	return v.validate()
 }
 
 func (v *AudioSpecificConfig) MarshalBinary() (data []byte, err error) {
-	if err = v.validate(); err != nil {
+	if err = v.validateEncode(); err != nil {
 		return
 	}
 
 	// AudioSpecificConfig
 	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 33, @section 1.6.2.1 AudioSpecificConfig
-	//
-	// only need to decode the first 2bytes:
-	// audioObjectType, 5bits.
-	// samplingFrequencyIndex, aac_sample_rate, 4bits.
-	// channelConfiguration, aac_channels, 4bits
-	return []byte{
-		byte(byte(v.Object)&0x1f)<<3 | byte(byte(v.SampleRate)&0x0e)>>1,
-		byte(byte(v.SampleRate)&0x01)<<7 | byte(byte(v.Channels)&0x0f)<<3,
-	}, nil
+	w := &bitWriter{}
+	v.encode(w, true)
+	return w.bytes(), nil
+}
+
+// Validate the ASC to encode, the escaped object type is not supported for no specific config.
+func (v *AudioSpecificConfig) validateEncode() (err error) {
+	if err = v.validate(); err != nil {
+		return
+	}
+	if v.Object.escaped() {
+		return errors.Errorf("unsupported object %v to encode", uint8(v.Object))
+	}
+	return
+}
+
+// Encode the AudioSpecificConfig to bits, which may not be byte aligned.
+// The backward compatible signalling of SBR and PS is only written when withSyncExtension,
+// because it requires the decoder to know the size of ASC.
+// @remark User must validate the ASC before encoding.
+func (v *AudioSpecificConfig) encode(w *bitWriter, withSyncExtension bool) {
+	start := w.pos
+
+	// audioObjectType 5 uimsbf
+	// samplingFrequencyIndex 4 bslbf
+	// channelConfiguration 4 bslbf
+	w.audioObjectType(v.Object)
+	w.samplingFrequency(v.SampleRate, v.SamplingFrequency)
+	w.write(uint32(v.Channels), 4)
+
+	// For the explicit hierarchical signalling, the core object type follows.
+	hierarchical := v.Object == ObjectTypeHE || v.Object == ObjectTypeHEv2
+	if hierarchical {
+		// extensionSamplingFrequencyIndex 4 uimsbf
+		w.samplingFrequency(v.ExtensionSampleRate, v.ExtensionSamplingFrequency)
+		// audioObjectType 5 uimsbf
+		w.audioObjectType(v.CoreObject)
+	}
+
+	// GASpecificConfig()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 4.4.1 GA bitstream payloads
+	w.flag(v.FrameLengthFlag)
+	w.flag(v.DependsOnCoreCoder)
+	if v.DependsOnCoreCoder {
+		w.write(uint32(v.CoreCoderDelay), 14)
+	}
+	w.flag(v.ExtensionFlag)
+	if v.Channels == ChannelForbidden {
+		v.PCE.encode(w, start)
+	}
+	if v.ExtensionFlag {
+		// extensionFlag3 1 bslbf
+		w.write(0, 1)
+	}
+
+	// The backward compatible explicit signalling of SBR and PS.
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.6.5.2 Explicit signaling
+	if withSyncExtension && v.SBR && !hierarchical {
+		w.write(ascSyncExtensionSBR, 11)
+		w.audioObjectType(ObjectTypeHE)
+		w.flag(true)
+		w.samplingFrequency(v.ExtensionSampleRate, v.ExtensionSamplingFrequency)
+		if v.PS {
+			w.write(ascSyncExtensionPS, 11)
+			w.flag(true)
+		}
+	}
+}
+
+// The syntactic element of channels in PCE, the SCE(single_channel_element) or CPE(channel_pair_element).
+type ChannelElement struct {
+	IsCPE     bool  // Whether it's CPE with 2 channels, otherwise SCE with 1 channel.
+	TagSelect uint8 // The instance tag of element.
+}
+
+// The coupling channel element in PCE.
+type CCElement struct {
+	IsIndSW   bool  // Whether it's independently switched CCE.
+	TagSelect uint8 // The instance tag of CCE.
+}
+
+// The program_config_element, which defines the channel layout when channelConfiguration is 0.
+// Refer to @doc ISO_IEC_13818-7-AAC-2004.pdf, @section 8.5.1 Program Config Element
+type ProgramConfigElement struct {
+	ElementInstanceTag uint8
+	Profile            Profile
+	SampleRate         SampleRateIndex
+
+	FrontElements []ChannelElement
+	SideElements  []ChannelElement
+	BackElements  []ChannelElement
+	// The tags of LFE(lfe_channel_element).
+	LFEElements []uint8
+	// The tags of DSE(data_stream_element).
+	AssocDataElements []uint8
+	CCElements        []CCElement
+
+	MonoMixdownPresent         bool
+	MonoMixdownElementNumber   uint8
+	StereoMixdownPresent       bool
+	StereoMixdownElementNumber uint8
+	MatrixMixdownIdxPresent    bool
+	MatrixMixdownIdx           uint8
+	PseudoSurroundEnable       bool
+
+	Comment []byte
+}
+
+// The number of channels, the CPE is 2 and others are 1.
+func (v *ProgramConfigElement) NumChannels() int {
+	n := len(v.LFEElements)
+	for _, elems := range [][]ChannelElement{v.FrontElements, v.SideElements, v.BackElements} {
+		for _, e := range elems {
+			if e.IsCPE {
+				n += 2
+			} else {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (v *ProgramConfigElement) validate() (err error) {
+	for _, elems := range [][]ChannelElement{v.FrontElements, v.SideElements, v.BackElements} {
+		if len(elems) > 0x0f {
+			return errors.Errorf("too many channel elements %v", len(elems))
+		}
+	}
+	if len(v.LFEElements) > 0x03 {
+		return errors.Errorf("too many lfe elements %v", len(v.LFEElements))
+	}
+	if len(v.AssocDataElements) > 0x07 {
+		return errors.Errorf("too many assoc data elements %v", len(v.AssocDataElements))
+	}
+	if len(v.CCElements) > 0x0f {
+		return errors.Errorf("too many cc elements %v", len(v.CCElements))
+	}
+	if len(v.Comment) > 0xff {
+		return errors.Errorf("too long comment %v", len(v.Comment))
+	}
+	return
+}
+
+// Decode the PCE, the start is the position of ASC, for the byte_alignment is relative to it.
+func (v *ProgramConfigElement) decode(p *avc.BitParser, start int) (err error) {
+	// element_instance_tag 4 uimsbf
+	// object_type 2 uimsbf
+	// sampling_frequency_index 4 uimsbf
+	v.ElementInstanceTag = uint8(p.U(4))
+	v.Profile = Profile(p.U(2))
+	v.SampleRate = SampleRateIndex(p.U(4))
+
+	// num_front_channel_elements 4 uimsbf
+	// num_side_channel_elements 4 uimsbf
+	// num_back_channel_elements 4 uimsbf
+	// num_lfe_channel_elements 2 uimsbf
+	// num_assoc_data_elements 3 uimsbf
+	// num_valid_cc_elements 4 uimsbf
+	v.FrontElements = make([]ChannelElement, p.U(4))
+	v.SideElements = make([]ChannelElement, p.U(4))
+	v.BackElements = make([]ChannelElement, p.U(4))
+	v.LFEElements = make([]uint8, p.U(2))
+	v.AssocDataElements = make([]uint8, p.U(3))
+	v.CCElements = make([]CCElement, p.U(4))
+
+	// mono_mixdown_present 1 uimsbf
+	if v.MonoMixdownPresent = p.Flag(); v.MonoMixdownPresent {
+		// mono_mixdown_element_number 4 uimsbf
+		v.MonoMixdownElementNumber = uint8(p.U(4))
+	}
+	// stereo_mixdown_present 1 uimsbf
+	if v.StereoMixdownPresent = p.Flag(); v.StereoMixdownPresent {
+		// stereo_mixdown_element_number 4 uimsbf
+		v.StereoMixdownElementNumber = uint8(p.U(4))
+	}
+	// matrix_mixdown_idx_present 1 uimsbf
+	if v.MatrixMixdownIdxPresent = p.Flag(); v.MatrixMixdownIdxPresent {
+		// matrix_mixdown_idx 2 uimsbf
+		// pseudo_surround_enable 1 uimsbf
+		v.MatrixMixdownIdx = uint8(p.U(2))
+		v.PseudoSurroundEnable = p.Flag()
+	}
+
+	// front_element_is_cpe 1 bslbf
+	// front_element_tag_select 4 uimsbf
+	for _, elems := range [][]ChannelElement{v.FrontElements, v.SideElements, v.BackElements} {
+		for i := range elems {
+			elems[i].IsCPE = p.Flag()
+			elems[i].TagSelect = uint8(p.U(4))
+		}
+	}
+	// lfe_element_tag_select 4 uimsbf
+	for i := range v.LFEElements {
+		v.LFEElements[i] = uint8(p.U(4))
+	}
+	// assoc_data_element_tag_select 4 uimsbf
+	for i := range v.AssocDataElements {
+		v.AssocDataElements[i] = uint8(p.U(4))
+	}
+	// cc_element_is_ind_sw 1 uimsbf
+	// valid_cc_element_tag_select 4 uimsbf
+	for i := range v.CCElements {
+		v.CCElements[i].IsIndSW = p.Flag()
+		v.CCElements[i].TagSelect = uint8(p.U(4))
+	}
+
+	// byte_alignment(), relative to the start of ASC.
+	if p.Err() == nil {
+		p.Skip((8 - (start-p.Left())%8) % 8)
+	}
+
+	// comment_field_bytes 8 uimsbf
+	// comment_field_data 8 uimsbf
+	v.Comment = make([]byte, p.U(8))
+	for i := range v.Comment {
+		v.Comment[i] = byte(p.U(8))
+	}
+
+	return p.Err()
+}
+
+// Encode the PCE, the start is the position of ASC, for the byte_alignment is relative to it.
+func (v *ProgramConfigElement) encode(w *bitWriter, start int) {
+	w.write(uint32(v.ElementInstanceTag), 4)
+	w.write(uint32(v.Profile), 2)
+	w.write(uint32(v.SampleRate), 4)
+
+	w.write(uint32(len(v.FrontElements)), 4)
+	w.write(uint32(len(v.SideElements)), 4)
+	w.write(uint32(len(v.BackElements)), 4)
+	w.write(uint32(len(v.LFEElements)), 2)
+	w.write(uint32(len(v.AssocDataElements)), 3)
+	w.write(uint32(len(v.CCElements)), 4)
+
+	if w.flag(v.MonoMixdownPresent); v.MonoMixdownPresent {
+		w.write(uint32(v.MonoMixdownElementNumber), 4)
+	}
+	if w.flag(v.StereoMixdownPresent); v.StereoMixdownPresent {
+		w.write(uint32(v.StereoMixdownElementNumber), 4)
+	}
+	if w.flag(v.MatrixMixdownIdxPresent); v.MatrixMixdownIdxPresent {
+		w.write(uint32(v.MatrixMixdownIdx), 2)
+		w.flag(v.PseudoSurroundEnable)
+	}
+
+	for _, elems := range [][]ChannelElement{v.FrontElements, v.SideElements, v.BackElements} {
+		for _, e := range elems {
+			w.flag(e.IsCPE)
+			w.write(uint32(e.TagSelect), 4)
+		}
+	}
+	for _, tag := range v.LFEElements {
+		w.write(uint32(tag), 4)
+	}
+	for _, tag := range v.AssocDataElements {
+		w.write(uint32(tag), 4)
+	}
+	for _, e := range v.CCElements {
+		w.flag(e.IsIndSW)
+		w.write(uint32(e.TagSelect), 4)
+	}
+
+	// byte_alignment(), relative to the start of ASC.
+	w.write(0, (8-(w.pos-start)%8)%8)
+
+	w.write(uint32(len(v.Comment)), 8)
+	for _, b := range v.Comment {
+		w.write(uint32(b), 8)
+	}
+}
+
+// Read the audioObjectType, with the escape for object type 32+.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.6.2.1 GetAudioObjectType()
+func audioObjectType(p *avc.BitParser) ObjectType {
+	// audioObjectType 5 uimsbf
+	object := ObjectType(p.U(5))
+	if object == ObjectTypeEscape {
+		// audioObjectTypeExt 6 uimsbf
+		object = ObjectTypeEscape + 1 + ObjectType(p.U(6))
+	}
+	return object
+}
+
+// Read the samplingFrequencyIndex, with the explicit frequency for the escape index.
+func samplingFrequency(p *avc.BitParser) (index SampleRateIndex, frequency uint32) {
+	// samplingFrequencyIndex 4 bslbf
+	if index = SampleRateIndex(p.U(4)); index == SampleRateIndexEscape {
+		// samplingFrequency 24 uimsbf
+		frequency = p.U(24)
+	}
+	return
+}
+
+// The LatmGetValue() of LATM.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.35 Syntax of LatmGetValue()
+func latmGetValue(p *avc.BitParser) (r uint32) {
+	// bytesForValue 2 uimsbf
+	bytesForValue := int(p.U(2))
+	for i := 0; i <= bytesForValue; i++ {
+		// valueTmp 8 uimsbf
+		r = r<<8 | p.U(8)
+	}
+	return
+}
+
+// The bit writer in MSB first, the last byte is padding with zero bits.
+type bitWriter struct {
+	data []byte
+	// The position in bits.
+	pos int
+}
+
+// Write the n bits of value, n is 0 to 32.
+func (v *bitWriter) write(value uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if v.pos%8 == 0 {
+			v.data = append(v.data, 0)
+		}
+		if (value>>uint(i))&0x01 == 1 {
+			v.data[v.pos/8] |= 0x80 >> uint(v.pos%8)
+		}
+		v.pos++
+	}
+}
+
+func (v *bitWriter) flag(b bool) {
+	if b {
+		v.write(1, 1)
+	} else {
+		v.write(0, 1)
+	}
+}
+
+// Write the audioObjectType, with the escape for object type 32+.
+func (v *bitWriter) audioObjectType(object ObjectType) {
+	if object < ObjectTypeEscape {
+		v.write(uint32(object), 5)
+	} else {
+		v.write(uint32(ObjectTypeEscape), 5)
+		v.write(uint32(object-ObjectTypeEscape-1), 6)
+	}
+}
+
+// Write the samplingFrequencyIndex, with the explicit frequency for the escape index.
+func (v *bitWriter) samplingFrequency(index SampleRateIndex, frequency uint32) {
+	v.write(uint32(index), 4)
+	if index == SampleRateIndexEscape {
+		v.write(frequency, 24)
+	}
+}
+
+func (v *bitWriter) bytes() []byte {
+	return v.data
 }
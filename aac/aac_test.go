@@ -65,6 +65,176 @@ func TestAudioSpecificConfig_UnmarshalBinary(t *testing.T) {
 	}
 }
 
+func TestAudioSpecificConfig_HE(t *testing.T) {
+	// The explicit hierarchical signalling, HEv2 24kHz mono, SBR 48kHz with LC core.
+	b := []byte{0xeb, 0x09, 0x88, 0x00}
+
+	asc := &AudioSpecificConfig{}
+	if err := asc.UnmarshalBinary(b); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if asc.Object != ObjectTypeHEv2 || asc.CoreObject != ObjectTypeLC {
+		t.Error(asc.Object, asc.CoreObject)
+	}
+	if !asc.SBR || !asc.PS {
+		t.Error(asc.SBR, asc.PS)
+	}
+	if asc.SampleRate != SampleRateIndex24kHz || asc.ExtensionSampleRate != SampleRateIndex48kHz {
+		t.Error(asc.SampleRate, asc.ExtensionSampleRate)
+	}
+	if v := asc.SampleRateHz(); v != 48000 {
+		t.Error(v)
+	}
+	if v := asc.NumChannels(); v != 2 {
+		t.Error(v)
+	}
+
+	if data, err := asc.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, b) != 0 {
+		t.Errorf("%#x", data)
+	}
+}
+
+func TestAudioSpecificConfig_HE2(t *testing.T) {
+	// The backward compatible signalling, LC 22kHz stereo, SBR 44kHz with PS.
+	b := []byte{0x13, 0x90, 0x56, 0xe5, 0xa5, 0x48, 0x80}
+
+	asc := &AudioSpecificConfig{}
+	if err := asc.UnmarshalBinary(b); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if asc.Object != ObjectTypeLC {
+		t.Error(asc.Object)
+	}
+	if !asc.SBR || !asc.PS {
+		t.Error(asc.SBR, asc.PS)
+	}
+	if v := asc.SampleRateHz(); v != 44100 {
+		t.Error(v)
+	}
+
+	if data, err := asc.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, b) != 0 {
+		t.Errorf("%#x", data)
+	}
+
+	// Without the sync extension, it's the basic config.
+	if err := asc.UnmarshalBinary(b[:2]); err != nil {
+		t.Errorf("%+v", err)
+	} else if asc.SBR || asc.PS {
+		t.Error(asc.SBR, asc.PS)
+	} else if v := asc.SampleRateHz(); v != 22050 {
+		t.Error(v)
+	}
+}
+
+func TestAudioSpecificConfig_Escape(t *testing.T) {
+	// The explicit sampling frequency 44100Hz.
+	b := []byte{0x17, 0x80, 0x56, 0x22, 0x10}
+
+	asc := &AudioSpecificConfig{}
+	if err := asc.UnmarshalBinary(b); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if asc.SampleRate != SampleRateIndexEscape || asc.SamplingFrequency != 44100 {
+		t.Error(asc.SampleRate, asc.SamplingFrequency)
+	}
+	if v := asc.SampleRateHz(); v != 44100 {
+		t.Error(v)
+	}
+
+	if data, err := asc.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, b) != 0 {
+		t.Errorf("%#x", data)
+	}
+
+	// The ADTS can not carry the explicit sampling frequency.
+	adts, _ := NewADTS()
+	if err := adts.SetASC(b); err != nil {
+		t.Errorf("%+v", err)
+	} else if _, err = adts.Encode(nil); err == nil {
+		t.Error("should fail")
+	}
+
+	// The USAC 48kHz stereo, object type 42 by the escape value, the UsacConfig is not parsed.
+	if err := asc.UnmarshalBinary([]byte{0xf9, 0x46, 0x40}); err != nil {
+		t.Errorf("%+v", err)
+	} else if asc.Object != ObjectTypeUSAC || asc.Object.String() != "USAC" {
+		t.Error(asc.Object)
+	} else if asc.SampleRateHz() != 48000 || asc.NumChannels() != 2 {
+		t.Error(asc.SampleRateHz(), asc.NumChannels())
+	}
+
+	// The ELD 48kHz stereo, object type 39, the ELDSpecificConfig is not parsed.
+	if err := asc.UnmarshalBinary([]byte{0xf8, 0xe6, 0x40, 0x00}); err != nil {
+		t.Errorf("%+v", err)
+	} else if asc.Object != ObjectTypeELD || asc.SampleRateHz() != 48000 || asc.Channels != ChannelStereo {
+		t.Error(asc.Object, asc.SampleRateHz(), asc.Channels)
+	}
+
+	// The escaped object can not be encoded, without the specific config.
+	if _, err := asc.MarshalBinary(); err == nil {
+		t.Error("should fail")
+	}
+	if err := adts.SetASC([]byte{0xf8, 0xe6, 0x40, 0x00}); err != nil {
+		t.Errorf("%+v", err)
+	} else if _, err = adts.Encode(nil); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestAudioSpecificConfig_PCE(t *testing.T) {
+	// The LC 48kHz, with PCE of FC, FL+FR, BL+BR and LFE, and comment "ab".
+	b := []byte{0x11, 0x80, 0x04, 0xc8, 0x05, 0x00, 0x01, 0x19, 0x18, 0x02, 0x61, 0x62}
+
+	asc := &AudioSpecificConfig{}
+	if err := asc.UnmarshalBinary(b); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if asc.Channels != ChannelForbidden || asc.PCE == nil {
+		t.Fatal(asc.Channels, asc.PCE)
+	}
+
+	pce := asc.PCE
+	if pce.Profile != ProfileLC || pce.SampleRate != SampleRateIndex48kHz {
+		t.Error(pce.Profile, pce.SampleRate)
+	}
+	if len(pce.FrontElements) != 2 || pce.FrontElements[0].IsCPE || !pce.FrontElements[1].IsCPE {
+		t.Error(pce.FrontElements)
+	}
+	if len(pce.BackElements) != 1 || pce.BackElements[0].TagSelect != 2 {
+		t.Error(pce.BackElements)
+	}
+	if len(pce.LFEElements) != 1 || pce.LFEElements[0] != 3 {
+		t.Error(pce.LFEElements)
+	}
+	if string(pce.Comment) != "ab" {
+		t.Error(pce.Comment)
+	}
+	if v := asc.NumChannels(); v != 6 {
+		t.Error(v)
+	}
+
+	if data, err := asc.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, b) != 0 {
+		t.Errorf("%#x", data)
+	}
+
+	// The PCE is required when channels is 0.
+	asc.PCE = nil
+	if _, err := asc.MarshalBinary(); err == nil {
+		t.Error("should fail")
+	}
+}
+
 func TestAdts_Encode(t *testing.T) {
 	adts, err := NewADTS()
 	if err != nil {
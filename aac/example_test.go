@@ -68,3 +68,28 @@ func ExampleADTSImpl_Encode() {
 	// Use the ADTS data.
 	_ = data
 }
+
+func ExampleLOASImpl_Decode() {
+	var err error
+	var loas aac.LOAS
+	if loas, err = aac.NewLOAS(); err != nil {
+		fmt.Println(fmt.Sprintf("APP: Create LOAS failed, err is %+v", err))
+		return
+	}
+
+	var data []byte // Read LOAS data from MPEG-TS PES or network.
+
+	for len(data) > 0 {
+		var raw []byte
+		if raw, data, err = loas.Decode(data); err != nil {
+			fmt.Println(fmt.Sprintf("APP: LOAS decode failed, err is %+v", err))
+			return
+		}
+
+		// Use the RAW data, for example, mux to FLV by flv.AudioPackager.
+		_ = raw
+	}
+
+	// Use the asc object, for example, used as RTMP audio sequence header.
+	_ = loas.ASC()
+}
@@ -0,0 +1,326 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package aac
+
+import (
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The LOAS(Low Overhead Audio Stream) is a format of AAC, which carries the
+// LATM(Low-overhead MPEG-4 Audio Transport Multiplex) AudioMuxElement, used by DVB and MPEG-TS.
+// We can encode the RAW AAC frame in LOAS muxer.
+// We can also decode the LOAS data to RAW AAC frame.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Low Overhead Audio Stream
+type LOAS interface {
+	// Set the ASC, the codec information.
+	// Before encoding raw frame, user must set the asc.
+	SetASC(asc []byte) (err error)
+	// Encode the raw aac frame to loas data, which always carries the StreamMuxConfig.
+	// @remark User must set the asc first.
+	Encode(raw []byte) (loas []byte, err error)
+
+	// Decode the loas data to raw frame.
+	// @remark User can get the asc after decode ok.
+	// @remark When left if not nil, user must decode it again.
+	Decode(loas []byte) (raw, left []byte, err error)
+	// Get the ASC, the codec information.
+	// When decode a loas data or set the asc, user can use this API to get it.
+	ASC() *AudioSpecificConfig
+}
+
+// The syncword of AudioSyncStream, 11bits.
+const loasSyncWord = 0x2b7
+
+// The StreamMuxConfig of LATM, only one program with one layer is supported.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.3 Semantics, StreamMuxConfig()
+type streamMuxConfig struct {
+	audioMuxVersion uint8
+	// The frameLengthType, only 0(variable frame length) is supported.
+	frameLengthType uint8
+	// The otherDataLenBits, skipped after the payload.
+	otherDataLenBits uint32
+	// Whether the crcCheckSum present.
+	crcCheckPresent bool
+}
+
+type LOASImpl struct {
+	asc AudioSpecificConfig
+	// The last StreamMuxConfig, used when useSameStreamMux is set.
+	config *streamMuxConfig
+}
+
+func NewLOAS() (LOAS, error) {
+	return &LOASImpl{}, nil
+}
+
+func (v *LOASImpl) SetASC(asc []byte) (err error) {
+	return v.asc.UnmarshalBinary(asc)
+}
+
+func (v *LOASImpl) Encode(raw []byte) (data []byte, err error) {
+	if err = v.asc.validateEncode(); err != nil {
+		return nil, errors.WithMessage(err, "loas encode")
+	}
+
+	w := &bitWriter{}
+
+	// AudioMuxElement(muxConfigPresent=1)
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.33 Syntax of AudioMuxElement()
+	// useSameStreamMux 1 bslbf
+	w.write(0, 1)
+
+	// StreamMuxConfig()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.34 Syntax of StreamMuxConfig()
+	// audioMuxVersion 1 bslbf
+	w.write(0, 1)
+	// allStreamsSameTimeFraming 1 uimsbf
+	w.write(1, 1)
+	// numSubFrames 6 uimsbf
+	w.write(0, 6)
+	// numProgram 4 uimsbf
+	w.write(0, 4)
+	// numLayer 3 uimsbf
+	w.write(0, 3)
+	// AudioSpecificConfig(), without the backward compatible SBR signalling, for the size is unknown.
+	v.asc.encode(w, false)
+	// frameLengthType 3 uimsbf
+	w.write(0, 3)
+	// latmBufferFullness 8 uimsbf, 0xff for variable bitrate.
+	w.write(0xff, 8)
+	// otherDataPresent 1 uimsbf
+	w.write(0, 1)
+	// crcCheckPresent 1 uimsbf
+	w.write(0, 1)
+
+	// PayloadLengthInfo()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.36 Syntax of PayloadLengthInfo()
+	for i := len(raw); ; i -= 255 {
+		if i < 255 {
+			w.write(uint32(i), 8)
+			break
+		}
+		w.write(0xff, 8)
+	}
+
+	// PayloadMux()
+	for _, b := range raw {
+		w.write(uint32(b), 8)
+	}
+
+	// byte_alignment()
+	ame := w.bytes()
+
+	// AudioSyncStream()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.28 Syntax of AudioSyncStream()
+	// syncword 11 bslbf
+	// audioMuxLengthBytes 13 uimsbf
+	if len(ame) > 0x1fff {
+		return nil, errors.Errorf("loas frame %v exceed 8191 bytes", len(ame))
+	}
+
+	data = make([]byte, 3, 3+len(ame))
+	data[0] = byte(loasSyncWord >> 3)
+	data[1] = byte(loasSyncWord&0x07)<<5 | byte(len(ame)>>8)&0x1f
+	data[2] = byte(len(ame))
+	data = append(data, ame...)
+
+	return
+}
+
+func (v *LOASImpl) Decode(data []byte) (raw, left []byte, err error) {
+	// AudioSyncStream()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.28 Syntax of AudioSyncStream()
+	if len(data) <= 3 {
+		return nil, nil, errors.Errorf("requires 3+ but only %v bytes", len(data))
+	}
+
+	// syncword 11 bslbf
+	if syncword := uint16(data[0])<<3 | uint16(data[1])>>5; syncword != loasSyncWord {
+		return nil, nil, errors.Errorf("invalid syncword %#x", syncword)
+	}
+
+	// audioMuxLengthBytes 13 uimsbf
+	audioMuxLengthBytes := int(data[1]&0x1f)<<8 | int(data[2])
+	p := data[3:]
+	if len(p) < audioMuxLengthBytes {
+		return nil, nil, errors.Errorf("requires %v but only %v bytes", audioMuxLengthBytes, len(p))
+	}
+	left = p[audioMuxLengthBytes:]
+
+	if raw, err = v.decodeAudioMuxElement(p[:audioMuxLengthBytes]); err != nil {
+		return nil, nil, errors.WithMessage(err, "loas decode")
+	}
+
+	return
+}
+
+func (v *LOASImpl) ASC() *AudioSpecificConfig {
+	return &v.asc
+}
+
+// Decode the AudioMuxElement(muxConfigPresent=1).
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.33 Syntax of AudioMuxElement()
+func (v *LOASImpl) decodeAudioMuxElement(data []byte) (raw []byte, err error) {
+	p := avc.NewBitParser(data)
+
+	// useSameStreamMux 1 bslbf
+	if useSameStreamMux := p.Flag(); p.Err() != nil {
+		return nil, p.Err()
+	} else if !useSameStreamMux {
+		if v.config, err = v.decodeStreamMuxConfig(p); err != nil {
+			return nil, errors.WithMessage(err, "stream mux config")
+		}
+	} else if v.config == nil {
+		return nil, errors.New("no stream mux config")
+	}
+
+	// PayloadLengthInfo()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.36 Syntax of PayloadLengthInfo()
+	// MuxSlotLengthBytes, the sum of tmp until it's not 255.
+	var nbRaw int
+	for p.Err() == nil {
+		tmp := p.U(8)
+		nbRaw += int(tmp)
+		if tmp != 0xff {
+			break
+		}
+	}
+
+	// PayloadMux()
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.37 Syntax of PayloadMux()
+	if p.Err() == nil && p.Left() < nbRaw*8 {
+		return nil, errors.Errorf("requires %v but only %v bytes", nbRaw, p.Left()/8)
+	}
+
+	raw = make([]byte, nbRaw)
+	for i := range raw {
+		raw[i] = byte(p.U(8))
+	}
+
+	// otherDataBits
+	if p.Err() == nil && v.config.otherDataLenBits > 0 {
+		p.Skip(int(v.config.otherDataLenBits))
+	}
+
+	if p.Err() != nil {
+		return nil, p.Err()
+	}
+	return
+}
+
+// Decode the StreamMuxConfig, only one program with one layer and frameLengthType 0 is supported.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @section 1.7.2 Table 1.34 Syntax of StreamMuxConfig()
+func (v *LOASImpl) decodeStreamMuxConfig(p *avc.BitParser) (c *streamMuxConfig, err error) {
+	c = &streamMuxConfig{}
+
+	// audioMuxVersion 1 bslbf
+	c.audioMuxVersion = uint8(p.U(1))
+	// audioMuxVersionA 1 bslbf
+	if c.audioMuxVersion == 1 {
+		if audioMuxVersionA := p.U(1); p.Err() == nil && audioMuxVersionA != 0 {
+			return nil, errors.Errorf("unsupported audioMuxVersionA %v", audioMuxVersionA)
+		}
+		// taraBufferFullness LatmGetValue()
+		_ = latmGetValue(p)
+	}
+
+	// allStreamsSameTimeFraming 1 uimsbf
+	_ = p.Flag()
+	// numSubFrames 6 uimsbf
+	if numSubFrames := p.U(6); p.Err() == nil && numSubFrames != 0 {
+		return nil, errors.Errorf("unsupported numSubFrames %v", numSubFrames)
+	}
+	// numProgram 4 uimsbf
+	if numProgram := p.U(4); p.Err() == nil && numProgram != 0 {
+		return nil, errors.Errorf("unsupported numProgram %v", numProgram)
+	}
+	// numLayer 3 uimsbf
+	if numLayer := p.U(3); p.Err() == nil && numLayer != 0 {
+		return nil, errors.Errorf("unsupported numLayer %v", numLayer)
+	}
+	if p.Err() != nil {
+		return nil, p.Err()
+	}
+
+	// AudioSpecificConfig(), for the first layer, the useSameConfig is always 0.
+	v.asc = AudioSpecificConfig{}
+	if c.audioMuxVersion == 0 {
+		if err = v.asc.decode(p, 0); err != nil {
+			return nil, errors.WithMessage(err, "asc")
+		}
+	} else {
+		// ascLen LatmGetValue()
+		ascLen := int(latmGetValue(p))
+		if p.Err() != nil {
+			return nil, p.Err()
+		}
+
+		before := p.Left()
+		if err = v.asc.decode(p, ascLen); err != nil {
+			return nil, errors.WithMessage(err, "asc")
+		}
+
+		// fillBits bslbf(ascLen-ascBits)
+		if fillBits := ascLen - (before - p.Left()); fillBits < 0 {
+			return nil, errors.Errorf("invalid ascLen %v", ascLen)
+		} else {
+			p.Skip(fillBits)
+		}
+	}
+
+	// frameLengthType 3 uimsbf
+	if c.frameLengthType = uint8(p.U(3)); p.Err() == nil && c.frameLengthType != 0 {
+		return nil, errors.Errorf("unsupported frameLengthType %v", c.frameLengthType)
+	}
+	// latmBufferFullness 8 uimsbf
+	_ = p.U(8)
+
+	// otherDataPresent 1 uimsbf
+	if otherDataPresent := p.Flag(); otherDataPresent {
+		if c.audioMuxVersion == 1 {
+			// otherDataLenBits LatmGetValue()
+			c.otherDataLenBits = latmGetValue(p)
+		} else {
+			for p.Err() == nil {
+				// otherDataLenEsc 1 uimsbf
+				esc := p.Flag()
+				// otherDataLenTmp 8 uimsbf
+				c.otherDataLenBits = c.otherDataLenBits<<8 + p.U(8)
+				if !esc {
+					break
+				}
+			}
+		}
+	}
+
+	// crcCheckPresent 1 uimsbf
+	if c.crcCheckPresent = p.Flag(); c.crcCheckPresent {
+		// crcCheckSum 8 uimsbf
+		_ = p.U(8)
+	}
+
+	if p.Err() != nil {
+		return nil, p.Err()
+	}
+	return
+}
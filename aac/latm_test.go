@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package aac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLoas_Encode(t *testing.T) {
+	loas, err := NewLOAS()
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if _, err = loas.Encode([]byte{0x00}); err == nil {
+		t.Error("should fail without asc")
+	}
+
+	if err = loas.SetASC([]byte{0x12, 0x10}); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	// The AudioMuxElement is 45bits of StreamMuxConfig and 8bits of length, then the payload.
+	if data, err := loas.Encode([]byte{0x01, 0x02}); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, []byte{
+		0x56, 0xe0, 0x09, 0x20, 0x00, 0x12, 0x10, 0x1f, 0xe0, 0x10, 0x08, 0x10,
+	}) != 0 {
+		t.Errorf("%#x", data)
+	}
+
+	raw := make([]byte, 600)
+	if data, err := loas.Encode(raw); err != nil {
+		t.Errorf("%+v", err)
+	} else if len(data) != 3+6+3+600 {
+		t.Errorf("size %v", len(data))
+	}
+
+	if _, err = loas.Encode(make([]byte, 8192)); err == nil {
+		t.Error("should fail for large frame")
+	}
+}
+
+func TestLoas_Decode(t *testing.T) {
+	loas, err := NewLOAS()
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if raw, left, err := loas.Decode([]byte{
+		0x56, 0xe0, 0x09, 0x20, 0x00, 0x12, 0x10, 0x1f, 0xe0, 0x10, 0x08, 0x10, 0x56,
+	}); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(raw, []byte{0x01, 0x02}) != 0 {
+		t.Errorf("%#x", raw)
+	} else if bytes.Compare(left, []byte{0x56}) != 0 {
+		t.Errorf("%#x", left)
+	}
+
+	asc := loas.ASC()
+	if asc.Object != ObjectTypeLC {
+		t.Error(asc.Object)
+	}
+	if asc.SampleRate != SampleRateIndex44kHz {
+		t.Error(asc.SampleRate)
+	}
+	if asc.Channels != ChannelStereo {
+		t.Error(asc.Channels)
+	}
+
+	// The useSameStreamMux is 1, reuse the previous StreamMuxConfig.
+	if raw, _, err := loas.Decode([]byte{0x56, 0xe0, 0x03, 0x80, 0x80, 0x80}); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(raw, []byte{0x01}) != 0 {
+		t.Errorf("%#x", raw)
+	}
+}
+
+func TestLoas_Decode2(t *testing.T) {
+	loas, err := NewLOAS()
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	// Invalid syncword.
+	if _, _, err = loas.Decode([]byte{0xff, 0xf1, 0x50, 0x80}); err == nil {
+		t.Error("should fail")
+	}
+
+	// Not enough data.
+	if _, _, err = loas.Decode([]byte{0x56, 0xe0, 0x09, 0x20}); err == nil {
+		t.Error("should fail")
+	}
+
+	// The useSameStreamMux is 1, but no StreamMuxConfig.
+	if _, _, err = loas.Decode([]byte{0x56, 0xe0, 0x03, 0x80, 0x80, 0x80}); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestLoas_Decode3(t *testing.T) {
+	loas, err := NewLOAS()
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	// The audioMuxVersion 1, with ascLen, fillBits, otherData and crc.
+	newFrame := func(ascLen uint32) []byte {
+		w := &bitWriter{}
+		w.write(0, 1)      // useSameStreamMux
+		w.write(1, 1)      // audioMuxVersion
+		w.write(0, 1)      // audioMuxVersionA
+		w.write(0, 2)      // taraBufferFullness, bytesForValue
+		w.write(0xff, 8)   // taraBufferFullness, valueTmp
+		w.write(1, 1)      // allStreamsSameTimeFraming
+		w.write(0, 6)      // numSubFrames
+		w.write(0, 4)      // numProgram
+		w.write(0, 3)      // numLayer
+		w.write(0, 2)      // ascLen, bytesForValue
+		w.write(ascLen, 8) // ascLen, valueTmp
+		w.write(5, 5)      // audioObjectType, HE
+		w.write(6, 4)      // samplingFrequencyIndex, 24kHz
+		w.write(1, 4)      // channelConfiguration
+		w.write(3, 4)      // extensionSamplingFrequencyIndex, 48kHz
+		w.write(2, 5)      // audioObjectType, LC
+		w.write(0, 3)      // GASpecificConfig
+		w.write(0, 7)      // fillBits
+		w.write(0, 3)      // frameLengthType
+		w.write(0xff, 8)   // latmBufferFullness
+		w.write(1, 1)      // otherDataPresent
+		w.write(0, 2)      // otherDataLenBits, bytesForValue
+		w.write(4, 8)      // otherDataLenBits, valueTmp
+		w.write(1, 1)      // crcCheckPresent
+		w.write(0, 8)      // crcCheckSum
+		w.write(1, 8)      // PayloadLengthInfo
+		w.write(0xaa, 8)   // PayloadMux
+		w.write(0xf, 4)    // otherDataBits
+		return append([]byte{0x56, 0xe0, byte(len(w.bytes()))}, w.bytes()...)
+	}
+
+	if raw, left, err := loas.Decode(newFrame(32)); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(raw, []byte{0xaa}) != 0 {
+		t.Errorf("%#x", raw)
+	} else if len(left) != 0 {
+		t.Errorf("%#x", left)
+	}
+
+	asc := loas.ASC()
+	if asc.Object != ObjectTypeHE {
+		t.Error(asc.Object)
+	}
+	if asc.SampleRate != SampleRateIndex24kHz {
+		t.Error(asc.SampleRate)
+	}
+	if v := asc.SampleRateHz(); v != 48000 {
+		t.Error(v)
+	}
+	if asc.Channels != ChannelMono {
+		t.Error(asc.Channels)
+	}
+
+	if _, _, err = loas.Decode(newFrame(20)); err == nil {
+		t.Error("should fail for ascLen less than asc")
+	}
+}
@@ -27,9 +27,12 @@ import (
 	"encoding"
 	"encoding/binary"
 	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf3"
 	oe "github.com/ossrs/go-oryx-lib/errors"
 	"math"
+	"strconv"
 	"sync"
+	"time"
 )
 
 // Please read @doc amf0_spec_121207.pdf, @page 4, @section 2.1 Types Overview
@@ -144,16 +147,27 @@ func Discovery(p []byte) (a Amf0, err error) {
 		return NewNull(), nil
 	case markerUndefined:
 		return NewUndefined(), nil
-	case markerReference:
 	case markerEcmaArray:
 		return NewEcmaArray(), nil
 	case markerObjectEnd:
 		return &objectEOF{}, nil
 	case markerStrictArray:
 		return NewStrictArray(), nil
-	case markerDate, markerLongString, markerUnsupported, markerXmlDocument,
-		markerTypedObject, markerAvmPlusObject, markerForbidden, markerMovieClip,
-		markerRecordSet:
+	case markerAvmPlusObject:
+		return NewAvmPlusObject(nil), nil
+	case markerReference:
+		return NewReference(0), nil
+	case markerDate:
+		return NewDate(time.Unix(0, 0)), nil
+	case markerLongString:
+		return NewLongString(""), nil
+	case markerUnsupported:
+		return NewUnsupported(), nil
+	case markerXmlDocument:
+		return NewXMLDocument(""), nil
+	case markerTypedObject:
+		return NewTypedObject(""), nil
+	case markerForbidden, markerMovieClip, markerRecordSet:
 		return nil, oe.Errorf("Marker %v is not supported", m)
 	}
 	return nil, oe.Errorf("Marker %v is invalid", m)
@@ -368,6 +382,17 @@ func (v *objectBase) Set(key string, value Amf0) *objectBase {
 	return v
 }
 
+// Get the keys, in the original order.
+func (v *objectBase) Keys() (keys []string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for _, p := range v.properties {
+		keys = append(keys, string(p.key))
+	}
+	return
+}
+
 func (v *objectBase) unmarshal(p []byte, eof bool, maxElems int) (err error) {
 	// if no eof, elems specified by maxElems.
 	if !eof && maxElems < 0 {
@@ -585,9 +610,9 @@ func (v *EcmaArray) MarshalBinary() (data []byte, err error) {
 }
 
 // The AMF0 strict array, please read @doc amf0_spec_121207.pdf, @page 7, @section 2.12 Strict Array Type
+// The values are dense without name, so the key of property is the index, for example, "0" and "1".
 type StrictArray struct {
 	objectBase
-	count uint32
 }
 
 func NewStrictArray() *StrictArray {
@@ -596,12 +621,34 @@ func NewStrictArray() *StrictArray {
 	return v
 }
 
+// Append the value, whose key is the index.
+func (v *StrictArray) Append(value Amf0) *StrictArray {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	key := amf0UTF8(strconv.Itoa(len(v.properties)))
+	v.properties = append(v.properties, &property{key: key, value: value})
+	return v
+}
+
+// Get the values, in the original order.
+func (v *StrictArray) Values() (values []Amf0) {
+	for _, p := range v.copyProperties() {
+		values = append(values, p.value)
+	}
+	return
+}
+
 func (v *StrictArray) amf0Marker() marker {
 	return markerStrictArray
 }
 
 func (v *StrictArray) Size() int {
-	return int(1) + 4 + v.objectBase.Size()
+	size := int(1) + 4
+	for _, p := range v.copyProperties() {
+		size += p.value.Size()
+	}
+	return size
 }
 
 func (v *StrictArray) UnmarshalBinary(data []byte) (err error) {
@@ -612,15 +659,20 @@ func (v *StrictArray) UnmarshalBinary(data []byte) (err error) {
 	if m := marker(p[0]); m != markerStrictArray {
 		return oe.Errorf("StrictArray marker %v is illegal", m)
 	}
-	v.count = binary.BigEndian.Uint32(p[1:])
+	count := binary.BigEndian.Uint32(p[1:])
 	p = p[5:]
 
-	if int(v.count) <= 0 {
-		return
-	}
+	for i := 0; i < int(count); i++ {
+		var a Amf0
+		if a, err = Discovery(p); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("discover elem %v", i))
+		}
+		if err = a.UnmarshalBinary(p); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("unmarshal elem %v", i))
+		}
 
-	if err = v.unmarshal(p, false, int(v.count)); err != nil {
-		return oe.WithMessage(err, "unmarshal")
+		v.Append(a)
+		p = p[a.Size():]
 	}
 	return
 }
@@ -632,12 +684,19 @@ func (v *StrictArray) MarshalBinary() (data []byte, err error) {
 		return nil, oe.Wrap(err, "marshal")
 	}
 
-	if err = binary.Write(b, binary.BigEndian, v.count); err != nil {
+	values := v.Values()
+	if err = binary.Write(b, binary.BigEndian, uint32(len(values))); err != nil {
 		return nil, oe.Wrap(err, "marshal")
 	}
 
-	if err = v.marshal(b); err != nil {
-		return nil, oe.WithMessage(err, "marshal")
+	var pb []byte
+	for i, value := range values {
+		if pb, err = value.MarshalBinary(); err != nil {
+			return nil, oe.WithMessage(err, fmt.Sprintf("marshal elem %v", i))
+		}
+		if _, err = b.Write(pb); err != nil {
+			return nil, oe.Wrapf(err, "write elem %v", i)
+		}
 	}
 
 	return b.Bytes(), nil
@@ -736,3 +795,401 @@ func (v *Boolean) MarshalBinary() (data []byte, err error) {
 	}
 	return []byte{byte(markerBoolean), b}, nil
 }
+
+// The AMF0 unsupported, please read @doc amf0_spec_121207.pdf, @page 7, @section 2.14 Unsupported Type
+type unsupported struct {
+	singleMarkerObject
+}
+
+func NewUnsupported() Amf0 {
+	v := unsupported{}
+	v.singleMarkerObject = newSingleMarkerObject(markerUnsupported)
+	return &v
+}
+
+// The UTF8 long string, please read @doc amf0_spec_121207.pdf, @page 3, @section 1.3.1 Strings and UTF-8
+type amf0UTF8Long string
+
+func (v *amf0UTF8Long) Size() int {
+	return 4 + len(string(*v))
+}
+
+func (v *amf0UTF8Long) UnmarshalBinary(data []byte) (err error) {
+	var p []byte
+	if p = data; len(p) < 4 {
+		return oe.Errorf("require 4 bytes only %v", len(p))
+	}
+	size := binary.BigEndian.Uint32(p)
+
+	if p = data[4:]; uint64(len(p)) < uint64(size) {
+		return oe.Errorf("require %v bytes only %v", size, len(p))
+	}
+	*v = amf0UTF8Long(string(p[:size]))
+
+	return
+}
+
+func (v *amf0UTF8Long) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, v.Size())
+	binary.BigEndian.PutUint32(data, uint32(len(string(*v))))
+	copy(data[4:], []byte(*v))
+	return
+}
+
+// The long string object, please read @doc amf0_spec_121207.pdf, @page 7, @section 2.14 Long String Type
+type LongString string
+
+func NewLongString(s string) *LongString {
+	v := LongString(s)
+	return &v
+}
+
+func (v *LongString) amf0Marker() marker {
+	return markerLongString
+}
+
+func (v *LongString) Size() int {
+	u := amf0UTF8Long(*v)
+	return 1 + u.Size()
+}
+
+func (v *LongString) UnmarshalBinary(data []byte) (err error) {
+	var p []byte
+	if p = data; len(p) < 1 {
+		return oe.Errorf("require 1 bytes only %v", len(p))
+	}
+	if m := marker(p[0]); m != markerLongString {
+		return oe.Errorf("LongString marker %v is illegal", m)
+	}
+
+	var sv amf0UTF8Long
+	if err = sv.UnmarshalBinary(p[1:]); err != nil {
+		return oe.WithMessage(err, "utf8")
+	}
+	*v = LongString(string(sv))
+	return
+}
+
+func (v *LongString) MarshalBinary() (data []byte, err error) {
+	u := amf0UTF8Long(*v)
+
+	var pb []byte
+	if pb, err = u.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "utf8")
+	}
+
+	data = append([]byte{byte(markerLongString)}, pb...)
+	return
+}
+
+// The XML document object, please read @doc amf0_spec_121207.pdf, @page 7, @section 2.17 XML Document Type
+type XMLDocument string
+
+func NewXMLDocument(s string) *XMLDocument {
+	v := XMLDocument(s)
+	return &v
+}
+
+func (v *XMLDocument) amf0Marker() marker {
+	return markerXmlDocument
+}
+
+func (v *XMLDocument) Size() int {
+	u := amf0UTF8Long(*v)
+	return 1 + u.Size()
+}
+
+func (v *XMLDocument) UnmarshalBinary(data []byte) (err error) {
+	var p []byte
+	if p = data; len(p) < 1 {
+		return oe.Errorf("require 1 bytes only %v", len(p))
+	}
+	if m := marker(p[0]); m != markerXmlDocument {
+		return oe.Errorf("XMLDocument marker %v is illegal", m)
+	}
+
+	var sv amf0UTF8Long
+	if err = sv.UnmarshalBinary(p[1:]); err != nil {
+		return oe.WithMessage(err, "utf8")
+	}
+	*v = XMLDocument(string(sv))
+	return
+}
+
+func (v *XMLDocument) MarshalBinary() (data []byte, err error) {
+	u := amf0UTF8Long(*v)
+
+	var pb []byte
+	if pb, err = u.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "utf8")
+	}
+
+	data = append([]byte{byte(markerXmlDocument)}, pb...)
+	return
+}
+
+// The date object, please read @doc amf0_spec_121207.pdf, @page 6, @section 2.13 Date Type
+// The date is in milliseconds since epoch, while the time-zone is reserved and always 0.
+type Date time.Time
+
+func NewDate(t time.Time) *Date {
+	v := Date(t)
+	return &v
+}
+
+func (v *Date) amf0Marker() marker {
+	return markerDate
+}
+
+func (v *Date) Size() int {
+	return 1 + 8 + 2
+}
+
+func (v *Date) UnmarshalBinary(data []byte) (err error) {
+	var p []byte
+	if p = data; len(p) < 11 {
+		return oe.Errorf("require 11 bytes only %v", len(p))
+	}
+	if m := marker(p[0]); m != markerDate {
+		return oe.Errorf("Date marker %v is illegal", m)
+	}
+
+	// Ignore the time-zone, which is reserved.
+	ms := math.Float64frombits(binary.BigEndian.Uint64(p[1:]))
+	msi := math.Floor(ms)
+	*v = Date(time.Unix(0, int64(msi)*int64(time.Millisecond)+int64(math.Floor((ms-msi)*1e6+0.5))))
+	return
+}
+
+func (v *Date) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 11)
+	data[0] = byte(markerDate)
+
+	ms := float64(time.Time(*v).UnixNano()) / float64(time.Millisecond)
+	binary.BigEndian.PutUint64(data[1:], math.Float64bits(ms))
+	return
+}
+
+// The reference object, please read @doc amf0_spec_121207.pdf, @page 6, @section 2.9 Reference Type
+// The index refers to the complex object, such as object, typed object, ECMA array and strict array,
+// in the order of appearance, see ReferenceTable.
+type Reference uint16
+
+func NewReference(index uint16) *Reference {
+	v := Reference(index)
+	return &v
+}
+
+func (v *Reference) amf0Marker() marker {
+	return markerReference
+}
+
+func (v *Reference) Size() int {
+	return 1 + 2
+}
+
+func (v *Reference) UnmarshalBinary(data []byte) (err error) {
+	var p []byte
+	if p = data; len(p) < 3 {
+		return oe.Errorf("require 3 bytes only %v", len(p))
+	}
+	if m := marker(p[0]); m != markerReference {
+		return oe.Errorf("Reference marker %v is illegal", m)
+	}
+
+	*v = Reference(binary.BigEndian.Uint16(p[1:]))
+	return
+}
+
+func (v *Reference) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 3)
+	data[0] = byte(markerReference)
+	binary.BigEndian.PutUint16(data[1:], uint16(*v))
+	return
+}
+
+// The reference table, to resolve the Reference to complex objects. User should add all
+// values in the order of appearance, for example, the values of a RTMP command.
+type ReferenceTable struct {
+	objects []Amf0
+}
+
+func NewReferenceTable() *ReferenceTable {
+	return &ReferenceTable{}
+}
+
+// Add the a and all complex objects in it to table, the object is added before its properties.
+func (v *ReferenceTable) Add(a Amf0) {
+	var ob *objectBase
+	switch a := a.(type) {
+	case *Object:
+		ob = &a.objectBase
+	case *TypedObject:
+		ob = &a.objectBase
+	case *EcmaArray:
+		ob = &a.objectBase
+	case *StrictArray:
+		ob = &a.objectBase
+	default:
+		return
+	}
+
+	v.objects = append(v.objects, a)
+
+	ob.lock.Lock()
+	properties := append([]*property{}, ob.properties...)
+	ob.lock.Unlock()
+
+	for _, p := range properties {
+		v.Add(p.value)
+	}
+}
+
+// Resolve the reference to the complex object.
+func (v *ReferenceTable) Resolve(r *Reference) (Amf0, error) {
+	if int(*r) >= len(v.objects) {
+		return nil, oe.Errorf("reference %v overflow %v", int(*r), len(v.objects))
+	}
+	return v.objects[int(*r)], nil
+}
+
+// The typed object, please read @doc amf0_spec_121207.pdf, @page 8, @section 2.18 Typed Object Type
+type TypedObject struct {
+	objectBase
+	ClassName string
+	eof       objectEOF
+}
+
+func NewTypedObject(className string) *TypedObject {
+	v := &TypedObject{ClassName: className}
+	v.properties = []*property{}
+	return v
+}
+
+func (v *TypedObject) amf0Marker() marker {
+	return markerTypedObject
+}
+
+func (v *TypedObject) Size() int {
+	u := amf0UTF8(v.ClassName)
+	return int(1) + u.Size() + v.eof.Size() + v.objectBase.Size()
+}
+
+func (v *TypedObject) UnmarshalBinary(data []byte) (err error) {
+	var p []byte
+	if p = data; len(p) < 1 {
+		return oe.Errorf("require 1 byte only %v", len(p))
+	}
+	if m := marker(p[0]); m != markerTypedObject {
+		return oe.Errorf("TypedObject marker %v is illegal", m)
+	}
+	p = p[1:]
+
+	var u amf0UTF8
+	if err = u.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "class name")
+	}
+	v.ClassName = string(u)
+	p = p[u.Size():]
+
+	if err = v.unmarshal(p, true, -1); err != nil {
+		return oe.WithMessage(err, "unmarshal")
+	}
+
+	return
+}
+
+func (v *TypedObject) MarshalBinary() (data []byte, err error) {
+	b := createBuffer()
+
+	if err = b.WriteByte(byte(markerTypedObject)); err != nil {
+		return nil, oe.Wrap(err, "marshal")
+	}
+
+	u := amf0UTF8(v.ClassName)
+	var pb []byte
+	if pb, err = u.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal")
+	}
+	if _, err = b.Write(pb); err != nil {
+		return nil, oe.Wrap(err, "marshal")
+	}
+
+	if err = v.marshal(b); err != nil {
+		return nil, oe.WithMessage(err, "marshal")
+	}
+
+	if pb, err = v.eof.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal")
+	}
+	if _, err = b.Write(pb); err != nil {
+		return nil, oe.Wrap(err, "marshal")
+	}
+
+	return b.Bytes(), nil
+}
+
+// The AMF0 avmplus object, to switch to AMF3 for the value,
+// please read @doc amf0_spec_121207.pdf, @page 8, @section 3.1 AVM+ Type Marker
+// @remark The AMF3 reference tables are reset for each avmplus object.
+type AvmPlusObject struct {
+	value amf3.Amf3
+	// The size of bytes consumed when unmarshal, because the AMF3 value may use references.
+	size int
+}
+
+func NewAvmPlusObject(a amf3.Amf3) *AvmPlusObject {
+	return &AvmPlusObject{value: a}
+}
+
+// Get the AMF3 value.
+func (v *AvmPlusObject) Value() amf3.Amf3 {
+	return v.value
+}
+
+func (v *AvmPlusObject) amf0Marker() marker {
+	return markerAvmPlusObject
+}
+
+func (v *AvmPlusObject) Size() int {
+	if v.size > 0 {
+		return v.size
+	}
+	if v.value == nil {
+		return 1
+	}
+	return 1 + v.value.Size()
+}
+
+func (v *AvmPlusObject) UnmarshalBinary(data []byte) (err error) {
+	var p []byte
+	if p = data; len(p) < 2 {
+		return oe.Errorf("require 2 bytes only %v", len(p))
+	}
+	if m := marker(p[0]); m != markerAvmPlusObject {
+		return oe.Errorf("AvmPlusObject marker %v is illegal", m)
+	}
+	p = p[1:]
+
+	d := amf3.NewDecoder(p)
+	if v.value, err = d.Decode(); err != nil {
+		return oe.WithMessage(err, "amf3")
+	}
+	v.size = 1 + len(p) - d.Len()
+
+	return
+}
+
+func (v *AvmPlusObject) MarshalBinary() (data []byte, err error) {
+	if v.value == nil {
+		return nil, oe.New("AvmPlusObject without value")
+	}
+
+	var pb []byte
+	if pb, err = v.value.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "amf3")
+	}
+
+	data = append([]byte{byte(markerAvmPlusObject)}, pb...)
+	return
+}
@@ -24,8 +24,12 @@ package amf0
 import (
 	"bytes"
 	"encoding"
+	"github.com/ossrs/go-oryx-lib/amf3"
 	oe "github.com/ossrs/go-oryx-lib/errors"
+	"math/rand"
+	"strings"
 	"testing"
+	"time"
 )
 
 type mockCreateBuffer struct {
@@ -121,6 +125,13 @@ func TestDiscovery(t *testing.T) {
 		{markerEcmaArray, 8},
 		{markerObjectEnd, 9},
 		{markerStrictArray, 10},
+		{markerAvmPlusObject, 17},
+		{markerReference, 7},
+		{markerDate, 11},
+		{markerLongString, 12},
+		{markerUnsupported, 13},
+		{markerXmlDocument, 15},
+		{markerTypedObject, 16},
 	}
 	for _, pv := range pvs {
 		if m, err := Discovery([]byte{pv.mv}); err != nil {
@@ -133,9 +144,7 @@ func TestDiscovery(t *testing.T) {
 
 func TestDiscovery2(t *testing.T) {
 	pvs := []byte{
-		7, 11, 12, 13, 15,
-		16, 17, 4,
-		14,
+		4, 14,
 
 		18, 0xff,
 	}
@@ -730,7 +739,7 @@ func TestAmf0StrictArray_MarshalBinary(t *testing.T) {
 func TestAmf0StrictArray_UnmarshalBinary(t *testing.T) {
 	pvs := [][]byte{
 		[]byte{10, 0, 0, 0, 0},
-		[]byte{10, 0, 0, 0, 1, 0, 1, byte('e'), 5},
+		[]byte{10, 0, 0, 0, 1, 5},
 	}
 
 	for _, pv := range pvs {
@@ -741,6 +750,43 @@ func TestAmf0StrictArray_UnmarshalBinary(t *testing.T) {
 	}
 }
 
+func TestAmf0StrictArray_RoundTrip(t *testing.T) {
+	// The strict array [1, "a"], the values without name.
+	data := []byte{10, 0, 0, 0, 2, 0, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 2, 0, 1, byte('a')}
+
+	v := NewStrictArray()
+	if err := v.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal failed err %+v", err)
+	}
+	if v.Size() != len(data) {
+		t.Errorf("invalid size %v", v.Size())
+	}
+	if values := v.Values(); len(values) != 2 {
+		t.Errorf("invalid values %v", values)
+	} else if n, ok := values[0].(*Number); !ok || *n != 1 {
+		t.Errorf("invalid number %v", values[0])
+	} else if s, ok := values[1].(*String); !ok || *s != "a" {
+		t.Errorf("invalid string %v", values[1])
+	}
+	if n, ok := v.Get("1").(*String); !ok || *n != "a" {
+		t.Errorf("invalid get %v", v.Get("1"))
+	}
+
+	if b, err := NewStrictArray().Append(NewNumber(1)).Append(NewString("a")).MarshalBinary(); err != nil {
+		t.Errorf("marshal failed err %+v", err)
+	} else if !bytes.Equal(b, data) {
+		t.Errorf("invalid data %v", b)
+	}
+
+	// The strict array in object, for example, the keyframes in onMetaData.
+	o := NewObject()
+	if err := o.UnmarshalBinary(append(append([]byte{3, 0, 1, byte('k')}, data...), 0, 0, 9)); err != nil {
+		t.Errorf("unmarshal failed err %+v", err)
+	} else if v, ok := o.Get("k").(*StrictArray); !ok || len(v.Values()) != 2 {
+		t.Errorf("invalid object %v", o)
+	}
+}
+
 func TestAmf0StrictArray_UnmarshalBinary2(t *testing.T) {
 	pvs := [][]byte{
 		nil, []byte{}, []byte{0},
@@ -868,3 +914,258 @@ func TestAmf0Boolean_UnmarshalBinary2(t *testing.T) {
 		}
 	}
 }
+
+func TestAmf0AvmPlusObject_MarshalBinary(t *testing.T) {
+	v := NewAvmPlusObject(amf3.NewString("oryx"))
+	if b, err := v.MarshalBinary(); err != nil {
+		t.Errorf("marshal failed err %+v", err)
+	} else if bytes.Compare(b, []byte{17, 6, 9, 'o', 'r', 'y', 'x'}) != 0 {
+		t.Errorf("invalid object %v", b)
+	} else if v.Size() != len(b) {
+		t.Errorf("invalid size %v", v.Size())
+	}
+
+	if _, err := NewAvmPlusObject(nil).MarshalBinary(); err == nil {
+		t.Error("should error without value")
+	}
+}
+
+func TestAmf0AvmPlusObject_UnmarshalBinary(t *testing.T) {
+	// The AMF3 string in avmplus object, followed by AMF0 number.
+	b := []byte{17, 6, 9, 'o', 'r', 'y', 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	v := NewAvmPlusObject(nil)
+	if err := v.UnmarshalBinary(b); err != nil {
+		t.Errorf("unmarshal failed err %+v", err)
+	} else if s, ok := v.Value().(*amf3.String); !ok || string(*s) != "oryx" {
+		t.Errorf("invalid value %v", v.Value())
+	} else if v.Size() != 7 {
+		t.Errorf("invalid size %v", v.Size())
+	}
+
+	pvs := [][]byte{
+		nil, []byte{17}, []byte{16, 6, 1},
+		[]byte{17, 0xff}, []byte{17, 6, 9},
+	}
+	for _, pv := range pvs {
+		if err := NewAvmPlusObject(nil).UnmarshalBinary(pv); err == nil {
+			t.Errorf("should error for %v", pv)
+		}
+	}
+}
+
+func TestAmf0Date(t *testing.T) {
+	d := NewDate(time.Unix(1500000000, 123*int64(time.Millisecond)))
+	b, err := d.MarshalBinary()
+	if err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if len(b) != d.Size() || b[0] != 11 || b[9] != 0 || b[10] != 0 {
+		t.Errorf("invalid data %v", b)
+	}
+
+	// The time-zone is reserved, which should be ignored.
+	b[9], b[10] = 0x01, 0xe0
+
+	var v Date
+	if err = v.UnmarshalBinary(b); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	} else if !time.Time(v).Equal(time.Time(*d)) {
+		t.Errorf("invalid date %v", time.Time(v))
+	}
+
+	if err = v.UnmarshalBinary(b[:10]); err == nil {
+		t.Error("should error")
+	}
+}
+
+func TestAmf0LongString(t *testing.T) {
+	s := NewLongString(strings.Repeat("o", 0x10000))
+	b, err := s.MarshalBinary()
+	if err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if len(b) != 1+4+0x10000 || !bytes.Equal(b[:5], []byte{12, 0, 1, 0, 0}) {
+		t.Errorf("invalid data %v", b[:5])
+	}
+
+	var v LongString
+	if err = v.UnmarshalBinary(b); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	} else if v != *s {
+		t.Errorf("invalid string %vB", len(v))
+	}
+
+	if err = v.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Error("should error")
+	}
+	if err = v.UnmarshalBinary([]byte{2, 0, 0, 0, 0}); err == nil {
+		t.Error("should error")
+	}
+}
+
+func TestAmf0XMLDocument(t *testing.T) {
+	x := NewXMLDocument("<a/>")
+	b, err := x.MarshalBinary()
+	if err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if !bytes.Equal(b, []byte{15, 0, 0, 0, 4, '<', 'a', '/', '>'}) {
+		t.Errorf("invalid data %v", b)
+	}
+
+	var v XMLDocument
+	if err = v.UnmarshalBinary(b); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	} else if v != "<a/>" {
+		t.Errorf("invalid xml %v", v)
+	}
+}
+
+func TestAmf0TypedObject(t *testing.T) {
+	o := NewTypedObject("oryx.Obj")
+	o.Set("id", NewNumber(1))
+	b, err := o.MarshalBinary()
+	if err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if len(b) != o.Size() || b[0] != 16 {
+		t.Errorf("invalid data %v", b)
+	}
+
+	var v TypedObject
+	if err = v.UnmarshalBinary(b); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	} else if v.ClassName != "oryx.Obj" {
+		t.Errorf("invalid class %v", v.ClassName)
+	} else if n, ok := v.Get("id").(*Number); !ok || *n != 1 {
+		t.Errorf("invalid id %v", v.Get("id"))
+	} else if v.Size() != len(b) {
+		t.Errorf("invalid size %v", v.Size())
+	}
+
+	if err = v.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Error("should error")
+	}
+}
+
+func TestAmf0Reference(t *testing.T) {
+	// The table contains the object, nested array and typed object.
+	o := NewObject()
+	arr := NewEcmaArray()
+	arr.Set("x", NewNumber(1))
+	o.Set("arr", arr)
+	o.Set("ref", NewReference(1))
+	to := NewTypedObject("T")
+
+	rt := NewReferenceTable()
+	rt.Add(NewString("ignored"))
+	rt.Add(o)
+	rt.Add(to)
+
+	for i, expect := range []Amf0{o, arr, to} {
+		if v, err := rt.Resolve(NewReference(uint16(i))); err != nil {
+			t.Errorf("resolve %v failed %+v", i, err)
+		} else if v != expect {
+			t.Errorf("invalid %v %T", i, v)
+		}
+	}
+	if _, err := rt.Resolve(NewReference(3)); err == nil {
+		t.Error("should error")
+	}
+
+	b, err := NewReference(0x0102).MarshalBinary()
+	if err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if !bytes.Equal(b, []byte{7, 1, 2}) {
+		t.Errorf("invalid data %v", b)
+	}
+
+	var v Reference
+	if err = v.UnmarshalBinary(b); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	} else if v != 0x0102 {
+		t.Errorf("invalid reference %v", v)
+	}
+}
+
+func randomAmf0(r *rand.Rand, depth int) Amf0 {
+	n := 12
+	if depth > 2 {
+		n = 9
+	}
+
+	switch r.Intn(n) {
+	case 0:
+		return NewNumber(r.NormFloat64())
+	case 1:
+		return NewBoolean(r.Intn(2) == 0)
+	case 2:
+		return NewString(strings.Repeat("s", r.Intn(16)))
+	case 3:
+		return NewNull()
+	case 4:
+		return NewUndefined()
+	case 5:
+		return NewUnsupported()
+	case 6:
+		return NewDate(time.Unix(r.Int63n(1<<32), 0))
+	case 7:
+		return NewLongString(strings.Repeat("l", r.Intn(16)))
+	case 8:
+		return NewReference(uint16(r.Intn(8)))
+	case 9:
+		o := NewObject()
+		for i := 0; i < r.Intn(4); i++ {
+			o.Set(strings.Repeat("k", i+1), randomAmf0(r, depth+1))
+		}
+		return o
+	case 10:
+		o := NewEcmaArray()
+		for i := 0; i < r.Intn(4); i++ {
+			o.Set(strings.Repeat("k", i+1), randomAmf0(r, depth+1))
+		}
+		return o
+	default:
+		o := NewTypedObject(strings.Repeat("c", r.Intn(4)))
+		for i := 0; i < r.Intn(4); i++ {
+			o.Set(strings.Repeat("k", i+1), randomAmf0(r, depth+1))
+		}
+		return o
+	}
+}
+
+func TestAmf0_RoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 1000; i++ {
+		a := randomAmf0(r, 0)
+		b, err := a.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshal %T failed %+v", a, err)
+		}
+		if len(b) != a.Size() {
+			t.Errorf("invalid size %v of %T, expect %v", a.Size(), a, len(b))
+		}
+
+		v, err := Discovery(b)
+		if err != nil {
+			t.Fatalf("discovery %v failed %+v", b, err)
+		}
+		if err = v.UnmarshalBinary(b); err != nil {
+			t.Fatalf("unmarshal %v failed %+v", b, err)
+		}
+
+		if bb, err := v.MarshalBinary(); err != nil {
+			t.Errorf("marshal %T failed %+v", v, err)
+		} else if !bytes.Equal(b, bb) {
+			t.Errorf("round trip %T failed, %v != %v", v, b, bb)
+		}
+
+		// Should never panic for corrupt data.
+		for j := 0; j < len(b); j++ {
+			if v, err := Discovery(b); err == nil {
+				v.UnmarshalBinary(b[:j])
+			}
+			c := append([]byte{}, b...)
+			c[j] = byte(r.Intn(256))
+			if v, err := Discovery(c); err == nil {
+				v.UnmarshalBinary(c)
+			}
+		}
+	}
+}
@@ -20,3 +20,30 @@
 // CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
 package amf0_test
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+)
+
+func ExampleMarshal() {
+	type ConnectArgs struct {
+		App   string `amf0:"app"`
+		TcURL string `amf0:"tcUrl"`
+		Fpad  bool   `amf0:"fpad,omitempty"`
+	}
+
+	b, err := amf0.Marshal(&ConnectArgs{App: "live", TcURL: "rtmp://localhost/live"})
+	if err != nil {
+		return
+	}
+
+	var args ConnectArgs
+	if err = amf0.Unmarshal(b, &args); err != nil {
+		return
+	}
+
+	fmt.Println(args.App, args.TcURL)
+	// Output:
+	// live rtmp://localhost/live
+}
@@ -0,0 +1,358 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package amf0
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ossrs/go-oryx-lib/amf3"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// FromJSON build the AMF0 object from the generic JSON data, the order of keys is kept:
+//
+//	JSON object to Object, array to StrictArray, same to ValueOf.
+//	JSON number to Number, string to String or LongString if overflow, bool to Boolean, null to Null.
+func FromJSON(data []byte) (a Amf0, err error) {
+	// Validate the JSON, then scan the values in order, which is always complete.
+	var raw json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, oe.Wrap(err, "json")
+	}
+
+	if a, err = readJSON(raw); err != nil {
+		return nil, oe.WithMessage(err, "read")
+	}
+	return a, nil
+}
+
+func readJSON(b []byte) (Amf0, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, oe.New("empty")
+	}
+
+	switch b[0] {
+	case '{':
+		o := NewObject()
+		for b = skipJSON(b[1:], 0); b[0] != '}'; b = skipJSON(b, ',') {
+			var key string
+			k, left := nextJSON(b)
+			if err := json.Unmarshal(k, &key); err != nil {
+				return nil, oe.Wrap(err, "key")
+			}
+
+			var v []byte
+			v, b = nextJSON(skipJSON(left, ':'))
+			a, err := readJSON(v)
+			if err != nil {
+				return nil, oe.WithMessage(err, key)
+			}
+			o.Set(key, a)
+		}
+		return o, nil
+	case '[':
+		o := NewStrictArray()
+		for b = skipJSON(b[1:], 0); b[0] != ']'; b = skipJSON(b, ',') {
+			var v []byte
+			v, b = nextJSON(b)
+			a, err := readJSON(v)
+			if err != nil {
+				return nil, oe.WithMessage(err, "elem")
+			}
+			o.Append(a)
+		}
+		return o, nil
+	case '"':
+		var v string
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, oe.Wrap(err, "string")
+		}
+		if len(v) > math.MaxUint16 {
+			return NewLongString(v), nil
+		}
+		return NewString(v), nil
+	case 't', 'f':
+		return NewBoolean(b[0] == 't'), nil
+	case 'n':
+		return NewNull(), nil
+	}
+
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return nil, oe.Wrapf(err, "number %v", string(b))
+	}
+	return NewNumber(f), nil
+}
+
+// Skip the spaces, and the separator sep if not 0, of the validated JSON.
+func skipJSON(b []byte, sep byte) []byte {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if sep != 0 && len(b) > 0 && b[0] == sep {
+		b = bytes.TrimLeft(b[1:], " \t\r\n")
+	}
+	return b
+}
+
+// Split the first value of the validated JSON, the string may contain escaped quote,
+// and the object or array may contain the nested ones.
+func nextJSON(b []byte) (v, left []byte) {
+	depth, quoted, escaped := 0, false, false
+	for i, c := range b {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			if quoted = !quoted; !quoted && depth == 0 {
+				return b[:i+1], b[i+1:]
+			}
+		case quoted:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			if depth--; depth == 0 {
+				return b[:i+1], b[i+1:]
+			} else if depth < 0 {
+				return b[:i], b[i:]
+			}
+		case depth == 0 && (c == ',' || c == ':' || c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+			return b[:i], b[i:]
+		}
+	}
+	return b, nil
+}
+
+// Marshal the properties as JSON object, in the order of properties.
+func (v *objectBase) marshalJSON() ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteByte('{')
+
+	for i, p := range v.copyProperties() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		pb, err := json.Marshal(string(p.key))
+		if err != nil {
+			return nil, oe.Wrapf(err, "key %v", string(p.key))
+		}
+		b.Write(pb)
+		b.WriteByte(':')
+
+		if pb, err = json.Marshal(p.value); err != nil {
+			return nil, oe.Wrapf(err, "value of %v", string(p.key))
+		}
+		b.Write(pb)
+	}
+
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// The JSON of object is the JSON object.
+func (v *Object) MarshalJSON() ([]byte, error) {
+	return v.marshalJSON()
+}
+
+func (v *Object) String() string {
+	return stringOf(v)
+}
+
+// The JSON of ECMA array is the JSON object.
+func (v *EcmaArray) MarshalJSON() ([]byte, error) {
+	return v.marshalJSON()
+}
+
+func (v *EcmaArray) String() string {
+	return stringOf(v)
+}
+
+// The JSON of typed object is the JSON object, without the class name.
+func (v *TypedObject) MarshalJSON() ([]byte, error) {
+	return v.marshalJSON()
+}
+
+func (v *TypedObject) String() string {
+	return stringOf(v)
+}
+
+// The JSON of strict array is the JSON array of values.
+func (v *StrictArray) MarshalJSON() ([]byte, error) {
+	values := []Amf0{}
+	for _, p := range v.copyProperties() {
+		values = append(values, p.value)
+	}
+	return json.Marshal(values)
+}
+
+func (v *StrictArray) String() string {
+	return stringOf(v)
+}
+
+// The JSON of number is null for NaN and Inf, which is not supported by JSON.
+func (v *Number) MarshalJSON() ([]byte, error) {
+	if f := float64(*v); math.IsNaN(f) || math.IsInf(f, 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(*v))
+}
+
+func (v *Boolean) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bool(*v))
+}
+
+func (v *String) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(*v))
+}
+
+func (v *LongString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(*v))
+}
+
+func (v *XMLDocument) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(*v))
+}
+
+// The JSON of date is the RFC3339 string.
+func (v *Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(*v))
+}
+
+// The JSON of reference is the index.
+func (v *Reference) MarshalJSON() ([]byte, error) {
+	return json.Marshal(uint16(*v))
+}
+
+// The JSON of null, undefined and unsupported is null.
+func (v *singleMarkerObject) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// The JSON of avmplus object is the JSON of AMF3 value, similar to AMF0:
+//
+//	Object to JSON object, without the class name.
+//	Array to JSON array of dense values, or JSON object keyed by index and name if associative.
+//	ByteArray to base64 string, Null and Undefined to null.
+func (v *AvmPlusObject) MarshalJSON() ([]byte, error) {
+	return marshalAmf3JSON(v.value)
+}
+
+func marshalAmf3JSON(a amf3.Amf3) ([]byte, error) {
+	switch a := a.(type) {
+	case *amf3.Boolean:
+		return json.Marshal(bool(*a))
+	case *amf3.Integer:
+		return json.Marshal(int32(*a))
+	case *amf3.Double:
+		if f := float64(*a); math.IsNaN(f) || math.IsInf(f, 0) {
+			return []byte("null"), nil
+		}
+		return json.Marshal(float64(*a))
+	case *amf3.String:
+		return json.Marshal(string(*a))
+	case *amf3.XML:
+		return json.Marshal(string(*a))
+	case *amf3.XMLDocument:
+		return json.Marshal(string(*a))
+	case *amf3.Date:
+		return json.Marshal(time.Time(*a))
+	case *amf3.ByteArray:
+		return json.Marshal([]byte(*a))
+	case *amf3.Object:
+		return marshalAmf3Pairs(nil, a.Keys(), a.Get)
+	case *amf3.Array:
+		if keys := a.Keys(); len(keys) > 0 {
+			return marshalAmf3Pairs(a.Dense, keys, a.Get)
+		}
+
+		b := &bytes.Buffer{}
+		b.WriteByte('[')
+		for i, value := range a.Dense {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			pb, err := marshalAmf3JSON(value)
+			if err != nil {
+				return nil, oe.WithMessage(err, strconv.Itoa(i))
+			}
+			b.Write(pb)
+		}
+		b.WriteByte(']')
+		return b.Bytes(), nil
+	}
+
+	// For null and undefined.
+	return []byte("null"), nil
+}
+
+// Marshal the dense values keyed by index, then the name-value pairs, as JSON object.
+func marshalAmf3Pairs(dense []amf3.Amf3, keys []string, get func(key string) amf3.Amf3) ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteByte('{')
+
+	write := func(key string, value amf3.Amf3) error {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+
+		pb, err := json.Marshal(key)
+		if err != nil {
+			return oe.Wrapf(err, "key %v", key)
+		}
+		b.Write(pb)
+		b.WriteByte(':')
+
+		if pb, err = marshalAmf3JSON(value); err != nil {
+			return oe.WithMessage(err, key)
+		}
+		b.Write(pb)
+		return nil
+	}
+
+	for i, value := range dense {
+		if err := write(strconv.Itoa(i), value); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range keys {
+		if err := write(key, get(key)); err != nil {
+			return nil, err
+		}
+	}
+
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func stringOf(a Amf0) string {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
@@ -0,0 +1,162 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package amf0
+
+import (
+	"encoding/json"
+	"github.com/ossrs/go-oryx-lib/amf3"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAmf0_MarshalJSON(t *testing.T) {
+	sa := NewStrictArray()
+	sa.Set("0", NewNumber(1))
+	sa.Set("1", NewString("s"))
+
+	ea := NewEcmaArray()
+	ea.Set("duration", NewNumber(0))
+
+	o := NewObject()
+	o.Set("z", NewBoolean(true))
+	o.Set("a", NewNull())
+	o.Set("u", NewUndefined())
+	o.Set("nan", NewNumber(math.NaN()))
+	o.Set("long", NewLongString("l"))
+	o.Set("xml", NewXMLDocument("<a/>"))
+	o.Set("date", NewDate(time.Unix(0, 0).UTC()))
+	o.Set("ref", NewReference(1))
+	o.Set("arr", sa)
+	o.Set("ecma", ea)
+	o.Set("typed", NewTypedObject("T"))
+
+	expect := `{"z":true,"a":null,"u":null,"nan":null,"long":"l","xml":"\u003ca/\u003e",` +
+		`"date":"1970-01-01T00:00:00Z","ref":1,"arr":[1,"s"],"ecma":{"duration":0},"typed":{}}`
+	if b, err := json.Marshal(o); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if string(b) != expect {
+		t.Errorf("invalid json %v", string(b))
+	}
+	if o.String() != expect {
+		t.Errorf("invalid string %v", o.String())
+	}
+
+	if b, err := json.MarshalIndent(ea, "", "  "); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if string(b) != "{\n  \"duration\": 0\n}" {
+		t.Errorf("invalid json %v", string(b))
+	}
+}
+
+func TestAvmPlusObject_MarshalJSON(t *testing.T) {
+	arr := amf3.NewArray()
+	arr.Dense = []amf3.Amf3{amf3.NewInteger(1), amf3.NewDouble(math.Inf(1))}
+
+	ea := amf3.NewArray()
+	ea.Dense = []amf3.Amf3{amf3.NewString("d")}
+	ea.Set("k", amf3.NewBoolean(true))
+
+	o := amf3.NewObject()
+	o.ClassName = "flex.messaging.messages.RemotingMessage"
+	o.Set("code", amf3.NewString("NetStream.Play.Start"))
+	o.Set("level", amf3.NewXML("<a/>"))
+	o.Set("date", amf3.NewDate(time.Unix(0, 0).UTC()))
+	o.Set("body", amf3.NewByteArray([]byte{1, 2}))
+	o.Set("none", amf3.NewNull())
+	o.Set("arr", arr)
+	o.Set("ecma", ea)
+
+	expect := `{"code":"NetStream.Play.Start","level":"\u003ca/\u003e","date":"1970-01-01T00:00:00Z",` +
+		`"body":"AQI=","none":null,"arr":[1,null],"ecma":{"0":"d","k":true}}`
+	if b, err := json.Marshal(NewAvmPlusObject(o)); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if string(b) != expect {
+		t.Errorf("invalid json %v", string(b))
+	}
+
+	if b, err := json.Marshal(NewAvmPlusObject(nil)); err != nil || string(b) != "null" {
+		t.Errorf("invalid json %v %+v", string(b), err)
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	data := `{"width":1280,"encoder":"oryx","stereo":true,"none":null,"tracks":["video",{"id":1}]}`
+	a, err := FromJSON([]byte(data))
+	if err != nil {
+		t.Fatalf("from json failed %+v", err)
+	}
+
+	o, ok := a.(*Object)
+	if !ok {
+		t.Fatalf("invalid object %T", a)
+	}
+	if v, ok := o.Get("width").(*Number); !ok || *v != 1280 {
+		t.Errorf("invalid width %v", o.Get("width"))
+	}
+	if v, ok := o.Get("tracks").(*StrictArray); !ok || len(v.Values()) != 2 {
+		t.Errorf("invalid tracks %v", o.Get("tracks"))
+	}
+
+	// Converted back to JSON, the array is kept.
+	if o.String() != data {
+		t.Errorf("invalid json %v", o.String())
+	}
+
+	// The bytes should be able to decode.
+	if b, err := o.MarshalBinary(); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if err = NewObject().UnmarshalBinary(b); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	}
+
+	if a, err := FromJSON([]byte(`"` + strings.Repeat("s", 0x10000) + `"`)); err != nil {
+		t.Errorf("from json failed %+v", err)
+	} else if _, ok := a.(*LongString); !ok {
+		t.Errorf("should be long string %T", a)
+	}
+
+	for _, v := range []string{`[1,2]`, `[]`, `[[1],{"a":[]}]`} {
+		if a, err := FromJSON([]byte(v)); err != nil {
+			t.Errorf("from json failed %+v", err)
+		} else if b, err := json.Marshal(a); err != nil || string(b) != v {
+			t.Errorf("invalid json %v, expect %v, %+v", string(b), v, err)
+		}
+	}
+
+	// The order of keys is kept, with spaces, and escaped quote, backslash and brackets in string.
+	data = ` { "z" : [ 1 , "]," , { } ] ,"a":{"y\"}":"}\"{","b":-1.5e2},"m":false,"k\\":"\\" } `
+	if a, err := FromJSON([]byte(data)); err != nil {
+		t.Errorf("from json failed %+v", err)
+	} else if b, err := json.Marshal(a); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if v := `{"z":[1,"],",{}],"a":{"y\"}":"}\"{","b":-150},"m":false,"k\\":"\\"}`; string(b) != v {
+		t.Errorf("invalid json %v, expect %v", string(b), v)
+	}
+
+	for _, v := range []string{"", "{", `{"a":}`, "[1,", "1 2", "{} x", "1e400"} {
+		if _, err := FromJSON([]byte(v)); err == nil {
+			t.Errorf("should error for %v", v)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package amf0
+
+import (
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshal the Go value v to AMF0 bytes, please read ValueOf for the mapping.
+func Marshal(v interface{}) (data []byte, err error) {
+	var a Amf0
+	if a, err = ValueOf(v); err != nil {
+		return nil, oe.WithMessage(err, "value")
+	}
+
+	if data, err = a.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal")
+	}
+	return
+}
+
+// Unmarshal the AMF0 bytes to v, which must be a non-nil pointer, please read Assign for the mapping.
+func Unmarshal(data []byte, v interface{}) (err error) {
+	var a Amf0
+	if a, err = Discovery(data); err != nil {
+		return oe.WithMessage(err, "discovery")
+	}
+	if err = a.UnmarshalBinary(data); err != nil {
+		return oe.WithMessage(err, "unmarshal")
+	}
+
+	if err = Assign(a, v); err != nil {
+		return oe.WithMessage(err, "assign")
+	}
+	return
+}
+
+// ValueOf convert the Go value v to AMF0 object, similar to encoding/json:
+//
+//	Amf0 is used as is.
+//	bool to Boolean, all integers and floats to Number, string to String, or LongString if
+//	longer than 65535 bytes, time.Time to Date.
+//	struct to Object, the field is named by tag `amf0:"name,omitempty"`, or "-" to ignore it.
+//	map with string key to Object, sorted by key.
+//	slice and array to StrictArray.
+//	nil pointer, interface, map and slice to Null.
+func ValueOf(v interface{}) (Amf0, error) {
+	return valueOf(reflect.ValueOf(v))
+}
+
+// Assign the AMF0 object a to the Go value v, which must be a non-nil pointer.
+// The mapping is the reverse of ValueOf, and:
+//
+//	Null and Undefined are ignored, except for pointer which is set to nil.
+//	LongString and XMLDocument to string, and TypedObject to struct or map.
+//	Object, EcmaArray and StrictArray to slice and array, in the order of properties.
+//	For interface{}, Number to float64, Date to time.Time, object-like to map[string]interface{}
+//	except StrictArray to []interface{}.
+func Assign(a Amf0, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return oe.Errorf("require non-nil pointer, got %v", reflect.TypeOf(v))
+	}
+	return assign(a, rv.Elem())
+}
+
+var amf0Type = reflect.TypeOf((*Amf0)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+func valueOf(rv reflect.Value) (Amf0, error) {
+	if !rv.IsValid() {
+		return NewNull(), nil
+	}
+
+	if rv.Type().Implements(amf0Type) {
+		if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil() {
+			return NewNull(), nil
+		}
+		return rv.Interface().(Amf0), nil
+	}
+
+	if rv.Type() == timeType {
+		return NewDate(rv.Interface().(time.Time)), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return NewBoolean(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewNumber(float64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewNumber(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NewNumber(rv.Float()), nil
+	case reflect.String:
+		s := rv.String()
+		if len(s) > math.MaxUint16 {
+			return NewLongString(s), nil
+		}
+		return NewString(s), nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return NewNull(), nil
+		}
+		return valueOf(rv.Elem())
+	case reflect.Map:
+		return mapOf(rv)
+	case reflect.Slice, reflect.Array:
+		return arrayOf(rv)
+	case reflect.Struct:
+		return structOf(rv)
+	}
+
+	return nil, oe.Errorf("unsupported type %v", rv.Type())
+}
+
+func mapOf(rv reflect.Value) (Amf0, error) {
+	if rv.IsNil() {
+		return NewNull(), nil
+	}
+	if rv.Type().Key().Kind() != reflect.String {
+		return nil, oe.Errorf("unsupported map key %v", rv.Type().Key())
+	}
+
+	keys := rv.MapKeys()
+	sort.Sort(mapKeys(keys))
+
+	o := NewObject()
+	for _, key := range keys {
+		a, err := valueOf(rv.MapIndex(key))
+		if err != nil {
+			return nil, oe.WithMessage(err, key.String())
+		}
+		o.Set(key.String(), a)
+	}
+	return o, nil
+}
+
+// The keys of map, sorted by string.
+type mapKeys []reflect.Value
+
+func (v mapKeys) Len() int {
+	return len(v)
+}
+
+func (v mapKeys) Less(i, j int) bool {
+	return v[i].String() < v[j].String()
+}
+
+func (v mapKeys) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
+
+func arrayOf(rv reflect.Value) (Amf0, error) {
+	if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return NewNull(), nil
+	}
+
+	o := NewStrictArray()
+	for i := 0; i < rv.Len(); i++ {
+		a, err := valueOf(rv.Index(i))
+		if err != nil {
+			return nil, oe.WithMessage(err, strconv.Itoa(i))
+		}
+		o.Append(a)
+	}
+	return o, nil
+}
+
+func structOf(rv reflect.Value) (Amf0, error) {
+	o := NewObject()
+	for _, f := range fieldsOf(rv.Type()) {
+		fv := rv.FieldByIndex(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		a, err := valueOf(fv)
+		if err != nil {
+			return nil, oe.WithMessage(err, f.name)
+		}
+		o.Set(f.name, a)
+	}
+	return o, nil
+}
+
+// The struct field to marshal, parsed from the tag.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// Parse the exported fields of struct t, the anonymous struct without tag is flatten.
+func fieldsOf(t reflect.Type) (fields []*field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		tag := sf.Tag.Get("amf0")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if n := strings.Index(tag, ","); n >= 0 {
+			name, opts = tag[:n], tag[n+1:]
+		}
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, f := range fieldsOf(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		f := &field{name: name, index: []int{i}}
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return
+}
+
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			return rv.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
+
+// Get the object-like base of a, nil if not object-like.
+func objectOf(a Amf0) *objectBase {
+	switch a := a.(type) {
+	case *Object:
+		return &a.objectBase
+	case *TypedObject:
+		return &a.objectBase
+	case *EcmaArray:
+		return &a.objectBase
+	case *StrictArray:
+		return &a.objectBase
+	}
+	return nil
+}
+
+// Get the properties of object-like a.
+func (v *objectBase) copyProperties() []*property {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return append([]*property{}, v.properties...)
+}
+
+func assign(a Amf0, rv reflect.Value) error {
+	if a == nil {
+		return nil
+	}
+
+	// Set to the Amf0 or interface it implements, except for interface{} which is the Go value.
+	if rv.Kind() == reflect.Interface && rv.NumMethod() > 0 {
+		if !reflect.TypeOf(a).AssignableTo(rv.Type()) {
+			return oe.Errorf("can't assign %T to %v", a, rv.Type())
+		}
+		rv.Set(reflect.ValueOf(a))
+		return nil
+	}
+	if reflect.TypeOf(a) == rv.Type() {
+		rv.Set(reflect.ValueOf(a))
+		return nil
+	}
+
+	switch a.amf0Marker() {
+	case markerNull, markerUndefined:
+		switch rv.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			rv.Set(reflect.Zero(rv.Type()))
+		}
+		return nil
+	}
+
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return assign(a, rv.Elem())
+	}
+
+	if rv.Kind() == reflect.Interface {
+		v, err := goValueOf(a)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+
+	switch a := a.(type) {
+	case *Number:
+		return assignNumber(float64(*a), rv)
+	case *Boolean:
+		if rv.Kind() == reflect.Bool {
+			rv.SetBool(bool(*a))
+			return nil
+		}
+	case *String:
+		return assignString(string(*a), rv)
+	case *LongString:
+		return assignString(string(*a), rv)
+	case *XMLDocument:
+		return assignString(string(*a), rv)
+	case *Date:
+		if rv.Type() == timeType {
+			rv.Set(reflect.ValueOf(time.Time(*a)))
+			return nil
+		}
+	case *AvmPlusObject:
+		return oe.Errorf("can't assign AMF3 %T to %v", a.Value(), rv.Type())
+	}
+
+	if ob := objectOf(a); ob != nil {
+		switch rv.Kind() {
+		case reflect.Struct:
+			return assignStruct(ob, rv)
+		case reflect.Map:
+			return assignMap(ob, rv)
+		case reflect.Slice, reflect.Array:
+			return assignArray(ob, rv)
+		}
+	}
+
+	return oe.Errorf("can't assign %v to %v", a.amf0Marker(), rv.Type())
+}
+
+func assignNumber(f float64, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.OverflowInt(int64(f)) {
+			return oe.Errorf("%v overflow %v", f, rv.Type())
+		}
+		rv.SetInt(int64(f))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f < 0 || rv.OverflowUint(uint64(f)) {
+			return oe.Errorf("%v overflow %v", f, rv.Type())
+		}
+		rv.SetUint(uint64(f))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		rv.SetFloat(f)
+		return nil
+	}
+	return oe.Errorf("can't assign Number to %v", rv.Type())
+}
+
+func assignString(s string, rv reflect.Value) error {
+	if rv.Kind() != reflect.String {
+		return oe.Errorf("can't assign String to %v", rv.Type())
+	}
+	rv.SetString(s)
+	return nil
+}
+
+func assignStruct(ob *objectBase, rv reflect.Value) error {
+	fields := fieldsOf(rv.Type())
+	for _, p := range ob.copyProperties() {
+		key := string(p.key)
+
+		var f *field
+		for _, v := range fields {
+			if v.name == key {
+				f = v
+				break
+			}
+			if f == nil && strings.EqualFold(v.name, key) {
+				f = v
+			}
+		}
+		if f == nil {
+			continue
+		}
+
+		if err := assign(p.value, rv.FieldByIndex(f.index)); err != nil {
+			return oe.WithMessage(err, key)
+		}
+	}
+	return nil
+}
+
+func assignMap(ob *objectBase, rv reflect.Value) error {
+	if rv.Type().Key().Kind() != reflect.String {
+		return oe.Errorf("unsupported map key %v", rv.Type().Key())
+	}
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(rv.Type()))
+	}
+
+	for _, p := range ob.copyProperties() {
+		ev := reflect.New(rv.Type().Elem()).Elem()
+		if err := assign(p.value, ev); err != nil {
+			return oe.WithMessage(err, string(p.key))
+		}
+		rv.SetMapIndex(reflect.ValueOf(string(p.key)).Convert(rv.Type().Key()), ev)
+	}
+	return nil
+}
+
+func assignArray(ob *objectBase, rv reflect.Value) error {
+	properties := ob.copyProperties()
+
+	if rv.Kind() == reflect.Slice {
+		rv.Set(reflect.MakeSlice(rv.Type(), len(properties), len(properties)))
+	} else if len(properties) > rv.Len() {
+		return oe.Errorf("%v elems overflow %v", len(properties), rv.Type())
+	}
+
+	for i, p := range properties {
+		if err := assign(p.value, rv.Index(i)); err != nil {
+			return oe.WithMessage(err, string(p.key))
+		}
+	}
+	return nil
+}
+
+// Convert a to the Go value for interface{}.
+func goValueOf(a Amf0) (interface{}, error) {
+	switch a := a.(type) {
+	case *Number:
+		return float64(*a), nil
+	case *Boolean:
+		return bool(*a), nil
+	case *String:
+		return string(*a), nil
+	case *LongString:
+		return string(*a), nil
+	case *XMLDocument:
+		return string(*a), nil
+	case *Date:
+		return time.Time(*a), nil
+	case *StrictArray:
+		var v []interface{}
+		err := assign(a, reflect.ValueOf(&v).Elem())
+		return v, err
+	}
+
+	if objectOf(a) != nil {
+		var v map[string]interface{}
+		err := assign(a, reflect.ValueOf(&v).Elem())
+		return v, err
+	}
+
+	// For other types, such as reference, use the AMF0 object.
+	return a, nil
+}
@@ -0,0 +1,242 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package amf0
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockConnectArgs struct {
+	App            string  `amf0:"app"`
+	TcURL          string  `amf0:"tcUrl"`
+	Fpad           bool    `amf0:"fpad"`
+	AudioCodecs    float64 `amf0:"audioCodecs,omitempty"`
+	ObjectEncoding int     `amf0:"objectEncoding"`
+	Ignored        string  `amf0:"-"`
+	ignored        string
+}
+
+func TestMarshal_Struct(t *testing.T) {
+	v := &mockConnectArgs{App: "live", TcURL: "rtmp://localhost/live", Ignored: "x", ignored: "y"}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+
+	o := NewObject()
+	o.Set("app", NewString("live"))
+	o.Set("tcUrl", NewString("rtmp://localhost/live"))
+	o.Set("fpad", NewBoolean(false))
+	o.Set("objectEncoding", NewNumber(0))
+	if eb, err := o.MarshalBinary(); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if !bytes.Equal(b, eb) {
+		t.Errorf("invalid data %v, expect %v", b, eb)
+	}
+
+	var nv mockConnectArgs
+	if err = Unmarshal(b, &nv); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	} else if nv.App != v.App || nv.TcURL != v.TcURL || nv.Ignored != "" || nv.ignored != "" {
+		t.Errorf("invalid value %+v", nv)
+	}
+}
+
+type mockEmbedded struct {
+	Width int `amf0:"width"`
+}
+
+type mockMetadata struct {
+	mockEmbedded
+	Duration     time.Duration          `amf0:"duration"`
+	CreationDate time.Time              `amf0:"creationdate"`
+	Encoder      *string                `amf0:"encoder,omitempty"`
+	Tracks       []string               `amf0:"tracks"`
+	Size         [2]uint16              `amf0:"size"`
+	Extra        map[string]interface{} `amf0:"extra"`
+	Raw          Amf0                   `amf0:"raw"`
+	Nested       *mockEmbedded          `amf0:"nested"`
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	encoder := "oryx"
+	v := &mockMetadata{
+		Duration:     100,
+		CreationDate: time.Unix(1500000000, 0),
+		Encoder:      &encoder,
+		Tracks:       []string{"video", "audio"},
+		Size:         [2]uint16{1280, 720},
+		Extra:        map[string]interface{}{"b": true, "n": 1.5, "s": "x", "l": []interface{}{"y"}},
+		Raw:          NewLongString("long"),
+		Nested:       &mockEmbedded{Width: 10},
+	}
+	v.Width = 1920
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+
+	var nv mockMetadata
+	if err = Unmarshal(b, &nv); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+
+	if !reflect.DeepEqual(v, &nv) {
+		t.Errorf("invalid value %+v, expect %+v", nv, *v)
+	}
+}
+
+func TestMarshal_LongString(t *testing.T) {
+	type mockLongString struct {
+		S string `amf0:"s"`
+		N int    `amf0:"n"`
+	}
+
+	// The String for 64KB-1, and LongString for larger.
+	for _, e := range []struct {
+		size   int
+		marker marker
+	}{
+		{65535, markerString},
+		{65536, markerLongString},
+	} {
+		v := &mockLongString{S: strings.Repeat("x", e.size), N: 1}
+
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal failed %+v", err)
+		}
+		// The object marker, the key size and "s", then the value marker.
+		if m := marker(b[4]); m != e.marker {
+			t.Errorf("invalid marker %v of %v", m, e.size)
+		}
+
+		var nv mockLongString
+		if err = Unmarshal(b, &nv); err != nil {
+			t.Fatalf("unmarshal failed %+v", err)
+		}
+		if len(nv.S) != e.size || nv.N != 1 {
+			t.Errorf("invalid value %v %v of %v", len(nv.S), nv.N, e.size)
+		}
+	}
+}
+
+func TestMarshal_Slice(t *testing.T) {
+	b, err := Marshal([]int{1, 2})
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+
+	// The slice is encoded as strict array of values.
+	expect := []byte{10, 0, 0, 0, 2, 0, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("invalid data %v, expect %v", b, expect)
+	}
+
+	var v []int
+	if err = Unmarshal(b, &v); err != nil || !reflect.DeepEqual(v, []int{1, 2}) {
+		t.Errorf("invalid %v %+v", v, err)
+	}
+
+	var i interface{}
+	if err = Unmarshal(b, &i); err != nil || !reflect.DeepEqual(i, []interface{}{float64(1), float64(2)}) {
+		t.Errorf("invalid %v %+v", i, err)
+	}
+}
+
+func TestUnmarshal_Types(t *testing.T) {
+	var f float32
+	if err := Assign(NewNumber(1.5), &f); err != nil || f != 1.5 {
+		t.Errorf("invalid %v %+v", f, err)
+	}
+
+	var i8 int8
+	if err := Assign(NewNumber(128), &i8); err == nil {
+		t.Error("should overflow")
+	}
+
+	var u uint
+	if err := Assign(NewNumber(-1), &u); err == nil {
+		t.Error("should overflow")
+	}
+
+	var s string
+	if err := Assign(NewXMLDocument("<a/>"), &s); err != nil || s != "<a/>" {
+		t.Errorf("invalid %v %+v", s, err)
+	}
+	if err := Assign(NewNumber(1), &s); err == nil {
+		t.Error("should error")
+	}
+
+	p := &s
+	if err := Assign(NewNull(), &p); err != nil || p != nil {
+		t.Errorf("invalid %v %+v", p, err)
+	}
+
+	var a Amf0
+	if err := Assign(NewString("v"), &a); err != nil {
+		t.Errorf("assign failed %+v", err)
+	} else if v, ok := a.(*String); !ok || *v != "v" {
+		t.Errorf("invalid %v", a)
+	}
+
+	var arr []int
+	sa := NewStrictArray()
+	sa.Set("0", NewNumber(1))
+	sa.Set("1", NewNumber(2))
+	if err := Assign(sa, &arr); err != nil || !reflect.DeepEqual(arr, []int{1, 2}) {
+		t.Errorf("invalid %v %+v", arr, err)
+	}
+
+	var small [1]int
+	if err := Assign(sa, &small); err == nil {
+		t.Error("should overflow")
+	}
+
+	var m map[string]string
+	to := NewTypedObject("T")
+	to.Set("k", NewString("v"))
+	if err := Assign(to, &m); err != nil || m["k"] != "v" {
+		t.Errorf("invalid %v %+v", m, err)
+	}
+
+	if err := Assign(NewNumber(1), m); err == nil {
+		t.Error("should require pointer")
+	}
+}
+
+func TestMarshal_Unsupported(t *testing.T) {
+	if _, err := Marshal(make(chan int)); err == nil {
+		t.Error("should error")
+	}
+	if _, err := Marshal(map[int]string{1: "v"}); err == nil {
+		t.Error("should error")
+	}
+	if b, err := Marshal(nil); err != nil || !bytes.Equal(b, []byte{5}) {
+		t.Errorf("invalid %v %+v", b, err)
+	}
+}
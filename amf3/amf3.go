@@ -0,0 +1,1233 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx amf3 package support AMF3 codec.
+// Because the AMF3 uses reference tables for strings, objects and traits, we use the Encoder
+// and Decoder to hold the tables, while the MarshalBinary and UnmarshalBinary of each value
+// always use a fresh context.
+package amf3
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Please read @doc amf3_spec_121207.pdf, @section 3.1 Overview
+type marker uint8
+
+const (
+	markerUndefined    marker = iota // 0
+	markerNull                       // 1
+	markerFalse                      // 2
+	markerTrue                       // 3
+	markerInteger                    // 4
+	markerDouble                     // 5
+	markerString                     // 6
+	markerXMLDocument                // 7
+	markerDate                       // 8
+	markerArray                      // 9
+	markerObject                     // 10
+	markerXML                        // 11
+	markerByteArray                  // 12
+	markerVectorInt                  // 13
+	markerVectorUint                 // 14
+	markerVectorDouble               // 15
+	markerVectorObject               // 16
+	markerDictionary                 // 17
+)
+
+func (v marker) String() string {
+	switch v {
+	case markerUndefined:
+		return "Undefined"
+	case markerNull:
+		return "Null"
+	case markerFalse:
+		return "False"
+	case markerTrue:
+		return "True"
+	case markerInteger:
+		return "Integer"
+	case markerDouble:
+		return "Double"
+	case markerString:
+		return "String"
+	case markerXMLDocument:
+		return "XMLDocument"
+	case markerDate:
+		return "Date"
+	case markerArray:
+		return "Array"
+	case markerObject:
+		return "Object"
+	case markerXML:
+		return "XML"
+	case markerByteArray:
+		return "ByteArray"
+	case markerVectorInt:
+		return "VectorInt"
+	case markerVectorUint:
+		return "VectorUint"
+	case markerVectorDouble:
+		return "VectorDouble"
+	case markerVectorObject:
+		return "VectorObject"
+	case markerDictionary:
+		return "Dictionary"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The range of AMF3 integer, which is 29bits signed integer.
+const (
+	minInteger = -0x10000000
+	maxInteger = 0x0fffffff
+)
+
+// The max value of U29.
+const maxU29 = 0x1fffffff
+
+// All AMF3 things.
+type Amf3 interface {
+	// Binary marshaler and unmarshaler, with fresh reference tables.
+	encoding.BinaryUnmarshaler
+	encoding.BinaryMarshaler
+	// Get the size of bytes to marshal this object.
+	Size() int
+
+	// Get the Marker of any AMF3 stuff.
+	amf3Marker() marker
+	// Encode or decode the AMF3 stuff with marker, in the context of reference tables.
+	encode(e *Encoder) error
+	decode(d *Decoder) error
+}
+
+// Discovery the amf3 object from the bytes b.
+func Discovery(p []byte) (a Amf3, err error) {
+	if len(p) < 1 {
+		return nil, oe.Errorf("require 1 bytes only %v", len(p))
+	}
+	m := marker(p[0])
+
+	switch m {
+	case markerUndefined:
+		return NewUndefined(), nil
+	case markerNull:
+		return NewNull(), nil
+	case markerFalse, markerTrue:
+		return NewBoolean(false), nil
+	case markerInteger:
+		return NewInteger(0), nil
+	case markerDouble:
+		return NewDouble(0), nil
+	case markerString:
+		return NewString(""), nil
+	case markerXMLDocument:
+		return NewXMLDocument(""), nil
+	case markerDate:
+		return NewDate(time.Unix(0, 0)), nil
+	case markerArray:
+		return NewArray(), nil
+	case markerObject:
+		return NewObject(), nil
+	case markerXML:
+		return NewXML(""), nil
+	case markerByteArray:
+		return NewByteArray(nil), nil
+	case markerVectorInt, markerVectorUint, markerVectorDouble, markerVectorObject, markerDictionary:
+		return nil, oe.Errorf("Marker %v is not supported", m)
+	}
+	return nil, oe.Errorf("Marker %v is invalid", m)
+}
+
+// Marshal the a with fresh reference tables.
+func marshal(a Amf3) (data []byte, err error) {
+	e := NewEncoder()
+	if err = e.Encode(a); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// Get the size of a, marshaled with fresh reference tables.
+func sizeOf(a Amf3) int {
+	if b, err := marshal(a); err == nil {
+		return len(b)
+	}
+	return 0
+}
+
+// The size of U29 in bytes.
+func sizeOfU29(n uint32) int {
+	switch {
+	case n < 0x80:
+		return 1
+	case n < 0x4000:
+		return 2
+	case n < 0x200000:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// The traits of object, please read @doc amf3_spec_121207.pdf, @section 3.12 Object Type
+type traits struct {
+	className      string
+	dynamic        bool
+	externalizable bool
+	sealed         []string
+}
+
+// The key to identify the traits, for encoder to reference the same traits.
+func (v *traits) key() string {
+	return fmt.Sprintf("%v|%v|%v", v.className, v.dynamic, strings.Join(v.sealed, "|"))
+}
+
+// The AMF3 encoder, with the reference tables of strings, objects and traits.
+type Encoder struct {
+	b       *bytes.Buffer
+	strings map[string]int
+	objects map[Amf3]int
+	traits  map[string]int
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{
+		b:       &bytes.Buffer{},
+		strings: make(map[string]int),
+		objects: make(map[Amf3]int),
+		traits:  make(map[string]int),
+	}
+}
+
+// Get the encoded bytes.
+func (v *Encoder) Bytes() []byte {
+	return v.b.Bytes()
+}
+
+// Encode the a, which maybe encoded as reference if encoded before.
+func (v *Encoder) Encode(a Amf3) (err error) {
+	if err = a.encode(v); err != nil {
+		return oe.WithMessage(err, fmt.Sprintf("encode %v", a.amf3Marker()))
+	}
+	return
+}
+
+// Please read @doc amf3_spec_121207.pdf, @section 1.3.1 Variable Length Unsigned 29-bit Integer Encoding
+func (v *Encoder) writeU29(n uint32) (err error) {
+	switch {
+	case n < 0x80:
+		v.b.WriteByte(byte(n))
+	case n < 0x4000:
+		v.b.Write([]byte{byte(n>>7 | 0x80), byte(n & 0x7f)})
+	case n < 0x200000:
+		v.b.Write([]byte{byte(n>>14 | 0x80), byte(n>>7 | 0x80), byte(n & 0x7f)})
+	case n <= maxU29:
+		v.b.Write([]byte{byte(n>>22 | 0x80), byte(n>>15 | 0x80), byte(n>>8 | 0x80), byte(n)})
+	default:
+		return oe.Errorf("U29 %v overflow", n)
+	}
+	return
+}
+
+// Write the UTF-8-vr, the empty string is never sent by reference.
+func (v *Encoder) writeString(s string) (err error) {
+	if s == "" {
+		return v.writeU29(0x01)
+	}
+
+	if index, ok := v.strings[s]; ok {
+		return v.writeU29(uint32(index) << 1)
+	}
+	v.strings[s] = len(v.strings)
+
+	if err = v.writeU29(uint32(len(s))<<1 | 0x01); err != nil {
+		return oe.WithMessage(err, "string length")
+	}
+	v.b.WriteString(s)
+
+	return
+}
+
+// Write the marker, then the reference if a is in the object table,
+// otherwise, add a to the table and return false.
+func (v *Encoder) writeReference(m marker, a Amf3) (ok bool, err error) {
+	v.b.WriteByte(byte(m))
+
+	var index int
+	if index, ok = v.objects[a]; ok {
+		return true, v.writeU29(uint32(index) << 1)
+	}
+	v.objects[a] = len(v.objects)
+
+	return false, nil
+}
+
+// The AMF3 decoder, with the reference tables of strings, objects and traits.
+type Decoder struct {
+	p       []byte
+	strings []string
+	objects []Amf3
+	traits  []*traits
+}
+
+func NewDecoder(p []byte) *Decoder {
+	return &Decoder{p: p}
+}
+
+// The number of bytes of the unread portion.
+func (v *Decoder) Len() int {
+	return len(v.p)
+}
+
+// Decode an AMF3 object, which maybe a reference to the object decoded before.
+func (v *Decoder) Decode() (a Amf3, err error) {
+	if a, err = Discovery(v.p); err != nil {
+		return nil, oe.WithMessage(err, "discovery")
+	}
+
+	switch a.amf3Marker() {
+	case markerXMLDocument, markerDate, markerArray, markerObject, markerXML, markerByteArray:
+		var ref Amf3
+		if ref, err = v.readReference(); err != nil {
+			return nil, oe.WithMessage(err, "reference")
+		} else if ref != nil {
+			return ref, nil
+		}
+	}
+
+	if err = a.decode(v); err != nil {
+		return nil, oe.WithMessage(err, fmt.Sprintf("decode %v", a.amf3Marker()))
+	}
+	return
+}
+
+func (v *Decoder) readByte() (b byte, err error) {
+	if len(v.p) < 1 {
+		return 0, oe.Errorf("require 1 bytes only %v", len(v.p))
+	}
+	b, v.p = v.p[0], v.p[1:]
+	return
+}
+
+func (v *Decoder) readBytes(n int) (b []byte, err error) {
+	if len(v.p) < n {
+		return nil, oe.Errorf("require %v bytes only %v", n, len(v.p))
+	}
+	b, v.p = v.p[:n], v.p[n:]
+	return
+}
+
+func (v *Decoder) readMarker(expect marker) (err error) {
+	var b byte
+	if b, err = v.readByte(); err != nil {
+		return oe.WithMessage(err, "marker")
+	}
+	if m := marker(b); m != expect {
+		return oe.Errorf("%v marker %v is illegal", expect, m)
+	}
+	return
+}
+
+// Please read @doc amf3_spec_121207.pdf, @section 1.3.1 Variable Length Unsigned 29-bit Integer Encoding
+func (v *Decoder) readU29() (n uint32, err error) {
+	for i := 0; i < 4; i++ {
+		var b byte
+		if b, err = v.readByte(); err != nil {
+			return 0, oe.WithMessage(err, "U29")
+		}
+
+		// The last byte use all 8bits.
+		if i == 3 {
+			return n<<8 | uint32(b), nil
+		}
+
+		n = n<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return
+}
+
+// Read the UTF-8-vr, which maybe a reference to the string table.
+func (v *Decoder) readString() (s string, err error) {
+	var h uint32
+	if h, err = v.readU29(); err != nil {
+		return "", oe.WithMessage(err, "string header")
+	}
+
+	if h&0x01 == 0 {
+		index := int(h >> 1)
+		if index >= len(v.strings) {
+			return "", oe.Errorf("string reference %v overflow %v", index, len(v.strings))
+		}
+		return v.strings[index], nil
+	}
+
+	var b []byte
+	if b, err = v.readBytes(int(h >> 1)); err != nil {
+		return "", oe.WithMessage(err, "string")
+	}
+
+	if s = string(b); s != "" {
+		v.strings = append(v.strings, s)
+	}
+	return
+}
+
+// Peek the marker and U29 header, return the object if it's a reference, or nil if not.
+func (v *Decoder) readReference() (a Amf3, err error) {
+	p := v.p
+	defer func() {
+		if a == nil {
+			v.p = p
+		}
+	}()
+
+	if _, err = v.readByte(); err != nil {
+		return nil, oe.WithMessage(err, "marker")
+	}
+
+	var h uint32
+	if h, err = v.readU29(); err != nil {
+		return nil, oe.WithMessage(err, "header")
+	}
+	if h&0x01 != 0 {
+		return nil, nil
+	}
+
+	index := int(h >> 1)
+	if index >= len(v.objects) {
+		return nil, oe.Errorf("object reference %v overflow %v", index, len(v.objects))
+	}
+	return v.objects[index], nil
+}
+
+// Read the marker and U29 header of object which is not a reference.
+func (v *Decoder) readHeader(expect marker) (h uint32, err error) {
+	if err = v.readMarker(expect); err != nil {
+		return 0, err
+	}
+
+	if h, err = v.readU29(); err != nil {
+		return 0, oe.WithMessage(err, "header")
+	}
+	if h&0x01 == 0 {
+		return 0, oe.Errorf("%v reference %v is not allowed", expect, h>>1)
+	}
+	return
+}
+
+// The single marker object, for all AMF3 which only has the marker, like null and undefined.
+type singleMarkerObject struct {
+	target marker
+}
+
+func newSingleMarkerObject(m marker) singleMarkerObject {
+	return singleMarkerObject{target: m}
+}
+
+func (v *singleMarkerObject) amf3Marker() marker {
+	return v.target
+}
+
+func (v *singleMarkerObject) Size() int {
+	return int(1)
+}
+
+func (v *singleMarkerObject) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *singleMarkerObject) MarshalBinary() (data []byte, err error) {
+	return []byte{byte(v.target)}, nil
+}
+
+func (v *singleMarkerObject) encode(e *Encoder) (err error) {
+	return e.b.WriteByte(byte(v.target))
+}
+
+func (v *singleMarkerObject) decode(d *Decoder) (err error) {
+	return d.readMarker(v.target)
+}
+
+// The AMF3 undefined, please read @doc amf3_spec_121207.pdf, @section 3.2 undefined Type
+type undefined struct {
+	singleMarkerObject
+}
+
+func NewUndefined() Amf3 {
+	v := undefined{}
+	v.singleMarkerObject = newSingleMarkerObject(markerUndefined)
+	return &v
+}
+
+// The AMF3 null, please read @doc amf3_spec_121207.pdf, @section 3.3 null Type
+type null struct {
+	singleMarkerObject
+}
+
+func NewNull() Amf3 {
+	v := null{}
+	v.singleMarkerObject = newSingleMarkerObject(markerNull)
+	return &v
+}
+
+// The AMF3 boolean, please read @doc amf3_spec_121207.pdf, @section 3.4 false Type and 3.5 true Type
+type Boolean bool
+
+func NewBoolean(b bool) *Boolean {
+	v := Boolean(b)
+	return &v
+}
+
+func (v *Boolean) amf3Marker() marker {
+	if *v {
+		return markerTrue
+	}
+	return markerFalse
+}
+
+func (v *Boolean) Size() int {
+	return int(1)
+}
+
+func (v *Boolean) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *Boolean) MarshalBinary() (data []byte, err error) {
+	return []byte{byte(v.amf3Marker())}, nil
+}
+
+func (v *Boolean) encode(e *Encoder) (err error) {
+	return e.b.WriteByte(byte(v.amf3Marker()))
+}
+
+func (v *Boolean) decode(d *Decoder) (err error) {
+	var b byte
+	if b, err = d.readByte(); err != nil {
+		return oe.WithMessage(err, "marker")
+	}
+
+	switch m := marker(b); m {
+	case markerFalse:
+		*v = false
+	case markerTrue:
+		*v = true
+	default:
+		return oe.Errorf("Boolean marker %v is illegal", m)
+	}
+	return
+}
+
+// The AMF3 integer, please read @doc amf3_spec_121207.pdf, @section 3.6 integer Type
+// @remark The value must be in 29bits signed integer, use Double for others.
+type Integer int32
+
+func NewInteger(n int32) *Integer {
+	v := Integer(n)
+	return &v
+}
+
+func (v *Integer) amf3Marker() marker {
+	return markerInteger
+}
+
+func (v *Integer) Size() int {
+	return 1 + sizeOfU29(uint32(*v)&maxU29)
+}
+
+func (v *Integer) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *Integer) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *Integer) encode(e *Encoder) (err error) {
+	if *v < minInteger || *v > maxInteger {
+		return oe.Errorf("Integer %v overflow, should use Double", int32(*v))
+	}
+
+	e.b.WriteByte(byte(markerInteger))
+	return e.writeU29(uint32(*v) & maxU29)
+}
+
+func (v *Integer) decode(d *Decoder) (err error) {
+	if err = d.readMarker(markerInteger); err != nil {
+		return err
+	}
+
+	var n uint32
+	if n, err = d.readU29(); err != nil {
+		return oe.WithMessage(err, "integer")
+	}
+
+	// Sign extend the 29bits integer.
+	if n&0x10000000 != 0 {
+		*v = Integer(int32(n) - 0x20000000)
+	} else {
+		*v = Integer(n)
+	}
+	return
+}
+
+// The AMF3 double, please read @doc amf3_spec_121207.pdf, @section 3.7 double Type
+type Double float64
+
+func NewDouble(f float64) *Double {
+	v := Double(f)
+	return &v
+}
+
+func (v *Double) amf3Marker() marker {
+	return markerDouble
+}
+
+func (v *Double) Size() int {
+	return 1 + 8
+}
+
+func (v *Double) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *Double) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *Double) encode(e *Encoder) (err error) {
+	e.b.WriteByte(byte(markerDouble))
+	return binary.Write(e.b, binary.BigEndian, math.Float64bits(float64(*v)))
+}
+
+func (v *Double) decode(d *Decoder) (err error) {
+	if err = d.readMarker(markerDouble); err != nil {
+		return err
+	}
+
+	var b []byte
+	if b, err = d.readBytes(8); err != nil {
+		return oe.WithMessage(err, "double")
+	}
+	*v = Double(math.Float64frombits(binary.BigEndian.Uint64(b)))
+	return
+}
+
+// The AMF3 string, please read @doc amf3_spec_121207.pdf, @section 3.8 String Type
+type String string
+
+func NewString(s string) *String {
+	v := String(s)
+	return &v
+}
+
+func (v *String) amf3Marker() marker {
+	return markerString
+}
+
+func (v *String) Size() int {
+	return sizeOf(v)
+}
+
+func (v *String) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *String) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *String) encode(e *Encoder) (err error) {
+	e.b.WriteByte(byte(markerString))
+	return e.writeString(string(*v))
+}
+
+func (v *String) decode(d *Decoder) (err error) {
+	if err = d.readMarker(markerString); err != nil {
+		return err
+	}
+
+	var s string
+	if s, err = d.readString(); err != nil {
+		return oe.WithMessage(err, "string")
+	}
+	*v = String(s)
+	return
+}
+
+// The XML string, for XMLDocument and XML, which is in the object table.
+type xmlString struct {
+	target marker
+	value  string
+}
+
+func (v *xmlString) encode(e *Encoder, a Amf3) (err error) {
+	var ok bool
+	if ok, err = e.writeReference(v.target, a); err != nil || ok {
+		return err
+	}
+
+	if err = e.writeU29(uint32(len(v.value))<<1 | 0x01); err != nil {
+		return oe.WithMessage(err, "length")
+	}
+	e.b.WriteString(v.value)
+	return
+}
+
+func (v *xmlString) decode(d *Decoder, a Amf3) (err error) {
+	var h uint32
+	if h, err = d.readHeader(v.target); err != nil {
+		return err
+	}
+
+	var b []byte
+	if b, err = d.readBytes(int(h >> 1)); err != nil {
+		return oe.WithMessage(err, "xml")
+	}
+	v.value = string(b)
+	d.objects = append(d.objects, a)
+	return
+}
+
+// The AMF3 XML document, please read @doc amf3_spec_121207.pdf, @section 3.9 XMLDocument Type
+type XMLDocument string
+
+func NewXMLDocument(s string) *XMLDocument {
+	v := XMLDocument(s)
+	return &v
+}
+
+func (v *XMLDocument) amf3Marker() marker {
+	return markerXMLDocument
+}
+
+func (v *XMLDocument) Size() int {
+	return sizeOf(v)
+}
+
+func (v *XMLDocument) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *XMLDocument) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *XMLDocument) encode(e *Encoder) (err error) {
+	x := &xmlString{target: markerXMLDocument, value: string(*v)}
+	return x.encode(e, v)
+}
+
+func (v *XMLDocument) decode(d *Decoder) (err error) {
+	x := &xmlString{target: markerXMLDocument}
+	if err = x.decode(d, v); err != nil {
+		return err
+	}
+	*v = XMLDocument(x.value)
+	return
+}
+
+// The AMF3 XML, please read @doc amf3_spec_121207.pdf, @section 3.13 XML Type
+type XML string
+
+func NewXML(s string) *XML {
+	v := XML(s)
+	return &v
+}
+
+func (v *XML) amf3Marker() marker {
+	return markerXML
+}
+
+func (v *XML) Size() int {
+	return sizeOf(v)
+}
+
+func (v *XML) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *XML) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *XML) encode(e *Encoder) (err error) {
+	x := &xmlString{target: markerXML, value: string(*v)}
+	return x.encode(e, v)
+}
+
+func (v *XML) decode(d *Decoder) (err error) {
+	x := &xmlString{target: markerXML}
+	if err = x.decode(d, v); err != nil {
+		return err
+	}
+	*v = XML(x.value)
+	return
+}
+
+// The AMF3 date, please read @doc amf3_spec_121207.pdf, @section 3.10 Date Type
+// @remark The date is in milliseconds, without timezone.
+type Date time.Time
+
+func NewDate(t time.Time) *Date {
+	v := Date(t)
+	return &v
+}
+
+func (v *Date) amf3Marker() marker {
+	return markerDate
+}
+
+func (v *Date) Size() int {
+	return sizeOf(v)
+}
+
+func (v *Date) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *Date) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *Date) encode(e *Encoder) (err error) {
+	var ok bool
+	if ok, err = e.writeReference(markerDate, v); err != nil || ok {
+		return err
+	}
+
+	if err = e.writeU29(0x01); err != nil {
+		return oe.WithMessage(err, "header")
+	}
+
+	ms := float64(time.Time(*v).UnixNano()) / float64(time.Millisecond)
+	return binary.Write(e.b, binary.BigEndian, math.Float64bits(ms))
+}
+
+func (v *Date) decode(d *Decoder) (err error) {
+	if _, err = d.readHeader(markerDate); err != nil {
+		return err
+	}
+
+	var b []byte
+	if b, err = d.readBytes(8); err != nil {
+		return oe.WithMessage(err, "date")
+	}
+
+	ms := math.Float64frombits(binary.BigEndian.Uint64(b))
+	msi := math.Floor(ms)
+	*v = Date(time.Unix(0, int64(msi)*int64(time.Millisecond)+int64(math.Floor((ms-msi)*1e6+0.5))))
+	d.objects = append(d.objects, v)
+	return
+}
+
+// The AMF3 byte array, please read @doc amf3_spec_121207.pdf, @section 3.14 ByteArray Type
+type ByteArray []byte
+
+func NewByteArray(b []byte) *ByteArray {
+	v := ByteArray(b)
+	return &v
+}
+
+func (v *ByteArray) amf3Marker() marker {
+	return markerByteArray
+}
+
+func (v *ByteArray) Size() int {
+	return sizeOf(v)
+}
+
+func (v *ByteArray) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *ByteArray) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *ByteArray) encode(e *Encoder) (err error) {
+	var ok bool
+	if ok, err = e.writeReference(markerByteArray, v); err != nil || ok {
+		return err
+	}
+
+	if err = e.writeU29(uint32(len(*v))<<1 | 0x01); err != nil {
+		return oe.WithMessage(err, "length")
+	}
+	e.b.Write([]byte(*v))
+	return
+}
+
+func (v *ByteArray) decode(d *Decoder) (err error) {
+	var h uint32
+	if h, err = d.readHeader(markerByteArray); err != nil {
+		return err
+	}
+
+	var b []byte
+	if b, err = d.readBytes(int(h >> 1)); err != nil {
+		return oe.WithMessage(err, "bytes")
+	}
+	*v = ByteArray(append([]byte{}, b...))
+	d.objects = append(d.objects, v)
+	return
+}
+
+// Use array for object and associative array, to keep the original order.
+type property struct {
+	key   string
+	value Amf3
+}
+
+// The object-like AMF3 structure, like object and associative portion of array.
+type objectBase struct {
+	properties []*property
+	lock       sync.Mutex
+}
+
+func (v *objectBase) Get(key string) Amf3 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for _, p := range v.properties {
+		if p.key == key {
+			return p.value
+		}
+	}
+
+	return nil
+}
+
+func (v *objectBase) Set(key string, value Amf3) *objectBase {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	prop := &property{key: key, value: value}
+
+	for i, p := range v.properties {
+		if p.key == key {
+			v.properties[i] = prop
+			return v
+		}
+	}
+
+	v.properties = append(v.properties, prop)
+	return v
+}
+
+// Get the keys, in the original order.
+func (v *objectBase) Keys() (keys []string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for _, p := range v.properties {
+		keys = append(keys, p.key)
+	}
+	return
+}
+
+// Encode the name-value pairs, except the names in excludes, then the empty string to end.
+func (v *objectBase) encodePairs(e *Encoder, excludes []string) (err error) {
+	for _, key := range v.Keys() {
+		if key == "" || contains(excludes, key) {
+			continue
+		}
+
+		if err = e.writeString(key); err != nil {
+			return oe.WithMessage(err, "key")
+		}
+		if err = e.Encode(v.Get(key)); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("value for %v", key))
+		}
+	}
+
+	return e.writeString("")
+}
+
+// Decode the name-value pairs, until the empty string.
+func (v *objectBase) decodePairs(d *Decoder) (err error) {
+	for {
+		var key string
+		if key, err = d.readString(); err != nil {
+			return oe.WithMessage(err, "key")
+		}
+		if key == "" {
+			return
+		}
+
+		var value Amf3
+		if value, err = d.Decode(); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("value for %v", key))
+		}
+		v.Set(key, value)
+	}
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// The AMF3 array, please read @doc amf3_spec_121207.pdf, @section 3.11 Array Type
+// The Get and Set is for the associative portion, while the Dense is the strict portion.
+type Array struct {
+	objectBase
+	Dense []Amf3
+}
+
+func NewArray() *Array {
+	v := &Array{}
+	v.properties = []*property{}
+	return v
+}
+
+func (v *Array) amf3Marker() marker {
+	return markerArray
+}
+
+func (v *Array) Size() int {
+	return sizeOf(v)
+}
+
+func (v *Array) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *Array) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *Array) encode(e *Encoder) (err error) {
+	var ok bool
+	if ok, err = e.writeReference(markerArray, v); err != nil || ok {
+		return err
+	}
+
+	if err = e.writeU29(uint32(len(v.Dense))<<1 | 0x01); err != nil {
+		return oe.WithMessage(err, "dense count")
+	}
+
+	if err = v.encodePairs(e, nil); err != nil {
+		return oe.WithMessage(err, "associative")
+	}
+
+	for i, a := range v.Dense {
+		if err = e.Encode(a); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("dense %v", i))
+		}
+	}
+
+	return
+}
+
+func (v *Array) decode(d *Decoder) (err error) {
+	var h uint32
+	if h, err = d.readHeader(markerArray); err != nil {
+		return err
+	}
+	// Add to table before the elements, which may reference to the array.
+	d.objects = append(d.objects, v)
+
+	if err = v.decodePairs(d); err != nil {
+		return oe.WithMessage(err, "associative")
+	}
+
+	count := int(h >> 1)
+	if count > d.Len() {
+		return oe.Errorf("dense count %v overflow %v", count, d.Len())
+	}
+
+	v.Dense = make([]Amf3, 0, count)
+	for i := 0; i < count; i++ {
+		var a Amf3
+		if a, err = d.Decode(); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("dense %v", i))
+		}
+		v.Dense = append(v.Dense, a)
+	}
+
+	return
+}
+
+// The AMF3 object, please read @doc amf3_spec_121207.pdf, @section 3.12 Object Type
+// The members in Sealed are encoded as sealed members of traits, in order, while others
+// are encoded as dynamic members when Dynamic is true.
+// @remark The externalizable object is not supported, because it depends on the class.
+type Object struct {
+	objectBase
+	// The class name of traits, empty for anonymous object.
+	ClassName string
+	// The names of sealed members.
+	Sealed []string
+	// Whether object is dynamic, which encodes the members not in Sealed.
+	Dynamic bool
+}
+
+// Create an anonymous dynamic object.
+func NewObject() *Object {
+	v := &Object{Dynamic: true}
+	v.properties = []*property{}
+	return v
+}
+
+func (v *Object) amf3Marker() marker {
+	return markerObject
+}
+
+func (v *Object) Size() int {
+	return sizeOf(v)
+}
+
+func (v *Object) UnmarshalBinary(data []byte) (err error) {
+	return v.decode(NewDecoder(data))
+}
+
+func (v *Object) MarshalBinary() (data []byte, err error) {
+	return marshal(v)
+}
+
+func (v *Object) encode(e *Encoder) (err error) {
+	var ok bool
+	if ok, err = e.writeReference(markerObject, v); err != nil || ok {
+		return err
+	}
+
+	t := &traits{className: v.ClassName, dynamic: v.Dynamic, sealed: v.Sealed}
+	if index, ok := e.traits[t.key()]; ok {
+		// U29O-traits-ref, the low 2bits are 01.
+		if err = e.writeU29(uint32(index)<<2 | 0x01); err != nil {
+			return oe.WithMessage(err, "traits reference")
+		}
+	} else {
+		e.traits[t.key()] = len(e.traits)
+
+		// U29O-traits, the low 4bits are 0011 or 1011 for dynamic.
+		h := uint32(len(t.sealed))<<4 | 0x03
+		if t.dynamic {
+			h |= 0x08
+		}
+		if err = e.writeU29(h); err != nil {
+			return oe.WithMessage(err, "traits")
+		}
+
+		if err = e.writeString(t.className); err != nil {
+			return oe.WithMessage(err, "class name")
+		}
+		for _, name := range t.sealed {
+			if err = e.writeString(name); err != nil {
+				return oe.WithMessage(err, "sealed name")
+			}
+		}
+	}
+
+	for _, name := range v.Sealed {
+		a := v.Get(name)
+		if a == nil {
+			a = NewUndefined()
+		}
+		if err = e.Encode(a); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("sealed %v", name))
+		}
+	}
+
+	if v.Dynamic {
+		if err = v.encodePairs(e, v.Sealed); err != nil {
+			return oe.WithMessage(err, "dynamic")
+		}
+	}
+
+	return
+}
+
+func (v *Object) decode(d *Decoder) (err error) {
+	var h uint32
+	if h, err = d.readHeader(markerObject); err != nil {
+		return err
+	}
+	// Add to table before the members, which may reference to the object.
+	d.objects = append(d.objects, v)
+
+	var t *traits
+	if h&0x02 == 0 {
+		index := int(h >> 2)
+		if index >= len(d.traits) {
+			return oe.Errorf("traits reference %v overflow %v", index, len(d.traits))
+		}
+		t = d.traits[index]
+	} else {
+		t = &traits{externalizable: h&0x04 != 0, dynamic: h&0x08 != 0}
+		if t.className, err = d.readString(); err != nil {
+			return oe.WithMessage(err, "class name")
+		}
+
+		count := int(h >> 4)
+		if count > d.Len() {
+			return oe.Errorf("sealed count %v overflow %v", count, d.Len())
+		}
+		for i := 0; i < count; i++ {
+			var name string
+			if name, err = d.readString(); err != nil {
+				return oe.WithMessage(err, "sealed name")
+			}
+			t.sealed = append(t.sealed, name)
+		}
+
+		d.traits = append(d.traits, t)
+	}
+
+	if t.externalizable {
+		return oe.Errorf("externalizable %v is not supported", t.className)
+	}
+	v.ClassName, v.Dynamic, v.Sealed = t.className, t.dynamic, t.sealed
+
+	for _, name := range t.sealed {
+		var a Amf3
+		if a, err = d.Decode(); err != nil {
+			return oe.WithMessage(err, fmt.Sprintf("sealed %v", name))
+		}
+		v.Set(name, a)
+	}
+
+	if t.dynamic {
+		if err = v.decodePairs(d); err != nil {
+			return oe.WithMessage(err, "dynamic")
+		}
+	}
+
+	return
+}
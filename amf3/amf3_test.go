@@ -0,0 +1,435 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package amf3
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAmf3Marker(t *testing.T) {
+	pvs := []struct {
+		m  marker
+		ms string
+	}{
+		{markerUndefined, "Undefined"},
+		{markerNull, "Null"},
+		{markerFalse, "False"},
+		{markerTrue, "True"},
+		{markerInteger, "Integer"},
+		{markerDouble, "Double"},
+		{markerString, "String"},
+		{markerXMLDocument, "XMLDocument"},
+		{markerDate, "Date"},
+		{markerArray, "Array"},
+		{markerObject, "Object"},
+		{markerXML, "XML"},
+		{markerByteArray, "ByteArray"},
+		{markerVectorInt, "VectorInt"},
+		{markerVectorUint, "VectorUint"},
+		{markerVectorDouble, "VectorDouble"},
+		{markerVectorObject, "VectorObject"},
+		{markerDictionary, "Dictionary"},
+		{marker(0xff), "Forbidden"},
+	}
+	for _, pv := range pvs {
+		if v := pv.m.String(); v != pv.ms {
+			t.Errorf("marker %v expect %v actual %v", pv.m, pv.ms, v)
+		}
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	for _, m := range []marker{
+		markerUndefined, markerNull, markerInteger, markerDouble, markerString, markerXMLDocument,
+		markerDate, markerArray, markerObject, markerXML, markerByteArray,
+	} {
+		if a, err := Discovery([]byte{byte(m)}); err != nil {
+			t.Errorf("discovery err %+v", err)
+		} else if v := a.amf3Marker(); v != m {
+			t.Errorf("invalid %v actual %v", m, v)
+		}
+	}
+
+	for _, m := range []byte{2, 3} {
+		if a, err := Discovery([]byte{m}); err != nil {
+			t.Errorf("discovery err %+v", err)
+		} else if _, ok := a.(*Boolean); !ok {
+			t.Errorf("invalid %v actual %T", m, a)
+		}
+	}
+
+	for _, m := range []byte{13, 14, 15, 16, 17, 18, 0xff} {
+		if a, err := Discovery([]byte{m}); err == nil || a != nil {
+			t.Errorf("marker=%v should error", m)
+		}
+	}
+
+	if _, err := Discovery(nil); err == nil {
+		t.Error("should fail for empty")
+	}
+}
+
+func TestU29(t *testing.T) {
+	pvs := []struct {
+		n uint32
+		b []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x3fff, []byte{0xff, 0x7f}},
+		{0x4000, []byte{0x81, 0x80, 0x00}},
+		{0x1fffff, []byte{0xff, 0xff, 0x7f}},
+		{0x200000, []byte{0x80, 0xc0, 0x80, 0x00}},
+		{0x1fffffff, []byte{0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, pv := range pvs {
+		e := NewEncoder()
+		if err := e.writeU29(pv.n); err != nil {
+			t.Errorf("write %x failed %+v", pv.n, err)
+		} else if !bytes.Equal(e.Bytes(), pv.b) {
+			t.Errorf("write %x got %x, expect %x", pv.n, e.Bytes(), pv.b)
+		} else if sizeOfU29(pv.n) != len(pv.b) {
+			t.Errorf("size of %x is %v", pv.n, sizeOfU29(pv.n))
+		}
+
+		d := NewDecoder(pv.b)
+		if n, err := d.readU29(); err != nil {
+			t.Errorf("read %x failed %+v", pv.b, err)
+		} else if n != pv.n || d.Len() != 0 {
+			t.Errorf("read %x got %x, left %v", pv.b, n, d.Len())
+		}
+	}
+
+	if err := NewEncoder().writeU29(0x20000000); err == nil {
+		t.Error("should fail for overflow")
+	}
+	if _, err := NewDecoder([]byte{0x81, 0x80}).readU29(); err == nil {
+		t.Error("should fail for not enough")
+	}
+}
+
+func TestInteger(t *testing.T) {
+	pvs := []struct {
+		n int32
+		b []byte
+	}{
+		{0, []byte{0x04, 0x00}},
+		{1, []byte{0x04, 0x01}},
+		{-1, []byte{0x04, 0xff, 0xff, 0xff, 0xff}},
+		{maxInteger, []byte{0x04, 0xbf, 0xff, 0xff, 0xff}},
+		{minInteger, []byte{0x04, 0xc0, 0x80, 0x80, 0x00}},
+	}
+	for _, pv := range pvs {
+		v := NewInteger(pv.n)
+		if b, err := v.MarshalBinary(); err != nil {
+			t.Errorf("marshal %v failed %+v", pv.n, err)
+		} else if !bytes.Equal(b, pv.b) || v.Size() != len(b) {
+			t.Errorf("marshal %v got %x, size %v", pv.n, b, v.Size())
+		}
+
+		var n Integer
+		if err := n.UnmarshalBinary(pv.b); err != nil {
+			t.Errorf("unmarshal %x failed %+v", pv.b, err)
+		} else if int32(n) != pv.n {
+			t.Errorf("unmarshal %x got %v, expect %v", pv.b, n, pv.n)
+		}
+	}
+
+	for _, n := range []int32{maxInteger + 1, minInteger - 1} {
+		if _, err := NewInteger(n).MarshalBinary(); err == nil {
+			t.Errorf("should fail for %v", n)
+		}
+	}
+}
+
+func TestSimpleTypes(t *testing.T) {
+	pvs := []struct {
+		a Amf3
+		b []byte
+	}{
+		{NewUndefined(), []byte{0x00}},
+		{NewNull(), []byte{0x01}},
+		{NewBoolean(false), []byte{0x02}},
+		{NewBoolean(true), []byte{0x03}},
+		{NewDouble(1.5), []byte{0x05, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{NewString(""), []byte{0x06, 0x01}},
+		{NewString("hello"), []byte{0x06, 0x0b, 'h', 'e', 'l', 'l', 'o'}},
+		{NewXMLDocument("<a/>"), []byte{0x07, 0x09, '<', 'a', '/', '>'}},
+		{NewXML("<a/>"), []byte{0x0b, 0x09, '<', 'a', '/', '>'}},
+		{NewByteArray([]byte{1, 2, 3}), []byte{0x0c, 0x07, 1, 2, 3}},
+		{NewDate(time.Unix(1, 0)), []byte{0x08, 0x01, 0x40, 0x8f, 0x40, 0, 0, 0, 0, 0}},
+	}
+	for _, pv := range pvs {
+		b, err := pv.a.MarshalBinary()
+		if err != nil {
+			t.Errorf("marshal %v failed %+v", pv.a.amf3Marker(), err)
+			continue
+		}
+		if !bytes.Equal(b, pv.b) || pv.a.Size() != len(b) {
+			t.Errorf("marshal %v got %x, expect %x, size %v", pv.a.amf3Marker(), b, pv.b, pv.a.Size())
+		}
+
+		a, err := NewDecoder(b).Decode()
+		if err != nil {
+			t.Errorf("decode %x failed %+v", b, err)
+			continue
+		}
+		if b2, err := a.MarshalBinary(); err != nil || !bytes.Equal(b, b2) {
+			t.Errorf("round trip %x got %x, %+v", b, b2, err)
+		}
+
+		// Not enough bytes.
+		if len(b) > 1 {
+			if _, err := NewDecoder(b[:len(b)-1]).Decode(); err == nil {
+				t.Errorf("should fail for %x", b[:len(b)-1])
+			}
+		}
+	}
+
+	var d Date
+	if err := d.UnmarshalBinary([]byte{0x08, 0x01, 0x40, 0x8f, 0x40, 0, 0, 0, 0, 0}); err != nil {
+		t.Errorf("unmarshal date failed %+v", err)
+	} else if !time.Time(d).Equal(time.Unix(1, 0)) {
+		t.Errorf("invalid date %v", time.Time(d))
+	}
+
+	var s String
+	if err := s.UnmarshalBinary([]byte{0x04, 0x00}); err == nil {
+		t.Error("should fail for invalid marker")
+	}
+}
+
+func TestStringReference(t *testing.T) {
+	arr := NewArray()
+	arr.Dense = []Amf3{NewString("a"), NewString("a"), NewString(""), NewString("")}
+
+	// The second "a" is a reference, while the empty string is never a reference.
+	expect := []byte{0x09, 0x09, 0x01, 0x06, 0x03, 'a', 0x06, 0x00, 0x06, 0x01, 0x06, 0x01}
+	if b, err := arr.MarshalBinary(); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if !bytes.Equal(b, expect) {
+		t.Errorf("marshal got %x, expect %x", b, expect)
+	}
+
+	var v Array
+	if err := v.UnmarshalBinary(expect); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if len(v.Dense) != 4 {
+		t.Fatalf("invalid dense %v", len(v.Dense))
+	}
+	for i, s := range []string{"a", "a", "", ""} {
+		if a, ok := v.Dense[i].(*String); !ok || string(*a) != s {
+			t.Errorf("invalid %v, %v", i, v.Dense[i])
+		}
+	}
+
+	// The string reference overflow.
+	if err := v.UnmarshalBinary([]byte{0x09, 0x03, 0x01, 0x06, 0x02}); err == nil {
+		t.Error("should fail for invalid reference")
+	}
+}
+
+func TestObject(t *testing.T) {
+	obj := NewObject()
+	obj.Set("a", NewInteger(1))
+
+	expect := []byte{0x0a, 0x0b, 0x01, 0x03, 'a', 0x04, 0x01, 0x01}
+	if b, err := obj.MarshalBinary(); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if !bytes.Equal(b, expect) || obj.Size() != len(b) {
+		t.Errorf("marshal got %x, expect %x", b, expect)
+	}
+
+	v := NewObject()
+	if err := v.UnmarshalBinary(expect); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if n, ok := v.Get("a").(*Integer); !ok || *n != 1 {
+		t.Errorf("invalid a %v", v.Get("a"))
+	}
+	if !v.Dynamic || v.ClassName != "" || len(v.Sealed) != 0 {
+		t.Errorf("invalid traits %v %v %v", v.Dynamic, v.ClassName, v.Sealed)
+	}
+}
+
+func TestObject_Traits(t *testing.T) {
+	newPoint := func(x, y int32) *Object {
+		v := NewObject()
+		v.ClassName, v.Sealed, v.Dynamic = "Point", []string{"x", "y"}, false
+		v.Set("x", NewInteger(x))
+		v.Set("y", NewInteger(y))
+		return v
+	}
+
+	arr := NewArray()
+	arr.Dense = []Amf3{newPoint(1, 2), newPoint(3, 4)}
+
+	expect := []byte{
+		0x09, 0x05, 0x01,
+		// The first point with traits.
+		0x0a, 0x23, 0x0b, 'P', 'o', 'i', 'n', 't', 0x03, 'x', 0x03, 'y', 0x04, 0x01, 0x04, 0x02,
+		// The second point reference the traits.
+		0x0a, 0x01, 0x04, 0x03, 0x04, 0x04,
+	}
+	if b, err := arr.MarshalBinary(); err != nil {
+		t.Errorf("marshal failed %+v", err)
+	} else if !bytes.Equal(b, expect) {
+		t.Errorf("marshal got %x, expect %x", b, expect)
+	}
+
+	var v Array
+	if err := v.UnmarshalBinary(expect); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if len(v.Dense) != 2 {
+		t.Fatalf("invalid dense %v", len(v.Dense))
+	}
+	if p, ok := v.Dense[1].(*Object); !ok {
+		t.Errorf("invalid point %T", v.Dense[1])
+	} else if p.ClassName != "Point" || p.Dynamic || len(p.Sealed) != 2 {
+		t.Errorf("invalid traits %v %v %v", p.ClassName, p.Dynamic, p.Sealed)
+	} else if y, ok := p.Get("y").(*Integer); !ok || *y != 4 {
+		t.Errorf("invalid y %v", p.Get("y"))
+	}
+
+	// The externalizable object is not supported.
+	if err := NewObject().UnmarshalBinary([]byte{0x0a, 0x07, 0x03, 'A'}); err == nil {
+		t.Error("should fail for externalizable")
+	}
+	// The traits reference overflow.
+	if err := NewObject().UnmarshalBinary([]byte{0x0a, 0x05}); err == nil {
+		t.Error("should fail for traits reference")
+	}
+}
+
+func TestObjectReference(t *testing.T) {
+	obj := NewObject()
+	obj.Set("self", obj)
+	ba := NewByteArray([]byte{0x01})
+	obj.Set("ba", ba)
+	obj.Set("ba2", ba)
+
+	b, err := obj.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+
+	expect := []byte{
+		0x0a, 0x0b, 0x01,
+		0x09, 's', 'e', 'l', 'f', 0x0a, 0x00,
+		0x05, 'b', 'a', 0x0c, 0x03, 0x01,
+		0x07, 'b', 'a', '2', 0x0c, 0x02,
+		0x01,
+	}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("marshal got %x, expect %x", b, expect)
+	}
+
+	a, err := NewDecoder(b).Decode()
+	if err != nil {
+		t.Fatalf("decode failed %+v", err)
+	}
+	v, ok := a.(*Object)
+	if !ok {
+		t.Fatalf("invalid object %T", a)
+	}
+	if v.Get("self") != Amf3(v) {
+		t.Error("self should reference to object")
+	}
+	if v.Get("ba") != v.Get("ba2") {
+		t.Error("ba2 should reference to ba")
+	}
+
+	// The reference is not allowed for top level value.
+	if err = NewObject().UnmarshalBinary([]byte{0x0a, 0x00}); err == nil {
+		t.Error("should fail for reference")
+	}
+	if _, err = NewDecoder([]byte{0x0a, 0x02}).Decode(); err == nil {
+		t.Error("should fail for reference overflow")
+	}
+}
+
+func TestArray(t *testing.T) {
+	arr := NewArray()
+	arr.Set("name", NewString("oryx"))
+	arr.Dense = []Amf3{NewDouble(2), NewNull(), NewBoolean(true)}
+
+	b, err := arr.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+	if arr.Size() != len(b) {
+		t.Errorf("invalid size %v, expect %v", arr.Size(), len(b))
+	}
+
+	var v Array
+	if err = v.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if s, ok := v.Get("name").(*String); !ok || string(*s) != "oryx" {
+		t.Errorf("invalid name %v", v.Get("name"))
+	}
+	if len(v.Dense) != 3 || v.Dense[1].amf3Marker() != markerNull || v.Dense[2].amf3Marker() != markerTrue {
+		t.Errorf("invalid dense %v", v.Dense)
+	}
+	if keys := v.Keys(); len(keys) != 1 || keys[0] != "name" {
+		t.Errorf("invalid keys %v", keys)
+	}
+
+	// The dense count overflow.
+	if err = v.UnmarshalBinary([]byte{0x09, 0xff, 0x7f, 0x01}); err == nil {
+		t.Error("should fail for dense count")
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	// The reference tables are shared by values in the same decoder.
+	e := NewEncoder()
+	s := NewString("oryx")
+	for _, a := range []Amf3{s, s, NewInteger(100)} {
+		if err := e.Encode(a); err != nil {
+			t.Fatalf("encode failed %+v", err)
+		}
+	}
+
+	expect := []byte{0x06, 0x09, 'o', 'r', 'y', 'x', 0x06, 0x00, 0x04, 0x64}
+	if !bytes.Equal(e.Bytes(), expect) {
+		t.Errorf("encode got %x, expect %x", e.Bytes(), expect)
+	}
+
+	d := NewDecoder(append(expect, 0xff))
+	for i := 0; i < 3; i++ {
+		if _, err := d.Decode(); err != nil {
+			t.Errorf("decode %v failed %+v", i, err)
+		}
+	}
+	if d.Len() != 1 {
+		t.Errorf("invalid left %v", d.Len())
+	}
+	if _, err := d.Decode(); err == nil {
+		t.Error("should fail for invalid marker")
+	}
+}
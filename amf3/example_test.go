@@ -0,0 +1,60 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package amf3_test
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/amf3"
+)
+
+func ExampleEncoder() {
+	obj := amf3.NewObject()
+	obj.Set("operation", amf3.NewInteger(5))
+	obj.Set("body", amf3.NewString("hello"))
+
+	// The same object is encoded as reference at the second time.
+	e := amf3.NewEncoder()
+	for i := 0; i < 2; i++ {
+		if err := e.Encode(obj); err != nil {
+			return
+		}
+	}
+
+	d := amf3.NewDecoder(e.Bytes())
+	for d.Len() > 0 {
+		a, err := d.Decode()
+		if err != nil {
+			return
+		}
+
+		if obj, ok := a.(*amf3.Object); ok {
+			if body, ok := obj.Get("body").(*amf3.String); ok {
+				fmt.Println(obj.Keys(), string(*body))
+			}
+		}
+	}
+
+	// Output:
+	// [operation body] hello
+	// [operation body] hello
+}
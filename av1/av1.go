@@ -0,0 +1,534 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx AV1 package includes some utilites.
+// The OBU(Open Bitstream Unit) is the unit of AV1 bitstream, like the NALU of H.264.
+// We could package OBUs in different formats according to different scenarios.
+//
+//	@note Low overhead bitstream format, each OBU has the obu_size field, which is used
+//		by ISOBMFF, FLV(Enhanced RTMP) and RTP, please read av1-spec.pdf, 5.2 Low overhead
+//		bitstream format.
+//	@note Length delimited bitstream format, the temporal unit, frame unit and OBU are
+//		prefixed by the length, please read av1-spec.pdf, Annex B Length delimited bitstream format.
+//	@note The AV1CodecConfigurationRecord(av1C) for MP4 and FLV, please read av1-isobmff.pdf,
+//		2.3 AV1 Codec Configuration Box.
+package av1
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The max bytes of leb128, the value is in [0, 1<<32-1].
+const maxLEB128Bytes = 8
+
+// Decode the unsigned leb128, return the value and bytes consumed.
+// @doc av1-spec.pdf, 4.10.5 leb128
+func DecodeLEB128(data []byte) (v uint64, n int, err error) {
+	for i := 0; i < maxLEB128Bytes; i++ {
+		if i >= len(data) {
+			return 0, 0, errors.Errorf("requires %v+ only %v bytes", i+1, len(data))
+		}
+
+		v |= uint64(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			if v > 1<<32-1 {
+				return 0, 0, errors.Errorf("leb128 %v overflow", v)
+			}
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errors.Errorf("leb128 exceed %v bytes", maxLEB128Bytes)
+}
+
+// Encode the value as unsigned leb128, append to b.
+func EncodeLEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		if v >>= 7; v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// @doc av1-spec.pdf, 6.2.2 OBU header semantics
+type OBUType uint8
+
+const (
+	OBUTypeSequenceHeader       OBUType = 1
+	OBUTypeTemporalDelimiter    OBUType = 2
+	OBUTypeFrameHeader          OBUType = 3
+	OBUTypeTileGroup            OBUType = 4
+	OBUTypeMetadata             OBUType = 5
+	OBUTypeFrame                OBUType = 6
+	OBUTypeRedundantFrameHeader OBUType = 7
+	OBUTypeTileList             OBUType = 8
+	OBUTypePadding              OBUType = 15
+)
+
+func (v OBUType) String() string {
+	switch v {
+	case OBUTypeSequenceHeader:
+		return "SequenceHeader"
+	case OBUTypeTemporalDelimiter:
+		return "TemporalDelimiter"
+	case OBUTypeFrameHeader:
+		return "FrameHeader"
+	case OBUTypeTileGroup:
+		return "TileGroup"
+	case OBUTypeMetadata:
+		return "Metadata"
+	case OBUTypeFrame:
+		return "Frame"
+	case OBUTypeRedundantFrameHeader:
+		return "RedundantFrameHeader"
+	case OBUTypeTileList:
+		return "TileList"
+	case OBUTypePadding:
+		return "Padding"
+	default:
+		return fmt.Sprintf("OBU/%v", uint8(v))
+	}
+}
+
+// The OBU header, 1 byte or 2 bytes with extension.
+// @doc av1-spec.pdf, 5.3.2 OBU header syntax
+type OBUHeader struct {
+	// The 1-bit obu_forbidden_bit.
+	Forbidden uint8
+	// The 4-bits obu_type.
+	OBUType OBUType
+	// The obu_extension_flag, whether the temporal_id and spatial_id present.
+	ExtensionFlag bool
+	// The obu_has_size_field, whether the obu_size present.
+	HasSizeField bool
+	// The 3-bits temporal_id, for extension only.
+	TemporalID uint8
+	// The 2-bits spatial_id, for extension only.
+	SpatialID uint8
+}
+
+func NewOBUHeader() *OBUHeader {
+	return &OBUHeader{}
+}
+
+func (v *OBUHeader) String() string {
+	return fmt.Sprintf("%v, TemporalID=%v, SpatialID=%v", v.OBUType, v.TemporalID, v.SpatialID)
+}
+
+func (v *OBUHeader) Size() int {
+	if v.ExtensionFlag {
+		return 2
+	}
+	return 1
+}
+
+func (v *OBUHeader) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("empty OBU")
+	}
+
+	v.Forbidden = uint8(data[0]>>7) & 0x01
+	v.OBUType = OBUType(data[0]>>3) & 0x0f
+	v.ExtensionFlag = (data[0]>>2)&0x01 == 0x01
+	v.HasSizeField = (data[0]>>1)&0x01 == 0x01
+
+	if v.ExtensionFlag {
+		if len(data) < 2 {
+			return errors.New("no OBU extension")
+		}
+		v.TemporalID = uint8(data[1]>>5) & 0x07
+		v.SpatialID = uint8(data[1]>>3) & 0x03
+	}
+	return nil
+}
+
+func (v *OBUHeader) MarshalBinary() ([]byte, error) {
+	b := []byte{byte(v.Forbidden&0x01)<<7 | byte(v.OBUType&0x0f)<<3}
+	if v.HasSizeField {
+		b[0] |= 0x02
+	}
+	if v.ExtensionFlag {
+		b[0] |= 0x04
+		b = append(b, byte(v.TemporalID&0x07)<<5|byte(v.SpatialID&0x03)<<3)
+	}
+	return b, nil
+}
+
+// The OBU, the Data is the payload without obu_size.
+// @doc av1-spec.pdf, 5.3.1 General OBU syntax
+type OBU struct {
+	*OBUHeader
+	Data []byte
+}
+
+func NewOBU() *OBU {
+	return &OBU{OBUHeader: NewOBUHeader()}
+}
+
+func (v *OBU) String() string {
+	return fmt.Sprintf("%v, size=%vB", v.OBUHeader, len(v.Data))
+}
+
+// Unmarshal the OBU, which may has the obu_size, return the bytes consumed.
+// @remark The payload is the left bytes when obu_size is not present.
+func (v *OBU) unmarshal(data []byte) (int, error) {
+	if err := v.OBUHeader.UnmarshalBinary(data); err != nil {
+		return 0, errors.WithMessage(err, "header")
+	}
+	b := data[v.OBUHeader.Size():]
+
+	if !v.HasSizeField {
+		v.Data = b
+		return len(data), nil
+	}
+
+	size, n, err := DecodeLEB128(b)
+	if err != nil {
+		return 0, errors.WithMessage(err, "obu_size")
+	}
+	if b = b[n:]; uint64(len(b)) < size {
+		return 0, errors.Errorf("requires %v only %v bytes", size, len(b))
+	}
+
+	v.Data = b[:size]
+	return len(data) - len(b) + int(size), nil
+}
+
+// Unmarshal the OBU, the bytes must be exactly the OBU if has obu_size.
+func (v *OBU) UnmarshalBinary(data []byte) error {
+	n, err := v.unmarshal(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return errors.Errorf("OBU %vB with %vB left", n, len(data)-n)
+	}
+	return nil
+}
+
+// Marshal the OBU, with obu_size if HasSizeField.
+func (v *OBU) MarshalBinary() ([]byte, error) {
+	return v.marshal(v.HasSizeField)
+}
+
+// Marshal the OBU, overwrite the obu_has_size_field by withSize.
+func (v *OBU) marshal(withSize bool) ([]byte, error) {
+	h := *v.OBUHeader
+	h.HasSizeField = withSize
+
+	b, err := h.MarshalBinary()
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal")
+	}
+
+	if withSize {
+		b = EncodeLEB128(b, uint64(len(v.Data)))
+	}
+	return append(b, v.Data...), nil
+}
+
+// The AV1 sample in low overhead bitstream format, generally a temporal unit, which is the OBUs
+// with obu_size, used by ISOBMFF and FLV.
+// @doc av1-isobmff.pdf, 2.4 AV1 Sample Format
+type AV1Sample struct {
+	OBUs []*OBU
+}
+
+func NewAV1Sample() *AV1Sample {
+	return &AV1Sample{}
+}
+
+// Marshal the OBUs in low overhead bitstream format, all OBUs has the obu_size.
+func (v *AV1Sample) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, obu := range v.OBUs {
+		b, err := obu.marshal(true)
+		if err != nil {
+			return nil, errors.WithMessage(err, "write")
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal the OBUs in low overhead bitstream format.
+// @remark The last OBU may have no obu_size, the payload is the left bytes.
+func (v *AV1Sample) UnmarshalBinary(data []byte) error {
+	for b := data; len(b) > 0; {
+		obu := NewOBU()
+		n, err := obu.unmarshal(b)
+		if err != nil {
+			return errors.WithMessage(err, "unmarshal")
+		}
+		b = b[n:]
+
+		v.OBUs = append(v.OBUs, obu)
+	}
+	return nil
+}
+
+// Write the data with leb128 size prefix.
+func writeWithSize(buf *bytes.Buffer, data []byte) {
+	buf.Write(EncodeLEB128(nil, uint64(len(data))))
+	buf.Write(data)
+}
+
+// Read the data with leb128 size prefix, return the data and left bytes.
+func readWithSize(data []byte) (b, left []byte, err error) {
+	size, n, err := DecodeLEB128(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if data = data[n:]; uint64(len(data)) < size {
+		return nil, nil, errors.Errorf("requires %v only %v bytes", size, len(data))
+	}
+	return data[:size], data[size:], nil
+}
+
+// Marshal the OBUs as a temporal_unit in length delimited bitstream format, the OBUs has no obu_size.
+// A new frame_unit starts at each frame header or frame OBU, the other OBUs such as temporal delimiter,
+// sequence header and metadata are in the frame_unit of the frame after them.
+// @doc av1-spec.pdf, B.2 Length delimited bitstream syntax
+func (v *AV1Sample) MarshalAnnexB() ([]byte, error) {
+	var frameUnits [][]*OBU
+	var current []*OBU
+	var hasFrame bool
+	for _, obu := range v.OBUs {
+		if obu.OBUType == OBUTypeFrame || obu.OBUType == OBUTypeFrameHeader {
+			if hasFrame {
+				frameUnits, current = append(frameUnits, current), nil
+			}
+			hasFrame = true
+		}
+		current = append(current, obu)
+	}
+	if len(current) > 0 {
+		frameUnits = append(frameUnits, current)
+	}
+
+	var tu bytes.Buffer
+	for _, frameUnit := range frameUnits {
+		var fu bytes.Buffer
+		for _, obu := range frameUnit {
+			b, err := obu.marshal(false)
+			if err != nil {
+				return nil, errors.WithMessage(err, "write")
+			}
+			writeWithSize(&fu, b)
+		}
+		writeWithSize(&tu, fu.Bytes())
+	}
+
+	var buf bytes.Buffer
+	writeWithSize(&buf, tu.Bytes())
+	return buf.Bytes(), nil
+}
+
+// Unmarshal a temporal_unit in length delimited bitstream format, return the left bytes,
+// which is the next temporal_unit.
+func (v *AV1Sample) UnmarshalAnnexB(data []byte) (left []byte, err error) {
+	tu, left, err := readWithSize(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "temporal_unit")
+	}
+
+	for len(tu) > 0 {
+		var fu []byte
+		if fu, tu, err = readWithSize(tu); err != nil {
+			return nil, errors.WithMessage(err, "frame_unit")
+		}
+
+		for len(fu) > 0 {
+			var b []byte
+			if b, fu, err = readWithSize(fu); err != nil {
+				return nil, errors.WithMessage(err, "obu_length")
+			}
+
+			obu := NewOBU()
+			if err = obu.UnmarshalBinary(b); err != nil {
+				return nil, errors.WithMessage(err, "unmarshal")
+			}
+			v.OBUs = append(v.OBUs, obu)
+		}
+	}
+	return left, nil
+}
+
+// Convert the temporal unit in low overhead bitstream format to length delimited bitstream format.
+func LowOverheadToAnnexB(data []byte) ([]byte, error) {
+	sample := NewAV1Sample()
+	if err := sample.UnmarshalBinary(data); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal")
+	}
+	return sample.MarshalAnnexB()
+}
+
+// Convert the length delimited bitstream to temporal units in low overhead bitstream format.
+func AnnexBToLowOverhead(data []byte) (samples [][]byte, err error) {
+	for b := data; len(b) > 0; {
+		sample := NewAV1Sample()
+		if b, err = sample.UnmarshalAnnexB(b); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal")
+		}
+
+		var sb []byte
+		if sb, err = sample.MarshalBinary(); err != nil {
+			return nil, errors.WithMessage(err, "marshal")
+		}
+		samples = append(samples, sb)
+	}
+	return
+}
+
+// The AV1CodecConfigurationRecord, the sequence header for MP4 and FLV.
+// @doc av1-isobmff.pdf, 2.3.3 AV1 Codec Configuration Box Syntax
+type AV1CodecConfigurationRecord struct {
+	// The 1-bit marker and 7-bits version, must be 1.
+	marker  uint8
+	version uint8
+	// The 3-bits seq_profile.
+	SeqProfile uint8
+	// The 5-bits seq_level_idx[0].
+	SeqLevelIdx0 uint8
+	// The 1-bit seq_tier[0].
+	SeqTier0             uint8
+	HighBitdepth         bool
+	TwelveBit            bool
+	Monochrome           bool
+	ChromaSubsamplingX   bool
+	ChromaSubsamplingY   bool
+	ChromaSamplePosition uint8
+	// The initial_presentation_delay_minus_one, 4 bits if present.
+	InitialPresentationDelayPresent  bool
+	InitialPresentationDelayMinusOne uint8
+	// The configOBUs in low overhead bitstream format, generally the sequence header.
+	ConfigOBUs []*OBU
+}
+
+func NewAV1CodecConfigurationRecord() *AV1CodecConfigurationRecord {
+	return &AV1CodecConfigurationRecord{marker: 1, version: 1}
+}
+
+// Create the record from the sequence header OBU.
+func NewAV1CodecConfigurationRecordFromSequenceHeader(obu *OBU) (*AV1CodecConfigurationRecord, error) {
+	sh := NewSequenceHeader()
+	if err := sh.UnmarshalOBU(obu); err != nil {
+		return nil, errors.WithMessage(err, "sequence header")
+	}
+
+	v := NewAV1CodecConfigurationRecord()
+	v.SeqProfile = sh.SeqProfile
+	v.SeqLevelIdx0 = sh.OperatingPoints[0].SeqLevelIdx
+	v.SeqTier0 = sh.OperatingPoints[0].SeqTier
+	v.HighBitdepth = sh.ColorConfig.HighBitdepth
+	v.TwelveBit = sh.ColorConfig.TwelveBit
+	v.Monochrome = sh.ColorConfig.MonoChrome
+	v.ChromaSubsamplingX = sh.ColorConfig.SubsamplingX
+	v.ChromaSubsamplingY = sh.ColorConfig.SubsamplingY
+	v.ChromaSamplePosition = sh.ColorConfig.ChromaSamplePosition
+
+	config := *obu
+	config.OBUHeader = &OBUHeader{}
+	*config.OBUHeader = *obu.OBUHeader
+	config.HasSizeField = true
+	v.ConfigOBUs = append(v.ConfigOBUs, &config)
+
+	return v, nil
+}
+
+// Parse the first sequence header in configOBUs.
+func (v *AV1CodecConfigurationRecord) SequenceHeader() (*SequenceHeader, error) {
+	for _, obu := range v.ConfigOBUs {
+		if obu.OBUType != OBUTypeSequenceHeader {
+			continue
+		}
+
+		sh := NewSequenceHeader()
+		if err := sh.UnmarshalOBU(obu); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal")
+		}
+		return sh, nil
+	}
+	return nil, errors.New("no sequence header")
+}
+
+func (v *AV1CodecConfigurationRecord) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(v.marker&0x01)<<7 | byte(v.version&0x7f))
+	buf.WriteByte(byte(v.SeqProfile&0x07)<<5 | byte(v.SeqLevelIdx0&0x1f))
+
+	var b byte
+	for _, flag := range []bool{v.HighBitdepth, v.TwelveBit, v.Monochrome, v.ChromaSubsamplingX, v.ChromaSubsamplingY} {
+		if b <<= 1; flag {
+			b |= 0x01
+		}
+	}
+	buf.WriteByte(byte(v.SeqTier0&0x01)<<7 | b<<2 | byte(v.ChromaSamplePosition&0x03))
+
+	if v.InitialPresentationDelayPresent {
+		buf.WriteByte(0x10 | byte(v.InitialPresentationDelayMinusOne&0x0f))
+	} else {
+		buf.WriteByte(0x00)
+	}
+
+	for _, obu := range v.ConfigOBUs {
+		b, err := obu.marshal(true)
+		if err != nil {
+			return nil, errors.WithMessage(err, "config OBU")
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+func (v *AV1CodecConfigurationRecord) UnmarshalBinary(data []byte) error {
+	b := data
+	if len(b) < 4 {
+		return errors.Errorf("requires 4+ only %v bytes", len(b))
+	}
+
+	if v.marker, v.version = uint8(b[0]>>7), uint8(b[0]&0x7f); v.marker != 1 || v.version != 1 {
+		return errors.Errorf("invalid marker %v and version %v", v.marker, v.version)
+	}
+	v.SeqProfile = uint8(b[1]>>5) & 0x07
+	v.SeqLevelIdx0 = uint8(b[1]) & 0x1f
+	v.SeqTier0 = uint8(b[2]>>7) & 0x01
+	v.HighBitdepth = (b[2]>>6)&0x01 == 0x01
+	v.TwelveBit = (b[2]>>5)&0x01 == 0x01
+	v.Monochrome = (b[2]>>4)&0x01 == 0x01
+	v.ChromaSubsamplingX = (b[2]>>3)&0x01 == 0x01
+	v.ChromaSubsamplingY = (b[2]>>2)&0x01 == 0x01
+	v.ChromaSamplePosition = uint8(b[2]) & 0x03
+	if v.InitialPresentationDelayPresent = (b[3]>>4)&0x01 == 0x01; v.InitialPresentationDelayPresent {
+		v.InitialPresentationDelayMinusOne = uint8(b[3]) & 0x0f
+	}
+
+	sample := NewAV1Sample()
+	if err := sample.UnmarshalBinary(b[4:]); err != nil {
+		return errors.WithMessage(err, "config OBUs")
+	}
+	v.ConfigOBUs = sample.OBUs
+	return nil
+}
@@ -0,0 +1,274 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package av1
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The sequence header OBUs from aom_codec_get_global_headers of libaom v3.6.0, with the default config of good
+// quality usage, verified by dav1d 1.0.0.
+var (
+	// The Main profile 1920x1080 8bits.
+	aomSequenceHeader = []byte{0x0a, 0x0b, 0x00, 0x00, 0x00, 0x42, 0xab, 0xbf, 0xc3, 0x77, 0xff, 0xe6, 0x01}
+	// The Main profile 1920x1080 10bits 29.97fps, with --color-primaries=bt2020 --transfer-characteristics=smpte2084
+	// --matrix-coefficients=bt2020ncl --timing-info=constant.
+	aomHDRSequenceHeader = []byte{
+		0x0a, 0x17, 0x04, 0x00, 0x00, 0x0f, 0xa4, 0x00, 0x01, 0xd4, 0xc3, 0x40,
+		0x00, 0x08, 0x5e, 0xab, 0xbf, 0xc3, 0x77, 0xff, 0xe7, 0x42, 0x44, 0x02,
+		0x41,
+	}
+	// The Professional profile 1280x720 12bits 4:4:4.
+	aomProfessionalSequenceHeader = []byte{0x0a, 0x0b, 0x40, 0x00, 0x00, 0x2d, 0x4c, 0xff, 0xb3, 0xdf, 0xff, 0x9e, 0x04}
+	// The Professional profile 256x128 12bits 4:4:4 still picture, with --limit=1 to use the reduced header.
+	aomStillSequenceHeader = []byte{0x0a, 0x06, 0x58, 0x1d, 0xbf, 0xff, 0xf7, 0x81}
+)
+
+func TestLEB128(t *testing.T) {
+	for _, e := range []struct {
+		v uint64
+		b []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+		{1<<32 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+	} {
+		if b := EncodeLEB128(nil, e.v); !bytes.Equal(b, e.b) {
+			t.Errorf("invalid %x, expect %x", b, e.b)
+		}
+		if v, n, err := DecodeLEB128(append(e.b, 0xff)); err != nil || v != e.v || n != len(e.b) {
+			t.Errorf("invalid %v %v, expect %v, err %+v", v, n, e.v, err)
+		}
+	}
+
+	// The padding of leb128, which is valid.
+	if v, n, err := DecodeLEB128([]byte{0x81, 0x80, 0x80, 0x00}); err != nil || v != 1 || n != 4 {
+		t.Errorf("invalid %v %v, err %+v", v, n, err)
+	}
+
+	for _, b := range [][]byte{nil, {0x80}, bytes.Repeat([]byte{0x80}, 9), {0x80, 0x80, 0x80, 0x80, 0x10}} {
+		if _, _, err := DecodeLEB128(b); err == nil {
+			t.Errorf("should error for %x", b)
+		}
+	}
+}
+
+func TestOBU(t *testing.T) {
+	obu := &OBU{
+		OBUHeader: &OBUHeader{OBUType: OBUTypeFrame, ExtensionFlag: true, HasSizeField: true, TemporalID: 2, SpatialID: 1},
+		Data:      bytes.Repeat([]byte{0x01}, 200),
+	}
+
+	b, err := obu.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+	if !bytes.Equal(b[:4], []byte{0x36, 0x48, 0xc8, 0x01}) || len(b) != 204 {
+		t.Errorf("invalid obu %x", b[:4])
+	}
+
+	v := NewOBU()
+	if err := v.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if *v.OBUHeader != *obu.OBUHeader || !bytes.Equal(v.Data, obu.Data) {
+		t.Errorf("invalid obu %v", v)
+	}
+
+	if err := NewOBU().UnmarshalBinary(append(b, 0x00)); err == nil {
+		t.Error("should error for left bytes")
+	}
+	if err := NewOBU().UnmarshalBinary(b[:100]); err == nil {
+		t.Error("should error for not enough")
+	}
+	if err := NewOBU().UnmarshalBinary([]byte{0x34}); err == nil {
+		t.Error("should error for no extension")
+	}
+}
+
+func TestAV1Sample(t *testing.T) {
+	td := []byte{0x12, 0x00}
+	sh := aomHDRSequenceHeader
+	frame1 := []byte{0x32, 0x03, 0x10, 0x00, 0x01}
+	frame2 := []byte{0x32, 0x02, 0x30, 0x00}
+	data := bytes.Join([][]byte{td, sh, frame1, frame2}, nil)
+
+	sample := NewAV1Sample()
+	if err := sample.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if len(sample.OBUs) != 4 || sample.OBUs[1].OBUType != OBUTypeSequenceHeader || !bytes.Equal(sample.OBUs[2].Data, frame1[2:]) {
+		t.Errorf("invalid sample %v", sample.OBUs)
+	}
+	if b, err := sample.MarshalBinary(); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("invalid sample %x, expect %x, err %+v", b, data, err)
+	}
+
+	// The last OBU without obu_size.
+	last := NewAV1Sample()
+	if err := last.UnmarshalBinary(append(td, 0x30, 0x10, 0x00, 0x01)); err != nil || len(last.OBUs) != 2 ||
+		!bytes.Equal(last.OBUs[1].Data, frame1[2:]) {
+		t.Errorf("invalid sample %v, err %+v", last.OBUs, err)
+	}
+
+	// Two frame units, the first is TD, SH and frame1.
+	annexb, err := LowOverheadToAnnexB(data)
+	if err != nil {
+		t.Fatalf("convert failed %+v", err)
+	}
+	shLen := byte(len(sh) - 1)
+	expect := []byte{
+		byte(len(sh) + 13), byte(len(sh) + 7),
+		0x01, 0x10, shLen, 0x08,
+	}
+	expect = append(expect, sh[2:]...)
+	expect = append(expect, 0x04, 0x30, 0x10, 0x00, 0x01, 0x04, 0x03, 0x30, 0x30, 0x00)
+	if !bytes.Equal(annexb, expect) {
+		t.Errorf("invalid annexb %x, expect %x", annexb, expect)
+	}
+
+	samples, err := AnnexBToLowOverhead(append(annexb, annexb...))
+	if err != nil || len(samples) != 2 || !bytes.Equal(samples[0], data) || !bytes.Equal(samples[1], data) {
+		t.Errorf("invalid samples %x, err %+v", samples, err)
+	}
+
+	for i := 1; i < len(annexb); i++ {
+		if _, err := AnnexBToLowOverhead(annexb[:i]); err == nil {
+			t.Errorf("should error for %vB", i)
+		}
+	}
+}
+
+func TestSequenceHeader(t *testing.T) {
+	parse := func(b []byte) *SequenceHeader {
+		obu := NewOBU()
+		if err := obu.UnmarshalBinary(b); err != nil {
+			t.Fatalf("unmarshal obu failed %+v", err)
+		}
+		sh := NewSequenceHeader()
+		if err := sh.UnmarshalOBU(obu); err != nil {
+			t.Fatalf("unmarshal failed %+v", err)
+		}
+		return sh
+	}
+
+	sh := parse(aomSequenceHeader)
+	if sh.SeqProfile != 0 || sh.Width() != 1920 || sh.Height() != 1080 || len(sh.OperatingPoints) != 1 ||
+		sh.OperatingPoints[0].SeqLevelIdx != 8 || sh.TimingInfoPresentFlag || sh.FrameRate() != 0 {
+		t.Errorf("invalid sequence header %+v", sh)
+	}
+	if !sh.Use128x128Superblock || !sh.EnableOrderHint || sh.OrderHintBitsMinus1 != 6 || !sh.EnableCdef ||
+		!sh.EnableRestoration || sh.EnableSuperres || sh.FilmGrainParamsPresent {
+		t.Errorf("invalid sequence header %+v", sh)
+	}
+	if c := sh.ColorConfig; c.BitDepth != 8 || c.MonoChrome || c.ColorDescriptionPresentFlag || c.ColorPrimaries != 2 ||
+		!c.SubsamplingX || !c.SubsamplingY || c.ColorRange {
+		t.Errorf("invalid color config %+v", c)
+	}
+
+	sh = parse(aomHDRSequenceHeader)
+	if sh.SeqProfile != 0 || sh.Width() != 1920 || sh.Height() != 1080 || sh.OperatingPoints[0].SeqLevelIdx != 8 {
+		t.Errorf("invalid sequence header %+v", sh)
+	}
+	if fps := sh.FrameRate(); !sh.EqualPictureInterval || fps < 29.97 || fps > 29.98 {
+		t.Errorf("invalid fps %v", fps)
+	}
+	if op := sh.OperatingPoints[0]; !sh.InitialDisplayDelayPresentFlag || !op.InitialDisplayDelayPresentForThisOp ||
+		op.InitialDisplayDelayMinus1 != 7 {
+		t.Errorf("invalid operating point %+v", op)
+	}
+	if sh.SeqForceScreenContentTools != SelectScreenContentTools || sh.SeqForceIntegerMV != SelectIntegerMV {
+		t.Errorf("invalid sequence header %+v", sh)
+	}
+	if c := sh.ColorConfig; c.BitDepth != 10 || c.MonoChrome || c.ColorPrimaries != 9 || c.TransferCharacteristics != 16 ||
+		c.MatrixCoefficients != 9 || !c.SubsamplingX || !c.SubsamplingY || c.ColorRange {
+		t.Errorf("invalid color config %+v", c)
+	}
+
+	sh = parse(aomProfessionalSequenceHeader)
+	if sh.SeqProfile != 2 || sh.Width() != 1280 || sh.Height() != 720 || sh.OperatingPoints[0].SeqLevelIdx != 5 {
+		t.Errorf("invalid sequence header %+v", sh)
+	}
+	if c := sh.ColorConfig; c.BitDepth != 12 || !c.TwelveBit || c.SubsamplingX || c.SubsamplingY {
+		t.Errorf("invalid color config %+v", c)
+	}
+
+	sh = parse(aomStillSequenceHeader)
+	if !sh.StillPicture || !sh.ReducedStillPictureHeader || sh.OperatingPoints[0].SeqLevelIdx != 0 ||
+		sh.Width() != 256 || sh.Height() != 128 || sh.EnableOrderHint {
+		t.Errorf("invalid sequence header %+v", sh)
+	}
+	if c := sh.ColorConfig; c.BitDepth != 12 || c.SubsamplingX || c.SubsamplingY || c.ColorRange {
+		t.Errorf("invalid color config %+v", c)
+	}
+
+	for i := 0; i < len(aomHDRSequenceHeader)-3; i++ {
+		if err := NewSequenceHeader().UnmarshalBinary(aomHDRSequenceHeader[2 : 2+i]); err == nil {
+			t.Errorf("should error for %vB", i)
+		}
+	}
+}
+
+func TestAV1CodecConfigurationRecord(t *testing.T) {
+	obu := &OBU{OBUHeader: &OBUHeader{OBUType: OBUTypeSequenceHeader}, Data: aomHDRSequenceHeader[2:]}
+
+	r, err := NewAV1CodecConfigurationRecordFromSequenceHeader(obu)
+	if err != nil {
+		t.Fatalf("create failed %+v", err)
+	}
+	if obu.HasSizeField {
+		t.Error("should not change the OBU")
+	}
+
+	b, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+	if !bytes.Equal(b[:6], []byte{0x81, 0x08, 0x4c, 0x00, 0x0a, byte(len(obu.Data))}) {
+		t.Errorf("invalid record %x", b[:6])
+	}
+
+	v := NewAV1CodecConfigurationRecord()
+	if err := v.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if v.SeqLevelIdx0 != 8 || !v.HighBitdepth || v.TwelveBit || !v.ChromaSubsamplingX || len(v.ConfigOBUs) != 1 {
+		t.Errorf("invalid record %+v", v)
+	}
+	if sh, err := v.SequenceHeader(); err != nil || sh.Width() != 1920 {
+		t.Errorf("invalid sequence header %+v, err %+v", sh, err)
+	}
+
+	// The configOBUs is optional.
+	if err := NewAV1CodecConfigurationRecord().UnmarshalBinary(b[:4]); err != nil {
+		t.Errorf("unmarshal failed %+v", err)
+	}
+	if err := NewAV1CodecConfigurationRecord().UnmarshalBinary([]byte{0x01, 0x08, 0x4c, 0x00}); err == nil {
+		t.Error("should error for marker")
+	}
+	if _, err := NewAV1CodecConfigurationRecordFromSequenceHeader(&OBU{OBUHeader: &OBUHeader{OBUType: OBUTypeFrame}}); err == nil {
+		t.Error("should error for frame")
+	}
+}
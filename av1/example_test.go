@@ -0,0 +1,65 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package av1_test
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/av1"
+	"github.com/ossrs/go-oryx-lib/flv"
+)
+
+func ExampleAV1CodecConfigurationRecord() {
+	p, err := flv.NewVideoPackager()
+	if err != nil {
+		return
+	}
+
+	// The Enhanced RTMP video tag of AV1 sequence start, the av1C of libaom, 1920x1080.
+	tag := []byte{
+		0x90, 'a', 'v', '0', '1',
+		0x81, 0x08, 0x0c, 0x00,
+		0x0a, 0x0b, 0x00, 0x00, 0x00, 0x42, 0xab, 0xbf, 0xc3, 0x77, 0xff, 0xe6, 0x01,
+	}
+
+	frame, err := p.Decode(tag)
+	if err != nil || frame.FourCC != flv.VideoFourCCAV1 {
+		return
+	}
+
+	r := av1.NewAV1CodecConfigurationRecord()
+	if err = r.UnmarshalBinary(frame.Raw); err != nil {
+		return
+	}
+	fmt.Println("profile", r.SeqProfile, "level", r.SeqLevelIdx0)
+
+	// The sequence header in configOBUs, for the size and bit depth.
+	sh, err := r.SequenceHeader()
+	if err != nil {
+		return
+	}
+	fmt.Printf("%vx%v, %vbits\n", sh.Width(), sh.Height(), sh.ColorConfig.BitDepth)
+
+	// Output:
+	// profile 0 level 8
+	// 1920x1080, 8bits
+}
@@ -0,0 +1,335 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package av1
+
+import (
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// Read the uvlc(), the variable length unsigned n-bit number.
+// @doc av1-spec.pdf, 4.10.3 uvlc
+func uvlc(p *avc.BitParser) uint32 {
+	var leadingZeros int
+	for p.Err() == nil && !p.Flag() {
+		leadingZeros++
+	}
+	if p.Err() != nil || leadingZeros >= 32 {
+		return 1<<32 - 1
+	}
+	return p.U(leadingZeros) + (1 << uint(leadingZeros)) - 1
+}
+
+// The color_config of sequence header.
+// @doc av1-spec.pdf, 5.5.2 Color config syntax
+type ColorConfig struct {
+	HighBitdepth bool
+	TwelveBit    bool
+	// The BitDepth, 8, 10 or 12.
+	BitDepth                    int
+	MonoChrome                  bool
+	ColorDescriptionPresentFlag bool
+	ColorPrimaries              uint8
+	TransferCharacteristics     uint8
+	MatrixCoefficients          uint8
+	ColorRange                  bool
+	SubsamplingX                bool
+	SubsamplingY                bool
+	ChromaSamplePosition        uint8
+	SeparateUVDeltaQ            bool
+}
+
+// The color_primaries, transfer_characteristics and matrix_coefficients for sRGB.
+const (
+	colorPrimariesBT709         = 1
+	transferCharacteristicsSRGB = 13
+	matrixCoefficientsIdentity  = 0
+	colorDescriptionUnspecified = 2
+)
+
+func (v *ColorConfig) parse(p *avc.BitParser, seqProfile uint8) {
+	v.HighBitdepth = p.Flag()
+	if seqProfile == 2 && v.HighBitdepth {
+		v.TwelveBit = p.Flag()
+	}
+
+	v.BitDepth = 8
+	if v.TwelveBit {
+		v.BitDepth = 12
+	} else if v.HighBitdepth {
+		v.BitDepth = 10
+	}
+
+	if seqProfile != 1 {
+		v.MonoChrome = p.Flag()
+	}
+
+	v.ColorPrimaries, v.TransferCharacteristics, v.MatrixCoefficients =
+		colorDescriptionUnspecified, colorDescriptionUnspecified, colorDescriptionUnspecified
+	if v.ColorDescriptionPresentFlag = p.Flag(); v.ColorDescriptionPresentFlag {
+		v.ColorPrimaries = uint8(p.U(8))
+		v.TransferCharacteristics = uint8(p.U(8))
+		v.MatrixCoefficients = uint8(p.U(8))
+	}
+
+	if v.MonoChrome {
+		v.ColorRange = p.Flag()
+		v.SubsamplingX, v.SubsamplingY = true, true
+		return
+	}
+
+	if v.ColorPrimaries == colorPrimariesBT709 && v.TransferCharacteristics == transferCharacteristicsSRGB &&
+		v.MatrixCoefficients == matrixCoefficientsIdentity {
+		v.ColorRange = true
+	} else {
+		v.ColorRange = p.Flag()
+		switch seqProfile {
+		case 0:
+			v.SubsamplingX, v.SubsamplingY = true, true
+		case 1:
+		default:
+			if v.BitDepth == 12 {
+				if v.SubsamplingX = p.Flag(); v.SubsamplingX {
+					v.SubsamplingY = p.Flag()
+				}
+			} else {
+				v.SubsamplingX = true
+			}
+		}
+		if v.SubsamplingX && v.SubsamplingY {
+			v.ChromaSamplePosition = uint8(p.U(2))
+		}
+	}
+	v.SeparateUVDeltaQ = p.Flag()
+}
+
+// The operating point of sequence header.
+type OperatingPoint struct {
+	OperatingPointIDC uint16
+	// The seq_level_idx, the level is 2+(idx>>2).(idx&3), for example, 8 for level 4.0.
+	SeqLevelIdx uint8
+	SeqTier     uint8
+	// The operating_parameters_info, if decoder_model_present_for_this_op.
+	DecoderModelPresentForThisOp bool
+	DecoderBufferDelay           uint32
+	EncoderBufferDelay           uint32
+	LowDelayModeFlag             bool
+	// The initial_display_delay_minus_1, if initial_display_delay_present_for_this_op.
+	InitialDisplayDelayPresentForThisOp bool
+	InitialDisplayDelayMinus1           uint8
+}
+
+// The value of seq_force_screen_content_tools and seq_force_integer_mv, which means select per frame.
+const SelectScreenContentTools = 2
+const SelectIntegerMV = 2
+
+// The sequence header OBU.
+// @doc av1-spec.pdf, 5.5.1 General sequence header OBU syntax
+type SequenceHeader struct {
+	SeqProfile                uint8
+	StillPicture              bool
+	ReducedStillPictureHeader bool
+
+	TimingInfoPresentFlag    bool
+	NumUnitsInDisplayTick    uint32
+	TimeScale                uint32
+	EqualPictureInterval     bool
+	NumTicksPerPictureMinus1 uint32
+
+	DecoderModelInfoPresentFlag       bool
+	BufferDelayLengthMinus1           uint8
+	NumUnitsInDecodingTick            uint32
+	BufferRemovalTimeLengthMinus1     uint8
+	FramePresentationTimeLengthMinus1 uint8
+
+	InitialDisplayDelayPresentFlag bool
+	// The operating points, at least one.
+	OperatingPoints []OperatingPoint
+
+	FrameWidthBitsMinus1  uint8
+	FrameHeightBitsMinus1 uint8
+	MaxFrameWidthMinus1   uint32
+	MaxFrameHeightMinus1  uint32
+
+	FrameIDNumbersPresentFlag     bool
+	DeltaFrameIDLengthMinus2      uint8
+	AdditionalFrameIDLengthMinus1 uint8
+
+	Use128x128Superblock        bool
+	EnableFilterIntra           bool
+	EnableIntraEdgeFilter       bool
+	EnableInterintraCompound    bool
+	EnableMaskedCompound        bool
+	EnableWarpedMotion          bool
+	EnableDualFilter            bool
+	EnableOrderHint             bool
+	EnableJntComp               bool
+	EnableRefFrameMvs           bool
+	SeqChooseScreenContentTools bool
+	SeqForceScreenContentTools  uint8
+	SeqChooseIntegerMV          bool
+	SeqForceIntegerMV           uint8
+	OrderHintBitsMinus1         uint8
+
+	EnableSuperres         bool
+	EnableCdef             bool
+	EnableRestoration      bool
+	ColorConfig            ColorConfig
+	FilmGrainParamsPresent bool
+}
+
+func NewSequenceHeader() *SequenceHeader {
+	return &SequenceHeader{}
+}
+
+// Unmarshal the sequence header from the OBU.
+func (v *SequenceHeader) UnmarshalOBU(obu *OBU) error {
+	if obu.OBUType != OBUTypeSequenceHeader {
+		return errors.Errorf("require %v, actual %v", OBUTypeSequenceHeader, obu.OBUType)
+	}
+	return v.UnmarshalBinary(obu.Data)
+}
+
+// Unmarshal the sequence header from the OBU payload, without the OBU header.
+func (v *SequenceHeader) UnmarshalBinary(data []byte) error {
+	p := avc.NewBitParser(data)
+
+	v.SeqProfile = uint8(p.U(3))
+	v.StillPicture = p.Flag()
+	v.ReducedStillPictureHeader = p.Flag()
+
+	if v.ReducedStillPictureHeader {
+		v.OperatingPoints = []OperatingPoint{{SeqLevelIdx: uint8(p.U(5))}}
+	} else {
+		if v.TimingInfoPresentFlag = p.Flag(); v.TimingInfoPresentFlag {
+			v.NumUnitsInDisplayTick = p.U(32)
+			v.TimeScale = p.U(32)
+			if v.EqualPictureInterval = p.Flag(); v.EqualPictureInterval {
+				v.NumTicksPerPictureMinus1 = uvlc(p)
+			}
+
+			if v.DecoderModelInfoPresentFlag = p.Flag(); v.DecoderModelInfoPresentFlag {
+				v.BufferDelayLengthMinus1 = uint8(p.U(5))
+				v.NumUnitsInDecodingTick = p.U(32)
+				v.BufferRemovalTimeLengthMinus1 = uint8(p.U(5))
+				v.FramePresentationTimeLengthMinus1 = uint8(p.U(5))
+			}
+		}
+
+		v.InitialDisplayDelayPresentFlag = p.Flag()
+		operatingPointsCntMinus1 := int(p.U(5))
+		for i := 0; i <= operatingPointsCntMinus1 && p.Err() == nil; i++ {
+			op := OperatingPoint{OperatingPointIDC: uint16(p.U(12)), SeqLevelIdx: uint8(p.U(5))}
+			if op.SeqLevelIdx > 7 {
+				op.SeqTier = uint8(p.U(1))
+			}
+
+			if v.DecoderModelInfoPresentFlag {
+				if op.DecoderModelPresentForThisOp = p.Flag(); op.DecoderModelPresentForThisOp {
+					n := int(v.BufferDelayLengthMinus1) + 1
+					op.DecoderBufferDelay = p.U(n)
+					op.EncoderBufferDelay = p.U(n)
+					op.LowDelayModeFlag = p.Flag()
+				}
+			}
+
+			if v.InitialDisplayDelayPresentFlag {
+				if op.InitialDisplayDelayPresentForThisOp = p.Flag(); op.InitialDisplayDelayPresentForThisOp {
+					op.InitialDisplayDelayMinus1 = uint8(p.U(4))
+				}
+			}
+			v.OperatingPoints = append(v.OperatingPoints, op)
+		}
+	}
+
+	v.FrameWidthBitsMinus1 = uint8(p.U(4))
+	v.FrameHeightBitsMinus1 = uint8(p.U(4))
+	v.MaxFrameWidthMinus1 = p.U(int(v.FrameWidthBitsMinus1) + 1)
+	v.MaxFrameHeightMinus1 = p.U(int(v.FrameHeightBitsMinus1) + 1)
+
+	if !v.ReducedStillPictureHeader {
+		if v.FrameIDNumbersPresentFlag = p.Flag(); v.FrameIDNumbersPresentFlag {
+			v.DeltaFrameIDLengthMinus2 = uint8(p.U(4))
+			v.AdditionalFrameIDLengthMinus1 = uint8(p.U(3))
+		}
+	}
+
+	v.Use128x128Superblock = p.Flag()
+	v.EnableFilterIntra = p.Flag()
+	v.EnableIntraEdgeFilter = p.Flag()
+
+	v.SeqForceScreenContentTools = SelectScreenContentTools
+	v.SeqForceIntegerMV = SelectIntegerMV
+	if !v.ReducedStillPictureHeader {
+		v.EnableInterintraCompound = p.Flag()
+		v.EnableMaskedCompound = p.Flag()
+		v.EnableWarpedMotion = p.Flag()
+		v.EnableDualFilter = p.Flag()
+		if v.EnableOrderHint = p.Flag(); v.EnableOrderHint {
+			v.EnableJntComp = p.Flag()
+			v.EnableRefFrameMvs = p.Flag()
+		}
+
+		if v.SeqChooseScreenContentTools = p.Flag(); !v.SeqChooseScreenContentTools {
+			v.SeqForceScreenContentTools = uint8(p.U(1))
+		}
+		if v.SeqForceScreenContentTools > 0 {
+			if v.SeqChooseIntegerMV = p.Flag(); !v.SeqChooseIntegerMV {
+				v.SeqForceIntegerMV = uint8(p.U(1))
+			}
+		}
+
+		if v.EnableOrderHint {
+			v.OrderHintBitsMinus1 = uint8(p.U(3))
+		}
+	}
+
+	v.EnableSuperres = p.Flag()
+	v.EnableCdef = p.Flag()
+	v.EnableRestoration = p.Flag()
+	v.ColorConfig.parse(p, v.SeqProfile)
+	v.FilmGrainParamsPresent = p.Flag()
+
+	if p.Err() != nil {
+		return errors.WithMessage(p.Err(), "sequence header")
+	}
+	return nil
+}
+
+// The max width in pixels.
+func (v *SequenceHeader) Width() int {
+	return int(v.MaxFrameWidthMinus1) + 1
+}
+
+// The max height in pixels.
+func (v *SequenceHeader) Height() int {
+	return int(v.MaxFrameHeightMinus1) + 1
+}
+
+// The frame rate from timing info, 0 if not present or not equal picture interval.
+func (v *SequenceHeader) FrameRate() float64 {
+	if !v.TimingInfoPresentFlag || !v.EqualPictureInterval || v.NumUnitsInDisplayTick == 0 {
+		return 0
+	}
+	ticks := float64(v.NumUnitsInDisplayTick) * (float64(v.NumTicksPerPictureMinus1) + 1)
+	return float64(v.TimeScale) / ticks
+}
@@ -0,0 +1,312 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package avc
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The start code prefix of Annex B, the 3 bytes start_code_prefix_one_3bytes.
+var annexBStartCode = []byte{0x00, 0x00, 0x01}
+
+// The 4 bytes start code of Annex B, with the zero_byte, which is used when write NALUs.
+var AnnexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// Remove the trailing_zero_8bits, and the zero_byte of next 4 bytes start code.
+func trimTrailingZeros(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0x00 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// Check the leading_zero_8bits before the first start code.
+func isLeadingZeros(b []byte) bool {
+	for _, c := range b {
+		if c != 0x00 {
+			return false
+		}
+	}
+	return true
+}
+
+// Split the Annex B byte stream to NALUs, by the 3 or 4 bytes start code. The NALUs is EBSP,
+// with the NALU header and emulation prevention bytes, and refer to the data.
+// @remark The start code never occurs in NALU, for the encoder inserts emulation_prevention_three_byte.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 211, B.1.1 Byte stream NAL unit syntax
+func SplitAnnexB(data []byte) (nalus [][]byte, err error) {
+	pos := bytes.Index(data, annexBStartCode)
+	if pos < 0 || !isLeadingZeros(data[:pos]) {
+		return nil, errors.New("no start code")
+	}
+
+	for b := data[pos+len(annexBStartCode):]; len(b) > 0; {
+		var nalu []byte
+		if pos = bytes.Index(b, annexBStartCode); pos < 0 {
+			nalu, b = b, nil
+		} else {
+			nalu, b = b[:pos], b[pos+len(annexBStartCode):]
+		}
+
+		if nalu = trimTrailingZeros(nalu); len(nalu) > 0 {
+			nalus = append(nalus, nalu)
+		}
+	}
+	return
+}
+
+// Join the NALUs to Annex B byte stream, with the 4 bytes start code.
+func JoinAnnexB(nalus [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, nalu := range nalus {
+		buf.Write(AnnexBStartCode)
+		buf.Write(nalu)
+	}
+	return buf.Bytes()
+}
+
+// Insert the emulation_prevention_three_byte to RBSP, to get the EBSP.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 44, 7.3.1 NAL unit syntax
+func AddEmulationPrevention(rbsp []byte) (ebsp []byte) {
+	ebsp = make([]byte, 0, len(rbsp))
+
+	var zeros int
+	for _, c := range rbsp {
+		if zeros >= 2 && c <= 0x03 {
+			ebsp, zeros = append(ebsp, 0x03), 0
+		}
+		if ebsp = append(ebsp, c); c == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	// The last byte of NALU should never be zero, for it's confused with the trailing_zero_8bits.
+	if zeros > 0 {
+		ebsp = append(ebsp, 0x03)
+	}
+	return
+}
+
+// The lengthSizeMinusOne must be 0, 1 or 3, the 2 is not allowed.
+func checkLengthSizeMinusOne(lengthSizeMinusOne uint8) error {
+	if lengthSizeMinusOne == 2 || lengthSizeMinusOne > 3 {
+		return errors.Errorf("invalid lengthSizeMinusOne %v", lengthSizeMinusOne)
+	}
+	return nil
+}
+
+// Convert the Annex B byte stream to NALUs prefixed by length, such as AVCC and HVCC,
+// the size of length is lengthSizeMinusOne+1, which must be 1, 2 or 4.
+// @doc ISO_IEC_14496-15-AVC-format-2012.pdf at page 20, 5.3.4.2 Sample format
+func AnnexBToLengthPrefixed(data []byte, lengthSizeMinusOne uint8) ([]byte, error) {
+	if err := checkLengthSizeMinusOne(lengthSizeMinusOne); err != nil {
+		return nil, err
+	}
+
+	nalus, err := SplitAnnexB(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "split")
+	}
+
+	sizeOfNALU := int(lengthSizeMinusOne) + 1
+
+	var buf bytes.Buffer
+	for _, nalu := range nalus {
+		length := uint64(len(nalu))
+		if length >= uint64(1)<<uint(8*sizeOfNALU) {
+			return nil, errors.Errorf("NALU %vB overflow %v bytes length", length, sizeOfNALU)
+		}
+
+		for i := 0; i < sizeOfNALU; i++ {
+			buf.WriteByte(byte(length >> uint8(8*(sizeOfNALU-1-i))))
+		}
+		buf.Write(nalu)
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert the NALUs prefixed by length to Annex B byte stream, with the 4 bytes start code.
+func LengthPrefixedToAnnexB(data []byte, lengthSizeMinusOne uint8) ([]byte, error) {
+	if err := checkLengthSizeMinusOne(lengthSizeMinusOne); err != nil {
+		return nil, err
+	}
+	sizeOfNALU := int(lengthSizeMinusOne) + 1
+
+	var buf bytes.Buffer
+	for b := data; len(b) > 0; {
+		if len(b) < sizeOfNALU {
+			return nil, errors.Errorf("requires %v+ only %v bytes", sizeOfNALU, len(b))
+		}
+
+		var length uint64
+		for i := 0; i < sizeOfNALU; i++ {
+			length |= uint64(b[i]) << uint8(8*(sizeOfNALU-1-i))
+		}
+		b = b[sizeOfNALU:]
+
+		if uint64(len(b)) < length {
+			return nil, errors.Errorf("requires %v only %v bytes", length, len(b))
+		}
+
+		buf.Write(AnnexBStartCode)
+		buf.Write(b[:length])
+		b = b[length:]
+	}
+	return buf.Bytes(), nil
+}
+
+// The reader to read NALUs from Annex B byte stream, such as a raw .h264 or .h265 file.
+type AnnexBReader struct {
+	r io.Reader
+	// The data not parsed, after the start code of current NALU.
+	buf []byte
+	// The size of buf already searched, which has no start code.
+	searched int
+	// Whether got the first start code.
+	started bool
+	eof     bool
+}
+
+func NewAnnexBReader(r io.Reader) *AnnexBReader {
+	return &AnnexBReader{r: r}
+}
+
+// Read the next NALU with header, which is EBSP with emulation prevention bytes.
+// @remark Return io.EOF when there is no more NALU.
+func (v *AnnexBReader) ReadNALU() ([]byte, error) {
+	for {
+		from := v.searched - len(annexBStartCode) + 1
+		if from < 0 {
+			from = 0
+		}
+
+		if pos := bytes.Index(v.buf[from:], annexBStartCode); pos >= 0 {
+			pos += from
+			head := v.buf[:pos]
+			v.buf, v.searched = v.buf[pos+len(annexBStartCode):], 0
+
+			if !v.started {
+				if !isLeadingZeros(head) {
+					return nil, errors.New("no start code")
+				}
+				v.started = true
+				continue
+			}
+
+			if nalu := trimTrailingZeros(head); len(nalu) > 0 {
+				return append([]byte(nil), nalu...), nil
+			}
+			continue
+		}
+		v.searched = len(v.buf)
+
+		if v.eof {
+			if !v.started && !isLeadingZeros(v.buf) {
+				return nil, errors.New("no start code")
+			}
+
+			nalu := trimTrailingZeros(v.buf)
+			v.buf, v.searched = nil, 0
+			if !v.started || len(nalu) == 0 {
+				return nil, io.EOF
+			}
+			return append([]byte(nil), nalu...), nil
+		}
+
+		b := make([]byte, 4096)
+		n, err := v.r.Read(b)
+		v.buf = append(v.buf, b[:n]...)
+		if err == io.EOF {
+			v.eof = true
+		} else if err != nil {
+			return nil, errors.Wrap(err, "read")
+		}
+	}
+}
+
+// Create the record from the raw SPS and PPS NALUs, with the NALU header.
+// The profile and level are parsed from the SPS.
+func NewAVCDecoderConfigurationRecordFromNALUs(sps, pps []byte) (*AVCDecoderConfigurationRecord, error) {
+	s := NewSequenceParameterSet()
+	if err := s.UnmarshalBinary(sps); err != nil {
+		return nil, errors.WithMessage(err, "sps")
+	}
+
+	if err := NewPictureParameterSet(s).UnmarshalBinary(pps); err != nil {
+		return nil, errors.WithMessage(err, "pps")
+	}
+
+	v := NewAVCDecoderConfigurationRecord()
+	v.AVCProfileIndication = AVCProfile(s.ProfileIDC)
+	v.profileCompatibility = s.ConstraintFlags
+	v.AVCLevelIndication = AVCLevel(s.LevelIDC)
+	v.LengthSizeMinusOne = 3
+
+	for _, e := range []struct {
+		b     []byte
+		units *[]*NALU
+	}{
+		{sps, &v.SequenceParameterSetNALUnits},
+		{pps, &v.PictureParameterSetNALUnits},
+	} {
+		nalu := NewNALU()
+		if err := nalu.UnmarshalBinary(e.b); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal")
+		}
+		*e.units = append(*e.units, nalu)
+	}
+
+	return v, nil
+}
+
+// Create the record from the Annex B byte stream, which must contain the SPS and PPS.
+// @remark We use the first SPS and PPS, and ignore others NALUs.
+func NewAVCDecoderConfigurationRecordFromAnnexB(data []byte) (*AVCDecoderConfigurationRecord, error) {
+	nalus, err := SplitAnnexB(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "split")
+	}
+
+	var sps, pps []byte
+	for _, nalu := range nalus {
+		switch NALUType(nalu[0] & 0x1f) {
+		case NALUTypeSPS:
+			if sps == nil {
+				sps = nalu
+			}
+		case NALUTypePPS:
+			if pps == nil {
+				pps = nalu
+			}
+		}
+	}
+
+	if sps == nil || pps == nil {
+		return nil, errors.Errorf("no sps or pps, sps=%vB, pps=%vB", len(sps), len(pps))
+	}
+	return NewAVCDecoderConfigurationRecordFromNALUs(sps, pps)
+}
@@ -0,0 +1,184 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package avc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSplitAnnexB(t *testing.T) {
+	for _, e := range []struct {
+		data   []byte
+		expect [][]byte
+	}{
+		{[]byte{0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xce}, [][]byte{{0x67, 0x42}, {0x68, 0xce}}},
+		{[]byte{0, 0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x65, 0x88, 0, 0}, [][]byte{{0x09, 0xf0}, {0x65, 0x88}}},
+		// The emulation prevention bytes, should not split.
+		{[]byte{0, 0, 1, 0x65, 0, 0, 3, 1, 0, 0, 3, 0, 0x80}, [][]byte{{0x65, 0, 0, 3, 1, 0, 0, 3, 0, 0x80}}},
+		// The empty NALU is ignored.
+		{[]byte{0, 0, 1, 0, 0, 1, 0x41, 0x9a}, [][]byte{{0x41, 0x9a}}},
+	} {
+		nalus, err := SplitAnnexB(e.data)
+		if err != nil {
+			t.Errorf("split %x failed %+v", e.data, err)
+			continue
+		}
+		if len(nalus) != len(e.expect) {
+			t.Errorf("invalid nalus %x, expect %x", nalus, e.expect)
+			continue
+		}
+		for i, nalu := range nalus {
+			if !bytes.Equal(nalu, e.expect[i]) {
+				t.Errorf("invalid nalu %x, expect %x", nalu, e.expect[i])
+			}
+		}
+
+		// Should be the same when read by reader.
+		r := NewAnnexBReader(iotest.OneByteReader(bytes.NewReader(e.data)))
+		for i := 0; ; i++ {
+			nalu, err := r.ReadNALU()
+			if err == io.EOF && i == len(e.expect) {
+				break
+			}
+			if err != nil || i >= len(e.expect) || !bytes.Equal(nalu, e.expect[i]) {
+				t.Errorf("invalid %v nalu %x of %x, err %+v", i, nalu, e.data, err)
+				break
+			}
+		}
+	}
+
+	for _, data := range [][]byte{nil, {0x67, 0x42}, {0x01, 0, 0, 1, 0x67}} {
+		if _, err := SplitAnnexB(data); err == nil {
+			t.Errorf("should error for %x", data)
+		}
+		if _, err := NewAnnexBReader(bytes.NewReader(data)).ReadNALU(); err == nil || (len(data) > 0 && err == io.EOF) {
+			t.Errorf("should error for %x, err %v", data, err)
+		}
+	}
+}
+
+func TestAnnexBReader_Large(t *testing.T) {
+	var nalus [][]byte
+	for i := 0; i < 16; i++ {
+		nalu := bytes.Repeat([]byte{0x41, byte(i + 1)}, 1000*i+1)
+		nalus = append(nalus, nalu)
+	}
+
+	r := NewAnnexBReader(bytes.NewReader(JoinAnnexB(nalus)))
+	for i := 0; i < len(nalus); i++ {
+		if nalu, err := r.ReadNALU(); err != nil || !bytes.Equal(nalu, nalus[i]) {
+			t.Fatalf("invalid %v nalu %vB, err %+v", i, len(nalu), err)
+		}
+	}
+	if _, err := r.ReadNALU(); err != io.EOF {
+		t.Errorf("should eof, err %+v", err)
+	}
+}
+
+func TestAddEmulationPrevention(t *testing.T) {
+	for _, e := range [][2][]byte{
+		{{0x00, 0x00, 0x01}, {0x00, 0x00, 0x03, 0x01}},
+		{{0x00, 0x00, 0x00, 0x00, 0x00}, {0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x03}},
+		{{0x01, 0x00, 0x04, 0x00}, {0x01, 0x00, 0x04, 0x00, 0x03}},
+	} {
+		ebsp := AddEmulationPrevention(e[0])
+		if !bytes.Equal(ebsp, e[1]) {
+			t.Errorf("invalid %x, expect %x", ebsp, e[1])
+		}
+		if rbsp := RemoveEmulationPrevention(ebsp); !bytes.Equal(rbsp[:len(e[0])], e[0]) {
+			t.Errorf("invalid %x, expect %x", rbsp, e[0])
+		}
+	}
+}
+
+func TestAnnexBToLengthPrefixed(t *testing.T) {
+	data := []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 1, 0x68, 0xce, 0x38}
+	for _, e := range []struct {
+		lengthSizeMinusOne uint8
+		expect             []byte
+	}{
+		{0, []byte{2, 0x67, 0x42, 3, 0x68, 0xce, 0x38}},
+		{1, []byte{0, 2, 0x67, 0x42, 0, 3, 0x68, 0xce, 0x38}},
+		{3, []byte{0, 0, 0, 2, 0x67, 0x42, 0, 0, 0, 3, 0x68, 0xce, 0x38}},
+	} {
+		b, err := AnnexBToLengthPrefixed(data, e.lengthSizeMinusOne)
+		if err != nil || !bytes.Equal(b, e.expect) {
+			t.Errorf("invalid %x, expect %x, err %+v", b, e.expect, err)
+			continue
+		}
+
+		// Should be decoded by the sample.
+		sample := NewAVCSample(e.lengthSizeMinusOne)
+		if err := sample.UnmarshalBinary(b); err != nil || len(sample.NALUs) != 2 || sample.NALUs[1].NALUType != NALUTypePPS {
+			t.Errorf("invalid sample %v, err %+v", sample.NALUs, err)
+		}
+
+		if b, err = LengthPrefixedToAnnexB(b, e.lengthSizeMinusOne); err != nil {
+			t.Errorf("convert failed %+v", err)
+		} else if expect := JoinAnnexB([][]byte{{0x67, 0x42}, {0x68, 0xce, 0x38}}); !bytes.Equal(b, expect) {
+			t.Errorf("invalid %x, expect %x", b, expect)
+		}
+	}
+
+	if _, err := AnnexBToLengthPrefixed(data, 2); err == nil {
+		t.Error("should error for 3 bytes length")
+	}
+	if _, err := AnnexBToLengthPrefixed(append([]byte{0, 0, 1}, make([]byte, 256)...), 0); err != nil {
+		t.Errorf("the trailing zeros should be ignored, err %+v", err)
+	}
+	if _, err := AnnexBToLengthPrefixed(append([]byte{0, 0, 1}, bytes.Repeat([]byte{1}, 256)...), 0); err == nil {
+		t.Error("should error for overflow")
+	}
+	if _, err := LengthPrefixedToAnnexB([]byte{0, 3, 0x67, 0x42}, 1); err == nil {
+		t.Error("should error for not enough")
+	}
+}
+
+func TestNewAVCDecoderConfigurationRecordFromAnnexB(t *testing.T) {
+	data := JoinAnnexB([][]byte{{0x09, 0xf0}, x264SPS, x264PPS, {0x65, 0x88, 0x84}})
+	r, err := NewAVCDecoderConfigurationRecordFromAnnexB(data)
+	if err != nil {
+		t.Fatalf("create failed %+v", err)
+	}
+	if r.AVCProfileIndication != AVCProfileHigh || r.AVCLevelIndication != AVCLevel_12 || r.LengthSizeMinusOne != 3 {
+		t.Errorf("invalid record %+v", r)
+	}
+	if s, err := r.SPS(); err != nil || s.Width() != 320 || s.Height() != 180 {
+		t.Errorf("invalid sps %+v, err %+v", s, err)
+	}
+
+	b, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+	v := NewAVCDecoderConfigurationRecord()
+	if err := v.UnmarshalBinary(b); err != nil || len(v.PictureParameterSetNALUnits) != 1 {
+		t.Errorf("invalid record %+v, err %+v", v, err)
+	}
+
+	if _, err := NewAVCDecoderConfigurationRecordFromAnnexB(JoinAnnexB([][]byte{x264SPS})); err == nil {
+		t.Error("should error for no pps")
+	}
+}
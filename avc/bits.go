@@ -0,0 +1,219 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package avc
+
+import (
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+var errBitsNotEnough = errors.New("bits not enough")
+
+// Remove the emulation_prevention_three_byte from EBSP, to get the RBSP.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 44, 7.3.1 NAL unit syntax
+func RemoveEmulationPrevention(ebsp []byte) (rbsp []byte) {
+	rbsp = make([]byte, 0, len(ebsp))
+	for i := 0; i < len(ebsp); i++ {
+		if i >= 2 && ebsp[i] == 0x03 && ebsp[i-1] == 0x00 && ebsp[i-2] == 0x00 && len(rbsp) >= 2 &&
+			rbsp[len(rbsp)-1] == 0x00 && rbsp[len(rbsp)-2] == 0x00 {
+			continue
+		}
+		rbsp = append(rbsp, ebsp[i])
+	}
+	return
+}
+
+// The bit reader for RBSP, MSB first, supports the Exp-Golomb codes.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 171, 9.1 Parsing process for Exp-Golomb codes
+type BitReader struct {
+	data []byte
+	// The position in bits.
+	pos int
+}
+
+func NewBitReader(data []byte) *BitReader {
+	return &BitReader{data: data}
+}
+
+// The number of bits left.
+func (v *BitReader) Left() int {
+	return len(v.data)*8 - v.pos
+}
+
+// Skip n bits.
+func (v *BitReader) Skip(n int) error {
+	if n < 0 || v.Left() < n {
+		return errBitsNotEnough
+	}
+	v.pos += n
+	return nil
+}
+
+// Read the u(1) as bool.
+func (v *BitReader) ReadFlag() (bool, error) {
+	b, err := v.ReadBits(1)
+	return b == 1, err
+}
+
+// Read the u(n), n is 0 to 32.
+func (v *BitReader) ReadBits(n int) (uint32, error) {
+	if n < 0 || n > 32 {
+		return 0, errors.Errorf("invalid bits %v", n)
+	}
+	if v.Left() < n {
+		return 0, errBitsNotEnough
+	}
+
+	var r uint32
+	for i := 0; i < n; i++ {
+		b := (v.data[v.pos/8] >> uint(7-v.pos%8)) & 0x01
+		r = r<<1 | uint32(b)
+		v.pos++
+	}
+	return r, nil
+}
+
+// Read the ue(v), the unsigned Exp-Golomb code.
+func (v *BitReader) ReadUE() (uint32, error) {
+	var leadingZeroBits int
+	for {
+		b, err := v.ReadBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+
+		if leadingZeroBits++; leadingZeroBits > 31 {
+			return 0, errors.New("ue overflow")
+		}
+	}
+
+	r, err := v.ReadBits(leadingZeroBits)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<uint(leadingZeroBits) - 1) + r, nil
+}
+
+// Read the se(v), the signed Exp-Golomb code.
+func (v *BitReader) ReadSE() (int32, error) {
+	k, err := v.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+
+	if k%2 == 1 {
+		return int32((k + 1) / 2), nil
+	}
+	return -int32(k / 2), nil
+}
+
+// Whether there is more data before the rbsp_trailing_bits.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 49, 7.2 Specification of syntax functions
+func (v *BitReader) MoreRBSPData() bool {
+	// Find the last 1 bit, which is the rbsp_stop_one_bit.
+	last := len(v.data) - 1
+	for last >= 0 && v.data[last] == 0 {
+		last--
+	}
+	if last < 0 {
+		return false
+	}
+
+	stop := last*8 + 7
+	for b := v.data[last]; b&0x01 == 0; b >>= 1 {
+		stop--
+	}
+	return v.pos < stop
+}
+
+// The bit reader which keeps the first error, to read many fields then check the error.
+type BitParser struct {
+	r   *BitReader
+	err error
+}
+
+func NewBitParser(data []byte) *BitParser {
+	return &BitParser{r: NewBitReader(data)}
+}
+
+// The first error, nil if all reads succeed.
+func (v *BitParser) Err() error {
+	return v.err
+}
+
+// Set the error if no error yet, to stop the following reads.
+func (v *BitParser) SetErr(err error) {
+	if v.err == nil {
+		v.err = err
+	}
+}
+
+// The number of bits left.
+func (v *BitParser) Left() int {
+	return v.r.Left()
+}
+
+// Whether there is more data before the rbsp_trailing_bits, false if error.
+func (v *BitParser) MoreRBSPData() bool {
+	return v.err == nil && v.r.MoreRBSPData()
+}
+
+// Read the u(n) or f(n), n is 0 to 32.
+func (v *BitParser) U(n int) (r uint32) {
+	if v.err == nil {
+		r, v.err = v.r.ReadBits(n)
+	}
+	return
+}
+
+// Read the u(1) as bool.
+func (v *BitParser) Flag() (r bool) {
+	if v.err == nil {
+		r, v.err = v.r.ReadFlag()
+	}
+	return
+}
+
+// Read the ue(v).
+func (v *BitParser) UE() (r uint32) {
+	if v.err == nil {
+		r, v.err = v.r.ReadUE()
+	}
+	return
+}
+
+// Read the se(v).
+func (v *BitParser) SE() (r int32) {
+	if v.err == nil {
+		r, v.err = v.r.ReadSE()
+	}
+	return
+}
+
+// Skip n bits.
+func (v *BitParser) Skip(n int) {
+	if v.err == nil {
+		v.err = v.r.Skip(n)
+	}
+}
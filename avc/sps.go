@@ -0,0 +1,604 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package avc
+
+import (
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// Parse the NALU bytes with header to RBSP, the nal_unit_type must be t.
+func nalToRBSP(data []byte, t NALUType) ([]byte, error) {
+	h := NewNALUHeader()
+	if err := h.UnmarshalBinary(data); err != nil {
+		return nil, errors.WithMessage(err, "header")
+	}
+	if h.NALUType != t {
+		return nil, errors.Errorf("require %v, actual %v", t, h.NALUType)
+	}
+	return RemoveEmulationPrevention(data[1:]), nil
+}
+
+// The SAR(sample aspect ratio) for aspect_ratio_idc 1 to 16.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 225, Table E-1 Meaning of sample aspect ratio indicator
+var sampleAspectRatios = [][2]uint16{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+// The aspect_ratio_idc for Extended_SAR, the SAR is in sar_width and sar_height.
+const AspectRatioExtendedSAR = 255
+
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 223, E.1.2 HRD parameters syntax
+type HRDParameters struct {
+	CPBCntMinus1                       uint32
+	BitRateScale                       uint8
+	CPBSizeScale                       uint8
+	BitRateValueMinus1                 []uint32
+	CPBSizeValueMinus1                 []uint32
+	CBRFlag                            []bool
+	InitialCPBRemovalDelayLengthMinus1 uint8
+	CPBRemovalDelayLengthMinus1        uint8
+	DPBOutputDelayLengthMinus1         uint8
+	TimeOffsetLength                   uint8
+}
+
+func (v *HRDParameters) parse(p *BitParser) {
+	v.CPBCntMinus1 = p.UE()
+	if v.CPBCntMinus1 > 31 {
+		p.SetErr(errors.Errorf("invalid cpb_cnt_minus1 %v", v.CPBCntMinus1))
+		return
+	}
+
+	v.BitRateScale = uint8(p.U(4))
+	v.CPBSizeScale = uint8(p.U(4))
+	for i := 0; i <= int(v.CPBCntMinus1); i++ {
+		v.BitRateValueMinus1 = append(v.BitRateValueMinus1, p.UE())
+		v.CPBSizeValueMinus1 = append(v.CPBSizeValueMinus1, p.UE())
+		v.CBRFlag = append(v.CBRFlag, p.Flag())
+	}
+	v.InitialCPBRemovalDelayLengthMinus1 = uint8(p.U(5))
+	v.CPBRemovalDelayLengthMinus1 = uint8(p.U(5))
+	v.DPBOutputDelayLengthMinus1 = uint8(p.U(5))
+	v.TimeOffsetLength = uint8(p.U(5))
+}
+
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 222, E.1.1 VUI parameters syntax
+type VUIParameters struct {
+	AspectRatioInfoPresentFlag bool
+	AspectRatioIDC             uint8
+	SARWidth                   uint16
+	SARHeight                  uint16
+
+	OverscanInfoPresentFlag bool
+	OverscanAppropriateFlag bool
+
+	VideoSignalTypePresentFlag   bool
+	VideoFormat                  uint8
+	VideoFullRangeFlag           bool
+	ColourDescriptionPresentFlag bool
+	ColourPrimaries              uint8
+	TransferCharacteristics      uint8
+	MatrixCoefficients           uint8
+
+	ChromaLocInfoPresentFlag       bool
+	ChromaSampleLocTypeTopField    uint32
+	ChromaSampleLocTypeBottomField uint32
+
+	TimingInfoPresentFlag bool
+	NumUnitsInTick        uint32
+	TimeScale             uint32
+	FixedFrameRateFlag    bool
+
+	// The HRD parameters, nil if not present.
+	NALHRDParameters *HRDParameters
+	VCLHRDParameters *HRDParameters
+	LowDelayHRDFlag  bool
+
+	PicStructPresentFlag bool
+
+	BitstreamRestrictionFlag           bool
+	MotionVectorsOverPicBoundariesFlag bool
+	MaxBytesPerPicDenom                uint32
+	MaxBitsPerMBDenom                  uint32
+	Log2MaxMVLengthHorizontal          uint32
+	Log2MaxMVLengthVertical            uint32
+	MaxNumReorderFrames                uint32
+	MaxDecFrameBuffering               uint32
+}
+
+func (v *VUIParameters) parse(p *BitParser) {
+	if v.AspectRatioInfoPresentFlag = p.Flag(); v.AspectRatioInfoPresentFlag {
+		v.AspectRatioIDC = uint8(p.U(8))
+		if v.AspectRatioIDC == AspectRatioExtendedSAR {
+			v.SARWidth = uint16(p.U(16))
+			v.SARHeight = uint16(p.U(16))
+		} else if int(v.AspectRatioIDC) < len(sampleAspectRatios) {
+			v.SARWidth, v.SARHeight = sampleAspectRatios[v.AspectRatioIDC][0], sampleAspectRatios[v.AspectRatioIDC][1]
+		}
+	}
+
+	if v.OverscanInfoPresentFlag = p.Flag(); v.OverscanInfoPresentFlag {
+		v.OverscanAppropriateFlag = p.Flag()
+	}
+
+	if v.VideoSignalTypePresentFlag = p.Flag(); v.VideoSignalTypePresentFlag {
+		v.VideoFormat = uint8(p.U(3))
+		v.VideoFullRangeFlag = p.Flag()
+		if v.ColourDescriptionPresentFlag = p.Flag(); v.ColourDescriptionPresentFlag {
+			v.ColourPrimaries = uint8(p.U(8))
+			v.TransferCharacteristics = uint8(p.U(8))
+			v.MatrixCoefficients = uint8(p.U(8))
+		}
+	}
+
+	if v.ChromaLocInfoPresentFlag = p.Flag(); v.ChromaLocInfoPresentFlag {
+		v.ChromaSampleLocTypeTopField = p.UE()
+		v.ChromaSampleLocTypeBottomField = p.UE()
+	}
+
+	if v.TimingInfoPresentFlag = p.Flag(); v.TimingInfoPresentFlag {
+		v.NumUnitsInTick = p.U(32)
+		v.TimeScale = p.U(32)
+		v.FixedFrameRateFlag = p.Flag()
+	}
+
+	if p.Flag() {
+		v.NALHRDParameters = &HRDParameters{}
+		v.NALHRDParameters.parse(p)
+	}
+	if p.Flag() {
+		v.VCLHRDParameters = &HRDParameters{}
+		v.VCLHRDParameters.parse(p)
+	}
+	if v.NALHRDParameters != nil || v.VCLHRDParameters != nil {
+		v.LowDelayHRDFlag = p.Flag()
+	}
+
+	v.PicStructPresentFlag = p.Flag()
+
+	if v.BitstreamRestrictionFlag = p.Flag(); v.BitstreamRestrictionFlag {
+		v.MotionVectorsOverPicBoundariesFlag = p.Flag()
+		v.MaxBytesPerPicDenom = p.UE()
+		v.MaxBitsPerMBDenom = p.UE()
+		v.Log2MaxMVLengthHorizontal = p.UE()
+		v.Log2MaxMVLengthVertical = p.UE()
+		v.MaxNumReorderFrames = p.UE()
+		v.MaxDecFrameBuffering = p.UE()
+	}
+}
+
+// The scaling list, nil if not present.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 52, 7.3.2.1.1.1 Scaling list syntax
+type ScalingList struct {
+	// The scaling values, 16 for 4x4 or 64 for 8x8.
+	List []uint8
+	// Whether to use the default scaling matrix.
+	UseDefaultScalingMatrixFlag bool
+}
+
+// Parse the scaling_list_present_flag and scaling lists, n is the number of lists.
+func parseScalingLists(p *BitParser, n int) (lists []*ScalingList) {
+	for i := 0; i < n; i++ {
+		if !p.Flag() {
+			lists = append(lists, nil)
+			continue
+		}
+
+		size := 16
+		if i >= 6 {
+			size = 64
+		}
+
+		sl := &ScalingList{List: make([]uint8, size)}
+		lastScale, nextScale := int32(8), int32(8)
+		for j := 0; j < size; j++ {
+			if nextScale != 0 {
+				deltaScale := p.SE()
+				nextScale = (lastScale + deltaScale + 256) % 256
+				sl.UseDefaultScalingMatrixFlag = j == 0 && nextScale == 0
+			}
+			if nextScale != 0 {
+				lastScale = nextScale
+			}
+			sl.List[j] = uint8(lastScale)
+		}
+		lists = append(lists, sl)
+	}
+	return
+}
+
+// Whether the profile_idc has the chroma_format_idc and scaling matrix in SPS.
+func hasChromaFormat(profileIDC uint8) bool {
+	switch profileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		return true
+	}
+	return false
+}
+
+// The SPS(sequence parameter set), parsed from the SPS NALU.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 47, 7.3.2.1 Sequence parameter set RBSP syntax
+type SequenceParameterSet struct {
+	ProfileIDC uint8
+	// The constraint_set0_flag to constraint_set5_flag, MSB is constraint_set0_flag, then 2bits reserved.
+	ConstraintFlags   uint8
+	LevelIDC          uint8
+	SeqParameterSetID uint32
+
+	// Default to 1(4:2:0) and 8bits, if not present.
+	ChromaFormatIDC                 uint32
+	SeparateColourPlaneFlag         bool
+	BitDepthLumaMinus8              uint32
+	BitDepthChromaMinus8            uint32
+	QPPrimeYZeroTransformBypassFlag bool
+	SeqScalingMatrixPresentFlag     bool
+	// The scaling lists, 6 for 4x4 then 2 or 6 for 8x8, the element is nil if not present.
+	ScalingLists []*ScalingList
+
+	Log2MaxFrameNumMinus4 uint32
+	PicOrderCntType       uint32
+	// For pic_order_cnt_type 0.
+	Log2MaxPicOrderCntLsbMinus4 uint32
+	// For pic_order_cnt_type 1.
+	DeltaPicOrderAlwaysZeroFlag bool
+	OffsetForNonRefPic          int32
+	OffsetForTopToBottomField   int32
+	OffsetForRefFrame           []int32
+
+	MaxNumRefFrames                uint32
+	GapsInFrameNumValueAllowedFlag bool
+	PicWidthInMbsMinus1            uint32
+	PicHeightInMapUnitsMinus1      uint32
+	FrameMbsOnlyFlag               bool
+	MbAdaptiveFrameFieldFlag       bool
+	Direct8x8InferenceFlag         bool
+
+	FrameCroppingFlag     bool
+	FrameCropLeftOffset   uint32
+	FrameCropRightOffset  uint32
+	FrameCropTopOffset    uint32
+	FrameCropBottomOffset uint32
+
+	// The VUI parameters, nil if not present.
+	VUI *VUIParameters
+}
+
+func NewSequenceParameterSet() *SequenceParameterSet {
+	return &SequenceParameterSet{}
+}
+
+// Unmarshal the SPS NALU, with the NALU header.
+func (v *SequenceParameterSet) UnmarshalBinary(data []byte) error {
+	rbsp, err := nalToRBSP(data, NALUTypeSPS)
+	if err != nil {
+		return errors.WithMessage(err, "sps")
+	}
+
+	p := NewBitParser(rbsp)
+
+	v.ProfileIDC = uint8(p.U(8))
+	v.ConstraintFlags = uint8(p.U(8))
+	v.LevelIDC = uint8(p.U(8))
+	v.SeqParameterSetID = p.UE()
+
+	v.ChromaFormatIDC = 1
+	if hasChromaFormat(v.ProfileIDC) {
+		if v.ChromaFormatIDC = p.UE(); v.ChromaFormatIDC == 3 {
+			v.SeparateColourPlaneFlag = p.Flag()
+		}
+		v.BitDepthLumaMinus8 = p.UE()
+		v.BitDepthChromaMinus8 = p.UE()
+		v.QPPrimeYZeroTransformBypassFlag = p.Flag()
+
+		if v.SeqScalingMatrixPresentFlag = p.Flag(); v.SeqScalingMatrixPresentFlag {
+			n := 8
+			if v.ChromaFormatIDC == 3 {
+				n = 12
+			}
+			v.ScalingLists = parseScalingLists(p, n)
+		}
+	}
+	if v.ChromaFormatIDC > 3 {
+		return errors.Errorf("invalid chroma_format_idc %v", v.ChromaFormatIDC)
+	}
+
+	v.Log2MaxFrameNumMinus4 = p.UE()
+	if v.PicOrderCntType = p.UE(); v.PicOrderCntType == 0 {
+		v.Log2MaxPicOrderCntLsbMinus4 = p.UE()
+	} else if v.PicOrderCntType == 1 {
+		v.DeltaPicOrderAlwaysZeroFlag = p.Flag()
+		v.OffsetForNonRefPic = p.SE()
+		v.OffsetForTopToBottomField = p.SE()
+
+		n := p.UE()
+		if n > 255 {
+			return errors.Errorf("invalid num_ref_frames_in_pic_order_cnt_cycle %v", n)
+		}
+		for i := 0; i < int(n) && p.Err() == nil; i++ {
+			v.OffsetForRefFrame = append(v.OffsetForRefFrame, p.SE())
+		}
+	}
+
+	v.MaxNumRefFrames = p.UE()
+	v.GapsInFrameNumValueAllowedFlag = p.Flag()
+	v.PicWidthInMbsMinus1 = p.UE()
+	v.PicHeightInMapUnitsMinus1 = p.UE()
+	if v.FrameMbsOnlyFlag = p.Flag(); !v.FrameMbsOnlyFlag {
+		v.MbAdaptiveFrameFieldFlag = p.Flag()
+	}
+	v.Direct8x8InferenceFlag = p.Flag()
+
+	if v.FrameCroppingFlag = p.Flag(); v.FrameCroppingFlag {
+		v.FrameCropLeftOffset = p.UE()
+		v.FrameCropRightOffset = p.UE()
+		v.FrameCropTopOffset = p.UE()
+		v.FrameCropBottomOffset = p.UE()
+	}
+
+	if p.Flag() {
+		v.VUI = &VUIParameters{}
+		v.VUI.parse(p)
+	}
+
+	if p.Err() != nil {
+		return errors.WithMessage(p.Err(), "sps")
+	}
+	return nil
+}
+
+// The ChromaArrayType, 0 for separate colour planes.
+func (v *SequenceParameterSet) ChromaArrayType() uint32 {
+	if v.SeparateColourPlaneFlag {
+		return 0
+	}
+	return v.ChromaFormatIDC
+}
+
+// The BitDepthY of luma.
+func (v *SequenceParameterSet) BitDepthLuma() int {
+	return 8 + int(v.BitDepthLumaMinus8)
+}
+
+// The BitDepthC of chroma.
+func (v *SequenceParameterSet) BitDepthChroma() int {
+	return 8 + int(v.BitDepthChromaMinus8)
+}
+
+// The CropUnitX and CropUnitY.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 77, 7.4.2.1.1 Sequence parameter set data semantics
+func (v *SequenceParameterSet) cropUnit() (x, y int) {
+	frameMbsOnly := 0
+	if v.FrameMbsOnlyFlag {
+		frameMbsOnly = 1
+	}
+
+	// The SubWidthC and SubHeightC for 4:2:0, 4:2:2 and 4:4:4.
+	subWidthC, subHeightC := 1, 1
+	switch v.ChromaArrayType() {
+	case 0:
+		return 1, 2 - frameMbsOnly
+	case 1:
+		subWidthC, subHeightC = 2, 2
+	case 2:
+		subWidthC, subHeightC = 2, 1
+	}
+	return subWidthC, subHeightC * (2 - frameMbsOnly)
+}
+
+// The width in pixels, after frame cropping.
+func (v *SequenceParameterSet) Width() int {
+	x, _ := v.cropUnit()
+	return (int(v.PicWidthInMbsMinus1)+1)*16 - x*int(v.FrameCropLeftOffset+v.FrameCropRightOffset)
+}
+
+// The height in pixels, after frame cropping.
+func (v *SequenceParameterSet) Height() int {
+	frameMbsOnly := 0
+	if v.FrameMbsOnlyFlag {
+		frameMbsOnly = 1
+	}
+
+	_, y := v.cropUnit()
+	return (2-frameMbsOnly)*(int(v.PicHeightInMapUnitsMinus1)+1)*16 - y*int(v.FrameCropTopOffset+v.FrameCropBottomOffset)
+}
+
+// The frame rate from VUI timing, 0 if not present.
+// @remark The frame rate is time_scale/(2*num_units_in_tick), for each frame is two fields.
+func (v *SequenceParameterSet) FrameRate() float64 {
+	if v.VUI == nil || !v.VUI.TimingInfoPresentFlag || v.VUI.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(v.VUI.TimeScale) / float64(2*uint64(v.VUI.NumUnitsInTick))
+}
+
+// The SAR(sample aspect ratio) from VUI, 0:0 if unspecified.
+func (v *SequenceParameterSet) SAR() (width, height uint16) {
+	if v.VUI == nil || !v.VUI.AspectRatioInfoPresentFlag {
+		return 0, 0
+	}
+	return v.VUI.SARWidth, v.VUI.SARHeight
+}
+
+// The PPS(picture parameter set), parsed from the PPS NALU.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 49, 7.3.2.2 Picture parameter set RBSP syntax
+type PictureParameterSet struct {
+	// The SPS to parse the scaling lists, nil to use 4:2:0.
+	sps *SequenceParameterSet
+
+	PicParameterSetID                  uint32
+	SeqParameterSetID                  uint32
+	EntropyCodingModeFlag              bool
+	BottomFieldPicOrderInFramePresent  bool
+	NumSliceGroupsMinus1               uint32
+	SliceGroupMapType                  uint32
+	RunLengthMinus1                    []uint32
+	TopLeft                            []uint32
+	BottomRight                        []uint32
+	SliceGroupChangeDirectionFlag      bool
+	SliceGroupChangeRateMinus1         uint32
+	PicSizeInMapUnitsMinus1            uint32
+	SliceGroupID                       []uint32
+	NumRefIdxL0DefaultActiveMinus1     uint32
+	NumRefIdxL1DefaultActiveMinus1     uint32
+	WeightedPredFlag                   bool
+	WeightedBipredIDC                  uint8
+	PicInitQPMinus26                   int32
+	PicInitQSMinus26                   int32
+	ChromaQPIndexOffset                int32
+	DeblockingFilterControlPresentFlag bool
+	ConstrainedIntraPredFlag           bool
+	RedundantPicCntPresentFlag         bool
+
+	// The extension for High profiles, if present.
+	Transform8x8ModeFlag        bool
+	PicScalingMatrixPresentFlag bool
+	ScalingLists                []*ScalingList
+	SecondChromaQPIndexOffset   int32
+}
+
+// Create the PPS, the sps is optional, used for the chroma_format_idc of scaling lists.
+func NewPictureParameterSet(sps *SequenceParameterSet) *PictureParameterSet {
+	return &PictureParameterSet{sps: sps}
+}
+
+// Unmarshal the PPS NALU, with the NALU header.
+func (v *PictureParameterSet) UnmarshalBinary(data []byte) error {
+	rbsp, err := nalToRBSP(data, NALUTypePPS)
+	if err != nil {
+		return errors.WithMessage(err, "pps")
+	}
+
+	p := NewBitParser(rbsp)
+
+	v.PicParameterSetID = p.UE()
+	v.SeqParameterSetID = p.UE()
+	v.EntropyCodingModeFlag = p.Flag()
+	v.BottomFieldPicOrderInFramePresent = p.Flag()
+
+	if v.NumSliceGroupsMinus1 = p.UE(); v.NumSliceGroupsMinus1 > 7 {
+		return errors.Errorf("invalid num_slice_groups_minus1 %v", v.NumSliceGroupsMinus1)
+	}
+	if v.NumSliceGroupsMinus1 > 0 {
+		switch v.SliceGroupMapType = p.UE(); v.SliceGroupMapType {
+		case 0:
+			for i := 0; i <= int(v.NumSliceGroupsMinus1); i++ {
+				v.RunLengthMinus1 = append(v.RunLengthMinus1, p.UE())
+			}
+		case 2:
+			for i := 0; i < int(v.NumSliceGroupsMinus1); i++ {
+				v.TopLeft = append(v.TopLeft, p.UE())
+				v.BottomRight = append(v.BottomRight, p.UE())
+			}
+		case 3, 4, 5:
+			v.SliceGroupChangeDirectionFlag = p.Flag()
+			v.SliceGroupChangeRateMinus1 = p.UE()
+		case 6:
+			// The bits of slice_group_id is Ceil(Log2(num_slice_groups_minus1+1)).
+			var bits int
+			for (1 << uint(bits)) < int(v.NumSliceGroupsMinus1)+1 {
+				bits++
+			}
+
+			v.PicSizeInMapUnitsMinus1 = p.UE()
+			if int(v.PicSizeInMapUnitsMinus1) >= p.Left() {
+				return errors.Errorf("invalid pic_size_in_map_units_minus1 %v", v.PicSizeInMapUnitsMinus1)
+			}
+			for i := 0; i <= int(v.PicSizeInMapUnitsMinus1); i++ {
+				v.SliceGroupID = append(v.SliceGroupID, p.U(bits))
+			}
+		}
+	}
+
+	v.NumRefIdxL0DefaultActiveMinus1 = p.UE()
+	v.NumRefIdxL1DefaultActiveMinus1 = p.UE()
+	v.WeightedPredFlag = p.Flag()
+	v.WeightedBipredIDC = uint8(p.U(2))
+	v.PicInitQPMinus26 = p.SE()
+	v.PicInitQSMinus26 = p.SE()
+	v.ChromaQPIndexOffset = p.SE()
+	v.DeblockingFilterControlPresentFlag = p.Flag()
+	v.ConstrainedIntraPredFlag = p.Flag()
+	v.RedundantPicCntPresentFlag = p.Flag()
+
+	v.SecondChromaQPIndexOffset = v.ChromaQPIndexOffset
+	if p.MoreRBSPData() {
+		v.Transform8x8ModeFlag = p.Flag()
+		if v.PicScalingMatrixPresentFlag = p.Flag(); v.PicScalingMatrixPresentFlag {
+			n := 6
+			if v.Transform8x8ModeFlag {
+				if v.sps != nil && v.sps.ChromaFormatIDC == 3 {
+					n += 6
+				} else {
+					n += 2
+				}
+			}
+			v.ScalingLists = parseScalingLists(p, n)
+		}
+		v.SecondChromaQPIndexOffset = p.SE()
+	}
+
+	if p.Err() != nil {
+		return errors.WithMessage(p.Err(), "pps")
+	}
+	return nil
+}
+
+// Parse the first SPS in record.
+func (v *AVCDecoderConfigurationRecord) SPS() (*SequenceParameterSet, error) {
+	if len(v.SequenceParameterSetNALUnits) == 0 {
+		return nil, errors.New("no sps")
+	}
+
+	b, err := v.SequenceParameterSetNALUnits[0].MarshalBinary()
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal")
+	}
+
+	sps := NewSequenceParameterSet()
+	if err = sps.UnmarshalBinary(b); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal")
+	}
+	return sps, nil
+}
+
+// Parse the first PPS in record, with the first SPS.
+func (v *AVCDecoderConfigurationRecord) PPS() (*PictureParameterSet, error) {
+	if len(v.PictureParameterSetNALUnits) == 0 {
+		return nil, errors.New("no pps")
+	}
+
+	sps, err := v.SPS()
+	if err != nil {
+		return nil, errors.WithMessage(err, "sps")
+	}
+
+	b, err := v.PictureParameterSetNALUnits[0].MarshalBinary()
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal")
+	}
+
+	pps := NewPictureParameterSet(sps)
+	if err = pps.UnmarshalBinary(b); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal")
+	}
+	return pps, nil
+}
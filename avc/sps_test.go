@@ -0,0 +1,298 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package avc
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The SPS and PPS in the avcC of testdata/sample.mp4 of github.com/abema/go-mp4, encoded by
+// x264 core 155 r2917, 320x180 10fps with cabac=1 ref=3 bframes=3 weightp=2 8x8dct=1 chroma_qp_offset=-2.
+var x264SPS = []byte{
+	0x67, 0x64, 0x00, 0x0c, 0xac, 0xd9, 0x41, 0x41, 0x9f, 0x9f, 0x01, 0x6c,
+	0x80, 0x00, 0x00, 0x03, 0x00, 0x80, 0x00, 0x00, 0x0a, 0x07, 0x8a, 0x14,
+	0xcb,
+}
+var x264PPS = []byte{0x68, 0xeb, 0xec, 0xb2, 0x2c}
+
+// The SPS captured from cameras, from the h264 tests of github.com/bluenviron/mediacommon.
+var (
+	// The Hikvision 1920x1080 25fps, with NAL and VCL HRD.
+	hikvisionSPS = []byte{
+		0x67, 0x4d, 0x00, 0x29, 0x9a, 0x64, 0x03, 0xc0, 0x11, 0x3f, 0x2e, 0x02,
+		0xdc, 0x04, 0x04, 0x05, 0x00, 0x00, 0x03, 0x03, 0xe8, 0x00, 0x00, 0xc3,
+		0x50, 0xe8, 0x60, 0x00, 0xba, 0xb4, 0x00, 0x02, 0xea, 0xc4, 0xbb, 0xcb,
+		0x8d, 0x0c, 0x00, 0x17, 0x56, 0x80, 0x00, 0x5d, 0x58, 0x97, 0x79, 0x70,
+		0xa0,
+	}
+	// The 1920x1080 interlaced, the frame_mbs_only_flag is 0.
+	interlacedSPS = []byte{
+		0x67, 0x4d, 0x40, 0x28, 0xab, 0x60, 0x3c, 0x02, 0x23, 0xef, 0x01, 0x10,
+		0x00, 0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0x2e, 0x94, 0x00,
+		0x35, 0x64, 0x06, 0xb2, 0x85, 0x08, 0x0e, 0xe2, 0xc5, 0x22, 0xc0,
+	}
+	// The 2560x1440 20fps, with the 4x4 scaling lists.
+	scalingSPS = []byte{
+		0x67, 0x64, 0x00, 0x32, 0xad, 0x84, 0x01, 0x0c, 0x20, 0x08, 0x61, 0x00,
+		0x43, 0x08, 0x02, 0x18, 0x40, 0x10, 0xc2, 0x00, 0x84, 0x3b, 0x50, 0x14,
+		0x00, 0x5a, 0xd3, 0x70, 0x10, 0x10, 0x14, 0x00, 0x00, 0x03, 0x00, 0x04,
+		0x00, 0x00, 0x03, 0x00, 0xa2, 0x10,
+	}
+)
+
+func TestBitReader(t *testing.T) {
+	// The ue 0,1,2,254, se 0,1,-1,-100, u(3) 5 and u(32) 0xdeadbeef, then the rbsp_trailing_bits.
+	r := NewBitReader([]byte{0xa6, 0x03, 0xfe, 0x98, 0x0c, 0x9b, 0xbd, 0x5b, 0x7d, 0xdf})
+	for _, expect := range []uint32{0, 1, 2, 254} {
+		if v, err := r.ReadUE(); err != nil || v != expect {
+			t.Errorf("invalid ue %v, expect %v, err %v", v, expect, err)
+		}
+	}
+	for _, expect := range []int32{0, 1, -1, -100} {
+		if v, err := r.ReadSE(); err != nil || v != expect {
+			t.Errorf("invalid se %v, expect %v, err %v", v, expect, err)
+		}
+	}
+	if v, err := r.ReadBits(3); err != nil || v != 5 {
+		t.Errorf("invalid bits %v %v", v, err)
+	}
+	if !r.MoreRBSPData() {
+		t.Error("should more data")
+	}
+	if v, err := r.ReadBits(32); err != nil || v != 0xdeadbeef {
+		t.Errorf("invalid bits %x %v", v, err)
+	}
+	if r.MoreRBSPData() {
+		t.Error("should no more data")
+	}
+	if _, err := r.ReadBits(r.Left() + 1); err == nil {
+		t.Error("should error")
+	}
+	if _, err := NewBitReader([]byte{0, 0, 0, 0}).ReadUE(); err == nil {
+		t.Error("should error")
+	}
+}
+
+func TestBitParser(t *testing.T) {
+	p := NewBitParser([]byte{0xa6})
+	if p.UE() != 0 || p.UE() != 1 || p.UE() != 2 || p.Err() != nil {
+		t.Errorf("invalid parser, err %v", p.Err())
+	}
+
+	// Keep the first error, and never read after error.
+	if v := p.U(8); v != 0 || p.Err() == nil {
+		t.Errorf("should error, v=%v", v)
+	}
+	err := p.Err()
+	if p.SetErr(errBitsNotEnough); p.Err() != err || p.Flag() || p.Left() != 1 || p.MoreRBSPData() {
+		t.Errorf("should keep first error %v", p.Err())
+	}
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	for _, e := range [][2][]byte{
+		{{0x00, 0x00, 0x03, 0x01}, {0x00, 0x00, 0x01}},
+		{{0x00, 0x00, 0x03, 0x03}, {0x00, 0x00, 0x03}},
+		{{0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00}, {0x00, 0x00, 0x00, 0x00, 0x00}},
+		{{0x01, 0x00, 0x03, 0x00}, {0x01, 0x00, 0x03, 0x00}},
+	} {
+		if v := RemoveEmulationPrevention(e[0]); !bytes.Equal(v, e[1]) {
+			t.Errorf("invalid %v, expect %v", v, e[1])
+		}
+	}
+}
+
+func TestSequenceParameterSet_X264(t *testing.T) {
+	sps := NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(x264SPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+
+	if sps.ProfileIDC != 100 || sps.LevelIDC != 12 || sps.ChromaFormatIDC != 1 || sps.BitDepthLuma() != 8 {
+		t.Errorf("invalid sps %+v", sps)
+	}
+	if sps.PicOrderCntType != 0 || sps.MaxNumRefFrames != 4 || !sps.FrameMbsOnlyFlag || !sps.Direct8x8InferenceFlag {
+		t.Errorf("invalid sps %+v", sps)
+	}
+	if sps.Width() != 320 || sps.Height() != 180 {
+		t.Errorf("invalid size %vx%v", sps.Width(), sps.Height())
+	}
+	if sps.FrameRate() != 10 {
+		t.Errorf("invalid fps %v", sps.FrameRate())
+	}
+	if w, h := sps.SAR(); w != 1 || h != 1 {
+		t.Errorf("invalid sar %v:%v", w, h)
+	}
+	if vui := sps.VUI; vui.VideoFormat != 5 || !vui.VideoFullRangeFlag || vui.FixedFrameRateFlag ||
+		vui.MaxNumReorderFrames != 2 || vui.MaxDecFrameBuffering != 4 {
+		t.Errorf("invalid vui %+v", vui)
+	}
+
+	// The record should parse the SPS.
+	r := NewAVCDecoderConfigurationRecord()
+	r.SequenceParameterSetNALUnits = append(r.SequenceParameterSetNALUnits, NewNALU())
+	r.SequenceParameterSetNALUnits[0].UnmarshalBinary(x264SPS)
+	if v, err := r.SPS(); err != nil || v.Width() != 320 {
+		t.Errorf("invalid sps %+v, err %+v", v, err)
+	}
+	if _, err := r.PPS(); err == nil {
+		t.Error("should no pps")
+	}
+
+	for i := 1; i < len(x264SPS)-1; i++ {
+		if err := NewSequenceParameterSet().UnmarshalBinary(x264SPS[:i]); err == nil {
+			t.Errorf("should error for %vB", i)
+		}
+	}
+	if err := NewSequenceParameterSet().UnmarshalBinary(x264PPS); err == nil {
+		t.Error("should error for pps")
+	}
+}
+
+func TestSequenceParameterSet_Camera(t *testing.T) {
+	sps := NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(hikvisionSPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if sps.ProfileIDC != 77 || sps.LevelIDC != 41 || sps.Width() != 1920 || sps.Height() != 1080 || sps.FrameRate() != 25 {
+		t.Errorf("invalid sps %+v", sps)
+	}
+	for _, hrd := range []*HRDParameters{sps.VUI.NALHRDParameters, sps.VUI.VCLHRDParameters} {
+		if hrd == nil || hrd.BitRateScale != 4 || hrd.CPBSizeScale != 3 || hrd.BitRateValueMinus1[0] != 11948 ||
+			hrd.CPBSizeValueMinus1[0] != 95585 || hrd.CBRFlag[0] || hrd.TimeOffsetLength != 24 {
+			t.Errorf("invalid hrd %+v", hrd)
+		}
+	}
+	if vui := sps.VUI; !vui.PicStructPresentFlag || vui.ColourPrimaries != 1 || vui.MatrixCoefficients != 1 {
+		t.Errorf("invalid vui %+v", vui)
+	}
+
+	sps = NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(interlacedSPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if sps.FrameMbsOnlyFlag || sps.PicHeightInMapUnitsMinus1 != 33 || sps.FrameCropBottomOffset != 2 {
+		t.Errorf("invalid sps %+v", sps)
+	}
+	if sps.Width() != 1920 || sps.Height() != 1080 || sps.FrameRate() != 25 {
+		t.Errorf("invalid size %vx%v fps %v", sps.Width(), sps.Height(), sps.FrameRate())
+	}
+	if vui := sps.VUI; vui.MaxBytesPerPicDenom != 2 || vui.Log2MaxMVLengthHorizontal != 10 || vui.MaxNumReorderFrames != 1 {
+		t.Errorf("invalid vui %+v", vui)
+	}
+
+	sps = NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(scalingSPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if !sps.SeqScalingMatrixPresentFlag || len(sps.ScalingLists) != 8 || sps.ScalingLists[6] != nil {
+		t.Errorf("invalid scaling lists %v", sps.ScalingLists)
+	}
+	for i := 0; i < 6; i++ {
+		if sl := sps.ScalingLists[i]; sl == nil || sl.UseDefaultScalingMatrixFlag || sl.List[0] != 16 || sl.List[15] != 16 {
+			t.Errorf("invalid scaling list %v %+v", i, sl)
+		}
+	}
+	if sps.PicOrderCntType != 2 || sps.Width() != 2560 || sps.Height() != 1440 || sps.FrameRate() != 20 {
+		t.Errorf("invalid sps %+v", sps)
+	}
+}
+
+// The SPS of High 4:2:2 with 10bits luma, default scaling list, poc type 1 and extended SAR, which are rarely used
+// by encoders, so it's crafted to cover the syntax.
+func TestSequenceParameterSet_Crafted(t *testing.T) {
+	sps := NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary([]byte{
+		0x67, 0x64, 0x00, 0x1f, 0x4d, 0xd8, 0x44, 0x05, 0x0a, 0x66, 0x9b, 0x02,
+		0xd0, 0x93, 0xf2, 0xff, 0xe0, 0x00, 0x80, 0x00, 0x62, 0x00, 0x00, 0x07,
+		0xd2, 0x00, 0x01, 0xd4, 0xc0, 0xc8, 0xc0, 0x1f, 0x40, 0x01, 0xf4, 0x37,
+		0xbd, 0xf0, 0x90,
+	}); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+
+	if sps.ChromaFormatIDC != 2 || sps.BitDepthLuma() != 10 || sps.BitDepthChroma() != 8 {
+		t.Errorf("invalid chroma %v %v %v", sps.ChromaFormatIDC, sps.BitDepthLuma(), sps.BitDepthChroma())
+	}
+	if len(sps.ScalingLists) != 8 || sps.ScalingLists[0] == nil || !sps.ScalingLists[0].UseDefaultScalingMatrixFlag ||
+		sps.ScalingLists[1] != nil {
+		t.Errorf("invalid scaling lists %v", sps.ScalingLists)
+	}
+	if sps.PicOrderCntType != 1 || sps.OffsetForNonRefPic != -2 || len(sps.OffsetForRefFrame) != 2 {
+		t.Errorf("invalid poc %+v", sps)
+	}
+	if sps.Width() != 720 || sps.Height() != 568 {
+		t.Errorf("invalid size %vx%v", sps.Width(), sps.Height())
+	}
+	if fps := sps.FrameRate(); fps < 29.97 || fps > 29.98 {
+		t.Errorf("invalid fps %v", fps)
+	}
+	if w, h := sps.SAR(); w != 4 || h != 3 {
+		t.Errorf("invalid sar %v:%v", w, h)
+	}
+	if hrd := sps.VUI.NALHRDParameters; hrd == nil || hrd.BitRateValueMinus1[0] != 999 || hrd.TimeOffsetLength != 24 {
+		t.Errorf("invalid hrd %+v", hrd)
+	}
+	if !sps.VUI.LowDelayHRDFlag || sps.VUI.VCLHRDParameters != nil {
+		t.Errorf("invalid vui %+v", sps.VUI)
+	}
+}
+
+func TestPictureParameterSet(t *testing.T) {
+	sps := NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(x264SPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+
+	pps := NewPictureParameterSet(sps)
+	if err := pps.UnmarshalBinary(x264PPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if !pps.EntropyCodingModeFlag || pps.NumRefIdxL0DefaultActiveMinus1 != 2 || !pps.WeightedPredFlag ||
+		pps.WeightedBipredIDC != 2 || pps.PicInitQPMinus26 != 0 || pps.ChromaQPIndexOffset != -2 ||
+		!pps.DeblockingFilterControlPresentFlag {
+		t.Errorf("invalid pps %+v", pps)
+	}
+	if !pps.Transform8x8ModeFlag || pps.PicScalingMatrixPresentFlag || pps.SecondChromaQPIndexOffset != -2 {
+		t.Errorf("invalid extension %+v", pps)
+	}
+	if err := NewPictureParameterSet(sps).UnmarshalBinary(x264SPS); err == nil {
+		t.Error("should error for sps")
+	}
+
+	// The crafted PPS with slice groups of map type 6 and 8x8 scaling list, which are rarely used by encoders.
+	pps = NewPictureParameterSet(&SequenceParameterSet{ChromaFormatIDC: 1})
+	if err := pps.UnmarshalBinary([]byte{
+		0x68, 0x59, 0x1c, 0x8b, 0x8d, 0x5c, 0x04, 0x21, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xfd, 0xc0,
+	}); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if pps.NumSliceGroupsMinus1 != 1 || pps.SliceGroupMapType != 6 || len(pps.SliceGroupID) != 4 || pps.SliceGroupID[1] != 1 {
+		t.Errorf("invalid slice groups %+v", pps)
+	}
+	if !pps.Transform8x8ModeFlag || len(pps.ScalingLists) != 8 || pps.ScalingLists[7] == nil ||
+		pps.ScalingLists[7].List[63] != 16 || pps.SecondChromaQPIndexOffset != -1 {
+		t.Errorf("invalid extension %+v", pps)
+	}
+}
@@ -22,8 +22,10 @@
 package flv_test
 
 import (
+	"fmt"
 	"github.com/ossrs/go-oryx-lib/flv"
 	"io"
+	"os"
 )
 
 func ExampleDemuxer() {
@@ -66,6 +68,44 @@ func ExampleDemuxer() {
 	_ = tag
 }
 
+func ExampleNewDemuxerWithOptions() {
+	// To open a damaged flv file, for example, a truncated recording.
+	var r io.Reader
+
+	var err error
+	var f flv.Demuxer
+	if f, err = flv.NewDemuxerWithOptions(r, &flv.DemuxerOptions{
+		// Skip the corrupt bytes and continue at the next plausible tag.
+		Resync: true,
+		OnCorrupt: func(err *flv.CorruptError) {
+			// Optional, user can log the offset of corruption.
+			_ = err.Offset
+		},
+	}); err != nil {
+		return
+	}
+	defer f.Close()
+
+	if _, _, _, err = f.ReadHeader(); err != nil {
+		return
+	}
+
+	for {
+		var tagSize uint32
+		if _, tagSize, _, err = f.ReadTagHeader(); err != nil {
+			return
+		}
+
+		var tag []byte
+		if tag, err = f.ReadTag(tagSize); err != nil {
+			// The *flv.CorruptError for truncated tag.
+			return
+		}
+
+		_ = tag
+	}
+}
+
 func ExampleMuxer() {
 	// To open a flv file or http post stream.
 	var w io.Writer
@@ -89,3 +129,84 @@ func ExampleMuxer() {
 		return
 	}
 }
+
+func ExampleReader() {
+	// To open a flv file, for VOD or DVR.
+	var r io.ReadSeeker
+
+	var err error
+	var f flv.Reader
+	if f, err = flv.NewReader(r); err != nil {
+		return
+	}
+	defer f.Close()
+
+	// Optional, user can get the duration in ms.
+	_ = f.Duration()
+
+	// Seek to the keyframe at or before 30s.
+	if _, err = f.SeekToTime(30 * 1000); err != nil {
+		return
+	}
+
+	for {
+		var tagType flv.TagType
+		var timestamp uint32
+		var tag []byte
+		if tagType, timestamp, tag, err = f.ReadTag(); err != nil {
+			return
+		}
+
+		// Using the FLV tag type, dts and body.
+		_ = tagType
+		_ = timestamp
+		_ = tag
+	}
+}
+
+func ExampleRecorder() {
+	// To record to a flv file, which is seekable.
+	var w io.WriteSeeker
+
+	var err error
+	var f flv.Recorder
+	if f, err = flv.NewRecorder(w, &flv.RecorderOptions{HasVideo: true, HasAudio: true}); err != nil {
+		return
+	}
+	// The duration, filesize and keyframes in onMetaData is updated when closed.
+	defer f.Close()
+
+	var tagType flv.TagType
+	var timestamp uint32
+	var tag []byte
+	// Get a FLV tag to write to recorder.
+	if err = f.WriteTag(tagType, timestamp, tag); err != nil {
+		return
+	}
+}
+
+func ExampleNewSegmentedRecorder() {
+	var err error
+	var f flv.Recorder
+	if f, err = flv.NewSegmentedRecorder(&flv.SegmentOptions{
+		RecorderOptions: flv.RecorderOptions{HasVideo: true, HasAudio: true},
+		// Start a new segment at the keyframe every 60s.
+		Duration: 60 * 1000,
+		Create: func(index int) (io.WriteSeeker, error) {
+			return os.Create(fmt.Sprintf("record-%v.flv", index))
+		},
+		OnClose: func(index int, w io.WriteSeeker) error {
+			return w.(*os.File).Close()
+		},
+	}); err != nil {
+		return
+	}
+	defer f.Close()
+
+	var tagType flv.TagType
+	var timestamp uint32
+	var tag []byte
+	if err = f.WriteTag(tagType, timestamp, tag); err != nil {
+		return
+	}
+}
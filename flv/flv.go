@@ -24,7 +24,9 @@ package flv
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/ossrs/go-oryx-lib/aac"
 	"io"
 	"strings"
@@ -59,7 +61,7 @@ func (v TagType) String() string {
 // A FLV file must consist the bellow parts:
 //	1. A FLV header, refer to @doc video_file_format_spec_v10.pdf, @page 8, @section The FLV header
 //	2. One or more tags, refer to @doc video_file_format_spec_v10.pdf, @page 9, @section FLV tags
-// @remark We always ignore the previous tag size.
+// @remark We ignore the previous tag size, except for the strict mode, see DemuxerOptions.
 type Demuxer interface {
 	// Read the FLV header, return the version of FLV, whether hasVideo or hasAudio in header.
 	ReadHeader() (version uint8, hasVideo, hasAudio bool, err error)
@@ -75,6 +77,36 @@ type Demuxer interface {
 // When FLV signature is not "FLV"
 var errSignature = errors.New("FLV signatures are illegal")
 
+// The options of FLV demuxer, for integrity checks and recovery of damaged stream.
+type DemuxerOptions struct {
+	// Whether validate the header, tag header and previous tag size,
+	// return *CorruptError with the byte offset when corrupt or truncated.
+	Strict bool
+	// Whether scan forward for the next plausible tag header when the tag header is corrupt,
+	// instead of returning error, which implies the Strict.
+	Resync bool
+	// For resync mode, the optional callback for each recovered corruption, for example,
+	// the skipped corrupt bytes, or the mismatched previous tag size.
+	OnCorrupt func(err *CorruptError)
+}
+
+// The error of corrupt or truncated FLV stream, in strict or resync mode.
+type CorruptError struct {
+	// The byte offset in stream, where the corrupt tag or previous tag size starts.
+	Offset int64
+	// The reason of corruption.
+	Reason string
+	// For resync mode, the number of bytes skipped to the next plausible tag header.
+	Skipped int64
+}
+
+func (v *CorruptError) Error() string {
+	if v.Skipped > 0 {
+		return fmt.Sprintf("FLV corrupt at %v, %v, skipped %v bytes", v.Offset, v.Reason, v.Skipped)
+	}
+	return fmt.Sprintf("FLV corrupt at %v, %v", v.Offset, v.Reason)
+}
+
 // Create a demuxer object.
 func NewDemuxer(r io.Reader) (Demuxer, error) {
 	return &demuxer{
@@ -82,11 +114,33 @@ func NewDemuxer(r io.Reader) (Demuxer, error) {
 	}, nil
 }
 
+// Create a demuxer object with options, for strict or resync mode.
+func NewDemuxerWithOptions(r io.Reader, opts *DemuxerOptions) (Demuxer, error) {
+	if opts == nil || (!opts.Strict && !opts.Resync) {
+		return NewDemuxer(r)
+	}
+
+	return &demuxer{
+		r:    r,
+		opts: opts,
+	}, nil
+}
+
 type demuxer struct {
 	r io.Reader
+	// For strict or resync mode, the options and the peeked bytes.
+	opts *DemuxerOptions
+	buf  []byte
+	// The number of bytes consumed from reader, and the offset of last tag, in strict or resync mode.
+	offset    int64
+	tagOffset int64
 }
 
 func (v *demuxer) ReadHeader() (version uint8, hasVideo, hasAudio bool, err error) {
+	if v.opts != nil {
+		return v.readHeaderStrict()
+	}
+
 	h := &bytes.Buffer{}
 	if _, err = io.CopyN(h, v.r, 13); err != nil {
 		return
@@ -107,21 +161,25 @@ func (v *demuxer) ReadHeader() (version uint8, hasVideo, hasAudio bool, err erro
 }
 
 func (v *demuxer) ReadTagHeader() (tagType TagType, tagSize uint32, timestamp uint32, err error) {
+	if v.opts != nil {
+		return v.readTagHeaderStrict()
+	}
+
 	h := &bytes.Buffer{}
 	if _, err = io.CopyN(h, v.r, 11); err != nil {
 		return
 	}
 
-	p := h.Bytes()
-
-	tagType = TagType(p[0])
-	tagSize = uint32(p[1])<<16 | uint32(p[2])<<8 | uint32(p[3])
-	timestamp = uint32(p[7])<<24 | uint32(p[4])<<16 | uint32(p[5])<<8 | uint32(p[6])
+	tagType, tagSize, timestamp = parseTagHeader(h.Bytes())
 
 	return
 }
 
 func (v *demuxer) ReadTag(tagSize uint32) (tag []byte, err error) {
+	if v.opts != nil {
+		return v.readTagStrict(tagSize)
+	}
+
 	h := &bytes.Buffer{}
 	if _, err = io.CopyN(h, v.r, int64(tagSize+4)); err != nil {
 		return
@@ -137,6 +195,201 @@ func (v *demuxer) Close() error {
 	return nil
 }
 
+// Parse the 11 bytes FLV tag header.
+// Refer to @doc video_file_format_spec_v10.pdf, @page 9, @section FLV tags
+func parseTagHeader(p []byte) (tagType TagType, tagSize uint32, timestamp uint32) {
+	tagType = TagType(p[0])
+	tagSize = uint32(p[1])<<16 | uint32(p[2])<<8 | uint32(p[3])
+	timestamp = uint32(p[7])<<24 | uint32(p[4])<<16 | uint32(p[5])<<8 | uint32(p[6])
+	return
+}
+
+// Check the 11 bytes FLV tag header, return the reason if corrupt.
+// The reserved and filter bits must be 0, the tag type must be audio, video or script data,
+// and the StreamID must be 0.
+func checkTagHeader(p []byte) (reason string) {
+	if p[0]&0xe0 != 0 {
+		return fmt.Sprintf("invalid reserved or filter bits %#x", p[0])
+	}
+	switch TagType(p[0]) {
+	case TagTypeAudio, TagTypeVideo, TagTypeScriptData:
+	default:
+		return fmt.Sprintf("invalid tag type %v", p[0])
+	}
+	if p[8] != 0 || p[9] != 0 || p[10] != 0 {
+		return "invalid stream id"
+	}
+	return
+}
+
+// Peek n bytes from reader, return the available bytes with error when not enough.
+func (v *demuxer) peek(n int) ([]byte, error) {
+	if len(v.buf) < n {
+		b := make([]byte, n-len(v.buf))
+		nn, err := io.ReadFull(v.r, b)
+		v.buf = append(v.buf, b[:nn]...)
+		if err != nil {
+			return v.buf, err
+		}
+	}
+	return v.buf[:n], nil
+}
+
+// Consume n bytes which is peeked.
+func (v *demuxer) consume(n int) {
+	v.buf = v.buf[n:]
+	v.offset += int64(n)
+}
+
+func (v *demuxer) readHeaderStrict() (version uint8, hasVideo, hasAudio bool, err error) {
+	var p []byte
+	if p, err = v.peek(13); err != nil {
+		if len(p) > 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			err = &CorruptError{Offset: v.offset, Reason: fmt.Sprintf("truncated header, %v of 13 bytes", len(p))}
+		}
+		return
+	}
+	v.consume(13)
+
+	if !bytes.Equal([]byte{byte('F'), byte('L'), byte('V')}, p[:3]) {
+		err = errSignature
+		return
+	}
+
+	// The DataOffset must be 9 for version 1, and the PreviousTagSize0 must be 0.
+	if dataOffset := binary.BigEndian.Uint32(p[5:]); dataOffset != 9 {
+		err = &CorruptError{Offset: 5, Reason: fmt.Sprintf("invalid data offset %v", dataOffset)}
+		return
+	}
+	if previousTagSize := binary.BigEndian.Uint32(p[9:]); previousTagSize != 0 {
+		err = &CorruptError{Offset: 9, Reason: fmt.Sprintf("invalid previous tag size %v", previousTagSize)}
+		return
+	}
+
+	version = uint8(p[3])
+	hasVideo = (p[4] & 0x01) == 0x01
+	hasAudio = ((p[4] >> 2) & 0x01) == 0x01
+
+	return
+}
+
+func (v *demuxer) readTagHeaderStrict() (tagType TagType, tagSize uint32, timestamp uint32, err error) {
+	var resync *CorruptError
+	for {
+		var p []byte
+		if p, err = v.peek(11); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return
+			}
+
+			// For resync mode, the trailing bytes are skipped.
+			if v.opts.Resync && len(p) > 0 {
+				if resync == nil {
+					resync = &CorruptError{Offset: v.offset, Reason: "truncated tag header"}
+				}
+				resync.Skipped += int64(len(p))
+				v.consume(len(p))
+			}
+			if resync != nil {
+				v.notifyCorrupt(resync)
+			}
+
+			if len(p) == 0 || v.opts.Resync {
+				err = io.EOF
+			} else {
+				err = &CorruptError{Offset: v.offset, Reason: fmt.Sprintf("truncated tag header, %v of 11 bytes", len(p))}
+			}
+			return
+		}
+
+		reason := checkTagHeader(p)
+		if reason == "" && v.opts.Resync {
+			reason = v.checkTagTrailer(p)
+		}
+
+		if reason == "" {
+			if resync != nil {
+				v.notifyCorrupt(resync)
+			}
+
+			tagType, tagSize, timestamp = parseTagHeader(p)
+			v.tagOffset = v.offset
+			v.consume(11)
+			return
+		}
+
+		if !v.opts.Resync {
+			err = &CorruptError{Offset: v.offset, Reason: reason}
+			return
+		}
+
+		// Skip a byte, then try the next position.
+		if resync == nil {
+			resync = &CorruptError{Offset: v.offset, Reason: reason}
+		}
+		resync.Skipped++
+		v.consume(1)
+	}
+}
+
+// For resync mode, check the previous tag size after the tag body, or the next tag header.
+// The tag is plausible when the previous tag size matches, the next tag header is valid,
+// or the stream is end.
+func (v *demuxer) checkTagTrailer(h []byte) (reason string) {
+	_, tagSize, _ := parseTagHeader(h)
+
+	p, err := v.peek(11 + int(tagSize) + 4 + 11)
+	if err != nil && len(p) < 11+int(tagSize)+4 {
+		return
+	}
+
+	trailer := p[11+int(tagSize):]
+	if previousTagSize := binary.BigEndian.Uint32(trailer); previousTagSize == 11+tagSize {
+		return
+	}
+	if len(trailer) < 4+11 || checkTagHeader(trailer[4:]) == "" {
+		return
+	}
+	return "invalid previous tag size and next tag header"
+}
+
+func (v *demuxer) notifyCorrupt(err *CorruptError) {
+	if v.opts.OnCorrupt != nil {
+		v.opts.OnCorrupt(err)
+	}
+}
+
+func (v *demuxer) readTagStrict(tagSize uint32) (tag []byte, err error) {
+	var p []byte
+	if p, err = v.peek(int(tagSize) + 4); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = &CorruptError{
+				Offset: v.tagOffset,
+				Reason: fmt.Sprintf("truncated tag, %v of %v bytes", len(p), int(tagSize)+4),
+			}
+		}
+		return
+	}
+	v.consume(int(tagSize) + 4)
+
+	// The previous tag size is the size of tag header and body.
+	if previousTagSize := binary.BigEndian.Uint32(p[tagSize:]); previousTagSize != 11+tagSize {
+		corrupt := &CorruptError{
+			Offset: v.offset - 4,
+			Reason: fmt.Sprintf("invalid previous tag size %v, expect %v", previousTagSize, 11+tagSize),
+		}
+
+		// For resync mode, the tag is still plausible, for the next tag header is checked.
+		if !v.opts.Resync {
+			return nil, corrupt
+		}
+		v.notifyCorrupt(corrupt)
+	}
+
+	tag = append([]byte(nil), p[:tagSize]...)
+	return
+}
+
 // The FLV muxer is used to write packet in FLV protocol.
 // Refer to @doc video_file_format_spec_v10.pdf, @page 74, @section Annex E. The FLV File Format
 type Muxer interface {
@@ -432,7 +685,7 @@ const (
 	AudioCodecNellymoser                        // 6 = Nellymoser
 	AudioCodecG711Alaw                          // 7 = G.711 A-law logarithmic PCM
 	AudioCodecG711MuLaw                         // 8 = G.711 mu-law logarithmic PCM
-	AudioCodecReserved                          // 9 = reserved
+	AudioCodecReserved                          // 9 = reserved, for Enhanced RTMP, it's ExHeader.
 	AudioCodecAAC                               // 10 = AAC
 	AudioCodecSpeex                             // 11 = Speex
 	AudioCodecUndefined12
@@ -443,6 +696,9 @@ const (
 	AudioCodecForbidden
 )
 
+// For Enhanced RTMP, the SoundFormat 9 means the ExHeader, followed by the FourCC.
+const AudioCodecExHeader = AudioCodecReserved
+
 func (v AudioCodec) String() string {
 	switch v {
 	case AudioCodecLinearPCM:
@@ -463,6 +719,8 @@ func (v AudioCodec) String() string {
 		return "G.711(A-law)"
 	case AudioCodecG711MuLaw:
 		return "G.711(mu-law)"
+	case AudioCodecExHeader:
+		return "ExHeader"
 	case AudioCodecAAC:
 		return "AAC"
 	case AudioCodecSpeex:
@@ -478,6 +736,103 @@ func (v AudioCodec) String() string {
 	}
 }
 
+// The Enhanced RTMP audio FourCC, when SoundFormat is AudioCodecExHeader.
+// Refer to @doc enhanced-rtmp-v2.pdf, @section Enhanced Audio
+type AudioFourCC uint32
+
+const (
+	AudioFourCCOpus AudioFourCC = 'O'<<24 | 'p'<<16 | 'u'<<8 | 's'
+	AudioFourCCFLAC AudioFourCC = 'f'<<24 | 'L'<<16 | 'a'<<8 | 'C'
+	AudioFourCCAC3  AudioFourCC = 'a'<<24 | 'c'<<16 | '-'<<8 | '3'
+	AudioFourCCEAC3 AudioFourCC = 'e'<<24 | 'c'<<16 | '-'<<8 | '3'
+	AudioFourCCAAC  AudioFourCC = 'm'<<24 | 'p'<<16 | '4'<<8 | 'a'
+	AudioFourCCMP3  AudioFourCC = '.'<<24 | 'm'<<16 | 'p'<<8 | '3'
+)
+
+func (v AudioFourCC) String() string {
+	return string([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+// The Enhanced RTMP audio packet type, when SoundFormat is AudioCodecExHeader.
+// Refer to @doc enhanced-rtmp-v2.pdf, @section Enhanced Audio
+// It's 4bits, that is 0-15.
+type AudioPacketType uint8
+
+const (
+	AudioPacketTypeSequenceStart      AudioPacketType = 0 // 0 = Sequence start, for example, the OpusHead.
+	AudioPacketTypeCodedFrames        AudioPacketType = 1 // 1 = Coded frames.
+	AudioPacketTypeSequenceEnd        AudioPacketType = 2 // 2 = Sequence end.
+	AudioPacketTypeMultichannelConfig AudioPacketType = 4 // 4 = Multichannel config.
+	AudioPacketTypeMultitrack         AudioPacketType = 5 // 5 = Multitrack, not supported.
+	AudioPacketTypeModEx              AudioPacketType = 7 // 7 = Mod extension, not supported.
+)
+
+func (v AudioPacketType) String() string {
+	switch v {
+	case AudioPacketTypeSequenceStart:
+		return "SequenceStart"
+	case AudioPacketTypeCodedFrames:
+		return "CodedFrames"
+	case AudioPacketTypeSequenceEnd:
+		return "SequenceEnd"
+	case AudioPacketTypeMultichannelConfig:
+		return "MultichannelConfig"
+	case AudioPacketTypeMultitrack:
+		return "Multitrack"
+	case AudioPacketTypeModEx:
+		return "ModEx"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The trait of packet type, for user to process the enhanced frame as legacy.
+func (v AudioPacketType) Trait() AudioFrameTrait {
+	switch v {
+	case AudioPacketTypeSequenceStart:
+		return AudioFrameTraitSequenceHeader
+	case AudioPacketTypeCodedFrames:
+		return AudioFrameTraitRaw
+	default:
+		return AudioFrameTraitForbidden
+	}
+}
+
+// The audio channel order of multichannel config.
+// Refer to @doc enhanced-rtmp-v2.pdf, @section Enhanced Audio
+type AudioChannelOrder uint8
+
+const (
+	AudioChannelOrderUnspecified AudioChannelOrder = iota // 0 = Only the channel count.
+	AudioChannelOrderNative                               // 1 = The channel flags of native order.
+	AudioChannelOrderCustom                               // 2 = The channel mapping of custom order.
+)
+
+func (v AudioChannelOrder) String() string {
+	switch v {
+	case AudioChannelOrderUnspecified:
+		return "Unspecified"
+	case AudioChannelOrderNative:
+		return "Native"
+	case AudioChannelOrderCustom:
+		return "Custom"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The multichannel config, for AudioPacketTypeMultichannelConfig.
+type AudioMultichannelConfig struct {
+	Order AudioChannelOrder
+	Count uint8
+	// For native order, the bit mask of channels, for example, 0x3 for FrontLeft and FrontRight.
+	Flags uint32
+	// For custom order, the channel of each index, length is Count.
+	Mapping []uint8
+}
+
+// The audio frame, the legacy FLV audio tag or Enhanced RTMP audio tag if IsExHeader.
+// For Enhanced RTMP, the Trait is set by PacketType when decoding, to process the frame as legacy.
 type AudioFrame struct {
 	SoundFormat AudioCodec
 	SoundRate   AudioSamplingRate
@@ -486,10 +841,17 @@ type AudioFrame struct {
 	Trait       AudioFrameTrait
 	AudioLevel  uint16
 	Raw         []byte
+	// Whether it's Enhanced RTMP audio tag, with the FourCC and PacketType.
+	IsExHeader bool
+	FourCC     AudioFourCC
+	PacketType AudioPacketType
+	// For AudioPacketTypeMultichannelConfig, the multichannel config.
+	Multichannel *AudioMultichannelConfig
 }
 
 // The packager used to codec the FLV audio tag body.
 // Refer to @doc video_file_format_spec_v10.pdf, @page 76, @section E.4.2 Audio Tags
+// Refer to @doc enhanced-rtmp-v2.pdf, @section Enhanced Audio
 type AudioPackager interface {
 	// Encode the audio frame to FLV audio tag.
 	Encode(frame *AudioFrame) (tag []byte, err error)
@@ -498,6 +860,7 @@ type AudioPackager interface {
 }
 
 var errDataNotEnough = errors.New("Data not enough")
+var errUnsupportedPacketType = errors.New("Unsupported packet type")
 
 type audioPackager struct {
 }
@@ -507,6 +870,10 @@ func NewAudioPackager() (AudioPackager, error) {
 }
 
 func (v *audioPackager) Encode(frame *AudioFrame) (tag []byte, err error) {
+	if frame.IsExHeader {
+		return v.encodeEnhanced(frame)
+	}
+
 	audioTagHeader := []byte{
 		byte(frame.SoundFormat)<<4 | byte(frame.SoundRate)<<2 | byte(frame.SoundSize)<<1 | byte(frame.SoundType),
 	}
@@ -544,6 +911,10 @@ func (v *audioPackager) Encode(frame *AudioFrame) (tag []byte, err error) {
 func (v *audioPackager) Decode(tag []byte) (frame *AudioFrame, err error) {
 	// Refer to @doc video_file_format_spec_v10.pdf, @page 76, @section E.4.2 Audio Tags
 	// @see SrsFormat::audio_aac_demux
+	if len(tag) > 0 && AudioCodec(tag[0]>>4) == AudioCodecExHeader {
+		return v.decodeEnhanced(tag)
+	}
+
 	if len(tag) < 2 {
 		err = errDataNotEnough
 		return
@@ -589,6 +960,81 @@ func (v *audioPackager) Decode(tag []byte) (frame *AudioFrame, err error) {
 	return
 }
 
+func (v *audioPackager) decodeEnhanced(tag []byte) (frame *AudioFrame, err error) {
+	p := tag
+	frame = &AudioFrame{SoundFormat: AudioCodecExHeader, IsExHeader: true}
+	frame.PacketType = AudioPacketType(p[0] & 0x0f)
+	frame.Trait = frame.PacketType.Trait()
+	p = p[1:]
+
+	if frame.PacketType == AudioPacketTypeMultitrack || frame.PacketType == AudioPacketTypeModEx {
+		return nil, errUnsupportedPacketType
+	}
+
+	if len(p) < 4 {
+		return nil, errDataNotEnough
+	}
+	frame.FourCC = AudioFourCC(binary.BigEndian.Uint32(p))
+	p = p[4:]
+
+	if frame.PacketType == AudioPacketTypeMultichannelConfig {
+		if len(p) < 2 {
+			return nil, errDataNotEnough
+		}
+		mc := &AudioMultichannelConfig{Order: AudioChannelOrder(p[0]), Count: p[1]}
+		p = p[2:]
+
+		if mc.Order == AudioChannelOrderNative {
+			if len(p) < 4 {
+				return nil, errDataNotEnough
+			}
+			mc.Flags = binary.BigEndian.Uint32(p)
+			p = p[4:]
+		} else if mc.Order == AudioChannelOrderCustom {
+			if len(p) < int(mc.Count) {
+				return nil, errDataNotEnough
+			}
+			mc.Mapping = append([]uint8{}, p[:mc.Count]...)
+			p = p[mc.Count:]
+		}
+
+		frame.Multichannel = mc
+	}
+
+	frame.Raw = p
+	return
+}
+
+func (v *audioPackager) encodeEnhanced(frame *AudioFrame) (tag []byte, err error) {
+	if frame.PacketType == AudioPacketTypeMultitrack || frame.PacketType == AudioPacketTypeModEx {
+		return nil, errUnsupportedPacketType
+	}
+
+	tag = []byte{
+		byte(AudioCodecExHeader)<<4 | byte(frame.PacketType&0x0f),
+		byte(frame.FourCC >> 24), byte(frame.FourCC >> 16), byte(frame.FourCC >> 8), byte(frame.FourCC),
+	}
+
+	if frame.PacketType == AudioPacketTypeMultichannelConfig {
+		mc := frame.Multichannel
+		if mc == nil {
+			return nil, errDataNotEnough
+		}
+		tag = append(tag, byte(mc.Order), mc.Count)
+
+		if mc.Order == AudioChannelOrderNative {
+			tag = append(tag, byte(mc.Flags>>24), byte(mc.Flags>>16), byte(mc.Flags>>8), byte(mc.Flags))
+		} else if mc.Order == AudioChannelOrderCustom {
+			if len(mc.Mapping) != int(mc.Count) {
+				return nil, errors.New("Channel mapping mismatch count")
+			}
+			tag = append(tag, mc.Mapping...)
+		}
+	}
+
+	return append(tag, frame.Raw...), nil
+}
+
 // The video frame type.
 // Refer to @doc video_file_format_spec_v10.pdf, @page 78, @section E.4.3 Video Tags
 type VideoFrameType uint8
@@ -682,20 +1128,127 @@ func (v VideoFrameTrait) String() string {
 	}
 }
 
+// The Enhanced RTMP video FourCC, when IsExHeader is set.
+// Refer to @doc enhanced-rtmp-v2.pdf, @section Enhanced Video
+type VideoFourCC uint32
+
+const (
+	VideoFourCCAVC  VideoFourCC = 'a'<<24 | 'v'<<16 | 'c'<<8 | '1'
+	VideoFourCCHEVC VideoFourCC = 'h'<<24 | 'v'<<16 | 'c'<<8 | '1'
+	VideoFourCCAV1  VideoFourCC = 'a'<<24 | 'v'<<16 | '0'<<8 | '1'
+	VideoFourCCVP8  VideoFourCC = 'v'<<24 | 'p'<<16 | '0'<<8 | '8'
+	VideoFourCCVP9  VideoFourCC = 'v'<<24 | 'p'<<16 | '0'<<8 | '9'
+)
+
+func (v VideoFourCC) String() string {
+	return string([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+// The codec id of FourCC, for AVC and HEVC, or VideoCodecForbidden for others.
+func (v VideoFourCC) CodecID() VideoCodec {
+	switch v {
+	case VideoFourCCAVC:
+		return VideoCodecAVC
+	case VideoFourCCHEVC:
+		return VideoCodecHEVC
+	default:
+		return VideoCodecForbidden
+	}
+}
+
+// The Enhanced RTMP video packet type, when IsExHeader is set.
+// Refer to @doc enhanced-rtmp-v2.pdf, @section Enhanced Video
+// It's 4bits, that is 0-15.
+type VideoPacketType uint8
+
+const (
+	VideoPacketTypeSequenceStart        VideoPacketType = iota // 0 = Sequence start, the codec configuration record.
+	VideoPacketTypeCodedFrames                                 // 1 = Coded frames, with CTS for AVC and HEVC.
+	VideoPacketTypeSequenceEnd                                 // 2 = Sequence end.
+	VideoPacketTypeCodedFramesX                                // 3 = Coded frames, without CTS, which is 0.
+	VideoPacketTypeMetadata                                    // 4 = Metadata in AMF, for example, colorInfo.
+	VideoPacketTypeMPEG2TSSequenceStart                        // 5 = The MPEG-2 TS sequence start, for AV1.
+	VideoPacketTypeMultitrack                                  // 6 = Multitrack, not supported.
+	VideoPacketTypeModEx                                       // 7 = Mod extension, not supported.
+)
+
+func (v VideoPacketType) String() string {
+	switch v {
+	case VideoPacketTypeSequenceStart:
+		return "SequenceStart"
+	case VideoPacketTypeCodedFrames:
+		return "CodedFrames"
+	case VideoPacketTypeSequenceEnd:
+		return "SequenceEnd"
+	case VideoPacketTypeCodedFramesX:
+		return "CodedFramesX"
+	case VideoPacketTypeMetadata:
+		return "Metadata"
+	case VideoPacketTypeMPEG2TSSequenceStart:
+		return "MPEG2TSSequenceStart"
+	case VideoPacketTypeMultitrack:
+		return "Multitrack"
+	case VideoPacketTypeModEx:
+		return "ModEx"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The trait of packet type, for user to process the enhanced frame as legacy.
+func (v VideoPacketType) Trait() VideoFrameTrait {
+	switch v {
+	case VideoPacketTypeSequenceStart:
+		return VideoFrameTraitSequenceHeader
+	case VideoPacketTypeCodedFrames, VideoPacketTypeCodedFramesX:
+		return VideoFrameTraitNALU
+	case VideoPacketTypeSequenceEnd:
+		return VideoFrameTraitSequenceEOF
+	default:
+		return VideoFrameTraitForbidden
+	}
+}
+
+// The video frame, the legacy FLV video tag or Enhanced RTMP video tag if IsExHeader.
+// For Enhanced RTMP, the CodecID and Trait are set by FourCC and PacketType when decoding,
+// to process the AVC and HEVC frame as legacy.
 type VideoFrame struct {
 	CodecID   VideoCodec
 	FrameType VideoFrameType
 	Trait     VideoFrameTrait
-	CTS       int32
-	Raw       []byte
+	// The composition time in ms, the SI24 in tag, pts = dts + cts.
+	// For Enhanced RTMP, it's only available for CodedFrames of AVC and HEVC.
+	CTS int32
+	Raw []byte
+	// Whether it's Enhanced RTMP video tag, with the FourCC and PacketType.
+	IsExHeader bool
+	FourCC     VideoFourCC
+	PacketType VideoPacketType
 }
 
 func NewVideoFrame() *VideoFrame {
 	return &VideoFrame{}
 }
 
+// Whether the enhanced frame carries the CTS, only CodedFrames of AVC and HEVC.
+func (v *VideoFrame) hasCTS() bool {
+	if !v.IsExHeader {
+		return v.CodecID == VideoCodecAVC || v.CodecID == VideoCodecHEVC
+	}
+	if v.PacketType != VideoPacketTypeCodedFrames {
+		return false
+	}
+	return v.FourCC == VideoFourCCAVC || v.FourCC == VideoFourCCHEVC
+}
+
+// Whether the enhanced frame is a command, which has no FourCC.
+func (v *VideoFrame) isCommand() bool {
+	return v.IsExHeader && v.FrameType == VideoFrameTypeInfo && v.PacketType != VideoPacketTypeMetadata
+}
+
 // The packager used to codec the FLV video tag body.
 // Refer to @doc video_file_format_spec_v10.pdf, @page 78, @section E.4.3 Video Tags
+// Refer to @doc enhanced-rtmp-v2.pdf, @section Enhanced Video
 type VideoPackager interface {
 	// Decode the FLV video tag to video frame.
 	// @remark For RTMP/FLV: pts = dts + cts, where dts is timestamp in packet/tag.
@@ -712,6 +1265,10 @@ func NewVideoPackager() (VideoPackager, error) {
 }
 
 func (v *videoPackager) Decode(tag []byte) (frame *VideoFrame, err error) {
+	if len(tag) > 0 && tag[0]&0x80 == 0x80 {
+		return v.decodeEnhanced(tag)
+	}
+
 	if len(tag) < 5 {
 		err = errDataNotEnough
 		return
@@ -722,9 +1279,9 @@ func (v *videoPackager) Decode(tag []byte) (frame *VideoFrame, err error) {
 	frame.FrameType = VideoFrameType(byte(p[0]>>4) & 0x0f)
 	frame.CodecID = VideoCodec(byte(p[0]) & 0x0f)
 
-	if frame.CodecID == VideoCodecAVC || frame.CodecID == VideoCodecHEVC {
+	if frame.hasCTS() {
 		frame.Trait = VideoFrameTrait(p[1])
-		frame.CTS = int32(uint32(p[2])<<16 | uint32(p[3])<<8 | uint32(p[4]))
+		frame.CTS = decodeSI24(p[2:])
 		frame.Raw = tag[5:]
 	} else {
 		frame.Raw = tag[1:]
@@ -733,8 +1290,52 @@ func (v *videoPackager) Decode(tag []byte) (frame *VideoFrame, err error) {
 	return
 }
 
+func (v *videoPackager) decodeEnhanced(tag []byte) (frame *VideoFrame, err error) {
+	p := tag
+	frame = &VideoFrame{IsExHeader: true}
+	frame.FrameType = VideoFrameType(byte(p[0]>>4) & 0x07)
+	frame.PacketType = VideoPacketType(byte(p[0]) & 0x0f)
+	frame.Trait = frame.PacketType.Trait()
+	p = p[1:]
+
+	if frame.PacketType == VideoPacketTypeMultitrack || frame.PacketType == VideoPacketTypeModEx {
+		return nil, errUnsupportedPacketType
+	}
+
+	// The command frame, only the UI8 command.
+	if frame.isCommand() {
+		if len(p) < 1 {
+			return nil, errDataNotEnough
+		}
+		frame.Raw = p
+		return
+	}
+
+	if len(p) < 4 {
+		return nil, errDataNotEnough
+	}
+	frame.FourCC = VideoFourCC(binary.BigEndian.Uint32(p))
+	frame.CodecID = frame.FourCC.CodecID()
+	p = p[4:]
+
+	if frame.hasCTS() {
+		if len(p) < 3 {
+			return nil, errDataNotEnough
+		}
+		frame.CTS = decodeSI24(p)
+		p = p[3:]
+	}
+
+	frame.Raw = p
+	return
+}
+
 func (v videoPackager) Encode(frame *VideoFrame) (tag []byte, err error) {
-	if frame.CodecID == VideoCodecAVC || frame.CodecID == VideoCodecHEVC {
+	if frame.IsExHeader {
+		return v.encodeEnhanced(frame)
+	}
+
+	if frame.hasCTS() {
 		return append([]byte{
 			byte(frame.FrameType)<<4 | byte(frame.CodecID), byte(frame.Trait),
 			byte(frame.CTS >> 16), byte(frame.CTS >> 8), byte(frame.CTS),
@@ -745,3 +1346,26 @@ func (v videoPackager) Encode(frame *VideoFrame) (tag []byte, err error) {
 		}, frame.Raw...), nil
 	}
 }
+
+func (v videoPackager) encodeEnhanced(frame *VideoFrame) (tag []byte, err error) {
+	if frame.PacketType == VideoPacketTypeMultitrack || frame.PacketType == VideoPacketTypeModEx {
+		return nil, errUnsupportedPacketType
+	}
+
+	tag = []byte{0x80 | byte(frame.FrameType&0x07)<<4 | byte(frame.PacketType&0x0f)}
+
+	if !frame.isCommand() {
+		tag = append(tag, byte(frame.FourCC>>24), byte(frame.FourCC>>16), byte(frame.FourCC>>8), byte(frame.FourCC))
+	}
+
+	if frame.hasCTS() {
+		tag = append(tag, byte(frame.CTS>>16), byte(frame.CTS>>8), byte(frame.CTS))
+	}
+
+	return append(tag, frame.Raw...), nil
+}
+
+// Decode the SI24 in big-endian, the signed 24bits integer.
+func decodeSI24(p []byte) int32 {
+	return int32(uint32(p[0])<<24|uint32(p[1])<<16|uint32(p[2])<<8) >> 8
+}
@@ -0,0 +1,368 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package flv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestVideoPackager_Legacy(t *testing.T) {
+	vp, _ := NewVideoPackager()
+
+	// The AVC NALU with negative CTS -1.
+	tag := []byte{0x27, 0x01, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x01}
+	frame, err := vp.Decode(tag)
+	if err != nil {
+		t.Fatalf("decode failed %+v", err)
+	}
+	if frame.IsExHeader || frame.CodecID != VideoCodecAVC || frame.FrameType != VideoFrameTypeInterframe ||
+		frame.Trait != VideoFrameTraitNALU || frame.CTS != -1 || len(frame.Raw) != 4 {
+		t.Errorf("invalid frame %+v", frame)
+	}
+
+	if b, err := vp.Encode(frame); err != nil {
+		t.Errorf("encode failed %+v", err)
+	} else if !bytes.Equal(b, tag) {
+		t.Errorf("invalid tag %v", b)
+	}
+}
+
+func TestVideoPackager_Enhanced(t *testing.T) {
+	vp, _ := NewVideoPackager()
+
+	for _, e := range []struct {
+		tag    []byte
+		frame  VideoFrame
+		legacy VideoFrameTrait
+	}{
+		// The HEVC sequence start.
+		{[]byte{0x90, 'h', 'v', 'c', '1', 0x01}, VideoFrame{
+			FrameType: VideoFrameTypeKeyframe, PacketType: VideoPacketTypeSequenceStart, FourCC: VideoFourCCHEVC,
+			CodecID: VideoCodecHEVC,
+		}, VideoFrameTraitSequenceHeader},
+		// The HEVC coded frames with CTS 40.
+		{[]byte{0xa1, 'h', 'v', 'c', '1', 0x00, 0x00, 0x28, 0x01}, VideoFrame{
+			FrameType: VideoFrameTypeInterframe, PacketType: VideoPacketTypeCodedFrames, FourCC: VideoFourCCHEVC,
+			CodecID: VideoCodecHEVC, CTS: 40,
+		}, VideoFrameTraitNALU},
+		// The HEVC coded frames without CTS.
+		{[]byte{0x93, 'h', 'v', 'c', '1', 0x01}, VideoFrame{
+			FrameType: VideoFrameTypeKeyframe, PacketType: VideoPacketTypeCodedFramesX, FourCC: VideoFourCCHEVC,
+			CodecID: VideoCodecHEVC,
+		}, VideoFrameTraitNALU},
+		// The AV1 coded frames, no CTS.
+		{[]byte{0x91, 'a', 'v', '0', '1', 0x01}, VideoFrame{
+			FrameType: VideoFrameTypeKeyframe, PacketType: VideoPacketTypeCodedFrames, FourCC: VideoFourCCAV1,
+			CodecID: VideoCodecForbidden,
+		}, VideoFrameTraitNALU},
+		// The VP9 sequence end.
+		{[]byte{0x92, 'v', 'p', '0', '9'}, VideoFrame{
+			FrameType: VideoFrameTypeKeyframe, PacketType: VideoPacketTypeSequenceEnd, FourCC: VideoFourCCVP9,
+			CodecID: VideoCodecForbidden,
+		}, VideoFrameTraitSequenceEOF},
+		// The AV1 MPEG2-TS sequence start.
+		{[]byte{0x95, 'a', 'v', '0', '1', 0x01}, VideoFrame{
+			FrameType: VideoFrameTypeKeyframe, PacketType: VideoPacketTypeMPEG2TSSequenceStart, FourCC: VideoFourCCAV1,
+			CodecID: VideoCodecForbidden,
+		}, VideoFrameTraitForbidden},
+		// The metadata of HEVC.
+		{[]byte{0xd4, 'h', 'v', 'c', '1', 0x02}, VideoFrame{
+			FrameType: VideoFrameTypeInfo, PacketType: VideoPacketTypeMetadata, FourCC: VideoFourCCHEVC,
+			CodecID: VideoCodecHEVC,
+		}, VideoFrameTraitForbidden},
+		// The command frame, no FourCC.
+		{[]byte{0xd1, 0x00}, VideoFrame{
+			FrameType: VideoFrameTypeInfo, PacketType: VideoPacketTypeCodedFrames,
+		}, VideoFrameTraitNALU},
+	} {
+		frame, err := vp.Decode(e.tag)
+		if err != nil {
+			t.Errorf("decode %v failed %+v", e.tag, err)
+			continue
+		}
+
+		expect := e.frame
+		expect.IsExHeader, expect.Trait = true, e.legacy
+		if frame.FrameType != expect.FrameType || frame.PacketType != expect.PacketType ||
+			frame.FourCC != expect.FourCC || frame.CodecID != expect.CodecID || frame.CTS != expect.CTS ||
+			frame.Trait != expect.Trait || !frame.IsExHeader {
+			t.Errorf("invalid frame %+v of %v", frame, e.tag)
+		}
+
+		if b, err := vp.Encode(frame); err != nil {
+			t.Errorf("encode failed %+v", err)
+		} else if !bytes.Equal(b, e.tag) {
+			t.Errorf("invalid tag %v, expect %v", b, e.tag)
+		}
+	}
+
+	for _, tag := range [][]byte{
+		{0x90, 'h', 'v', 'c'}, {0xa1, 'h', 'v', 'c', '1', 0x00}, {0xd1},
+		{0x96, 0x00, 'h', 'v', 'c', '1'}, {0x97, 0x00},
+	} {
+		if _, err := vp.Decode(tag); err == nil {
+			t.Errorf("should error for %v", tag)
+		}
+	}
+
+	if VideoFourCCAV1.String() != "av01" || VideoFourCCVP8.String() != "vp08" ||
+		VideoPacketTypeCodedFramesX.String() != "CodedFramesX" {
+		t.Error("invalid string")
+	}
+}
+
+func TestAudioPackager_Legacy(t *testing.T) {
+	ap, _ := NewAudioPackager()
+
+	for _, tag := range [][]byte{
+		{0xaf, 0x00, 0x12, 0x10},
+		{0xaf, 0x01, 0x21},
+		{0x2f, 0xff, 0xfb},
+		{0xd0, 0x0e, 48, 0x00, 0x10, 0x01},
+	} {
+		frame, err := ap.Decode(tag)
+		if err != nil {
+			t.Errorf("decode %v failed %+v", tag, err)
+		} else if frame.IsExHeader {
+			t.Errorf("should be legacy %v", tag)
+		} else if b, err := ap.Encode(frame); err != nil {
+			t.Errorf("encode failed %+v", err)
+		} else if !bytes.Equal(b, tag) {
+			t.Errorf("invalid tag %v, expect %v", b, tag)
+		}
+	}
+}
+
+func TestAudioPackager_Enhanced(t *testing.T) {
+	ap, _ := NewAudioPackager()
+
+	for _, e := range []struct {
+		tag    []byte
+		fourcc AudioFourCC
+		pt     AudioPacketType
+		trait  AudioFrameTrait
+		mc     *AudioMultichannelConfig
+		raw    int
+	}{
+		{[]byte{0x90, 'O', 'p', 'u', 's', 'O', 'p', 'u', 's'}, AudioFourCCOpus, AudioPacketTypeSequenceStart, AudioFrameTraitSequenceHeader, nil, 4},
+		{[]byte{0x91, 'f', 'L', 'a', 'C', 0xff, 0xf8}, AudioFourCCFLAC, AudioPacketTypeCodedFrames, AudioFrameTraitRaw, nil, 2},
+		{[]byte{0x91, 'a', 'c', '-', '3', 0x0b, 0x77}, AudioFourCCAC3, AudioPacketTypeCodedFrames, AudioFrameTraitRaw, nil, 2},
+		{[]byte{0x92, 'e', 'c', '-', '3'}, AudioFourCCEAC3, AudioPacketTypeSequenceEnd, AudioFrameTraitForbidden, nil, 0},
+		{[]byte{0x94, 'O', 'p', 'u', 's', 0x00, 0x02}, AudioFourCCOpus, AudioPacketTypeMultichannelConfig, AudioFrameTraitForbidden,
+			&AudioMultichannelConfig{Order: AudioChannelOrderUnspecified, Count: 2}, 0},
+		{[]byte{0x94, 'e', 'c', '-', '3', 0x01, 0x06, 0x00, 0x00, 0x00, 0x3f}, AudioFourCCEAC3, AudioPacketTypeMultichannelConfig, AudioFrameTraitForbidden,
+			&AudioMultichannelConfig{Order: AudioChannelOrderNative, Count: 6, Flags: 0x3f}, 0},
+		{[]byte{0x94, 'O', 'p', 'u', 's', 0x02, 0x02, 0x01, 0x00}, AudioFourCCOpus, AudioPacketTypeMultichannelConfig, AudioFrameTraitForbidden,
+			&AudioMultichannelConfig{Order: AudioChannelOrderCustom, Count: 2, Mapping: []uint8{1, 0}}, 0},
+	} {
+		frame, err := ap.Decode(e.tag)
+		if err != nil {
+			t.Errorf("decode %v failed %+v", e.tag, err)
+			continue
+		}
+
+		if !frame.IsExHeader || frame.SoundFormat != AudioCodecExHeader || frame.FourCC != e.fourcc ||
+			frame.PacketType != e.pt || frame.Trait != e.trait || len(frame.Raw) != e.raw {
+			t.Errorf("invalid frame %+v of %v", frame, e.tag)
+		}
+		if e.mc != nil {
+			if mc := frame.Multichannel; mc == nil || mc.Order != e.mc.Order || mc.Count != e.mc.Count ||
+				mc.Flags != e.mc.Flags || !bytes.Equal(mc.Mapping, e.mc.Mapping) {
+				t.Errorf("invalid multichannel %+v of %v", mc, e.tag)
+			}
+		}
+
+		if b, err := ap.Encode(frame); err != nil {
+			t.Errorf("encode failed %+v", err)
+		} else if !bytes.Equal(b, e.tag) {
+			t.Errorf("invalid tag %v, expect %v", b, e.tag)
+		}
+	}
+
+	for _, tag := range [][]byte{
+		{0x90, 'O', 'p', 'u'}, {0x94, 'O', 'p', 'u', 's', 0x01, 0x02, 0x00},
+		{0x94, 'O', 'p', 'u', 's', 0x02, 0x02, 0x01}, {0x95, 0x00}, {0x97, 0x00},
+	} {
+		if _, err := ap.Decode(tag); err == nil {
+			t.Errorf("should error for %v", tag)
+		}
+	}
+
+	if AudioFourCCEAC3.String() != "ec-3" || AudioCodecExHeader.String() != "ExHeader" {
+		t.Error("invalid string")
+	}
+}
+
+// Create a FLV stream with 3 tags, the tags start at 13, 31 and 50, end at 67.
+func newTestFLV(t *testing.T) []byte {
+	b := &bytes.Buffer{}
+	m, _ := NewMuxer(b)
+	if err := m.WriteHeader(true, true); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for i, tag := range [][]byte{{0x01, 0x02, 0x03}, {0x04, 0x05, 0x06, 0x07}, {0x08, 0x09}} {
+		if err := m.WriteTag(TagTypeVideo, uint32(i*40), tag); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	return b.Bytes()
+}
+
+// Read all tags until error, return the tags and error.
+func readTestTags(d Demuxer) (tags [][]byte, err error) {
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		return
+	}
+
+	for {
+		var tagSize uint32
+		if _, tagSize, _, err = d.ReadTagHeader(); err != nil {
+			return
+		}
+
+		var tag []byte
+		if tag, err = d.ReadTag(tagSize); err != nil {
+			return
+		}
+		tags = append(tags, tag)
+	}
+}
+
+func TestDemuxer_Strict(t *testing.T) {
+	b := newTestFLV(t)
+
+	for _, opts := range []*DemuxerOptions{nil, {Strict: true}, {Resync: true}} {
+		d, _ := NewDemuxerWithOptions(bytes.NewReader(b), opts)
+		if tags, err := readTestTags(d); err != io.EOF {
+			t.Errorf("%+v", err)
+		} else if len(tags) != 3 || bytes.Compare(tags[1], []byte{0x04, 0x05, 0x06, 0x07}) != 0 {
+			t.Errorf("%#x", tags)
+		}
+	}
+}
+
+func TestDemuxer_StrictCorrupt(t *testing.T) {
+	for _, c := range []struct {
+		modify func(b []byte) []byte
+		tags   int
+		offset int64
+	}{
+		// The previous tag size of tag 2.
+		{func(b []byte) []byte { b[49] = 0x00; return b }, 1, 46},
+		// The stream id of tag 2.
+		{func(b []byte) []byte { b[41] = 0x01; return b }, 1, 31},
+		// The tag type of tag 3.
+		{func(b []byte) []byte { b[50] = 0x07; return b }, 2, 50},
+		// Truncated tag 3.
+		{func(b []byte) []byte { return b[:60] }, 2, 50},
+		// Truncated tag header 3.
+		{func(b []byte) []byte { return b[:55] }, 2, 50},
+		// The data offset of header.
+		{func(b []byte) []byte { b[8] = 0x0a; return b }, 0, 5},
+	} {
+		b := c.modify(newTestFLV(t))
+
+		// The loose mode ignores the corruption or returns io error.
+		d, _ := NewDemuxer(bytes.NewReader(b))
+		if _, err := readTestTags(d); err != nil {
+			if _, ok := err.(*CorruptError); ok {
+				t.Errorf("%+v", err)
+			}
+		}
+
+		d, _ = NewDemuxerWithOptions(bytes.NewReader(b), &DemuxerOptions{Strict: true})
+		tags, err := readTestTags(d)
+		if len(tags) != c.tags {
+			t.Errorf("tags %v", len(tags))
+		}
+		if err, ok := err.(*CorruptError); !ok {
+			t.Errorf("%+v", err)
+		} else if err.Offset != c.offset {
+			t.Errorf("offset %v, %v", err.Offset, err)
+		}
+	}
+}
+
+func TestDemuxer_Resync(t *testing.T) {
+	b := newTestFLV(t)
+
+	// Insert garbage between tag 1 and tag 2, and append trailing garbage.
+	garbage := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+	b = append(append(append(append([]byte{}, b[:31]...), garbage...), b[31:]...), 0x09, 0x00)
+
+	var corrupts []*CorruptError
+	d, _ := NewDemuxerWithOptions(bytes.NewReader(b), &DemuxerOptions{
+		Resync: true, OnCorrupt: func(err *CorruptError) {
+			corrupts = append(corrupts, err)
+		},
+	})
+
+	if tags, err := readTestTags(d); err != io.EOF {
+		t.Errorf("%+v", err)
+	} else if len(tags) != 3 || bytes.Compare(tags[2], []byte{0x08, 0x09}) != 0 {
+		t.Errorf("%#x", tags)
+	}
+
+	if len(corrupts) != 2 {
+		t.Fatalf("corrupts %v", corrupts)
+	}
+	if corrupts[0].Offset != 31 || corrupts[0].Skipped != 5 {
+		t.Error(corrupts[0])
+	}
+	if corrupts[1].Offset != 72 || corrupts[1].Skipped != 2 {
+		t.Error(corrupts[1])
+	}
+
+	// The strict mode fails at the garbage.
+	d, _ = NewDemuxerWithOptions(bytes.NewReader(b), &DemuxerOptions{Strict: true})
+	if tags, err := readTestTags(d); len(tags) != 1 {
+		t.Errorf("tags %v", len(tags))
+	} else if err, ok := err.(*CorruptError); !ok || err.Offset != 31 {
+		t.Errorf("%+v", err)
+	}
+}
+
+func TestDemuxer_ResyncPreviousTagSize(t *testing.T) {
+	b := newTestFLV(t)
+
+	// The previous tag size of tag 2 is wrong, but the next tag header is valid.
+	b[49] = 0x00
+
+	var corrupts []*CorruptError
+	d, _ := NewDemuxerWithOptions(bytes.NewReader(b), &DemuxerOptions{
+		Resync: true, OnCorrupt: func(err *CorruptError) {
+			corrupts = append(corrupts, err)
+		},
+	})
+
+	if tags, err := readTestTags(d); err != io.EOF {
+		t.Errorf("%+v", err)
+	} else if len(tags) != 3 {
+		t.Errorf("%#x", tags)
+	}
+
+	if len(corrupts) != 1 || corrupts[0].Offset != 46 || corrupts[0].Skipped != 0 {
+		t.Errorf("%v", corrupts)
+	}
+}
@@ -0,0 +1,391 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package flv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// The keyframe in index of FLV reader, to seek to.
+type Keyframe struct {
+	// The timestamp in ms.
+	Timestamp uint32
+	// The position in file of the tag header.
+	Position int64
+}
+
+// The FLV reader over io.ReadSeeker, with keyframe index for VOD and DVR playback.
+// The index is read from the "keyframes" of onMetaData, which has the "filepositions" and
+// "times", or built by scanning all tags when not available.
+// @remark The position is always the offset of the tag header in file.
+type Reader interface {
+	// Get the FLV header, the version of FLV, whether hasVideo or hasAudio in header.
+	Header() (version uint8, hasVideo, hasAudio bool)
+	// Get the duration in ms, from onMetaData or the timestamp of the last tag.
+	Duration() uint32
+	// Get the keyframes index, in the order of timestamp.
+	// For audio only file, it's the audio tags, about one tag per second.
+	Keyframes() []Keyframe
+	// Seek to the keyframe at or before the timestamp in ms, then user can read tags from it.
+	SeekToTime(timestamp uint32) (keyframe Keyframe, err error)
+	// Seek to the tag at the position, for example, to read from the start by position 13.
+	SeekToPosition(position int64) error
+	// Get the position of the next tag to read.
+	Position() int64
+	// Read the next tag, return the tag type, the timestamp and the tag body.
+	ReadTag() (tagType TagType, timestamp uint32, tag []byte, err error)
+	// Read the tag at the position, then the next tag follows it.
+	ReadTagAt(position int64) (tagType TagType, timestamp uint32, tag []byte, err error)
+	// Close the reader.
+	Close() error
+}
+
+// When no keyframe in index.
+var errNoKeyframes = errors.New("FLV no keyframes")
+
+// The size of FLV header and the PreviousTagSize0, the position of the first tag.
+const flvHeaderSize = 13
+
+// Create a reader object, read the header and build the keyframe index.
+func NewReader(r io.ReadSeeker) (Reader, error) {
+	v := &reader{r: r}
+
+	if _, err := r.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	d, _ := NewDemuxer(r)
+	var err error
+	if v.version, v.hasVideo, v.hasAudio, err = d.ReadHeader(); err != nil {
+		return nil, err
+	}
+
+	if v.size, err = r.Seek(0, os.SEEK_END); err != nil {
+		return nil, err
+	}
+
+	if err = v.buildIndex(); err != nil {
+		return nil, err
+	}
+
+	if err = v.SeekToPosition(flvHeaderSize); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+type reader struct {
+	r io.ReadSeeker
+	// The size of file.
+	size int64
+	// The position of the next tag.
+	position int64
+
+	version            uint8
+	hasVideo, hasAudio bool
+
+	duration  uint32
+	keyframes []Keyframe
+}
+
+func (v *reader) Header() (version uint8, hasVideo, hasAudio bool) {
+	return v.version, v.hasVideo, v.hasAudio
+}
+
+func (v *reader) Duration() uint32 {
+	return v.duration
+}
+
+func (v *reader) Keyframes() []Keyframe {
+	return v.keyframes
+}
+
+func (v *reader) SeekToTime(timestamp uint32) (keyframe Keyframe, err error) {
+	if len(v.keyframes) == 0 {
+		return keyframe, errNoKeyframes
+	}
+
+	// The first keyframe after the timestamp, then use the previous one.
+	i := sort.Search(len(v.keyframes), func(i int) bool {
+		return v.keyframes[i].Timestamp > timestamp
+	})
+	if i > 0 {
+		i--
+	}
+
+	keyframe = v.keyframes[i]
+	err = v.SeekToPosition(keyframe.Position)
+	return
+}
+
+func (v *reader) SeekToPosition(position int64) error {
+	if position < flvHeaderSize || position > v.size {
+		return fmt.Errorf("FLV invalid position %v, size is %v", position, v.size)
+	}
+
+	if _, err := v.r.Seek(position, os.SEEK_SET); err != nil {
+		return err
+	}
+	v.position = position
+	return nil
+}
+
+func (v *reader) Position() int64 {
+	return v.position
+}
+
+func (v *reader) ReadTag() (tagType TagType, timestamp uint32, tag []byte, err error) {
+	d, _ := NewDemuxer(v.r)
+
+	var tagSize uint32
+	if tagType, tagSize, timestamp, err = d.ReadTagHeader(); err != nil {
+		return
+	}
+
+	if tag, err = d.ReadTag(tagSize); err != nil {
+		return
+	}
+
+	v.position += int64(11 + tagSize + 4)
+	return
+}
+
+func (v *reader) ReadTagAt(position int64) (tagType TagType, timestamp uint32, tag []byte, err error) {
+	if err = v.SeekToPosition(position); err != nil {
+		return
+	}
+	return v.ReadTag()
+}
+
+func (v *reader) Close() error {
+	return nil
+}
+
+// Build the keyframe index, from onMetaData or by scanning all tags.
+func (v *reader) buildIndex() (err error) {
+	if ok := v.readIndexFromMetadata(); ok {
+		return
+	}
+
+	v.duration, v.keyframes = 0, nil
+	return v.scanIndex()
+}
+
+// Read the index from the onMetaData, which should be the first tag.
+// Return false if no valid keyframes in onMetaData.
+func (v *reader) readIndexFromMetadata() bool {
+	tagType, _, tag, err := v.ReadTagAt(flvHeaderSize)
+	if err != nil || tagType != TagTypeScriptData {
+		return false
+	}
+
+	m, err := parseMetadata(tag)
+	if err != nil || len(m.times) == 0 || len(m.times) != len(m.filepositions) {
+		return false
+	}
+
+	for i, t := range m.times {
+		position := m.filepositions[i]
+		if t < 0 || position < flvHeaderSize || position >= float64(v.size) {
+			return false
+		}
+		v.keyframes = append(v.keyframes, Keyframe{
+			Timestamp: uint32(math.Floor(t*1000 + 0.5)),
+			Position:  int64(position),
+		})
+	}
+
+	// Verify the first and last keyframe, which should be a video tag, or audio tag for audio only file.
+	expect := TagTypeVideo
+	if !v.hasVideo {
+		expect = TagTypeAudio
+	}
+	for _, k := range []Keyframe{v.keyframes[0], v.keyframes[len(v.keyframes)-1]} {
+		if tagType, _, _, err := v.ReadTagAt(k.Position); err != nil || tagType != expect {
+			return false
+		}
+	}
+
+	if m.duration > 0 {
+		v.duration = uint32(math.Floor(m.duration*1000 + 0.5))
+	} else {
+		v.duration = v.lastTimestamp()
+	}
+	return true
+}
+
+// Get the timestamp of the last tag, by the last previous tag size.
+func (v *reader) lastTimestamp() uint32 {
+	if v.size < flvHeaderSize+11+4 {
+		return 0
+	}
+
+	b := make([]byte, 4)
+	if _, err := v.r.Seek(v.size-4, os.SEEK_SET); err != nil {
+		return 0
+	}
+	if _, err := io.ReadFull(v.r, b); err != nil {
+		return 0
+	}
+
+	position := v.size - 4 - int64(binary.BigEndian.Uint32(b))
+	if _, timestamp, _, err := v.ReadTagAt(position); err == nil {
+		return timestamp
+	}
+	return 0
+}
+
+// Scan all tags to build the index, stop at the end or the truncated tag.
+func (v *reader) scanIndex() (err error) {
+	if err = v.SeekToPosition(flvHeaderSize); err != nil {
+		return
+	}
+
+	// For audio only file, index an audio tag about every second.
+	var audios []Keyframe
+	h := make([]byte, 11+2)
+	for position := int64(flvHeaderSize); position+11+4 <= v.size; {
+		if _, err = v.r.Seek(position, os.SEEK_SET); err != nil {
+			return
+		}
+
+		n := 11
+		if position+11+2 <= v.size {
+			n = len(h)
+		}
+		if _, err = io.ReadFull(v.r, h[:n]); err != nil {
+			return
+		}
+
+		tagType, tagSize, timestamp := parseTagHeader(h)
+		if position+int64(11+tagSize+4) > v.size {
+			break
+		}
+
+		if tagType == TagTypeVideo && tagSize >= 2 && isKeyframe(h[11:]) {
+			v.keyframes = append(v.keyframes, Keyframe{Timestamp: timestamp, Position: position})
+		}
+		if tagType == TagTypeAudio && (len(audios) == 0 || timestamp >= audios[len(audios)-1].Timestamp+1000) {
+			audios = append(audios, Keyframe{Timestamp: timestamp, Position: position})
+		}
+		if timestamp > v.duration {
+			v.duration = timestamp
+		}
+
+		position += int64(11 + tagSize + 4)
+	}
+
+	if len(v.keyframes) == 0 {
+		v.keyframes = audios
+	}
+	return nil
+}
+
+// Whether the video tag is a keyframe to seek to, exclude the sequence header.
+func isKeyframe(p []byte) bool {
+	// For Enhanced RTMP, only the coded frames.
+	if p[0]&0x80 == 0x80 {
+		frameType := VideoFrameType(p[0]>>4) & 0x07
+		packetType := VideoPacketType(p[0] & 0x0f)
+		return frameType == VideoFrameTypeKeyframe &&
+			(packetType == VideoPacketTypeCodedFrames || packetType == VideoPacketTypeCodedFramesX)
+	}
+
+	if frameType := VideoFrameType(p[0]>>4) & 0x0f; frameType != VideoFrameTypeKeyframe {
+		return false
+	}
+
+	// For AVC and HEVC, only the NALU.
+	if codec := VideoCodec(p[0] & 0x0f); codec == VideoCodecAVC || codec == VideoCodecHEVC {
+		return VideoFrameTrait(p[1]) == VideoFrameTraitNALU
+	}
+	return true
+}
+
+// The duration and keyframes in onMetaData.
+type metadata struct {
+	// The duration in seconds.
+	duration float64
+	// The keyframes, the times in seconds and the filepositions in bytes.
+	times         []float64
+	filepositions []float64
+}
+
+// Parse the onMetaData script tag, only the duration and keyframes.
+// Refer to @doc video_file_format_spec_v10.pdf, @page 80, @section E.5 onMetaData
+func parseMetadata(tag []byte) (m *metadata, err error) {
+	p := tag
+	readValue := func() (a amf0.Amf0, err error) {
+		if a, err = amf0.Discovery(p); err != nil {
+			return
+		}
+		if err = a.UnmarshalBinary(p); err != nil {
+			return
+		}
+		p = p[a.Size():]
+		return
+	}
+
+	// The name, generally onMetaData, maybe @setDataFrame and onMetaData.
+	for {
+		a, err := readValue()
+		if err != nil {
+			return nil, err
+		}
+
+		name, ok := a.(*amf0.String)
+		if !ok {
+			return nil, errors.New("FLV no onMetaData")
+		}
+		if *name == "onMetaData" {
+			break
+		}
+	}
+
+	a, err := readValue()
+	if err != nil {
+		return nil, err
+	}
+
+	var props struct {
+		Duration  float64 `amf0:"duration"`
+		Keyframes struct {
+			Times         []float64 `amf0:"times"`
+			Filepositions []float64 `amf0:"filepositions"`
+		} `amf0:"keyframes"`
+	}
+	if err = amf0.Assign(a, &props); err != nil {
+		return nil, err
+	}
+
+	m = &metadata{duration: props.Duration}
+	m.times, m.filepositions = props.Keyframes.Times, props.Keyframes.Filepositions
+	return
+}
@@ -0,0 +1,340 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package flv
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	"io"
+	"testing"
+)
+
+// Marshal the AMF0 values, for script data.
+func marshalTestScript(values ...amf0.Amf0) []byte {
+	b := &bytes.Buffer{}
+	for _, a := range values {
+		pb, _ := a.MarshalBinary()
+		b.Write(pb)
+	}
+	return b.Bytes()
+}
+
+func newTestMetadata(duration float64, times, positions []float64) []byte {
+	numbers := func(values []float64) *amf0.StrictArray {
+		a := amf0.NewStrictArray()
+		for _, f := range values {
+			a.Append(amf0.NewNumber(f))
+		}
+		return a
+	}
+
+	keyframes := amf0.NewObject()
+	keyframes.Set("filepositions", numbers(positions))
+	keyframes.Set("times", numbers(times))
+
+	m := amf0.NewEcmaArray()
+	m.Set("duration", amf0.NewNumber(duration))
+	m.Set("hasVideo", amf0.NewBoolean(true))
+	m.Set("encoder", amf0.NewString("oryx"))
+	m.Set("keyframes", keyframes)
+	return marshalTestScript(amf0.NewString("onMetaData"), m)
+}
+
+// Create a FLV file with 3s video and audio, a keyframe every second, return the positions of keyframes.
+// If metadata, write the onMetaData with keyframes as the first tag.
+func newTestVODFLV(t *testing.T, metadata func(positions []float64) []byte) (b []byte, positions []int64) {
+	// The positions of keyframes, the metadata is fixed size.
+	var times, filepositions []float64
+	for i := 0; i < 3; i++ {
+		times, filepositions = append(times, float64(i)), append(filepositions, 0)
+	}
+
+	for pass := 0; pass < 2; pass++ {
+		w := &bytes.Buffer{}
+		m, _ := NewMuxer(w)
+		if err := m.WriteHeader(true, true); err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		if metadata != nil {
+			if err := m.WriteTag(TagTypeScriptData, 0, metadata(filepositions)); err != nil {
+				t.Fatalf("%+v", err)
+			}
+		}
+
+		// The AVC sequence header, which is not a keyframe to seek to.
+		if err := m.WriteTag(TagTypeVideo, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		positions = nil
+		for ts := uint32(0); ts < 3000; ts += 40 {
+			if ts%1000 == 0 {
+				positions = append(positions, int64(w.Len()))
+				if err := m.WriteTag(TagTypeVideo, ts, []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x01}); err != nil {
+					t.Fatalf("%+v", err)
+				}
+			} else if err := m.WriteTag(TagTypeVideo, ts, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x02}); err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if err := m.WriteTag(TagTypeAudio, ts+20, []byte{0xaf, 0x01, 0x03}); err != nil {
+				t.Fatalf("%+v", err)
+			}
+		}
+
+		for i, position := range positions {
+			filepositions[i] = float64(position)
+		}
+		b = w.Bytes()
+	}
+	return
+}
+
+func TestReader_Scan(t *testing.T) {
+	b, positions := newTestVODFLV(t, nil)
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer r.Close()
+
+	if version, hasVideo, hasAudio := r.Header(); version != 1 || !hasVideo || !hasAudio {
+		t.Error(version, hasVideo, hasAudio)
+	}
+	if v := r.Duration(); v != 2980 {
+		t.Error(v)
+	}
+
+	keyframes := r.Keyframes()
+	if len(keyframes) != 3 {
+		t.Fatal(keyframes)
+	}
+	for i, k := range keyframes {
+		if k.Timestamp != uint32(i*1000) || k.Position != positions[i] {
+			t.Error(i, k)
+		}
+	}
+
+	// The first tag is the sequence header.
+	if v := r.Position(); v != 13 {
+		t.Error(v)
+	}
+	if tagType, timestamp, tag, err := r.ReadTag(); err != nil {
+		t.Errorf("%+v", err)
+	} else if tagType != TagTypeVideo || timestamp != 0 || tag[1] != 0x00 {
+		t.Error(tagType, timestamp, tag)
+	}
+
+	// Seek to the keyframe before 1500ms.
+	if k, err := r.SeekToTime(1500); err != nil {
+		t.Errorf("%+v", err)
+	} else if k.Timestamp != 1000 || r.Position() != positions[1] {
+		t.Error(k, r.Position())
+	}
+	if tagType, timestamp, tag, err := r.ReadTag(); err != nil {
+		t.Errorf("%+v", err)
+	} else if tagType != TagTypeVideo || timestamp != 1000 || tag[0] != 0x17 {
+		t.Error(tagType, timestamp, tag)
+	}
+	if tagType, timestamp, _, err := r.ReadTag(); err != nil {
+		t.Errorf("%+v", err)
+	} else if tagType != TagTypeAudio || timestamp != 1020 {
+		t.Error(tagType, timestamp)
+	}
+
+	// Seek to the end.
+	if k, err := r.SeekToTime(10000); err != nil {
+		t.Errorf("%+v", err)
+	} else if k.Timestamp != 2000 {
+		t.Error(k)
+	}
+
+	// Read all tags to the end.
+	var n int
+	for ; ; n++ {
+		if _, _, _, err := r.ReadTag(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	if n != 50 || r.Position() != int64(len(b)) {
+		t.Error(n, r.Position())
+	}
+
+	// Random access.
+	if _, timestamp, _, err := r.ReadTagAt(positions[2]); err != nil {
+		t.Errorf("%+v", err)
+	} else if timestamp != 2000 {
+		t.Error(timestamp)
+	}
+	if _, _, _, err := r.ReadTagAt(5); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestReader_Metadata(t *testing.T) {
+	b, positions := newTestVODFLV(t, func(positions []float64) []byte {
+		return newTestMetadata(3.5, []float64{0, 1, 2}, positions)
+	})
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The duration is from the onMetaData.
+	if v := r.Duration(); v != 3500 {
+		t.Error(v)
+	}
+
+	keyframes := r.Keyframes()
+	if len(keyframes) != 3 {
+		t.Fatal(keyframes)
+	}
+	for i, k := range keyframes {
+		if k.Timestamp != uint32(i*1000) || k.Position != positions[i] {
+			t.Error(i, k)
+		}
+	}
+
+	if tagType, _, _, err := r.ReadTag(); err != nil {
+		t.Errorf("%+v", err)
+	} else if tagType != TagTypeScriptData {
+		t.Error(tagType)
+	}
+
+	// Without the duration, use the timestamp of the last tag.
+	b, _ = newTestVODFLV(t, func(positions []float64) []byte {
+		return newTestMetadata(0, []float64{0, 1, 2}, positions)
+	})
+	if r, err = NewReader(bytes.NewReader(b)); err != nil {
+		t.Fatalf("%+v", err)
+	} else if v := r.Duration(); v != 2980 {
+		t.Error(v)
+	}
+}
+
+func TestReader_MetadataInvalid(t *testing.T) {
+	for _, metadata := range []func(positions []float64) []byte{
+		// The positions are not video tags.
+		func(positions []float64) []byte {
+			return newTestMetadata(3.5, []float64{0, 1, 2}, []float64{13, 14, 15})
+		},
+		// The positions exceed the file.
+		func(positions []float64) []byte {
+			return newTestMetadata(3.5, []float64{0, 1, 2}, []float64{positions[0], positions[1], 1e9})
+		},
+		// The times and positions mismatch.
+		func(positions []float64) []byte {
+			return newTestMetadata(3.5, []float64{0, 1}, positions)
+		},
+	} {
+		b, positions := newTestVODFLV(t, metadata)
+
+		// Fallback to scan all tags.
+		r, err := NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if v := r.Duration(); v != 2980 {
+			t.Error(v)
+		}
+		if keyframes := r.Keyframes(); len(keyframes) != 3 || keyframes[2].Position != positions[2] {
+			t.Error(keyframes)
+		}
+	}
+}
+
+func TestReader_AudioOnly(t *testing.T) {
+	w := &bytes.Buffer{}
+	m, _ := NewMuxer(w)
+	m.WriteHeader(false, true)
+	for ts := uint32(0); ts < 2500; ts += 23 {
+		m.WriteTag(TagTypeAudio, ts, []byte{0xaf, 0x01, 0x03})
+	}
+
+	// Append a truncated tag.
+	b := append(w.Bytes(), byte(TagTypeAudio), 0x00, 0x00, 0x10)
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	keyframes := r.Keyframes()
+	if len(keyframes) != 3 {
+		t.Fatal(keyframes)
+	}
+	if keyframes[0].Timestamp != 0 || keyframes[1].Timestamp != 1012 || keyframes[2].Timestamp != 2024 {
+		t.Error(keyframes)
+	}
+	if v := r.Duration(); v != 2484 {
+		t.Error(v)
+	}
+}
+
+func TestReader_Empty(t *testing.T) {
+	w := &bytes.Buffer{}
+	m, _ := NewMuxer(w)
+	m.WriteHeader(true, true)
+
+	r, err := NewReader(bytes.NewReader(w.Bytes()))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err = r.SeekToTime(0); err == nil {
+		t.Error("should fail")
+	}
+	if _, _, _, err = r.ReadTag(); err != io.EOF {
+		t.Errorf("%+v", err)
+	}
+
+	if _, err = NewReader(bytes.NewReader([]byte("FLV"))); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	b := append(marshalTestScript(amf0.NewString("@setDataFrame")), newTestMetadata(10, []float64{0, 5}, []float64{100, 200})...)
+
+	m, err := parseMetadata(b)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if m.duration != 10 || len(m.times) != 2 || m.times[1] != 5 || m.filepositions[1] != 200 {
+		t.Error(m)
+	}
+
+	for _, b := range [][]byte{
+		nil,
+		marshalTestScript(amf0.NewNumber(1)),
+		marshalTestScript(amf0.NewNull()),
+		marshalTestScript(amf0.NewString("onMetaData"), amf0.NewNumber(1)),
+		append(marshalTestScript(amf0.NewString("onMetaData")), 0x0d),
+	} {
+		if _, err := parseMetadata(b); err == nil {
+			t.Errorf("should fail for %#x", b)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package flv
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	"io"
+	"os"
+)
+
+// The FLV recorder, to record FLV file which is seekable by players.
+// It reserves the onMetaData as the first tag, tracks the keyframes, and rewrites the
+// duration, filesize and keyframes of onMetaData in place when close, like yamdi.
+// @remark The keyframe position is the offset of the tag header in file, see Reader.
+type Recorder interface {
+	// Write a FLV tag, the video keyframe is indexed.
+	WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error)
+	// Finalize the onMetaData and close the recorder, the writer is not closed.
+	Close() error
+}
+
+// The options of FLV recorder.
+type RecorderOptions struct {
+	// Whether hasVideo or hasAudio in header and onMetaData.
+	HasVideo, HasAudio bool
+	// The max number of keyframes in onMetaData, to reserve the space of onMetaData.
+	// If exceed, the keyframes are sampled evenly. Use DefaultMaxKeyframes when 0.
+	MaxKeyframes int
+}
+
+// The default max number of keyframes in onMetaData, about 36KB.
+const DefaultMaxKeyframes = 2048
+
+// When write to a closed recorder.
+var errRecorderClosed = errors.New("FLV recorder closed")
+
+// Create a recorder object over the writer, which must be seekable to rewrite the onMetaData.
+// The header and the reserved onMetaData are written.
+func NewRecorder(w io.WriteSeeker, opts *RecorderOptions) (Recorder, error) {
+	v := &recorder{w: w}
+	if opts != nil {
+		v.opts = *opts
+	}
+	if v.opts.MaxKeyframes <= 0 {
+		v.opts.MaxKeyframes = DefaultMaxKeyframes
+	}
+
+	var err error
+	if v.m, err = NewMuxer(w); err != nil {
+		return nil, err
+	}
+
+	if err = v.m.WriteHeader(v.opts.HasVideo, v.opts.HasAudio); err != nil {
+		return nil, err
+	}
+
+	// Reserve the onMetaData with max keyframes.
+	v.reserved = len(v.marshalMetadata(make([]Keyframe, v.opts.MaxKeyframes), 0))
+	if err = v.m.WriteTag(TagTypeScriptData, 0, v.marshalMetadata(nil, v.reserved)); err != nil {
+		return nil, err
+	}
+
+	v.size = int64(flvHeaderSize + 11 + v.reserved + 4)
+	return v, nil
+}
+
+type recorder struct {
+	w    io.WriteSeeker
+	m    Muxer
+	opts RecorderOptions
+	// The size of onMetaData body.
+	reserved int
+	// The bytes written to file.
+	size int64
+	// The timestamp of the first and last tag.
+	started     bool
+	first, last uint32
+	keyframes   []Keyframe
+	closed      bool
+}
+
+func (v *recorder) WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error) {
+	if v.closed {
+		return errRecorderClosed
+	}
+
+	// Index the video keyframe, or audio about every second for audio only file.
+	if tagType == TagTypeVideo && len(tag) >= 2 && isKeyframe(tag) {
+		v.keyframes = append(v.keyframes, Keyframe{Timestamp: timestamp, Position: v.size})
+	} else if tagType == TagTypeAudio && !v.opts.HasVideo {
+		if n := len(v.keyframes); n == 0 || timestamp >= v.keyframes[n-1].Timestamp+1000 {
+			v.keyframes = append(v.keyframes, Keyframe{Timestamp: timestamp, Position: v.size})
+		}
+	}
+
+	if err = v.m.WriteTag(tagType, timestamp, tag); err != nil {
+		return
+	}
+	v.size += int64(11 + len(tag) + 4)
+
+	if !v.started {
+		v.started, v.first = true, timestamp
+	}
+	if timestamp > v.last {
+		v.last = timestamp
+	}
+	return
+}
+
+func (v *recorder) Close() (err error) {
+	if v.closed {
+		return nil
+	}
+	v.closed = true
+
+	// Sample the keyframes evenly if exceed, always keep the first and last one.
+	keyframes := v.keyframes
+	if n, max := len(keyframes), v.opts.MaxKeyframes; n > max {
+		keyframes = make([]Keyframe, max)
+		for i := range keyframes {
+			if max == 1 {
+				keyframes[i] = v.keyframes[n-1]
+			} else {
+				keyframes[i] = v.keyframes[i*(n-1)/(max-1)]
+			}
+		}
+	}
+
+	// Rewrite the onMetaData in place, then restore the position to the end.
+	if _, err = v.w.Seek(flvHeaderSize, os.SEEK_SET); err != nil {
+		return
+	}
+	if err = v.m.WriteTag(TagTypeScriptData, 0, v.marshalMetadata(keyframes, v.reserved)); err != nil {
+		return
+	}
+	if _, err = v.w.Seek(v.size, os.SEEK_SET); err != nil {
+		return
+	}
+
+	return v.m.Close()
+}
+
+// The duration in ms of the recorded tags.
+func (v *recorder) duration() uint32 {
+	return v.last - v.first
+}
+
+// Marshal the onMetaData with keyframes, padding to the reserved size if not 0.
+// Refer to @doc video_file_format_spec_v10.pdf, @page 80, @section E.5 onMetaData
+func (v *recorder) marshalMetadata(keyframes []Keyframe, reserved int) []byte {
+	filepositions, times := amf0.NewStrictArray(), amf0.NewStrictArray()
+	for _, k := range keyframes {
+		filepositions.Append(amf0.NewNumber(float64(k.Position)))
+		times.Append(amf0.NewNumber(float64(k.Timestamp) / 1000))
+	}
+
+	index := amf0.NewObject()
+	index.Set("filepositions", filepositions)
+	index.Set("times", times)
+
+	name := amf0.NewString("onMetaData")
+	m := amf0.NewEcmaArray()
+	m.Set("duration", amf0.NewNumber(float64(v.duration())/1000))
+	m.Set("filesize", amf0.NewNumber(float64(v.size)))
+	m.Set("hasVideo", amf0.NewBoolean(v.opts.HasVideo))
+	m.Set("hasAudio", amf0.NewBoolean(v.opts.HasAudio))
+	m.Set("keyframes", index)
+
+	// The padding to the reserved size, a long string property.
+	padding := reserved - name.Size() - m.Size() - (2 + 7 + 1 + 4)
+	if padding < 0 {
+		padding = 0
+	}
+	m.Set("padding", amf0.NewLongString(string(make([]byte, padding))))
+
+	w := &bytes.Buffer{}
+	for _, a := range []amf0.Amf0{name, m} {
+		// The values are always valid to marshal.
+		b, _ := a.MarshalBinary()
+		w.Write(b)
+	}
+	return w.Bytes()
+}
+
+// The options of segmented FLV recorder.
+type SegmentOptions struct {
+	RecorderOptions
+	// Start a new segment when the duration in ms of segment exceeds, 0 to ignore.
+	Duration uint32
+	// Start a new segment when the size in bytes of segment exceeds, 0 to ignore.
+	Size int64
+	// Create the writer of segment, the index starts from 0.
+	Create func(index int) (io.WriteSeeker, error)
+	// Optional, called when the segment is finalized, for example, to close the file.
+	OnClose func(index int, w io.WriteSeeker) error
+}
+
+// Create a segmented recorder, which starts a new segment by duration or size.
+// For stream with video, the new segment starts at the next video keyframe, otherwise at
+// the next audio tag. The sequence headers are written again at the start of new segment,
+// so each segment is playable.
+func NewSegmentedRecorder(opts *SegmentOptions) (Recorder, error) {
+	if opts == nil || opts.Create == nil {
+		return nil, errors.New("FLV no segment creator")
+	}
+
+	v := &segmentedRecorder{opts: *opts}
+	if err := v.open(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type segmentedRecorder struct {
+	opts SegmentOptions
+	// The current segment.
+	index int
+	w     io.WriteSeeker
+	r     *recorder
+	// The sequence headers, to write at the start of each segment.
+	videoSequenceHeader []byte
+	audioSequenceHeader []byte
+	closed              bool
+}
+
+func (v *segmentedRecorder) open() (err error) {
+	if v.w, err = v.opts.Create(v.index); err != nil {
+		return
+	}
+
+	var r Recorder
+	if r, err = NewRecorder(v.w, &v.opts.RecorderOptions); err != nil {
+		return
+	}
+	v.r = r.(*recorder)
+	return
+}
+
+func (v *segmentedRecorder) finalize() (err error) {
+	if err = v.r.Close(); err != nil {
+		return
+	}
+	if v.opts.OnClose != nil {
+		return v.opts.OnClose(v.index, v.w)
+	}
+	return
+}
+
+// Whether start a new segment before the tag.
+func (v *segmentedRecorder) shouldSplit(tagType TagType, timestamp uint32, tag []byte) bool {
+	// Never split the segment without any keyframe.
+	if len(v.r.keyframes) == 0 {
+		return false
+	}
+
+	// Only split at the video keyframe, or audio for audio only stream.
+	if v.opts.HasVideo {
+		if tagType != TagTypeVideo || len(tag) < 2 || !isKeyframe(tag) {
+			return false
+		}
+	} else if tagType != TagTypeAudio {
+		return false
+	}
+
+	if v.opts.Duration > 0 && timestamp >= v.r.first && timestamp-v.r.first >= v.opts.Duration {
+		return true
+	}
+	return v.opts.Size > 0 && v.r.size >= v.opts.Size
+}
+
+func (v *segmentedRecorder) WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error) {
+	if v.closed {
+		return errRecorderClosed
+	}
+
+	if v.shouldSplit(tagType, timestamp, tag) {
+		if err = v.finalize(); err != nil {
+			return
+		}
+
+		v.index++
+		if err = v.open(); err != nil {
+			return
+		}
+
+		// The sequence headers at the start of the new segment.
+		if v.videoSequenceHeader != nil {
+			if err = v.r.WriteTag(TagTypeVideo, timestamp, v.videoSequenceHeader); err != nil {
+				return
+			}
+		}
+		if v.audioSequenceHeader != nil {
+			if err = v.r.WriteTag(TagTypeAudio, timestamp, v.audioSequenceHeader); err != nil {
+				return
+			}
+		}
+	}
+
+	if isSequenceHeader(tagType, tag) {
+		if tagType == TagTypeVideo {
+			v.videoSequenceHeader = append([]byte(nil), tag...)
+		} else {
+			v.audioSequenceHeader = append([]byte(nil), tag...)
+		}
+	}
+
+	return v.r.WriteTag(tagType, timestamp, tag)
+}
+
+func (v *segmentedRecorder) Close() error {
+	if v.closed {
+		return nil
+	}
+	v.closed = true
+
+	return v.finalize()
+}
+
+// Whether the tag is the sequence header of video or audio, the codec configuration.
+func isSequenceHeader(tagType TagType, tag []byte) bool {
+	if len(tag) < 2 {
+		return false
+	}
+
+	if tagType == TagTypeVideo {
+		// For Enhanced RTMP, the sequence start.
+		if tag[0]&0x80 == 0x80 {
+			packetType := VideoPacketType(tag[0] & 0x0f)
+			return packetType == VideoPacketTypeSequenceStart || packetType == VideoPacketTypeMPEG2TSSequenceStart
+		}
+
+		codec := VideoCodec(tag[0] & 0x0f)
+		return (codec == VideoCodecAVC || codec == VideoCodecHEVC) &&
+			VideoFrameTrait(tag[1]) == VideoFrameTraitSequenceHeader
+	}
+
+	if tagType == TagTypeAudio {
+		// For Enhanced RTMP, the sequence start.
+		if AudioCodec(tag[0]>>4) == AudioCodecExHeader {
+			packetType := AudioPacketType(tag[0] & 0x0f)
+			return packetType == AudioPacketTypeSequenceStart || packetType == AudioPacketTypeMultichannelConfig
+		}
+
+		return AudioCodec(tag[0]>>4) == AudioCodecAAC && AudioFrameTrait(tag[1]) == AudioFrameTraitSequenceHeader
+	}
+
+	return false
+}
@@ -0,0 +1,357 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package flv
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	"io"
+	"os"
+	"testing"
+)
+
+// The in-memory file, which is seekable.
+type testFile struct {
+	b   []byte
+	pos int64
+}
+
+func (v *testFile) Write(p []byte) (int, error) {
+	if end := v.pos + int64(len(p)); end > int64(len(v.b)) {
+		v.b = append(v.b, make([]byte, end-int64(len(v.b)))...)
+	}
+	copy(v.b[v.pos:], p)
+	v.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (v *testFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+		v.pos = offset
+	case os.SEEK_CUR:
+		v.pos += offset
+	case os.SEEK_END:
+		v.pos = int64(len(v.b)) + offset
+	}
+	return v.pos, nil
+}
+
+// Write 3s video and audio, with sequence headers and a keyframe every second.
+func writeTestTags(t *testing.T, r Recorder) {
+	if err := r.WriteTag(TagTypeVideo, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := r.WriteTag(TagTypeAudio, 0, []byte{0xaf, 0x00, 0x12, 0x10}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for ts := uint32(0); ts < 3000; ts += 40 {
+		tag := []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x02}
+		if ts%1000 == 0 {
+			tag[0] = 0x17
+		}
+		if err := r.WriteTag(TagTypeVideo, ts, tag); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err := r.WriteTag(TagTypeAudio, ts+20, []byte{0xaf, 0x01, 0x03}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	f := &testFile{}
+	r, err := NewRecorder(f, &RecorderOptions{HasVideo: true, HasAudio: true})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	writeTestTags(t, r)
+	size := len(f.b)
+
+	if err = r.Close(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(f.b) != size || f.pos != int64(size) {
+		t.Error(len(f.b), size, f.pos)
+	}
+	if err = r.WriteTag(TagTypeAudio, 0, []byte{0xaf, 0x01}); err == nil {
+		t.Error("should fail")
+	}
+
+	// The onMetaData is finalized.
+	tagType, _, tag, err := readFirstTag(f.b)
+	if err != nil || tagType != TagTypeScriptData {
+		t.Fatal(tagType, err)
+	}
+	m, err := parseMetadata(tag)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if m.duration != 2.98 || len(m.times) != 3 || m.times[2] != 2 {
+		t.Error(m.duration, m.times)
+	}
+
+	// The onMetaData is AMF0, with the keyframes in StrictArray.
+	name, props := amf0.NewString(""), amf0.NewEcmaArray()
+	if err = name.UnmarshalBinary(tag); err != nil || string(*name) != "onMetaData" {
+		t.Errorf("invalid name %v %+v", name, err)
+	} else if err = props.UnmarshalBinary(tag[name.Size():]); err != nil {
+		t.Errorf("%+v", err)
+	} else if name.Size()+props.Size() != len(tag) {
+		t.Error(name.Size(), props.Size(), len(tag))
+	} else if k, ok := props.Get("keyframes").(*amf0.Object); !ok {
+		t.Error(props)
+	} else if times, ok := k.Get("times").(*amf0.StrictArray); !ok || len(times.Values()) != 3 {
+		t.Error(k)
+	}
+
+	// The reader uses the keyframes in onMetaData.
+	fr, err := NewReader(bytes.NewReader(f.b))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if v := fr.Duration(); v != 2980 {
+		t.Error(v)
+	}
+	if k, err := fr.SeekToTime(2500); err != nil {
+		t.Errorf("%+v", err)
+	} else if k.Timestamp != 2000 {
+		t.Error(k)
+	} else if tagType, timestamp, tag, err := fr.ReadTag(); err != nil {
+		t.Errorf("%+v", err)
+	} else if tagType != TagTypeVideo || timestamp != 2000 || tag[0] != 0x17 {
+		t.Error(tagType, timestamp, tag)
+	}
+}
+
+func readFirstTag(b []byte) (tagType TagType, timestamp uint32, tag []byte, err error) {
+	d, _ := NewDemuxer(bytes.NewReader(b))
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		return
+	}
+
+	var tagSize uint32
+	if tagType, tagSize, timestamp, err = d.ReadTagHeader(); err != nil {
+		return
+	}
+	tag, err = d.ReadTag(tagSize)
+	return
+}
+
+func TestRecorder_MaxKeyframes(t *testing.T) {
+	f := &testFile{}
+	r, err := NewRecorder(f, &RecorderOptions{HasVideo: true, MaxKeyframes: 2})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	writeTestTags(t, r)
+	if err = r.Close(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The file is still valid, with the previous tag size.
+	d, _ := NewDemuxerWithOptions(bytes.NewReader(f.b), &DemuxerOptions{Strict: true})
+	if tags, err := readTestTags(d); err != io.EOF {
+		t.Errorf("%+v", err)
+	} else if len(tags) != 1+2+150 {
+		t.Error(len(tags))
+	}
+
+	_, _, tag, _ := readFirstTag(f.b)
+	if m, err := parseMetadata(tag); err != nil {
+		t.Fatalf("%+v", err)
+	} else if len(m.times) != 2 || m.times[0] != 0 || m.times[1] != 2 {
+		t.Error(m.times)
+	} else if m.filepositions[1] <= m.filepositions[0] {
+		t.Error(m.filepositions)
+	}
+
+	// Sample 6 keyframes to 4, the first and last are kept.
+	f = &testFile{}
+	r, _ = NewRecorder(f, &RecorderOptions{HasVideo: true, MaxKeyframes: 4})
+	for ts := uint32(0); ts < 6000; ts += 1000 {
+		r.WriteTag(TagTypeVideo, ts, []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x02})
+	}
+	r.Close()
+
+	_, _, tag, _ = readFirstTag(f.b)
+	if m, err := parseMetadata(tag); err != nil {
+		t.Fatalf("%+v", err)
+	} else if len(m.times) != 4 || m.times[0] != 0 || m.times[1] != 1 || m.times[2] != 3 || m.times[3] != 5 {
+		t.Error(m.times)
+	}
+}
+
+func TestRecorder_AudioOnly(t *testing.T) {
+	f := &testFile{}
+	r, _ := NewRecorder(f, &RecorderOptions{HasAudio: true})
+	for ts := uint32(0); ts < 2500; ts += 23 {
+		r.WriteTag(TagTypeAudio, ts, []byte{0xaf, 0x01, 0x03})
+	}
+	r.Close()
+
+	_, _, tag, _ := readFirstTag(f.b)
+	if m, err := parseMetadata(tag); err != nil {
+		t.Fatalf("%+v", err)
+	} else if len(m.times) != 3 || m.duration != 2.484 {
+		t.Error(m.times, m.duration)
+	}
+}
+
+func TestRecorder_AudioOnlyReader(t *testing.T) {
+	// The keyframes are sampled, so the reader uses the index in onMetaData, not by scanning.
+	f := &testFile{}
+	r, _ := NewRecorder(f, &RecorderOptions{HasAudio: true, MaxKeyframes: 2})
+	for ts := uint32(0); ts < 5000; ts += 23 {
+		r.WriteTag(TagTypeAudio, ts, []byte{0xaf, 0x01, 0x03})
+	}
+	r.Close()
+
+	fr, err := NewReader(bytes.NewReader(f.b))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	keyframes := fr.Keyframes()
+	if len(keyframes) != 2 {
+		t.Fatal(keyframes)
+	}
+	for _, k := range keyframes {
+		if tagType, timestamp, _, err := fr.ReadTagAt(k.Position); err != nil || tagType != TagTypeAudio || timestamp != k.Timestamp {
+			t.Errorf("invalid keyframe %v, tag %v %v %v", k, tagType, timestamp, err)
+		}
+	}
+	if v := fr.Duration(); v != 4991 {
+		t.Error(v)
+	}
+}
+
+func TestSegmentedRecorder_Duration(t *testing.T) {
+	var files []*testFile
+	var closed []int
+	r, err := NewSegmentedRecorder(&SegmentOptions{
+		RecorderOptions: RecorderOptions{HasVideo: true, HasAudio: true},
+		Duration:        1000,
+		Create: func(index int) (io.WriteSeeker, error) {
+			files = append(files, &testFile{})
+			return files[index], nil
+		},
+		OnClose: func(index int, w io.WriteSeeker) error {
+			closed = append(closed, index)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	writeTestTags(t, r)
+	if err = r.Close(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if len(files) != 3 || len(closed) != 3 || closed[2] != 2 {
+		t.Fatal(len(files), closed)
+	}
+
+	for i, f := range files {
+		d, _ := NewDemuxerWithOptions(bytes.NewReader(f.b), &DemuxerOptions{Strict: true})
+		tags, err := readTestTags(d)
+		if err != io.EOF {
+			t.Errorf("%+v", err)
+		}
+
+		// The onMetaData, sequence headers, then the keyframe.
+		if len(tags) != 1+2+50 {
+			t.Error(i, len(tags))
+		}
+		if isSequenceHeader(TagTypeVideo, tags[1]) != true || isSequenceHeader(TagTypeAudio, tags[2]) != true {
+			t.Error(i, tags[1], tags[2])
+		}
+		if !isKeyframe(tags[3]) {
+			t.Error(i, tags[3])
+		}
+
+		fr, err := NewReader(bytes.NewReader(f.b))
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if keyframes := fr.Keyframes(); len(keyframes) != 1 || keyframes[0].Timestamp != uint32(i*1000) {
+			t.Error(i, keyframes)
+		}
+	}
+}
+
+func TestSegmentedRecorder_Size(t *testing.T) {
+	var files []*testFile
+	r, err := NewSegmentedRecorder(&SegmentOptions{
+		RecorderOptions: RecorderOptions{HasVideo: true, HasAudio: true, MaxKeyframes: 16},
+		Size:            1,
+		Create: func(index int) (io.WriteSeeker, error) {
+			files = append(files, &testFile{})
+			return files[index], nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// Split at each keyframe, for the size always exceeds.
+	writeTestTags(t, r)
+	r.Close()
+	if len(files) != 3 {
+		t.Error(len(files))
+	}
+
+	if err = r.WriteTag(TagTypeAudio, 0, []byte{0xaf, 0x01}); err == nil {
+		t.Error("should fail")
+	}
+	if _, err = NewSegmentedRecorder(&SegmentOptions{}); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestIsSequenceHeader(t *testing.T) {
+	for _, c := range []struct {
+		tagType TagType
+		tag     []byte
+		expect  bool
+	}{
+		{TagTypeVideo, []byte{0x17, 0x00}, true},
+		{TagTypeVideo, []byte{0x1c, 0x00}, true},
+		{TagTypeVideo, []byte{0x17, 0x01}, false},
+		{TagTypeVideo, []byte{0x90, 'a', 'v', '0', '1'}, true},
+		{TagTypeVideo, []byte{0x91, 'a', 'v', '0', '1'}, false},
+		{TagTypeAudio, []byte{0xaf, 0x00}, true},
+		{TagTypeAudio, []byte{0xaf, 0x01}, false},
+		{TagTypeAudio, []byte{0x2f, 0x00}, false},
+		{TagTypeAudio, []byte{0x90, 'O', 'p', 'u', 's'}, true},
+		{TagTypeScriptData, []byte{0x02, 0x00}, false},
+		{TagTypeVideo, []byte{0x17}, false},
+	} {
+		if v := isSequenceHeader(c.tagType, c.tag); v != c.expect {
+			t.Errorf("%v %#x: %v", c.tagType, c.tag, v)
+		}
+	}
+}
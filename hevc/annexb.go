@@ -0,0 +1,59 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package hevc
+
+import (
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// Create the record from the Annex B byte stream, which must contain the VPS, SPS and PPS.
+// @remark We use the first VPS, SPS and PPS, and ignore others NALUs.
+func NewHEVCDecoderConfigurationRecordFromAnnexB(data []byte) (*HEVCDecoderConfigurationRecord, error) {
+	nalus, err := avc.SplitAnnexB(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "split")
+	}
+
+	var vps, sps, pps []byte
+	for _, nalu := range nalus {
+		switch NALUType(nalu[0]>>1) & 0x3f {
+		case NALUType_VPS_NUT:
+			if vps == nil {
+				vps = nalu
+			}
+		case NALUType_SPS_NUT:
+			if sps == nil {
+				sps = nalu
+			}
+		case NALUType_PPS_NUT:
+			if pps == nil {
+				pps = nalu
+			}
+		}
+	}
+
+	if vps == nil || sps == nil || pps == nil {
+		return nil, errors.Errorf("no vps, sps or pps, vps=%vB, sps=%vB, pps=%vB", len(vps), len(sps), len(pps))
+	}
+	return NewHEVCDecoderConfigurationRecordFromNALUs(vps, sps, pps)
+}
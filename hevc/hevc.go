@@ -258,8 +258,8 @@ func (v *NALUHeader) UnmarshalBinary(data []byte) error {
 // @remark user must ensure the bytes left is at least 2.
 func (v *NALUHeader) MarshalBinary() ([]byte, error) {
 	return []byte{
-		byte(v.Forbidden)<<7 | byte(v.NALUType)<<1 | byte(v.NUHLayerID&0x01),
-		byte(v.NUHLayerID&0x1f)<<3 | byte(v.NUHTemporalIDPlus1),
+		byte(v.Forbidden)<<7 | byte(v.NALUType)<<1 | byte(v.NUHLayerID>>5)&0x01,
+		byte(v.NUHLayerID&0x1f)<<3 | byte(v.NUHTemporalIDPlus1&0x07),
 	}, nil
 }
 
@@ -308,8 +308,31 @@ func (v *NALU) MarshalBinary() ([]byte, error) {
 	return append(b, v.Data...), nil
 }
 
+// @doc ITU-T-H.265-2013.pdf, A.3 Profiles
 type HEVCProfile uint8
 
+const (
+	HEVCProfileMain             HEVCProfile = 1
+	HEVCProfileMain10           HEVCProfile = 2
+	HEVCProfileMainStillPicture HEVCProfile = 3
+	HEVCProfileRExt             HEVCProfile = 4
+)
+
+func (v HEVCProfile) String() string {
+	switch v {
+	case HEVCProfileMain:
+		return "Main"
+	case HEVCProfileMain10:
+		return "Main10"
+	case HEVCProfileMainStillPicture:
+		return "MainStillPicture"
+	case HEVCProfileRExt:
+		return "RExt"
+	default:
+		return fmt.Sprintf("Profile/%v", uint8(v))
+	}
+}
+
 // hevc sequence header
 type HEVCDecoderConfigurationRecord struct {
 	// It contains the profile code as defined in ISO/IEC 14496-10.
@@ -386,52 +409,224 @@ func NewHEVCDecoderConfigurationRecord() *HEVCDecoderConfigurationRecord {
 	return v
 }
 
-// func (v *HEVCDecoderConfigurationRecord) MarshalBinary() ([]byte, error) {
-// 	var buf bytes.Buffer
-// 	buf.WriteByte(byte(v.configurationVersion))
-// 	buf.WriteByte(byte(v.HEVCProfileIndication))
-// 	buf.WriteByte(byte(v.profileCompatibility))
-// 	buf.WriteByte(byte(v.AVCLevelIndication))
-// 	buf.WriteByte(byte(v.LengthSizeMinusOne))
-
-// 	// numOfSequenceParameterSets
-// 	buf.WriteByte(byte(len(v.SequenceParameterSetNALUnits)))
-// 	for _, sps := range v.SequenceParameterSetNALUnits {
-// 		b, err := sps.MarshalBinary()
-// 		if err != nil {
-// 			return nil, errors.WithMessage(err, "sps")
-// 		}
+// Create the record from the raw VPS, SPS and PPS NALUs, with the NALU header.
+// The profile, tier, level, chroma format and bit depth are parsed from the SPS.
+func NewHEVCDecoderConfigurationRecordFromNALUs(vps, sps, pps []byte) (*HEVCDecoderConfigurationRecord, error) {
+	v := NewHEVCDecoderConfigurationRecord()
+	v.LengthSizeMinusOne = 3
 
-// 		sequenceParameterSetLength := uint16(len(b))
-// 		buf.WriteByte(byte(sequenceParameterSetLength >> 8))
-// 		buf.WriteByte(byte(sequenceParameterSetLength))
-// 		buf.Write(b)
-// 	}
+	// Parse the VPS to make sure it's valid.
+	if err := NewVideoParameterSet().UnmarshalBinary(vps); err != nil {
+		return nil, errors.WithMessage(err, "vps")
+	}
 
-// 	// numOfPictureParameterSets
-// 	buf.WriteByte(byte(len(v.PictureParameterSetNALUnits)))
-// 	for _, pps := range v.PictureParameterSetNALUnits {
-// 		b, err := pps.MarshalBinary()
-// 		if err != nil {
-// 			return nil, errors.WithMessage(err, "pps")
-// 		}
+	s := NewSequenceParameterSet()
+	if err := s.UnmarshalBinary(sps); err != nil {
+		return nil, errors.WithMessage(err, "sps")
+	}
 
-// 		pictureParameterSetLength := uint16(len(b))
-// 		buf.WriteByte(byte(pictureParameterSetLength >> 8))
-// 		buf.WriteByte(byte(pictureParameterSetLength))
-// 		buf.Write(b)
-// 	}
+	if err := NewPictureParameterSet().UnmarshalBinary(pps); err != nil {
+		return nil, errors.WithMessage(err, "pps")
+	}
 
-// 	return buf.Bytes(), nil
-// }
+	ptl := &s.ProfileTierLevel
+	v.profileSpace = ptl.GeneralProfileSpace
+	v.tierFlag = ptl.GeneralTierFlag
+	v.HEVCProfileIndication = ptl.GeneralProfileIDC
+	v.profileCompatibilityFlags = ptl.GeneralProfileCompatibilityFlags
+	v.constraintIndicatorFlags = ptl.GeneralConstraintIndicatorFlags
+	v.levelIndication = ptl.GeneralLevelIDC
+	if s.VUI != nil {
+		v.minSpatialSegmentationIDC = uint16(s.VUI.MinSpatialSegmentationIDC & 0x0fff)
+	}
+	v.chromaFormat = uint8(s.ChromaFormatIDC)
+	v.bitDepthLumaMinus8 = uint8(s.BitDepthLumaMinus8 & 0x07)
+	v.bitDepthChromaMinus8 = uint8(s.BitDepthChromaMinus8 & 0x07)
+	v.numTemporalLayers = s.SPSMaxSubLayersMinus1 + 1
+	if s.SPSTemporalIDNestingFlag {
+		v.temporalIdNested = 1
+	}
+
+	for _, e := range []struct {
+		b     []byte
+		units *[]*NALU
+	}{
+		{vps, &v.VideoParameterSetNALUnits},
+		{sps, &v.SequenceParameterSetNALUnits},
+		{pps, &v.PictureParameterSetNALUnits},
+	} {
+		nalu := NewNALU()
+		if err := nalu.UnmarshalBinary(e.b); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal")
+		}
+		*e.units = append(*e.units, nalu)
+	}
+	v.numOfNaluArrays = 3
+
+	return v, nil
+}
+
+// The general_profile_space, 2 bits.
+func (v *HEVCDecoderConfigurationRecord) ProfileSpace() uint8 {
+	return v.profileSpace
+}
+
+// The general_tier_flag, 0 for Main tier and 1 for High tier.
+func (v *HEVCDecoderConfigurationRecord) TierFlag() uint8 {
+	return v.tierFlag
+}
+
+// The general_profile_compatibility_flags, 32 bits.
+func (v *HEVCDecoderConfigurationRecord) ProfileCompatibilityFlags() uint32 {
+	return v.profileCompatibilityFlags
+}
+
+// The general_constraint_indicator_flags, 48 bits.
+func (v *HEVCDecoderConfigurationRecord) ConstraintIndicatorFlags() uint64 {
+	return v.constraintIndicatorFlags
+}
+
+// The general_level_idc, which is 30 times the level number, for example, 93 for level 3.1.
+func (v *HEVCDecoderConfigurationRecord) LevelIndication() uint8 {
+	return v.levelIndication
+}
+
+// The chroma_format_idc, 1 for 4:2:0.
+func (v *HEVCDecoderConfigurationRecord) ChromaFormat() uint8 {
+	return v.chromaFormat
+}
+
+// The bit depth of luma and chroma.
+func (v *HEVCDecoderConfigurationRecord) BitDepth() (luma, chroma int) {
+	return 8 + int(v.bitDepthLumaMinus8), 8 + int(v.bitDepthChromaMinus8)
+}
+
+// Marshal H.265 sequence header with HEVCDecoderConfigurationRecord to bytes.
+// @doc ISO_IEC_14496-15-2017.pdf, 8.3.3.1 HEVC decoder configuration record
+func (v *HEVCDecoderConfigurationRecord) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(v.configurationVersion))
+	buf.WriteByte(byte(v.profileSpace&0x03)<<6 | byte(v.tierFlag&0x01)<<5 | byte(v.HEVCProfileIndication&0x1f))
+	for i := 3; i >= 0; i-- {
+		buf.WriteByte(byte(v.profileCompatibilityFlags >> uint(8*i)))
+	}
+	for i := 5; i >= 0; i-- {
+		buf.WriteByte(byte(v.constraintIndicatorFlags >> uint(8*i)))
+	}
+	buf.WriteByte(byte(v.levelIndication))
+	buf.WriteByte(0xf0 | byte(v.minSpatialSegmentationIDC>>8)&0x0f)
+	buf.WriteByte(byte(v.minSpatialSegmentationIDC))
+	buf.WriteByte(0xfc | byte(v.parallelismType&0x03))
+	buf.WriteByte(0xfc | byte(v.chromaFormat&0x03))
+	buf.WriteByte(0xf8 | byte(v.bitDepthLumaMinus8&0x07))
+	buf.WriteByte(0xf8 | byte(v.bitDepthChromaMinus8&0x07))
+	buf.WriteByte(byte(v.avgFrameRate >> 8))
+	buf.WriteByte(byte(v.avgFrameRate))
+	buf.WriteByte(byte(v.constantFrameRate&0x03)<<6 | byte(v.numTemporalLayers&0x07)<<3 |
+		byte(v.temporalIdNested&0x01)<<2 | byte(v.LengthSizeMinusOne&0x03))
+
+	arrays := []struct {
+		t     NALUType
+		units []*NALU
+	}{
+		{NALUType_VPS_NUT, v.VideoParameterSetNALUnits},
+		{NALUType_SPS_NUT, v.SequenceParameterSetNALUnits},
+		{NALUType_PPS_NUT, v.PictureParameterSetNALUnits},
+	}
+
+	var numOfArrays byte
+	for _, array := range arrays {
+		if len(array.units) > 0 {
+			numOfArrays++
+		}
+	}
+	buf.WriteByte(numOfArrays)
+
+	for _, array := range arrays {
+		if len(array.units) == 0 {
+			continue
+		}
+
+		// The array_completeness is 1, all parameter sets are in the array.
+		buf.WriteByte(0x80 | byte(array.t))
+		buf.WriteByte(byte(len(array.units) >> 8))
+		buf.WriteByte(byte(len(array.units)))
+		for _, nalu := range array.units {
+			b, err := nalu.MarshalBinary()
+			if err != nil {
+				return nil, errors.WithMessage(err, array.t.String())
+			}
+
+			nalUnitLength := uint16(len(b))
+			buf.WriteByte(byte(nalUnitLength >> 8))
+			buf.WriteByte(byte(nalUnitLength))
+			buf.Write(b)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Parse the first VPS in record.
+func (v *HEVCDecoderConfigurationRecord) VPS() (*VideoParameterSet, error) {
+	if len(v.VideoParameterSetNALUnits) == 0 {
+		return nil, errors.New("no vps")
+	}
+
+	b, err := v.VideoParameterSetNALUnits[0].MarshalBinary()
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal")
+	}
+
+	vps := NewVideoParameterSet()
+	if err = vps.UnmarshalBinary(b); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal")
+	}
+	return vps, nil
+}
+
+// Parse the first SPS in record.
+func (v *HEVCDecoderConfigurationRecord) SPS() (*SequenceParameterSet, error) {
+	if len(v.SequenceParameterSetNALUnits) == 0 {
+		return nil, errors.New("no sps")
+	}
+
+	b, err := v.SequenceParameterSetNALUnits[0].MarshalBinary()
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal")
+	}
+
+	sps := NewSequenceParameterSet()
+	if err = sps.UnmarshalBinary(b); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal")
+	}
+	return sps, nil
+}
+
+// Parse the first PPS in record.
+func (v *HEVCDecoderConfigurationRecord) PPS() (*PictureParameterSet, error) {
+	if len(v.PictureParameterSetNALUnits) == 0 {
+		return nil, errors.New("no pps")
+	}
+
+	b, err := v.PictureParameterSetNALUnits[0].MarshalBinary()
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal")
+	}
+
+	pps := NewPictureParameterSet()
+	if err = pps.UnmarshalBinary(b); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal")
+	}
+	return pps, nil
+}
 
 // Unmarshal H.265 sequence header with HEVCDecoderConfigurationRecord from bytes.
 // @remark user must ensure the bytes left is at least 23.
 func (v *HEVCDecoderConfigurationRecord) UnmarshalBinary(data []byte) error {
-	resLen := len(data)
 	b := data
-	if len(b) < 24 {
-		return errors.Errorf("requires 24+ only %v bytes", len(b))
+	if len(b) < 23 {
+		return errors.Errorf("requires 23+ only %v bytes", len(b))
 	}
 
 	v.configurationVersion = uint8(b[0])
@@ -459,37 +654,28 @@ func (v *HEVCDecoderConfigurationRecord) UnmarshalBinary(data []byte) error {
 	v.numOfNaluArrays = uint8(b[22])
 
 	b = b[23:]
-	resLen -= 23
-	for {
-		var (
-			offset  = 0
-			err     error
-			nalType = NALUType(b[0])
-		)
-		switch nalType {
-		case NALUType_VPS_NUT:
-			offset, err = v.parseVPS_SPS_PPS(b[1:], NALUType_VPS_NUT)
-		case NALUType_SPS_NUT:
-			offset, err = v.parseVPS_SPS_PPS(b[1:], NALUType_SPS_NUT)
-		case NALUType_PPS_NUT:
-			offset, err = v.parseVPS_SPS_PPS(b[1:], NALUType_PPS_NUT)
-		default:
-			return errors.New("error NALU type")
+	for i := 0; i < int(v.numOfNaluArrays); i++ {
+		if len(b) < 1 {
+			return errors.Errorf("requires 1+ only %v bytes", len(b))
 		}
+
+		// The array_completeness(1 bit) and reserved(1 bit) is ignored.
+		nalType := NALUType(b[0] & 0x3f)
+		offset, err := v.parseVPS_SPS_PPS(b[1:], nalType)
 		if err != nil {
-			return err
+			return errors.WithMessage(err, nalType.String())
 		}
 		b = b[offset+1:]
-		resLen -= offset + 1
-		if resLen <= 0 {
-			break
-		}
 	}
 
 	return nil
 }
 
 func (v *HEVCDecoderConfigurationRecord) parseVPS_SPS_PPS(b []byte, nalType NALUType) (int, error) {
+	if len(b) < 2 {
+		return 0, errors.Errorf("requires 2+ only %v bytes", len(b))
+	}
+
 	offset := 0
 	numOfVideoParameterSets := uint16(b[0])<<8 | uint16(b[1])
 	b = b[2:]
@@ -520,6 +706,7 @@ func (v *HEVCDecoderConfigurationRecord) parseVPS_SPS_PPS(b []byte, nalType NALU
 		case NALUType_PPS_NUT:
 			v.PictureParameterSetNALUnits = append(v.PictureParameterSetNALUnits, nalu)
 		}
+		// @remark We ignore other NALUs, such as SEI.
 	}
 
 	return offset, nil
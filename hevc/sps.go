@@ -0,0 +1,817 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package hevc
+
+import (
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// Parse the NALU bytes with header to RBSP, the nal_unit_type must be t.
+func nalToRBSP(data []byte, t NALUType) ([]byte, error) {
+	h := NewNALUHeader()
+	if err := h.UnmarshalBinary(data); err != nil {
+		return nil, errors.WithMessage(err, "header")
+	}
+	if h.NALUType != t {
+		return nil, errors.Errorf("require %v, actual %v", t, h.NALUType)
+	}
+	return avc.RemoveEmulationPrevention(data[2:]), nil
+}
+
+// The max sub-layers, the sps_max_sub_layers_minus1 is in [0, 6].
+const maxSubLayers = 7
+
+// The profile_tier_level of VPS and SPS, for general layer only, the sub-layers are skipped.
+// @doc ITU-T-H.265-2013.pdf, 7.3.3 Profile, tier and level syntax
+type ProfileTierLevel struct {
+	GeneralProfileSpace uint8
+	GeneralTierFlag     uint8
+	GeneralProfileIDC   HEVCProfile
+	// The 32 general_profile_compatibility_flag, MSB is general_profile_compatibility_flag[0].
+	GeneralProfileCompatibilityFlags uint32
+	// The 48 bits from general_progressive_source_flag to general_inbld_flag(or reserved).
+	GeneralConstraintIndicatorFlags uint64
+	GeneralLevelIDC                 uint8
+
+	SubLayerProfilePresentFlags []bool
+	SubLayerLevelPresentFlags   []bool
+}
+
+func (v *ProfileTierLevel) parse(p *avc.BitParser, maxNumSubLayersMinus1 int) {
+	v.GeneralProfileSpace = uint8(p.U(2))
+	v.GeneralTierFlag = uint8(p.U(1))
+	v.GeneralProfileIDC = HEVCProfile(p.U(5))
+	v.GeneralProfileCompatibilityFlags = p.U(32)
+	v.GeneralConstraintIndicatorFlags = uint64(p.U(16))<<32 | uint64(p.U(32))
+	v.GeneralLevelIDC = uint8(p.U(8))
+
+	v.SubLayerProfilePresentFlags = make([]bool, maxNumSubLayersMinus1)
+	v.SubLayerLevelPresentFlags = make([]bool, maxNumSubLayersMinus1)
+	for i := 0; i < maxNumSubLayersMinus1; i++ {
+		v.SubLayerProfilePresentFlags[i] = p.Flag()
+		v.SubLayerLevelPresentFlags[i] = p.Flag()
+	}
+	if maxNumSubLayersMinus1 > 0 {
+		// The reserved_zero_2bits to align the sub-layer flags to 16 bits.
+		p.Skip(2 * (8 - maxNumSubLayersMinus1))
+	}
+
+	for i := 0; i < maxNumSubLayersMinus1; i++ {
+		if v.SubLayerProfilePresentFlags[i] {
+			// From sub_layer_profile_space to sub_layer_inbld_flag(or reserved).
+			p.Skip(88)
+		}
+		if v.SubLayerLevelPresentFlags[i] {
+			p.Skip(8)
+		}
+	}
+}
+
+// The sub_layer_ordering_info for each sub-layer.
+type SubLayerOrderingInfo struct {
+	MaxDecPicBufferingMinus1 uint32
+	MaxNumReorderPics        uint32
+	MaxLatencyIncreasePlus1  uint32
+}
+
+func parseSubLayerOrderingInfos(p *avc.BitParser, maxSubLayersMinus1 int) (infos []SubLayerOrderingInfo) {
+	from := maxSubLayersMinus1
+	if p.Flag() {
+		from = 0
+	}
+
+	for i := from; i <= maxSubLayersMinus1; i++ {
+		infos = append(infos, SubLayerOrderingInfo{
+			MaxDecPicBufferingMinus1: p.UE(),
+			MaxNumReorderPics:        p.UE(),
+			MaxLatencyIncreasePlus1:  p.UE(),
+		})
+	}
+	return
+}
+
+// The VPS(video parameter set), parsed from the VPS NALU.
+// @doc ITU-T-H.265-2013.pdf, 7.3.2.1 Video parameter set RBSP syntax
+type VideoParameterSet struct {
+	VPSVideoParameterSetID      uint8
+	VPSBaseLayerInternalFlag    bool
+	VPSBaseLayerAvailableFlag   bool
+	VPSMaxLayersMinus1          uint8
+	VPSMaxSubLayersMinus1       uint8
+	VPSTemporalIDNestingFlag    bool
+	ProfileTierLevel            ProfileTierLevel
+	SubLayerOrderingInfos       []SubLayerOrderingInfo
+	VPSMaxLayerID               uint8
+	VPSNumLayerSetsMinus1       uint32
+	VPSTimingInfoPresentFlag    bool
+	VPSNumUnitsInTick           uint32
+	VPSTimeScale                uint32
+	VPSPocProportionalToTiming  bool
+	VPSNumTicksPocDiffOneMinus1 uint32
+	// @remark We ignore the hrd_parameters and extension.
+	VPSNumHRDParameters uint32
+}
+
+func NewVideoParameterSet() *VideoParameterSet {
+	return &VideoParameterSet{}
+}
+
+// Unmarshal the VPS NALU, with the NALU header.
+func (v *VideoParameterSet) UnmarshalBinary(data []byte) error {
+	rbsp, err := nalToRBSP(data, NALUType_VPS_NUT)
+	if err != nil {
+		return errors.WithMessage(err, "vps")
+	}
+
+	p := avc.NewBitParser(rbsp)
+
+	v.VPSVideoParameterSetID = uint8(p.U(4))
+	v.VPSBaseLayerInternalFlag = p.Flag()
+	v.VPSBaseLayerAvailableFlag = p.Flag()
+	v.VPSMaxLayersMinus1 = uint8(p.U(6))
+	if v.VPSMaxSubLayersMinus1 = uint8(p.U(3)); v.VPSMaxSubLayersMinus1 >= maxSubLayers {
+		return errors.Errorf("invalid vps_max_sub_layers_minus1 %v", v.VPSMaxSubLayersMinus1)
+	}
+	v.VPSTemporalIDNestingFlag = p.Flag()
+	p.Skip(16) // vps_reserved_0xffff_16bits
+
+	v.ProfileTierLevel.parse(p, int(v.VPSMaxSubLayersMinus1))
+	v.SubLayerOrderingInfos = parseSubLayerOrderingInfos(p, int(v.VPSMaxSubLayersMinus1))
+
+	v.VPSMaxLayerID = uint8(p.U(6))
+	if v.VPSNumLayerSetsMinus1 = p.UE(); v.VPSNumLayerSetsMinus1 > 1023 {
+		return errors.Errorf("invalid vps_num_layer_sets_minus1 %v", v.VPSNumLayerSetsMinus1)
+	}
+	// The layer_id_included_flag for each layer set.
+	for i := 1; i <= int(v.VPSNumLayerSetsMinus1); i++ {
+		p.Skip(int(v.VPSMaxLayerID) + 1)
+	}
+
+	if v.VPSTimingInfoPresentFlag = p.Flag(); v.VPSTimingInfoPresentFlag {
+		v.VPSNumUnitsInTick = p.U(32)
+		v.VPSTimeScale = p.U(32)
+		if v.VPSPocProportionalToTiming = p.Flag(); v.VPSPocProportionalToTiming {
+			v.VPSNumTicksPocDiffOneMinus1 = p.UE()
+		}
+		v.VPSNumHRDParameters = p.UE()
+	}
+
+	if p.Err() != nil {
+		return errors.WithMessage(p.Err(), "vps")
+	}
+	return nil
+}
+
+// Parse the scaling_list_data, we only check the syntax and ignore the values.
+// @doc ITU-T-H.265-2013.pdf, 7.3.4 Scaling list data syntax
+func parseScalingListData(p *avc.BitParser) {
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			if !p.Flag() {
+				p.UE() // scaling_list_pred_matrix_id_delta
+				continue
+			}
+
+			coefNum := 64
+			if sizeID == 0 {
+				coefNum = 16
+			}
+			if sizeID > 1 {
+				p.SE() // scaling_list_dc_coef_minus8
+			}
+			for i := 0; i < coefNum && p.Err() == nil; i++ {
+				p.SE() // scaling_list_delta_coef
+			}
+		}
+	}
+}
+
+// The short-term reference picture set, with the derived DeltaPocS0 and DeltaPocS1.
+// @doc ITU-T-H.265-2013.pdf, 7.3.7 Short-term reference picture set syntax
+type ShortTermRefPicSet struct {
+	InterRefPicSetPredictionFlag bool
+	// The DeltaPocS0 of negative pictures, and DeltaPocS1 of positive pictures.
+	DeltaPocS0 []int32
+	DeltaPocS1 []int32
+}
+
+// The NumDeltaPocs of the set.
+func (v *ShortTermRefPicSet) NumDeltaPocs() int {
+	return len(v.DeltaPocS0) + len(v.DeltaPocS1)
+}
+
+// Parse the st_ref_pic_set(stRpsIdx) in SPS, the sets are the parsed ones before it.
+func (v *ShortTermRefPicSet) parse(p *avc.BitParser, sets []*ShortTermRefPicSet) {
+	if len(sets) > 0 {
+		v.InterRefPicSetPredictionFlag = p.Flag()
+	}
+
+	if !v.InterRefPicSetPredictionFlag {
+		numNegativePics, numPositivePics := p.UE(), p.UE()
+		if numNegativePics > 16 || numPositivePics > 16 {
+			p.SetErr(errors.Errorf("invalid pics negative=%v, positive=%v", numNegativePics, numPositivePics))
+			return
+		}
+
+		var poc int32
+		for i := 0; i < int(numNegativePics); i++ {
+			poc -= int32(p.UE()) + 1
+			p.Flag() // used_by_curr_pic_s0_flag
+			v.DeltaPocS0 = append(v.DeltaPocS0, poc)
+		}
+
+		poc = 0
+		for i := 0; i < int(numPositivePics); i++ {
+			poc += int32(p.UE()) + 1
+			p.Flag() // used_by_curr_pic_s1_flag
+			v.DeltaPocS1 = append(v.DeltaPocS1, poc)
+		}
+		return
+	}
+
+	// In SPS, the delta_idx_minus1 is not present and inferred to 0.
+	ref := sets[len(sets)-1]
+	deltaRps := int32(p.U(1))
+	deltaRps = (1 - 2*deltaRps) * (int32(p.UE()) + 1)
+
+	useDeltaFlags := make([]bool, ref.NumDeltaPocs()+1)
+	for j := range useDeltaFlags {
+		usedByCurrPicFlag := p.Flag()
+		useDeltaFlags[j] = usedByCurrPicFlag
+		if !usedByCurrPicFlag {
+			useDeltaFlags[j] = p.Flag()
+		}
+	}
+
+	// @doc ITU-T-H.265-2013.pdf, 7.4.8 Short-term reference picture set semantics, (7-61) and (7-62)
+	numNegativePics := len(ref.DeltaPocS0)
+	for j := len(ref.DeltaPocS1) - 1; j >= 0; j-- {
+		if dPoc := ref.DeltaPocS1[j] + deltaRps; dPoc < 0 && useDeltaFlags[numNegativePics+j] {
+			v.DeltaPocS0 = append(v.DeltaPocS0, dPoc)
+		}
+	}
+	if deltaRps < 0 && useDeltaFlags[ref.NumDeltaPocs()] {
+		v.DeltaPocS0 = append(v.DeltaPocS0, deltaRps)
+	}
+	for j := 0; j < numNegativePics; j++ {
+		if dPoc := ref.DeltaPocS0[j] + deltaRps; dPoc < 0 && useDeltaFlags[j] {
+			v.DeltaPocS0 = append(v.DeltaPocS0, dPoc)
+		}
+	}
+
+	for j := numNegativePics - 1; j >= 0; j-- {
+		if dPoc := ref.DeltaPocS0[j] + deltaRps; dPoc > 0 && useDeltaFlags[j] {
+			v.DeltaPocS1 = append(v.DeltaPocS1, dPoc)
+		}
+	}
+	if deltaRps > 0 && useDeltaFlags[ref.NumDeltaPocs()] {
+		v.DeltaPocS1 = append(v.DeltaPocS1, deltaRps)
+	}
+	for j := 0; j < len(ref.DeltaPocS1); j++ {
+		if dPoc := ref.DeltaPocS1[j] + deltaRps; dPoc > 0 && useDeltaFlags[numNegativePics+j] {
+			v.DeltaPocS1 = append(v.DeltaPocS1, dPoc)
+		}
+	}
+}
+
+// Parse the hrd_parameters, we only check the syntax and ignore the values.
+// @doc ITU-T-H.265-2013.pdf, E.2.2 HRD parameters syntax
+func parseHRDParameters(p *avc.BitParser, commonInfPresentFlag bool, maxNumSubLayersMinus1 int) {
+	var nalHRD, vclHRD, subPicHRD bool
+	if commonInfPresentFlag {
+		nalHRD, vclHRD = p.Flag(), p.Flag()
+		if nalHRD || vclHRD {
+			if subPicHRD = p.Flag(); subPicHRD {
+				// From tick_divisor_minus2 to dpb_output_delay_du_length_minus1.
+				p.Skip(8 + 5 + 1 + 5)
+			}
+			p.Skip(4 + 4) // bit_rate_scale, cpb_size_scale
+			if subPicHRD {
+				p.Skip(4) // cpb_size_du_scale
+			}
+			// From initial_cpb_removal_delay_length_minus1 to dpb_output_delay_length_minus1.
+			p.Skip(5 + 5 + 5)
+		}
+	}
+
+	for i := 0; i <= maxNumSubLayersMinus1; i++ {
+		fixedPicRateWithinCVS := p.Flag() // fixed_pic_rate_general_flag
+		if !fixedPicRateWithinCVS {
+			fixedPicRateWithinCVS = p.Flag()
+		}
+
+		var lowDelayHRD bool
+		if fixedPicRateWithinCVS {
+			p.UE() // elemental_duration_in_tc_minus1
+		} else {
+			lowDelayHRD = p.Flag()
+		}
+
+		var cpbCntMinus1 uint32
+		if !lowDelayHRD {
+			if cpbCntMinus1 = p.UE(); cpbCntMinus1 > 31 {
+				p.SetErr(errors.Errorf("invalid cpb_cnt_minus1 %v", cpbCntMinus1))
+				return
+			}
+		}
+
+		for _, present := range []bool{nalHRD, vclHRD} {
+			if !present {
+				continue
+			}
+			// The sub_layer_hrd_parameters.
+			for k := 0; k <= int(cpbCntMinus1); k++ {
+				p.UE() // bit_rate_value_minus1
+				p.UE() // cpb_size_value_minus1
+				if subPicHRD {
+					p.UE() // cpb_size_du_value_minus1
+					p.UE() // bit_rate_du_value_minus1
+				}
+				p.Flag() // cbr_flag
+			}
+		}
+	}
+}
+
+// @doc ITU-T-H.265-2013.pdf, E.2.1 VUI parameters syntax
+type VUIParameters struct {
+	AspectRatioInfoPresentFlag bool
+	AspectRatioIDC             uint8
+	SARWidth                   uint16
+	SARHeight                  uint16
+
+	OverscanInfoPresentFlag bool
+	OverscanAppropriateFlag bool
+
+	VideoSignalTypePresentFlag   bool
+	VideoFormat                  uint8
+	VideoFullRangeFlag           bool
+	ColourDescriptionPresentFlag bool
+	ColourPrimaries              uint8
+	TransferCharacteristics      uint8
+	MatrixCoeffs                 uint8
+
+	ChromaLocInfoPresentFlag       bool
+	ChromaSampleLocTypeTopField    uint32
+	ChromaSampleLocTypeBottomField uint32
+
+	NeutralChromaIndicationFlag bool
+	FieldSeqFlag                bool
+	FrameFieldInfoPresentFlag   bool
+
+	DefaultDisplayWindowFlag bool
+	DefDispWinLeftOffset     uint32
+	DefDispWinRightOffset    uint32
+	DefDispWinTopOffset      uint32
+	DefDispWinBottomOffset   uint32
+
+	TimingInfoPresentFlag       bool
+	NumUnitsInTick              uint32
+	TimeScale                   uint32
+	PocProportionalToTimingFlag bool
+	NumTicksPocDiffOneMinus1    uint32
+	HRDParametersPresentFlag    bool
+
+	BitstreamRestrictionFlag           bool
+	TilesFixedStructureFlag            bool
+	MotionVectorsOverPicBoundariesFlag bool
+	RestrictedRefPicListsFlag          bool
+	MinSpatialSegmentationIDC          uint32
+	MaxBytesPerPicDenom                uint32
+	MaxBitsPerMinCuDenom               uint32
+	Log2MaxMVLengthHorizontal          uint32
+	Log2MaxMVLengthVertical            uint32
+}
+
+// The SAR(sample aspect ratio) for aspect_ratio_idc 1 to 16, same to H.264.
+// @doc ITU-T-H.265-2013.pdf, Table E.1 Interpretation of sample aspect ratio indicator
+var sampleAspectRatios = [][2]uint16{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+func (v *VUIParameters) parse(p *avc.BitParser, maxSubLayersMinus1 int) {
+	if v.AspectRatioInfoPresentFlag = p.Flag(); v.AspectRatioInfoPresentFlag {
+		v.AspectRatioIDC = uint8(p.U(8))
+		if v.AspectRatioIDC == avc.AspectRatioExtendedSAR {
+			v.SARWidth = uint16(p.U(16))
+			v.SARHeight = uint16(p.U(16))
+		} else if int(v.AspectRatioIDC) < len(sampleAspectRatios) {
+			v.SARWidth, v.SARHeight = sampleAspectRatios[v.AspectRatioIDC][0], sampleAspectRatios[v.AspectRatioIDC][1]
+		}
+	}
+
+	if v.OverscanInfoPresentFlag = p.Flag(); v.OverscanInfoPresentFlag {
+		v.OverscanAppropriateFlag = p.Flag()
+	}
+
+	if v.VideoSignalTypePresentFlag = p.Flag(); v.VideoSignalTypePresentFlag {
+		v.VideoFormat = uint8(p.U(3))
+		v.VideoFullRangeFlag = p.Flag()
+		if v.ColourDescriptionPresentFlag = p.Flag(); v.ColourDescriptionPresentFlag {
+			v.ColourPrimaries = uint8(p.U(8))
+			v.TransferCharacteristics = uint8(p.U(8))
+			v.MatrixCoeffs = uint8(p.U(8))
+		}
+	}
+
+	if v.ChromaLocInfoPresentFlag = p.Flag(); v.ChromaLocInfoPresentFlag {
+		v.ChromaSampleLocTypeTopField = p.UE()
+		v.ChromaSampleLocTypeBottomField = p.UE()
+	}
+
+	v.NeutralChromaIndicationFlag = p.Flag()
+	v.FieldSeqFlag = p.Flag()
+	v.FrameFieldInfoPresentFlag = p.Flag()
+
+	if v.DefaultDisplayWindowFlag = p.Flag(); v.DefaultDisplayWindowFlag {
+		v.DefDispWinLeftOffset = p.UE()
+		v.DefDispWinRightOffset = p.UE()
+		v.DefDispWinTopOffset = p.UE()
+		v.DefDispWinBottomOffset = p.UE()
+	}
+
+	if v.TimingInfoPresentFlag = p.Flag(); v.TimingInfoPresentFlag {
+		v.NumUnitsInTick = p.U(32)
+		v.TimeScale = p.U(32)
+		if v.PocProportionalToTimingFlag = p.Flag(); v.PocProportionalToTimingFlag {
+			v.NumTicksPocDiffOneMinus1 = p.UE()
+		}
+		if v.HRDParametersPresentFlag = p.Flag(); v.HRDParametersPresentFlag {
+			parseHRDParameters(p, true, maxSubLayersMinus1)
+		}
+	}
+
+	if v.BitstreamRestrictionFlag = p.Flag(); v.BitstreamRestrictionFlag {
+		v.TilesFixedStructureFlag = p.Flag()
+		v.MotionVectorsOverPicBoundariesFlag = p.Flag()
+		v.RestrictedRefPicListsFlag = p.Flag()
+		v.MinSpatialSegmentationIDC = p.UE()
+		v.MaxBytesPerPicDenom = p.UE()
+		v.MaxBitsPerMinCuDenom = p.UE()
+		v.Log2MaxMVLengthHorizontal = p.UE()
+		v.Log2MaxMVLengthVertical = p.UE()
+	}
+}
+
+// The SPS(sequence parameter set), parsed from the SPS NALU.
+// @doc ITU-T-H.265-2013.pdf, 7.3.2.2 Sequence parameter set RBSP syntax
+type SequenceParameterSet struct {
+	SPSVideoParameterSetID   uint8
+	SPSMaxSubLayersMinus1    uint8
+	SPSTemporalIDNestingFlag bool
+	ProfileTierLevel         ProfileTierLevel
+	SPSSeqParameterSetID     uint32
+
+	ChromaFormatIDC         uint32
+	SeparateColourPlaneFlag bool
+	PicWidthInLumaSamples   uint32
+	PicHeightInLumaSamples  uint32
+
+	ConformanceWindowFlag bool
+	ConfWinLeftOffset     uint32
+	ConfWinRightOffset    uint32
+	ConfWinTopOffset      uint32
+	ConfWinBottomOffset   uint32
+
+	BitDepthLumaMinus8          uint32
+	BitDepthChromaMinus8        uint32
+	Log2MaxPicOrderCntLsbMinus4 uint32
+	SubLayerOrderingInfos       []SubLayerOrderingInfo
+
+	Log2MinLumaCodingBlockSizeMinus3     uint32
+	Log2DiffMaxMinLumaCodingBlockSize    uint32
+	Log2MinLumaTransformBlockSizeMinus2  uint32
+	Log2DiffMaxMinLumaTransformBlockSize uint32
+	MaxTransformHierarchyDepthInter      uint32
+	MaxTransformHierarchyDepthIntra      uint32
+	ScalingListEnabledFlag               bool
+	SPSScalingListDataPresentFlag        bool
+	AMPEnabledFlag                       bool
+	SampleAdaptiveOffsetEnabledFlag      bool
+
+	PCMEnabledFlag                       bool
+	PCMSampleBitDepthLumaMinus1          uint8
+	PCMSampleBitDepthChromaMinus1        uint8
+	Log2MinPCMLumaCodingBlockSizeMinus3  uint32
+	Log2DiffMaxMinPCMLumaCodingBlockSize uint32
+	PCMLoopFilterDisabledFlag            bool
+
+	ShortTermRefPicSets         []*ShortTermRefPicSet
+	LongTermRefPicsPresentFlag  bool
+	NumLongTermRefPicsSPS       uint32
+	SPSTemporalMVPEnabledFlag   bool
+	StrongIntraSmoothingEnabled bool
+
+	// The VUI parameters, nil if not present.
+	VUI *VUIParameters
+}
+
+func NewSequenceParameterSet() *SequenceParameterSet {
+	return &SequenceParameterSet{}
+}
+
+// Unmarshal the SPS NALU, with the NALU header.
+// @remark We ignore the sps_extension.
+func (v *SequenceParameterSet) UnmarshalBinary(data []byte) error {
+	rbsp, err := nalToRBSP(data, NALUType_SPS_NUT)
+	if err != nil {
+		return errors.WithMessage(err, "sps")
+	}
+
+	p := avc.NewBitParser(rbsp)
+
+	v.SPSVideoParameterSetID = uint8(p.U(4))
+	if v.SPSMaxSubLayersMinus1 = uint8(p.U(3)); v.SPSMaxSubLayersMinus1 >= maxSubLayers {
+		return errors.Errorf("invalid sps_max_sub_layers_minus1 %v", v.SPSMaxSubLayersMinus1)
+	}
+	v.SPSTemporalIDNestingFlag = p.Flag()
+	v.ProfileTierLevel.parse(p, int(v.SPSMaxSubLayersMinus1))
+	v.SPSSeqParameterSetID = p.UE()
+
+	if v.ChromaFormatIDC = p.UE(); v.ChromaFormatIDC > 3 {
+		return errors.Errorf("invalid chroma_format_idc %v", v.ChromaFormatIDC)
+	} else if v.ChromaFormatIDC == 3 {
+		v.SeparateColourPlaneFlag = p.Flag()
+	}
+	v.PicWidthInLumaSamples = p.UE()
+	v.PicHeightInLumaSamples = p.UE()
+
+	if v.ConformanceWindowFlag = p.Flag(); v.ConformanceWindowFlag {
+		v.ConfWinLeftOffset = p.UE()
+		v.ConfWinRightOffset = p.UE()
+		v.ConfWinTopOffset = p.UE()
+		v.ConfWinBottomOffset = p.UE()
+	}
+
+	v.BitDepthLumaMinus8 = p.UE()
+	v.BitDepthChromaMinus8 = p.UE()
+	if v.Log2MaxPicOrderCntLsbMinus4 = p.UE(); v.Log2MaxPicOrderCntLsbMinus4 > 12 {
+		return errors.Errorf("invalid log2_max_pic_order_cnt_lsb_minus4 %v", v.Log2MaxPicOrderCntLsbMinus4)
+	}
+	v.SubLayerOrderingInfos = parseSubLayerOrderingInfos(p, int(v.SPSMaxSubLayersMinus1))
+
+	v.Log2MinLumaCodingBlockSizeMinus3 = p.UE()
+	v.Log2DiffMaxMinLumaCodingBlockSize = p.UE()
+	v.Log2MinLumaTransformBlockSizeMinus2 = p.UE()
+	v.Log2DiffMaxMinLumaTransformBlockSize = p.UE()
+	v.MaxTransformHierarchyDepthInter = p.UE()
+	v.MaxTransformHierarchyDepthIntra = p.UE()
+
+	if v.ScalingListEnabledFlag = p.Flag(); v.ScalingListEnabledFlag {
+		if v.SPSScalingListDataPresentFlag = p.Flag(); v.SPSScalingListDataPresentFlag {
+			parseScalingListData(p)
+		}
+	}
+
+	v.AMPEnabledFlag = p.Flag()
+	v.SampleAdaptiveOffsetEnabledFlag = p.Flag()
+
+	if v.PCMEnabledFlag = p.Flag(); v.PCMEnabledFlag {
+		v.PCMSampleBitDepthLumaMinus1 = uint8(p.U(4))
+		v.PCMSampleBitDepthChromaMinus1 = uint8(p.U(4))
+		v.Log2MinPCMLumaCodingBlockSizeMinus3 = p.UE()
+		v.Log2DiffMaxMinPCMLumaCodingBlockSize = p.UE()
+		v.PCMLoopFilterDisabledFlag = p.Flag()
+	}
+
+	numShortTermRefPicSets := p.UE()
+	if numShortTermRefPicSets > 64 {
+		return errors.Errorf("invalid num_short_term_ref_pic_sets %v", numShortTermRefPicSets)
+	}
+	for i := 0; i < int(numShortTermRefPicSets) && p.Err() == nil; i++ {
+		rps := &ShortTermRefPicSet{}
+		rps.parse(p, v.ShortTermRefPicSets)
+		v.ShortTermRefPicSets = append(v.ShortTermRefPicSets, rps)
+	}
+
+	if v.LongTermRefPicsPresentFlag = p.Flag(); v.LongTermRefPicsPresentFlag {
+		if v.NumLongTermRefPicsSPS = p.UE(); v.NumLongTermRefPicsSPS > 32 {
+			return errors.Errorf("invalid num_long_term_ref_pics_sps %v", v.NumLongTermRefPicsSPS)
+		}
+		for i := 0; i < int(v.NumLongTermRefPicsSPS); i++ {
+			// The lt_ref_pic_poc_lsb_sps and used_by_curr_pic_lt_sps_flag.
+			p.Skip(int(v.Log2MaxPicOrderCntLsbMinus4) + 4 + 1)
+		}
+	}
+
+	v.SPSTemporalMVPEnabledFlag = p.Flag()
+	v.StrongIntraSmoothingEnabled = p.Flag()
+
+	if p.Flag() {
+		v.VUI = &VUIParameters{}
+		v.VUI.parse(p, int(v.SPSMaxSubLayersMinus1))
+	}
+
+	if p.Err() != nil {
+		return errors.WithMessage(p.Err(), "sps")
+	}
+	return nil
+}
+
+// The ChromaArrayType, 0 for separate colour planes.
+func (v *SequenceParameterSet) ChromaArrayType() uint32 {
+	if v.SeparateColourPlaneFlag {
+		return 0
+	}
+	return v.ChromaFormatIDC
+}
+
+// The BitDepthY of luma.
+func (v *SequenceParameterSet) BitDepthLuma() int {
+	return 8 + int(v.BitDepthLumaMinus8)
+}
+
+// The BitDepthC of chroma.
+func (v *SequenceParameterSet) BitDepthChroma() int {
+	return 8 + int(v.BitDepthChromaMinus8)
+}
+
+// The SubWidthC and SubHeightC, the unit of conformance window offsets.
+// @doc ITU-T-H.265-2013.pdf, Table 6-1 SubWidthC, and SubHeightC values derived from chroma_format_idc
+func (v *SequenceParameterSet) subWidthHeightC() (x, y int) {
+	switch v.ChromaArrayType() {
+	case 1:
+		return 2, 2
+	case 2:
+		return 2, 1
+	}
+	return 1, 1
+}
+
+// The width in pixels, cropped by the conformance window.
+func (v *SequenceParameterSet) Width() int {
+	x, _ := v.subWidthHeightC()
+	return int(v.PicWidthInLumaSamples) - x*int(v.ConfWinLeftOffset+v.ConfWinRightOffset)
+}
+
+// The height in pixels, cropped by the conformance window.
+func (v *SequenceParameterSet) Height() int {
+	_, y := v.subWidthHeightC()
+	return int(v.PicHeightInLumaSamples) - y*int(v.ConfWinTopOffset+v.ConfWinBottomOffset)
+}
+
+// The frame rate from VUI timing, 0 if not present.
+// @remark The frame rate is time_scale/num_units_in_tick, not two fields for a frame as H.264.
+func (v *SequenceParameterSet) FrameRate() float64 {
+	if v.VUI == nil || !v.VUI.TimingInfoPresentFlag || v.VUI.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(v.VUI.TimeScale) / float64(v.VUI.NumUnitsInTick)
+}
+
+// The SAR(sample aspect ratio) from VUI, 0:0 if unspecified.
+func (v *SequenceParameterSet) SAR() (width, height uint16) {
+	if v.VUI == nil || !v.VUI.AspectRatioInfoPresentFlag {
+		return 0, 0
+	}
+	return v.VUI.SARWidth, v.VUI.SARHeight
+}
+
+// The PPS(picture parameter set), parsed from the PPS NALU.
+// @doc ITU-T-H.265-2013.pdf, 7.3.2.3 Picture parameter set RBSP syntax
+type PictureParameterSet struct {
+	PPSPicParameterSetID              uint32
+	PPSSeqParameterSetID              uint32
+	DependentSliceSegmentsEnabledFlag bool
+	OutputFlagPresentFlag             bool
+	NumExtraSliceHeaderBits           uint8
+	SignDataHidingEnabledFlag         bool
+	CabacInitPresentFlag              bool
+	NumRefIdxL0DefaultActiveMinus1    uint32
+	NumRefIdxL1DefaultActiveMinus1    uint32
+	InitQPMinus26                     int32
+	ConstrainedIntraPredFlag          bool
+	TransformSkipEnabledFlag          bool
+	CuQPDeltaEnabledFlag              bool
+	DiffCuQPDeltaDepth                uint32
+	PPSCbQPOffset                     int32
+	PPSCrQPOffset                     int32
+	PPSSliceChromaQPOffsetsPresent    bool
+	WeightedPredFlag                  bool
+	WeightedBipredFlag                bool
+	TransquantBypassEnabledFlag       bool
+	TilesEnabledFlag                  bool
+	EntropyCodingSyncEnabledFlag      bool
+
+	NumTileColumnsMinus1             uint32
+	NumTileRowsMinus1                uint32
+	UniformSpacingFlag               bool
+	ColumnWidthMinus1                []uint32
+	RowHeightMinus1                  []uint32
+	LoopFilterAcrossTilesEnabledFlag bool
+
+	PPSLoopFilterAcrossSlicesEnabledFlag bool
+	DeblockingFilterControlPresentFlag   bool
+	DeblockingFilterOverrideEnabledFlag  bool
+	PPSDeblockingFilterDisabledFlag      bool
+	PPSBetaOffsetDiv2                    int32
+	PPSTcOffsetDiv2                      int32
+
+	PPSScalingListDataPresentFlag      bool
+	ListsModificationPresentFlag       bool
+	Log2ParallelMergeLevelMinus2       uint32
+	SliceSegmentHeaderExtensionPresent bool
+}
+
+func NewPictureParameterSet() *PictureParameterSet {
+	return &PictureParameterSet{}
+}
+
+// Unmarshal the PPS NALU, with the NALU header.
+// @remark We ignore the pps_extension.
+func (v *PictureParameterSet) UnmarshalBinary(data []byte) error {
+	rbsp, err := nalToRBSP(data, NALUType_PPS_NUT)
+	if err != nil {
+		return errors.WithMessage(err, "pps")
+	}
+
+	p := avc.NewBitParser(rbsp)
+
+	v.PPSPicParameterSetID = p.UE()
+	v.PPSSeqParameterSetID = p.UE()
+	v.DependentSliceSegmentsEnabledFlag = p.Flag()
+	v.OutputFlagPresentFlag = p.Flag()
+	v.NumExtraSliceHeaderBits = uint8(p.U(3))
+	v.SignDataHidingEnabledFlag = p.Flag()
+	v.CabacInitPresentFlag = p.Flag()
+	v.NumRefIdxL0DefaultActiveMinus1 = p.UE()
+	v.NumRefIdxL1DefaultActiveMinus1 = p.UE()
+	v.InitQPMinus26 = p.SE()
+	v.ConstrainedIntraPredFlag = p.Flag()
+	v.TransformSkipEnabledFlag = p.Flag()
+	if v.CuQPDeltaEnabledFlag = p.Flag(); v.CuQPDeltaEnabledFlag {
+		v.DiffCuQPDeltaDepth = p.UE()
+	}
+	v.PPSCbQPOffset = p.SE()
+	v.PPSCrQPOffset = p.SE()
+	v.PPSSliceChromaQPOffsetsPresent = p.Flag()
+	v.WeightedPredFlag = p.Flag()
+	v.WeightedBipredFlag = p.Flag()
+	v.TransquantBypassEnabledFlag = p.Flag()
+	v.TilesEnabledFlag = p.Flag()
+	v.EntropyCodingSyncEnabledFlag = p.Flag()
+
+	if v.TilesEnabledFlag {
+		v.NumTileColumnsMinus1 = p.UE()
+		v.NumTileRowsMinus1 = p.UE()
+		if v.NumTileColumnsMinus1 > 19 || v.NumTileRowsMinus1 > 21 {
+			return errors.Errorf("invalid tiles columns=%v, rows=%v", v.NumTileColumnsMinus1, v.NumTileRowsMinus1)
+		}
+		if v.UniformSpacingFlag = p.Flag(); !v.UniformSpacingFlag {
+			for i := 0; i < int(v.NumTileColumnsMinus1); i++ {
+				v.ColumnWidthMinus1 = append(v.ColumnWidthMinus1, p.UE())
+			}
+			for i := 0; i < int(v.NumTileRowsMinus1); i++ {
+				v.RowHeightMinus1 = append(v.RowHeightMinus1, p.UE())
+			}
+		}
+		v.LoopFilterAcrossTilesEnabledFlag = p.Flag()
+	}
+
+	v.PPSLoopFilterAcrossSlicesEnabledFlag = p.Flag()
+	if v.DeblockingFilterControlPresentFlag = p.Flag(); v.DeblockingFilterControlPresentFlag {
+		v.DeblockingFilterOverrideEnabledFlag = p.Flag()
+		if v.PPSDeblockingFilterDisabledFlag = p.Flag(); !v.PPSDeblockingFilterDisabledFlag {
+			v.PPSBetaOffsetDiv2 = p.SE()
+			v.PPSTcOffsetDiv2 = p.SE()
+		}
+	}
+
+	if v.PPSScalingListDataPresentFlag = p.Flag(); v.PPSScalingListDataPresentFlag {
+		parseScalingListData(p)
+	}
+	v.ListsModificationPresentFlag = p.Flag()
+	v.Log2ParallelMergeLevelMinus2 = p.UE()
+	v.SliceSegmentHeaderExtensionPresent = p.Flag()
+
+	if p.Err() != nil {
+		return errors.WithMessage(p.Err(), "pps")
+	}
+	return nil
+}
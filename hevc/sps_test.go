@@ -0,0 +1,353 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package hevc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ossrs/go-oryx-lib/avc"
+)
+
+// The VPS, SPS and PPS encoded by x265 3.5+1 (build 199) with preset medium, 1920x1080 25fps, and options
+// --sar 1 --range full --colorprim bt709 --transfer bt709 --colormatrix bt709 --hrd --vbv-bufsize 4000 --vbv-maxrate 2000
+var (
+	x265VPS = []byte{
+		0x40, 0x01, 0x0c, 0x01, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00,
+		0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x78, 0x95, 0x98, 0x09,
+	}
+	x265SPS = []byte{
+		0x42, 0x01, 0x01, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00,
+		0x03, 0x00, 0x00, 0x03, 0x00, 0x78, 0xa0, 0x03, 0xc0, 0x80, 0x10, 0xe5,
+		0x96, 0x56, 0x69, 0x24, 0xca, 0xf0, 0x16, 0xe0, 0x20, 0x20, 0x20, 0x80,
+		0x00, 0x01, 0xf4, 0x00, 0x00, 0x30, 0xd4, 0x30, 0x52, 0x6b, 0x2f, 0x00,
+		0x07, 0xa1, 0x20, 0x00, 0xf4, 0x24, 0x40,
+	}
+	x265PPS = []byte{0x44, 0x01, 0xc1, 0x72, 0xb4, 0x62, 0x40}
+)
+
+// The VPS, SPS and PPS encoded by x265 3.5+1 (build 199) with preset medium, 1280x720 29.97fps, and options
+// --temporal-layers --scaling-list default --cbqpoffs -2 --crqpoffs 2 --deblock -1:1 --tskip --constrained-intra --weightb
+var (
+	x265TemporalVPS = []byte{
+		0x40, 0x01, 0x0c, 0x02, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00,
+		0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x5d, 0x00, 0x00, 0x95,
+		0x98, 0xac, 0xc0, 0x48,
+	}
+	x265TemporalSPS = []byte{
+		0x42, 0x01, 0x02, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00,
+		0x03, 0x00, 0x00, 0x03, 0x00, 0x5d, 0x00, 0x00, 0xa0, 0x02, 0x80, 0x80,
+		0x2d, 0x16, 0x59, 0x59, 0x8a, 0xcd, 0x24, 0x9c, 0xae, 0x01, 0x00, 0x00,
+		0x03, 0x03, 0xe9, 0x00, 0x00, 0x75, 0x30, 0x08,
+	}
+	x265TemporalPPS = []byte{0x44, 0x01, 0xc1, 0x7e, 0x8a, 0x46, 0x71, 0x32, 0x40}
+)
+
+// The VPS, SPS and PPS crafted for the syntax which x265 never writes, for example, the sub-layer level, the VPS
+// timing, the scaling list data, the short-term RPS in SPS with inter RPS prediction, the long-term reference
+// pictures and the tiles.
+var (
+	craftedVPS = []byte{
+		0x40, 0x01, 0x0c, 0x03, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00,
+		0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x78, 0x40, 0x00, 0x5a,
+		0x15, 0xc0, 0xc0, 0x00, 0x00, 0x03, 0x00, 0x40, 0x00, 0x00, 0x06, 0x54,
+	}
+	craftedSPS = []byte{
+		0x42, 0x01, 0x03, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00,
+		0x03, 0x00, 0x00, 0x03, 0x00, 0x78, 0x40, 0x00, 0x5a, 0xa0, 0x03, 0xc0,
+		0x80, 0x11, 0x07, 0xcb, 0x96, 0x57, 0x2b, 0xc9, 0x22, 0x5a, 0xaa, 0xaa,
+		0xac, 0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xea, 0xaa, 0xe6,
+		0xd6, 0xbf, 0x9d, 0x02, 0xfc, 0x05, 0xa8, 0x08, 0x08, 0x08, 0x7e, 0x00,
+		0x00, 0x03, 0x00, 0x02, 0x00, 0x00, 0x03, 0x00, 0x32, 0xc0, 0x0b, 0xde,
+		0xfc, 0x01, 0xf4, 0x00, 0x1f, 0x41, 0xc0, 0x1f, 0x40, 0x01, 0xf4, 0x16,
+		0x03, 0x25, 0xa0, 0x80, 0x41,
+	}
+	craftedPPS = []byte{0x44, 0x01, 0xc0, 0xf2, 0x8a, 0x40, 0x92, 0x0a, 0x37, 0x13, 0x19}
+)
+
+func TestNALUHeader(t *testing.T) {
+	h := &NALUHeader{NALUType: NALUType_SPS_NUT, NUHLayerID: 33, NUHTemporalIDPlus1: 1}
+	b, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+
+	v := NewNALUHeader()
+	if err := v.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if *v != *h {
+		t.Errorf("invalid header %v, expect %v", v, h)
+	}
+}
+
+func TestVideoParameterSet(t *testing.T) {
+	vps := NewVideoParameterSet()
+	if err := vps.UnmarshalBinary(x265VPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if vps.VPSMaxSubLayersMinus1 != 0 || !vps.VPSTemporalIDNestingFlag || len(vps.SubLayerOrderingInfos) != 1 {
+		t.Errorf("invalid vps %+v", vps)
+	}
+	if info := vps.SubLayerOrderingInfos[0]; info.MaxDecPicBufferingMinus1 != 4 || info.MaxNumReorderPics != 2 {
+		t.Errorf("invalid sub-layer ordering %+v", info)
+	}
+	if ptl := vps.ProfileTierLevel; ptl.GeneralProfileIDC != HEVCProfileMain || ptl.GeneralLevelIDC != 120 {
+		t.Errorf("invalid ptl %+v", ptl)
+	}
+
+	vps = NewVideoParameterSet()
+	if err := vps.UnmarshalBinary(x265TemporalVPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if vps.VPSMaxSubLayersMinus1 != 1 || vps.VPSTemporalIDNestingFlag || len(vps.SubLayerOrderingInfos) != 2 ||
+		vps.ProfileTierLevel.GeneralLevelIDC != 93 || vps.ProfileTierLevel.SubLayerLevelPresentFlags[0] {
+		t.Errorf("invalid vps %+v", vps)
+	}
+
+	vps = NewVideoParameterSet()
+	if err := vps.UnmarshalBinary(craftedVPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if vps.VPSMaxSubLayersMinus1 != 1 || !vps.VPSTemporalIDNestingFlag || len(vps.SubLayerOrderingInfos) != 1 ||
+		!vps.ProfileTierLevel.SubLayerLevelPresentFlags[0] {
+		t.Errorf("invalid vps %+v", vps)
+	}
+	if !vps.VPSTimingInfoPresentFlag || vps.VPSTimeScale != 25 {
+		t.Errorf("invalid timing %+v", vps)
+	}
+
+	if err := NewVideoParameterSet().UnmarshalBinary(x265SPS); err == nil {
+		t.Error("should error for sps")
+	}
+}
+
+func TestSequenceParameterSet(t *testing.T) {
+	sps := NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(x265SPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+
+	if ptl := sps.ProfileTierLevel; ptl.GeneralProfileIDC != HEVCProfileMain || ptl.GeneralTierFlag != 0 ||
+		ptl.GeneralProfileCompatibilityFlags != 0x60000000 || ptl.GeneralConstraintIndicatorFlags != 0x900000000000 ||
+		ptl.GeneralLevelIDC != 120 {
+		t.Errorf("invalid ptl %+v", ptl)
+	}
+	if sps.ChromaFormatIDC != 1 || sps.BitDepthLuma() != 8 || sps.BitDepthChroma() != 8 {
+		t.Errorf("invalid chroma %+v", sps)
+	}
+	if sps.Width() != 1920 || sps.Height() != 1080 || sps.FrameRate() != 25 {
+		t.Errorf("invalid size %vx%v fps %v", sps.Width(), sps.Height(), sps.FrameRate())
+	}
+	if w, h := sps.SAR(); w != 1 || h != 1 {
+		t.Errorf("invalid sar %v:%v", w, h)
+	}
+	if sps.ScalingListEnabledFlag || sps.AMPEnabledFlag || !sps.SampleAdaptiveOffsetEnabledFlag ||
+		len(sps.ShortTermRefPicSets) != 0 || !sps.SPSTemporalMVPEnabledFlag || !sps.StrongIntraSmoothingEnabled {
+		t.Errorf("invalid sps %+v", sps)
+	}
+	if vui := sps.VUI; vui.VideoFormat != 5 || !vui.VideoFullRangeFlag || vui.ColourPrimaries != 1 ||
+		vui.TransferCharacteristics != 1 || vui.MatrixCoeffs != 1 || !vui.HRDParametersPresentFlag {
+		t.Errorf("invalid vui %+v", vui)
+	}
+
+	for i := 2; i < len(x265SPS)-1; i++ {
+		if err := NewSequenceParameterSet().UnmarshalBinary(x265SPS[:i]); err == nil {
+			t.Errorf("should error for %vB", i)
+		}
+	}
+
+	sps = NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(x265TemporalSPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if sps.SPSMaxSubLayersMinus1 != 1 || len(sps.SubLayerOrderingInfos) != 2 || !sps.ScalingListEnabledFlag ||
+		sps.SPSScalingListDataPresentFlag {
+		t.Errorf("invalid sps %+v", sps)
+	}
+	if fps := sps.FrameRate(); sps.Width() != 1280 || sps.Height() != 720 || fps < 29.97 || fps > 29.98 {
+		t.Errorf("invalid size %vx%v fps %v", sps.Width(), sps.Height(), fps)
+	}
+	if w, h := sps.SAR(); w != 0 || h != 0 {
+		t.Errorf("invalid sar %v:%v", w, h)
+	}
+
+	sps = NewSequenceParameterSet()
+	if err := sps.UnmarshalBinary(craftedSPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if sps.Width() != 1920 || sps.Height() != 1080 || sps.FrameRate() != 25 {
+		t.Errorf("invalid size %vx%v fps %v", sps.Width(), sps.Height(), sps.FrameRate())
+	}
+	if len(sps.SubLayerOrderingInfos) != 2 || !sps.SPSScalingListDataPresentFlag || !sps.AMPEnabledFlag {
+		t.Errorf("invalid sps %+v", sps)
+	}
+
+	if len(sps.ShortTermRefPicSets) != 2 {
+		t.Fatalf("invalid rps %v", sps.ShortTermRefPicSets)
+	}
+	if rps := sps.ShortTermRefPicSets[0]; len(rps.DeltaPocS0) != 2 || rps.DeltaPocS0[1] != -3 || rps.DeltaPocS1[0] != 1 {
+		t.Errorf("invalid rps %+v", rps)
+	}
+	// The dPoc 0 is dropped, and the -4 is not used.
+	if rps := sps.ShortTermRefPicSets[1]; rps.NumDeltaPocs() != 2 || rps.DeltaPocS0[0] != -1 || rps.DeltaPocS0[1] != -2 {
+		t.Errorf("invalid rps %+v", rps)
+	}
+
+	if !sps.LongTermRefPicsPresentFlag || sps.NumLongTermRefPicsSPS != 1 || !sps.StrongIntraSmoothingEnabled {
+		t.Errorf("invalid sps %+v", sps)
+	}
+	if vui := sps.VUI; vui.ColourPrimaries != 1 || !vui.HRDParametersPresentFlag || vui.MinSpatialSegmentationIDC != 200 ||
+		vui.Log2MaxMVLengthVertical != 15 {
+		t.Errorf("invalid vui %+v", vui)
+	}
+}
+
+func TestPictureParameterSet(t *testing.T) {
+	pps := NewPictureParameterSet()
+	if err := pps.UnmarshalBinary(x265PPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if !pps.SignDataHidingEnabledFlag || !pps.CuQPDeltaEnabledFlag || pps.DiffCuQPDeltaDepth != 1 || !pps.WeightedPredFlag ||
+		pps.WeightedBipredFlag || !pps.EntropyCodingSyncEnabledFlag || !pps.PPSLoopFilterAcrossSlicesEnabledFlag {
+		t.Errorf("invalid pps %+v", pps)
+	}
+	if pps.TilesEnabledFlag || pps.DeblockingFilterControlPresentFlag || pps.TransformSkipEnabledFlag {
+		t.Errorf("invalid pps %+v", pps)
+	}
+
+	pps = NewPictureParameterSet()
+	if err := pps.UnmarshalBinary(x265TemporalPPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if pps.PPSCbQPOffset != -2 || pps.PPSCrQPOffset != 2 || !pps.TransformSkipEnabledFlag || !pps.ConstrainedIntraPredFlag ||
+		!pps.WeightedBipredFlag {
+		t.Errorf("invalid pps %+v", pps)
+	}
+	if !pps.DeblockingFilterControlPresentFlag || pps.PPSBetaOffsetDiv2 != 1 || pps.PPSTcOffsetDiv2 != -1 {
+		t.Errorf("invalid deblocking %+v", pps)
+	}
+
+	pps = NewPictureParameterSet()
+	if err := pps.UnmarshalBinary(craftedPPS); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if !pps.CabacInitPresentFlag || pps.DiffCuQPDeltaDepth != 1 || pps.PPSCbQPOffset != -2 || pps.PPSCrQPOffset != 2 {
+		t.Errorf("invalid pps %+v", pps)
+	}
+	if !pps.TilesEnabledFlag || pps.ColumnWidthMinus1[0] != 9 || pps.RowHeightMinus1[0] != 5 ||
+		!pps.LoopFilterAcrossTilesEnabledFlag {
+		t.Errorf("invalid tiles %+v", pps)
+	}
+	if pps.PPSBetaOffsetDiv2 != 1 || pps.PPSTcOffsetDiv2 != -1 || pps.Log2ParallelMergeLevelMinus2 != 2 {
+		t.Errorf("invalid pps %+v", pps)
+	}
+}
+
+func TestHEVCDecoderConfigurationRecord(t *testing.T) {
+	vps, sps, pps := x265TemporalVPS, x265TemporalSPS, x265TemporalPPS
+
+	r, err := NewHEVCDecoderConfigurationRecordFromNALUs(vps, sps, pps)
+	if err != nil {
+		t.Fatalf("create failed %+v", err)
+	}
+	if r.ProfileSpace() != 0 || r.TierFlag() != 0 || r.HEVCProfileIndication != HEVCProfileMain ||
+		r.ProfileCompatibilityFlags() != 0x60000000 || r.ConstraintIndicatorFlags() != 0x900000000000 ||
+		r.LevelIndication() != 93 || r.ChromaFormat() != 1 {
+		t.Errorf("invalid record %+v", r)
+	}
+	if luma, chroma := r.BitDepth(); luma != 8 || chroma != 8 {
+		t.Errorf("invalid bit depth %v %v", luma, chroma)
+	}
+
+	b, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+	if b[0] != 1 || b[1] != 0x01 || b[12] != 93 || b[13] != 0xf0 || b[14] != 0 || b[21] != 0x13 || b[22] != 3 {
+		t.Errorf("invalid record %x", b[:23])
+	}
+
+	// Append a SEI array, which should be ignored.
+	b[22]++
+	b = append(b, 0x80|byte(NALUType_Prefix_SEI_NUT), 0x00, 0x01, 0x00, 0x03, 0x4e, 0x01, 0x05)
+
+	v := NewHEVCDecoderConfigurationRecord()
+	if err := v.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if v.LengthSizeMinusOne != 3 || v.LevelIndication() != 93 || v.numTemporalLayers != 2 || v.temporalIdNested != 0 {
+		t.Errorf("invalid record %+v", v)
+	}
+	for _, e := range []struct {
+		units  []*NALU
+		expect []byte
+	}{
+		{v.VideoParameterSetNALUnits, vps},
+		{v.SequenceParameterSetNALUnits, sps},
+		{v.PictureParameterSetNALUnits, pps},
+	} {
+		if len(e.units) != 1 {
+			t.Fatalf("invalid units %v", e.units)
+		}
+		if nb, _ := e.units[0].MarshalBinary(); !bytes.Equal(nb, e.expect) {
+			t.Errorf("invalid nalu %x, expect %x", nb, e.expect)
+		}
+	}
+
+	if s, err := v.SPS(); err != nil || s.Width() != 1280 || s.Height() != 720 {
+		t.Errorf("invalid sps %+v, err %+v", s, err)
+	}
+	if _, err := v.VPS(); err != nil {
+		t.Errorf("invalid vps %+v", err)
+	}
+	if _, err := v.PPS(); err != nil {
+		t.Errorf("invalid pps %+v", err)
+	}
+
+	for i := 0; i < len(b); i++ {
+		if err := NewHEVCDecoderConfigurationRecord().UnmarshalBinary(b[:i]); err == nil {
+			t.Errorf("should error for %vB", i)
+		}
+	}
+
+	if _, err := NewHEVCDecoderConfigurationRecordFromNALUs(sps, vps, pps); err == nil {
+		t.Error("should error for invalid order")
+	}
+}
+
+func TestNewHEVCDecoderConfigurationRecordFromAnnexB(t *testing.T) {
+	aud := []byte{byte(NALUType_AUD_NUT) << 1, 0x01, 0x50}
+	data := avc.JoinAnnexB([][]byte{aud, x265VPS, x265SPS, x265PPS})
+
+	r, err := NewHEVCDecoderConfigurationRecordFromAnnexB(data)
+	if err != nil {
+		t.Fatalf("create failed %+v", err)
+	}
+	if r.HEVCProfileIndication != HEVCProfileMain || r.LevelIndication() != 120 || len(r.VideoParameterSetNALUnits) != 1 {
+		t.Errorf("invalid record %+v", r)
+	}
+
+	if _, err := NewHEVCDecoderConfigurationRecordFromAnnexB(avc.JoinAnnexB([][]byte{aud, x265SPS})); err == nil {
+		t.Error("should error for no vps and pps")
+	}
+}
@@ -0,0 +1,56 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp3_test
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/mp3"
+)
+
+func ExampleFrameHeader() {
+	p, err := flv.NewAudioPackager()
+	if err != nil {
+		return
+	}
+
+	// The FLV audio tag of MP3, the SoundRate bits is 44kHz, while the frame is 24kHz mono.
+	tag := []byte{0x2f, 0xff, 0xf3, 0x84, 0xc0}
+
+	frame, err := p.Decode(tag)
+	if err != nil || frame.SoundFormat != flv.AudioCodecMP3 {
+		return
+	}
+
+	// Trust the frame header instead of the SoundRate bits.
+	h := &mp3.FrameHeader{}
+	if err = h.UnmarshalBinary(frame.Raw); err != nil {
+		return
+	}
+	fmt.Println(h)
+	fmt.Println("channels", h.Channels(), "duration", h.Duration())
+
+	// Output:
+	// MPEG2 LayerIII, 24000Hz, 64kbps, Mono
+	// channels 1 duration 24ms
+}
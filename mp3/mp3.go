@@ -0,0 +1,442 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+// The oryx MP3 package includes some utilites for MPEG audio.
+// The MP3 stream is a sequence of frames, each frame starts with a 4bytes header which
+// indicates the version, layer, bitrate and sample rate, while the VBR stream generally
+// puts a Xing or VBRI header in the first frame, for the number of frames and bytes.
+//
+//	@note MPEG audio frame header, please read ISO_IEC_11172-3-MP3-1993.pdf, 2.4.1.3 Header
+//		and ISO_IEC_13818-3-MP3-1998.pdf for MPEG2 LSF(lower sampling frequencies).
+package mp3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The version of MPEG audio, the ID bits in header.
+type Version uint8
+
+const (
+	Version2_5      Version = 0 // The unofficial MPEG2.5 extension for very low sample rate.
+	VersionReserved Version = 1
+	Version2        Version = 2 // The MPEG2 LSF(lower sampling frequencies).
+	Version1        Version = 3
+)
+
+func (v Version) String() string {
+	switch v {
+	case Version1:
+		return "MPEG1"
+	case Version2:
+		return "MPEG2"
+	case Version2_5:
+		return "MPEG2.5"
+	default:
+		return "Reserved"
+	}
+}
+
+// The layer of MPEG audio, the MP3 is layer III.
+type Layer uint8
+
+const (
+	LayerReserved Layer = 0
+	LayerIII      Layer = 1
+	LayerII       Layer = 2
+	LayerI        Layer = 3
+)
+
+func (v Layer) String() string {
+	switch v {
+	case LayerI:
+		return "LayerI"
+	case LayerII:
+		return "LayerII"
+	case LayerIII:
+		return "LayerIII"
+	default:
+		return "Reserved"
+	}
+}
+
+// The channel mode of MPEG audio.
+type ChannelMode uint8
+
+const (
+	ChannelModeStereo      ChannelMode = 0
+	ChannelModeJointStereo ChannelMode = 1
+	ChannelModeDualChannel ChannelMode = 2
+	ChannelModeMono        ChannelMode = 3
+)
+
+func (v ChannelMode) String() string {
+	switch v {
+	case ChannelModeStereo:
+		return "Stereo"
+	case ChannelModeJointStereo:
+		return "JointStereo"
+	case ChannelModeDualChannel:
+		return "DualChannel"
+	default:
+		return "Mono"
+	}
+}
+
+// The bitrate in kbps, indexed by the bitrate_index, the 0 is free format.
+// Refer to @doc ISO_IEC_11172-3-MP3-1993.pdf, @section 2.4.2.3 bitrate_index
+var bitrates = map[Version]map[Layer][15]int{
+	Version1: {
+		LayerI:   {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		LayerII:  {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		LayerIII: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	// Refer to @doc ISO_IEC_13818-3-MP3-1998.pdf, @section 2.5.2.3 bitrate_index
+	Version2: {
+		LayerI:   {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		LayerII:  {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		LayerIII: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// The sample rate in Hz, indexed by the sampling_frequency.
+var sampleRates = map[Version][3]int{
+	Version1:   {44100, 48000, 32000},
+	Version2:   {22050, 24000, 16000},
+	Version2_5: {11025, 12000, 8000},
+}
+
+// The syncword of MPEG audio frame, 11bits of 1, to support MPEG2.5.
+const syncword = 0x7ff
+
+// The frame header of MPEG audio, 4bytes.
+// Refer to @doc ISO_IEC_11172-3-MP3-1993.pdf, @section 2.4.1.3 Header
+type FrameHeader struct {
+	Version Version
+	Layer   Layer
+	// Whether no CRC after the header, the protection_bit is 1.
+	ProtectionAbsent bool
+	// The index of bitrate, 0 is free format and 15 is forbidden.
+	BitrateIndex uint8
+	// The index of sample rate, 3 is reserved.
+	SampleRateIndex uint8
+	// Whether the frame contains an additional slot.
+	Padding bool
+	Private bool
+
+	ChannelMode   ChannelMode
+	ModeExtension uint8
+
+	Copyright bool
+	Original  bool
+	Emphasis  uint8
+}
+
+func (v *FrameHeader) String() string {
+	return fmt.Sprintf("%v %v, %vHz, %vkbps, %v", v.Version, v.Layer, v.SampleRate(), v.Bitrate()/1000, v.ChannelMode)
+}
+
+func (v *FrameHeader) validate() error {
+	if v.Version == VersionReserved {
+		return errors.New("invalid version")
+	}
+	if v.Layer == LayerReserved {
+		return errors.New("invalid layer")
+	}
+	if v.BitrateIndex >= 0x0f {
+		return errors.Errorf("invalid bitrate index %v", v.BitrateIndex)
+	}
+	if v.SampleRateIndex >= 0x03 {
+		return errors.Errorf("invalid sample rate index %v", v.SampleRateIndex)
+	}
+	return nil
+}
+
+func (v *FrameHeader) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 4 {
+		return errors.Errorf("requires 4 but only %v bytes", len(data))
+	}
+
+	h := binary.BigEndian.Uint32(data)
+	if sw := h >> 21; sw != syncword {
+		return errors.Errorf("invalid syncword %#x", sw)
+	}
+
+	// ID 2 bslbf, the MPEG2.5 use the last bit of syncword.
+	// layer 2 bslbf
+	// protection_bit 1 bslbf
+	v.Version = Version(h>>19) & 0x03
+	v.Layer = Layer(h>>17) & 0x03
+	v.ProtectionAbsent = (h>>16)&0x01 == 1
+	// bitrate_index 4 bslbf
+	// sampling_frequency 2 bslbf
+	// padding_bit 1 bslbf
+	// private_bit 1 bslbf
+	v.BitrateIndex = uint8(h>>12) & 0x0f
+	v.SampleRateIndex = uint8(h>>10) & 0x03
+	v.Padding = (h>>9)&0x01 == 1
+	v.Private = (h>>8)&0x01 == 1
+	// mode 2 bslbf
+	// mode_extension 2 bslbf
+	// copyright 1 bslbf
+	// original/home 1 bslbf
+	// emphasis 2 bslbf
+	v.ChannelMode = ChannelMode(h>>6) & 0x03
+	v.ModeExtension = uint8(h>>4) & 0x03
+	v.Copyright = (h>>3)&0x01 == 1
+	v.Original = (h>>2)&0x01 == 1
+	v.Emphasis = uint8(h) & 0x03
+
+	return v.validate()
+}
+
+func (v *FrameHeader) MarshalBinary() (data []byte, err error) {
+	if err = v.validate(); err != nil {
+		return
+	}
+
+	h := uint32(syncword)<<21 | uint32(v.Version&0x03)<<19 | uint32(v.Layer&0x03)<<17
+	h |= uint32(v.BitrateIndex&0x0f)<<12 | uint32(v.SampleRateIndex&0x03)<<10
+	h |= uint32(v.ChannelMode&0x03)<<6 | uint32(v.ModeExtension&0x03)<<4 | uint32(v.Emphasis&0x03)
+
+	for _, f := range []struct {
+		set   bool
+		shift uint
+	}{{v.ProtectionAbsent, 16}, {v.Padding, 9}, {v.Private, 8}, {v.Copyright, 3}, {v.Original, 2}} {
+		if f.set {
+			h |= 1 << f.shift
+		}
+	}
+
+	data = make([]byte, 4)
+	binary.BigEndian.PutUint32(data, h)
+	return
+}
+
+// The bitrate in bps, 0 for free format.
+func (v *FrameHeader) Bitrate() int {
+	version := v.Version
+	if version == Version2_5 {
+		version = Version2
+	}
+	if t, ok := bitrates[version][v.Layer]; ok && v.BitrateIndex < 0x0f {
+		return t[v.BitrateIndex] * 1000
+	}
+	return 0
+}
+
+// The sample rate in Hz.
+func (v *FrameHeader) SampleRate() int {
+	if t, ok := sampleRates[v.Version]; ok && v.SampleRateIndex < 0x03 {
+		return t[v.SampleRateIndex]
+	}
+	return 0
+}
+
+// The number of channels.
+func (v *FrameHeader) Channels() int {
+	if v.ChannelMode == ChannelModeMono {
+		return 1
+	}
+	return 2
+}
+
+// The number of samples per channel in a frame.
+func (v *FrameHeader) Samples() int {
+	switch v.Layer {
+	case LayerI:
+		return 384
+	case LayerIII:
+		if v.Version != Version1 {
+			return 576
+		}
+	}
+	return 1152
+}
+
+// The duration of a frame.
+func (v *FrameHeader) Duration() time.Duration {
+	if sr := v.SampleRate(); sr > 0 {
+		return time.Duration(v.Samples()) * time.Second / time.Duration(sr)
+	}
+	return 0
+}
+
+// The size in bytes of the frame, including the header, 0 for free format.
+func (v *FrameHeader) FrameSize() int {
+	bitrate, sr := v.Bitrate(), v.SampleRate()
+	if bitrate == 0 || sr == 0 {
+		return 0
+	}
+
+	// The slot of layer I is 4bytes, while others are 1byte.
+	var padding int
+	if v.Padding {
+		padding = 1
+	}
+	if v.Layer == LayerI {
+		return (12*bitrate/sr + padding) * 4
+	}
+	return v.Samples()/8*bitrate/sr + padding
+}
+
+// The size of side information, which follows the header and CRC for layer III.
+// Refer to @doc ISO_IEC_11172-3-MP3-1993.pdf, @section 2.4.1.7 Audio data, Layer III
+func (v *FrameHeader) sideInfoSize() int {
+	if v.Layer != LayerIII {
+		return 0
+	}
+	if v.Version == Version1 {
+		if v.ChannelMode == ChannelModeMono {
+			return 17
+		}
+		return 32
+	}
+	if v.ChannelMode == ChannelModeMono {
+		return 9
+	}
+	return 17
+}
+
+// The flags of Xing header, which fields present.
+const (
+	xingFlagFrames  = 0x01
+	xingFlagBytes   = 0x02
+	xingFlagTOC     = 0x04
+	xingFlagQuality = 0x08
+)
+
+// The Xing header in the first frame of VBR stream, or Info header of CBR stream by LAME.
+type XingHeader struct {
+	// Whether it's the Info header, for the CBR stream.
+	Info bool
+	// The number of frames, excluding the frame of Xing header, 0 if not present.
+	Frames uint32
+	// The number of bytes of stream, 0 if not present.
+	Bytes uint32
+	// The 100 entries of seek table, nil if not present.
+	TOC []byte
+	// The quality indicator from 0(best) to 100(worst), 0 if not present.
+	Quality uint32
+}
+
+// Unmarshal the Xing header from the whole first frame, including the frame header.
+func (v *XingHeader) UnmarshalBinary(data []byte) (err error) {
+	h := &FrameHeader{}
+	if err = h.UnmarshalBinary(data); err != nil {
+		return errors.WithMessage(err, "frame header")
+	}
+
+	offset := 4 + h.sideInfoSize()
+	if !h.ProtectionAbsent {
+		offset += 2
+	}
+	if len(data) < offset+8 {
+		return errors.Errorf("requires %v but only %v bytes", offset+8, len(data))
+	}
+
+	p := data[offset:]
+	switch string(p[:4]) {
+	case "Xing":
+		v.Info = false
+	case "Info":
+		v.Info = true
+	default:
+		return errors.Errorf("invalid xing tag %#x", p[:4])
+	}
+
+	flags := binary.BigEndian.Uint32(p[4:])
+	p = p[8:]
+
+	read := func(flag uint32, n int) (b []byte, err error) {
+		if flags&flag == 0 {
+			return nil, nil
+		}
+		if len(p) < n {
+			return nil, errors.Errorf("requires %v but only %v bytes", n, len(p))
+		}
+		b, p = p[:n], p[n:]
+		return
+	}
+
+	var b []byte
+	if b, err = read(xingFlagFrames, 4); err != nil {
+		return errors.WithMessage(err, "frames")
+	} else if b != nil {
+		v.Frames = binary.BigEndian.Uint32(b)
+	}
+	if b, err = read(xingFlagBytes, 4); err != nil {
+		return errors.WithMessage(err, "bytes")
+	} else if b != nil {
+		v.Bytes = binary.BigEndian.Uint32(b)
+	}
+	if b, err = read(xingFlagTOC, 100); err != nil {
+		return errors.WithMessage(err, "toc")
+	} else if b != nil {
+		v.TOC = append([]byte(nil), b...)
+	}
+	if b, err = read(xingFlagQuality, 4); err != nil {
+		return errors.WithMessage(err, "quality")
+	} else if b != nil {
+		v.Quality = binary.BigEndian.Uint32(b)
+	}
+
+	return
+}
+
+// The VBRI header in the first frame of VBR stream by Fraunhofer encoder.
+type VBRIHeader struct {
+	Version uint16
+	Delay   uint16
+	Quality uint16
+	// The number of bytes of stream.
+	Bytes uint32
+	// The number of frames.
+	Frames uint32
+}
+
+// Unmarshal the VBRI header from the whole first frame, which is always 32bytes after the header.
+func (v *VBRIHeader) UnmarshalBinary(data []byte) (err error) {
+	h := &FrameHeader{}
+	if err = h.UnmarshalBinary(data); err != nil {
+		return errors.WithMessage(err, "frame header")
+	}
+
+	const offset = 4 + 32
+	if len(data) < offset+18 {
+		return errors.Errorf("requires %v but only %v bytes", offset+18, len(data))
+	}
+
+	p := data[offset:]
+	if string(p[:4]) != "VBRI" {
+		return errors.Errorf("invalid vbri tag %#x", p[:4])
+	}
+
+	v.Version = binary.BigEndian.Uint16(p[4:])
+	v.Delay = binary.BigEndian.Uint16(p[6:])
+	v.Quality = binary.BigEndian.Uint16(p[8:])
+	v.Bytes = binary.BigEndian.Uint32(p[10:])
+	v.Frames = binary.BigEndian.Uint32(p[14:])
+	return
+}
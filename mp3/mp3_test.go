@@ -0,0 +1,197 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp3
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFrameHeader(t *testing.T) {
+	// MPEG1 LayerIII, 128kbps, 44.1kHz, stereo.
+	b := []byte{0xff, 0xfb, 0x90, 0x00}
+
+	h := &FrameHeader{}
+	if err := h.UnmarshalBinary(b); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if h.Version != Version1 || h.Layer != LayerIII || !h.ProtectionAbsent {
+		t.Error(h.Version, h.Layer, h.ProtectionAbsent)
+	}
+	if v := h.Bitrate(); v != 128000 {
+		t.Error(v)
+	}
+	if v := h.SampleRate(); v != 44100 {
+		t.Error(v)
+	}
+	if v := h.Channels(); v != 2 {
+		t.Error(v)
+	}
+	if v := h.Samples(); v != 1152 {
+		t.Error(v)
+	}
+	if v := h.FrameSize(); v != 417 {
+		t.Error(v)
+	}
+	if v := h.Duration(); v != 1152*time.Second/44100 {
+		t.Error(v)
+	}
+	if v := h.String(); v != "MPEG1 LayerIII, 44100Hz, 128kbps, Stereo" {
+		t.Error(v)
+	}
+
+	h.Padding = true
+	if v := h.FrameSize(); v != 418 {
+		t.Error(v)
+	}
+
+	h.Padding = false
+	if data, err := h.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, b) != 0 {
+		t.Errorf("%#x", data)
+	}
+}
+
+func TestFrameHeader_LSF(t *testing.T) {
+	// MPEG2 LayerIII, 64kbps, 24kHz, mono.
+	h := &FrameHeader{}
+	if err := h.UnmarshalBinary([]byte{0xff, 0xf3, 0x84, 0xc0}); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	if h.Version != Version2 || h.ChannelMode != ChannelModeMono {
+		t.Error(h.Version, h.ChannelMode)
+	}
+	if v := h.Channels(); v != 1 {
+		t.Error(v)
+	}
+	if v := h.Samples(); v != 576 {
+		t.Error(v)
+	}
+	if v := h.FrameSize(); v != 192 {
+		t.Error(v)
+	}
+	if v := h.Duration(); v != 24*time.Millisecond {
+		t.Error(v)
+	}
+
+	// MPEG2.5 LayerIII, 8kbps, 8kHz.
+	if err := h.UnmarshalBinary([]byte{0xff, 0xe3, 0x18, 0xc0}); err != nil {
+		t.Errorf("%+v", err)
+	} else if h.Version != Version2_5 || h.SampleRate() != 8000 || h.Bitrate() != 8000 {
+		t.Error(h)
+	}
+
+	// MPEG1 LayerI, 384kbps, 48kHz, with padding.
+	if err := h.UnmarshalBinary([]byte{0xff, 0xff, 0xc6, 0x00}); err != nil {
+		t.Errorf("%+v", err)
+	} else if v := h.FrameSize(); v != (12*384000/48000+1)*4 {
+		t.Error(v)
+	}
+}
+
+func TestFrameHeader_Invalid(t *testing.T) {
+	h := &FrameHeader{}
+	for _, b := range [][]byte{
+		nil,
+		{0xff, 0xfb, 0x90},
+		{0xff, 0x0b, 0x90, 0x00}, // Syncword.
+		{0xff, 0xeb, 0x90, 0x00}, // Reserved version.
+		{0xff, 0xf9, 0x90, 0x00}, // Reserved layer.
+		{0xff, 0xfb, 0xf0, 0x00}, // Bad bitrate.
+		{0xff, 0xfb, 0x9c, 0x00}, // Reserved sample rate.
+	} {
+		if err := h.UnmarshalBinary(b); err == nil {
+			t.Errorf("should fail for %#x", b)
+		}
+	}
+}
+
+func TestXingHeader(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+
+	// The Xing header is after the 32bytes side information of MPEG1 stereo.
+	p := frame[36:]
+	copy(p, []byte{'X', 'i', 'n', 'g', 0x00, 0x00, 0x00, 0x0f, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00})
+	p[16] = 0x01
+	copy(p[116:], []byte{0x00, 0x00, 0x00, 0x32})
+
+	x := &XingHeader{}
+	if err := x.UnmarshalBinary(frame); err != nil {
+		t.Errorf("%+v", err)
+	}
+	if x.Info || x.Frames != 256 || x.Bytes != 65536 || x.Quality != 50 {
+		t.Error(x.Info, x.Frames, x.Bytes, x.Quality)
+	}
+	if len(x.TOC) != 100 || x.TOC[0] != 0x01 {
+		t.Error(x.TOC)
+	}
+
+	// The Info header only has frames.
+	copy(p, []byte{'I', 'n', 'f', 'o', 0x00, 0x00, 0x00, 0x01})
+	x = &XingHeader{}
+	if err := x.UnmarshalBinary(frame); err != nil {
+		t.Errorf("%+v", err)
+	} else if !x.Info || x.Frames != 256 || x.Bytes != 0 || x.TOC != nil {
+		t.Error(x)
+	}
+
+	// Not enough data.
+	if err := x.UnmarshalBinary(frame[:40]); err == nil {
+		t.Error("should fail")
+	}
+
+	// No Xing header.
+	if err := x.UnmarshalBinary(make([]byte, 417)); err == nil {
+		t.Error("should fail")
+	}
+	frame[36] = 'x'
+	if err := x.UnmarshalBinary(frame); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestVBRIHeader(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	copy(frame[36:], []byte{
+		'V', 'B', 'R', 'I', 0x00, 0x01, 0x04, 0xb0, 0x00, 0x4b,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00,
+	})
+
+	x := &VBRIHeader{}
+	if err := x.UnmarshalBinary(frame); err != nil {
+		t.Errorf("%+v", err)
+	}
+	if x.Version != 1 || x.Delay != 1200 || x.Quality != 75 || x.Bytes != 65536 || x.Frames != 256 {
+		t.Error(x)
+	}
+
+	frame[36] = 'v'
+	if err := x.UnmarshalBinary(frame); err == nil {
+		t.Error("should fail")
+	}
+}
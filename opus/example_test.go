@@ -0,0 +1,69 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package opus_test
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/opus"
+)
+
+func ExampleOpusHead() {
+	p, err := flv.NewAudioPackager()
+	if err != nil {
+		return
+	}
+
+	// The Enhanced RTMP audio tag of Opus sequence start, with the OpusHead.
+	tag := []byte{
+		0x90, 'O', 'p', 'u', 's',
+		'O', 'p', 'u', 's', 'H', 'e', 'a', 'd',
+		0x01, 0x02, 0x38, 0x01, 0x80, 0xbb, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	frame, err := p.Decode(tag)
+	if err != nil || frame.FourCC != flv.AudioFourCCOpus || frame.PacketType != flv.AudioPacketTypeSequenceStart {
+		return
+	}
+
+	h := opus.NewOpusHead()
+	if err = h.UnmarshalBinary(frame.Raw); err != nil {
+		return
+	}
+	fmt.Println(h)
+
+	// The Enhanced RTMP audio tag of Opus coded frames, with 2 frames of 20ms.
+	if frame, err = p.Decode([]byte{0x91, 'O', 'p', 'u', 's', 0xfd}); err != nil {
+		return
+	}
+
+	d, err := opus.PacketDuration(frame.Raw)
+	if err != nil {
+		return
+	}
+	fmt.Println("duration", d)
+
+	// Output:
+	// Opus v1, 2 channels, 48000Hz, pre-skip=312
+	// duration 40ms
+}
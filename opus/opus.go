@@ -0,0 +1,331 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+// The oryx Opus package includes some utilites for Opus.
+// The Opus packet starts with a TOC byte, which indicates the mode, bandwidth, frame
+// duration and number of frames, while the codec information is carried by OpusHead
+// in Ogg, MP4 and FLV(Enhanced RTMP). The timestamp of Opus is always in 48kHz.
+//
+//	@note The TOC, please read rfc6716.txt, 3.1 The TOC Byte.
+//	@note The OpusHead, please read rfc7845.txt, 5.1 Identification Header.
+package opus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The sample rate of Opus timestamp and pre-skip, whatever the input sample rate.
+const SampleRate = 48000
+
+// The mode of Opus frame.
+type Mode uint8
+
+const (
+	ModeSILK Mode = iota
+	ModeHybrid
+	ModeCELT
+)
+
+func (v Mode) String() string {
+	switch v {
+	case ModeSILK:
+		return "SILK"
+	case ModeHybrid:
+		return "Hybrid"
+	default:
+		return "CELT"
+	}
+}
+
+// The audio bandwidth of Opus frame.
+type Bandwidth uint8
+
+const (
+	BandwidthNB  Bandwidth = iota // Narrowband, 4kHz.
+	BandwidthMB                   // Medium-band, 6kHz.
+	BandwidthWB                   // Wideband, 8kHz.
+	BandwidthSWB                  // Super-wideband, 12kHz.
+	BandwidthFB                   // Fullband, 20kHz.
+)
+
+func (v Bandwidth) String() string {
+	switch v {
+	case BandwidthNB:
+		return "NB"
+	case BandwidthMB:
+		return "MB"
+	case BandwidthWB:
+		return "WB"
+	case BandwidthSWB:
+		return "SWB"
+	default:
+		return "FB"
+	}
+}
+
+// The max duration of a packet.
+const maxPacketDuration = 120 * time.Millisecond
+
+// The TOC(table-of-contents) byte of Opus packet.
+// Refer to @doc rfc6716.txt, @section 3.1 The TOC Byte
+type TOC struct {
+	// The config from 0 to 31, for mode, bandwidth and frame duration.
+	Config uint8
+	// Whether stereo, otherwise mono.
+	Stereo bool
+	// The code for number of frames, 0 is 1 frame, 1 and 2 are 2 frames, 3 is arbitrary frames.
+	FrameCountCode uint8
+}
+
+func (v *TOC) String() string {
+	return fmt.Sprintf("%v %v, %v, stereo=%v, code=%v", v.Mode(), v.Bandwidth(), v.FrameDuration(), v.Stereo, v.FrameCountCode)
+}
+
+func (v *TOC) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 1 {
+		return errors.New("requires 1 byte for toc")
+	}
+
+	// config 5, s 1, c 2
+	v.Config = data[0] >> 3
+	v.Stereo = (data[0]>>2)&0x01 == 1
+	v.FrameCountCode = data[0] & 0x03
+	return
+}
+
+func (v *TOC) MarshalBinary() (data []byte, err error) {
+	if v.Config > 31 {
+		return nil, errors.Errorf("invalid config %v", v.Config)
+	}
+
+	b := v.Config<<3 | v.FrameCountCode&0x03
+	if v.Stereo {
+		b |= 0x04
+	}
+	return []byte{b}, nil
+}
+
+// The mode by config, 0-11 is SILK, 12-15 is Hybrid, and 16-31 is CELT.
+// Refer to @doc rfc6716.txt, @section 3.1 Table 2: TOC Byte Configuration Parameters
+func (v *TOC) Mode() Mode {
+	if v.Config < 12 {
+		return ModeSILK
+	} else if v.Config < 16 {
+		return ModeHybrid
+	}
+	return ModeCELT
+}
+
+// The bandwidth by config.
+func (v *TOC) Bandwidth() Bandwidth {
+	switch {
+	case v.Config < 12:
+		return Bandwidth(v.Config / 4)
+	case v.Config < 16:
+		return BandwidthSWB + Bandwidth((v.Config-12)/2)
+	case v.Config < 20:
+		return BandwidthNB
+	default:
+		// The CELT has no MB.
+		return BandwidthWB + Bandwidth((v.Config-20)/4)
+	}
+}
+
+// The duration of each frame by config.
+func (v *TOC) FrameDuration() time.Duration {
+	switch {
+	case v.Config < 12:
+		return []time.Duration{10, 20, 40, 60}[v.Config%4] * time.Millisecond
+	case v.Config < 16:
+		return []time.Duration{10, 20}[v.Config%2] * time.Millisecond
+	default:
+		return []time.Duration{2500, 5000, 10000, 20000}[v.Config%4] * time.Microsecond
+	}
+}
+
+// The number of frames in Opus packet.
+// Refer to @doc rfc6716.txt, @section 3.2 Frame Packing
+func NumFrames(packet []byte) (n int, err error) {
+	toc := &TOC{}
+	if err = toc.UnmarshalBinary(packet); err != nil {
+		return
+	}
+
+	switch toc.FrameCountCode {
+	case 0:
+		return 1, nil
+	case 1, 2:
+		return 2, nil
+	}
+
+	// The frame count byte, v 1, p 1, M 6.
+	if len(packet) < 2 {
+		return 0, errors.New("requires 2 bytes for code 3")
+	}
+	if n = int(packet[1] & 0x3f); n == 0 {
+		return 0, errors.New("invalid zero frames")
+	}
+	return
+}
+
+// The duration of Opus packet, which is no more than 120ms.
+func PacketDuration(packet []byte) (d time.Duration, err error) {
+	var n int
+	if n, err = NumFrames(packet); err != nil {
+		return
+	}
+
+	toc := &TOC{}
+	if err = toc.UnmarshalBinary(packet); err != nil {
+		return
+	}
+
+	if d = time.Duration(n) * toc.FrameDuration(); d > maxPacketDuration {
+		return 0, errors.Errorf("packet duration %v exceed %v", d, maxPacketDuration)
+	}
+	return
+}
+
+// The number of samples per channel in 48kHz of Opus packet.
+func PacketSamples(packet []byte) (n int, err error) {
+	var d time.Duration
+	if d, err = PacketDuration(packet); err != nil {
+		return
+	}
+	return int(d * SampleRate / time.Second), nil
+}
+
+// The magic signature of OpusHead.
+const opusHeadMagic = "OpusHead"
+
+// The channel mapping family of OpusHead.
+// Refer to @doc rfc7845.txt, @section 5.1.1 Channel Mapping
+type ChannelMappingFamily uint8
+
+const (
+	// The mono or stereo, without the channel mapping table.
+	ChannelMappingFamilyRTP ChannelMappingFamily = 0
+	// The Vorbis channel order, for 1 to 8 channels.
+	ChannelMappingFamilyVorbis ChannelMappingFamily = 1
+	// The undefined channels, no particular meaning.
+	ChannelMappingFamilyUndefined ChannelMappingFamily = 255
+)
+
+// The identification header of Opus, the OpusHead.
+// Refer to @doc rfc7845.txt, @section 5.1 Identification Header
+type OpusHead struct {
+	Version      uint8
+	ChannelCount uint8
+	// The number of samples in 48kHz to discard from the decoder output.
+	PreSkip uint16
+	// The sample rate of the original input, informational only.
+	InputSampleRate uint32
+	// The gain in dB to apply to the output, in Q7.8 format.
+	OutputGain int16
+
+	ChannelMappingFamily ChannelMappingFamily
+	// The channel mapping table, only present when family is not 0.
+	StreamCount    uint8
+	CoupledCount   uint8
+	ChannelMapping []uint8
+}
+
+func NewOpusHead() *OpusHead {
+	return &OpusHead{Version: 1}
+}
+
+func (v *OpusHead) String() string {
+	return fmt.Sprintf("Opus v%v, %v channels, %vHz, pre-skip=%v", v.Version, v.ChannelCount, v.InputSampleRate, v.PreSkip)
+}
+
+func (v *OpusHead) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 19 {
+		return errors.Errorf("requires 19 but only %v bytes", len(data))
+	}
+
+	if magic := string(data[:8]); magic != opusHeadMagic {
+		return errors.Errorf("invalid magic %v", magic)
+	}
+
+	// The major version is the upper 4bits, only 0 is compatible.
+	if v.Version = data[8]; v.Version>>4 != 0 {
+		return errors.Errorf("unsupported version %v", v.Version)
+	}
+	if v.ChannelCount = data[9]; v.ChannelCount == 0 {
+		return errors.New("invalid zero channels")
+	}
+
+	// The numbers are in little-endian.
+	v.PreSkip = binary.LittleEndian.Uint16(data[10:])
+	v.InputSampleRate = binary.LittleEndian.Uint32(data[12:])
+	v.OutputGain = int16(binary.LittleEndian.Uint16(data[16:]))
+	v.ChannelMappingFamily = ChannelMappingFamily(data[18])
+
+	v.StreamCount, v.CoupledCount, v.ChannelMapping = 0, 0, nil
+	if v.ChannelMappingFamily == ChannelMappingFamilyRTP {
+		if v.ChannelCount > 2 {
+			return errors.Errorf("invalid %v channels for family 0", v.ChannelCount)
+		}
+		return
+	}
+
+	// The channel mapping table.
+	// Refer to @doc rfc7845.txt, @section 5.1.1 Channel Mapping
+	p := data[19:]
+	if len(p) < 2+int(v.ChannelCount) {
+		return errors.Errorf("requires %v but only %v bytes", 2+int(v.ChannelCount), len(p))
+	}
+
+	v.StreamCount, v.CoupledCount = p[0], p[1]
+	if v.StreamCount == 0 || v.CoupledCount > v.StreamCount {
+		return errors.Errorf("invalid streams %v, coupled %v", v.StreamCount, v.CoupledCount)
+	}
+	v.ChannelMapping = append([]uint8(nil), p[2:2+int(v.ChannelCount)]...)
+
+	return
+}
+
+func (v *OpusHead) MarshalBinary() (data []byte, err error) {
+	if v.ChannelCount == 0 {
+		return nil, errors.New("invalid zero channels")
+	}
+	if v.ChannelMappingFamily != ChannelMappingFamilyRTP && len(v.ChannelMapping) != int(v.ChannelCount) {
+		return nil, errors.Errorf("invalid mapping %v for %v channels", len(v.ChannelMapping), v.ChannelCount)
+	}
+
+	data = make([]byte, 19)
+	copy(data, opusHeadMagic)
+	data[8] = v.Version
+	data[9] = v.ChannelCount
+	binary.LittleEndian.PutUint16(data[10:], v.PreSkip)
+	binary.LittleEndian.PutUint32(data[12:], v.InputSampleRate)
+	binary.LittleEndian.PutUint16(data[16:], uint16(v.OutputGain))
+	data[18] = byte(v.ChannelMappingFamily)
+
+	if v.ChannelMappingFamily != ChannelMappingFamilyRTP {
+		data = append(data, v.StreamCount, v.CoupledCount)
+		data = append(data, v.ChannelMapping...)
+	}
+	return
+}
@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package opus
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTOC(t *testing.T) {
+	for _, c := range []struct {
+		b         byte
+		mode      Mode
+		bandwidth Bandwidth
+		duration  time.Duration
+	}{
+		{0x08, ModeSILK, BandwidthNB, 20 * time.Millisecond},
+		{0x38, ModeSILK, BandwidthMB, 60 * time.Millisecond},
+		{0x40, ModeSILK, BandwidthWB, 10 * time.Millisecond},
+		{0x68, ModeHybrid, BandwidthSWB, 20 * time.Millisecond},
+		{0x70, ModeHybrid, BandwidthFB, 10 * time.Millisecond},
+		{0x80, ModeCELT, BandwidthNB, 2500 * time.Microsecond},
+		{0xa8, ModeCELT, BandwidthWB, 5 * time.Millisecond},
+		{0xd0, ModeCELT, BandwidthSWB, 10 * time.Millisecond},
+		{0xf8, ModeCELT, BandwidthFB, 20 * time.Millisecond},
+	} {
+		toc := &TOC{}
+		if err := toc.UnmarshalBinary([]byte{c.b}); err != nil {
+			t.Errorf("%+v", err)
+		}
+		if toc.Mode() != c.mode || toc.Bandwidth() != c.bandwidth || toc.FrameDuration() != c.duration {
+			t.Errorf("%#x: %v", c.b, toc)
+		}
+	}
+
+	toc := &TOC{}
+	if err := toc.UnmarshalBinary(nil); err == nil {
+		t.Error("should fail")
+	}
+
+	if err := toc.UnmarshalBinary([]byte{0xfd}); err != nil {
+		t.Errorf("%+v", err)
+	} else if toc.Config != 31 || !toc.Stereo || toc.FrameCountCode != 1 {
+		t.Error(toc)
+	} else if v := toc.String(); v != "CELT FB, 20ms, stereo=true, code=1" {
+		t.Error(v)
+	}
+
+	if data, err := toc.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, []byte{0xfd}) != 0 {
+		t.Errorf("%#x", data)
+	}
+}
+
+func TestPacketDuration(t *testing.T) {
+	for _, c := range []struct {
+		packet   []byte
+		frames   int
+		duration time.Duration
+	}{
+		{[]byte{0xfc}, 1, 20 * time.Millisecond},
+		{[]byte{0xfd}, 2, 40 * time.Millisecond},
+		{[]byte{0xfe}, 2, 40 * time.Millisecond},
+		{[]byte{0x0b, 0x03}, 3, 60 * time.Millisecond},
+		{[]byte{0x1b, 0x82}, 2, 120 * time.Millisecond},
+	} {
+		if n, err := NumFrames(c.packet); err != nil {
+			t.Errorf("%+v", err)
+		} else if n != c.frames {
+			t.Errorf("%#x: %v", c.packet, n)
+		}
+		if d, err := PacketDuration(c.packet); err != nil {
+			t.Errorf("%+v", err)
+		} else if d != c.duration {
+			t.Errorf("%#x: %v", c.packet, d)
+		}
+	}
+
+	if n, err := PacketSamples([]byte{0xfc}); err != nil {
+		t.Errorf("%+v", err)
+	} else if n != 960 {
+		t.Error(n)
+	}
+
+	for _, b := range [][]byte{
+		nil,
+		{0xff},       // No frame count byte.
+		{0xff, 0x00}, // Zero frames.
+		{0x1b, 0x03}, // Exceed 120ms.
+	} {
+		if _, err := PacketDuration(b); err == nil {
+			t.Errorf("should fail for %#x", b)
+		}
+	}
+}
+
+func TestOpusHead(t *testing.T) {
+	b := []byte{
+		'O', 'p', 'u', 's', 'H', 'e', 'a', 'd',
+		0x01, 0x02, 0x38, 0x01, 0x80, 0xbb, 0x00, 0x00, 0x00, 0xff, 0x00,
+	}
+
+	h := NewOpusHead()
+	if err := h.UnmarshalBinary(b); err != nil {
+		t.Errorf("%+v", err)
+	}
+	if h.Version != 1 || h.ChannelCount != 2 || h.PreSkip != 312 || h.InputSampleRate != 48000 {
+		t.Error(h)
+	}
+	if h.OutputGain != -256 || h.ChannelMappingFamily != ChannelMappingFamilyRTP {
+		t.Error(h.OutputGain, h.ChannelMappingFamily)
+	}
+	if v := h.String(); v != "Opus v1, 2 channels, 48000Hz, pre-skip=312" {
+		t.Error(v)
+	}
+
+	if data, err := h.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, b) != 0 {
+		t.Errorf("%#x", data)
+	}
+}
+
+func TestOpusHead_Mapping(t *testing.T) {
+	// The 5.1 surround, 4 streams and 2 coupled.
+	b := []byte{
+		'O', 'p', 'u', 's', 'H', 'e', 'a', 'd',
+		0x01, 0x06, 0x38, 0x01, 0x80, 0xbb, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x04, 0x02, 0x00, 0x04, 0x01, 0x02, 0x03, 0x05,
+	}
+
+	h := NewOpusHead()
+	if err := h.UnmarshalBinary(b); err != nil {
+		t.Errorf("%+v", err)
+	}
+	if h.ChannelMappingFamily != ChannelMappingFamilyVorbis || h.StreamCount != 4 || h.CoupledCount != 2 {
+		t.Error(h.ChannelMappingFamily, h.StreamCount, h.CoupledCount)
+	}
+	if bytes.Compare(h.ChannelMapping, []byte{0x00, 0x04, 0x01, 0x02, 0x03, 0x05}) != 0 {
+		t.Error(h.ChannelMapping)
+	}
+
+	if data, err := h.MarshalBinary(); err != nil {
+		t.Errorf("%+v", err)
+	} else if bytes.Compare(data, b) != 0 {
+		t.Errorf("%#x", data)
+	}
+
+	// Not enough channel mapping table.
+	if err := h.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Error("should fail")
+	}
+
+	// The family 0 requires no more than 2 channels.
+	b[18] = 0x00
+	if err := h.UnmarshalBinary(b); err == nil {
+		t.Error("should fail")
+	}
+
+	// Invalid magic.
+	b[0] = 'o'
+	if err := h.UnmarshalBinary(b); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,571 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/https/net/context"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default port of RTMP.
+const defaultPort = "1935"
+
+// The buffer length in ms for player, sent by SetBufferLength before play.
+const defaultBufferLength = 3000
+
+// The status code of NetStream, for client.
+const statusCodePlayStop = "NetStream.Play.Stop"
+
+// The publisher to write flv-style tags to RTMP server, see flv.Muxer.
+type Publisher interface {
+	// Write a FLV tag, the tag is the FLV tag body, for example, the video tag is
+	// the FLV video tag header followed by the AVC packet.
+	WriteTag(tagType flv.TagType, timestamp uint32, tag []byte) (err error)
+	// Stop publishing, then close the connection.
+	Close() error
+}
+
+// The player to read flv-style tags from RTMP server, see flv.Demuxer.
+type Player interface {
+	// Read a FLV tag of audio, video or script data, return io.EOF when stream stopped.
+	ReadTag() (tagType flv.TagType, timestamp uint32, tag []byte, err error)
+	// Stop playing, then close the connection.
+	Close() error
+}
+
+// The RTMP client connection, which does the handshake, connects to app and creates stream,
+// then user can start to publish or play the stream.
+type ClientConn struct {
+	// The underlayer connection.
+	conn net.Conn
+	// The RTMP protocol stack.
+	proto *Protocol
+	// The last transaction id, increased for each request.
+	tid amf0.Number
+
+	// The messages from server, closed when read failed.
+	msgs chan *Message
+	// Closed when connection closed, to notify the reader.
+	closed    chan struct{}
+	closeOnce sync.Once
+	// The read error, which is available after msgs closed.
+	err error
+
+	// Whether use simple handshake, the complex handshake is used if server support.
+	SimpleHandshake bool
+	// The tcUrl, app and stream with query string, parsed from RTMP url, for example,
+	// rtmp://localhost/live/livestream?token=xxx is parsed to:
+	//	tcUrl is rtmp://localhost/live
+	//	app is live
+	//	stream is livestream?token=xxx
+	TcURL, App, Stream string
+	// The stream id created by server.
+	StreamID int
+}
+
+// Dial to RTMP server by rtmpURL, for example, rtmp://localhost/live/livestream, the default
+// port is 1935. The ctx is used to cancel the handshake, connect and create stream, while
+// the dial is only limited by the deadline of ctx.
+func Dial(ctx context.Context, rtmpURL string) (*ClientConn, error) {
+	u, err := url.Parse(rtmpURL)
+	if err != nil {
+		return nil, oe.Wrapf(err, "parse %v", rtmpURL)
+	}
+
+	host := hostWithPort(u.Host)
+
+	var d net.Dialer
+	if deadline, ok := ctx.Deadline(); ok {
+		d.Deadline = deadline
+	}
+
+	c, err := d.Dial("tcp", host)
+	if err != nil {
+		return nil, oe.Wrapf(err, "dial %v", host)
+	}
+	if err = ctx.Err(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	v, err := NewClientConn(ctx, c, rtmpURL)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Append the default port to host if no port, for example, [::1] to [::1]:1935.
+func hostWithPort(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), defaultPort)
+}
+
+// Create client over c for rtmpURL, does the handshake, connect app and create stream.
+// @remark User should close the c when error.
+func NewClientConn(ctx context.Context, c net.Conn, rtmpURL string) (v *ClientConn, err error) {
+	v = &ClientConn{
+		conn:   c,
+		proto:  NewProtocol(c),
+		msgs:   make(chan *Message, sessionChannelSize),
+		closed: make(chan struct{}),
+	}
+
+	if v.TcURL, v.App, v.Stream, err = parseURL(rtmpURL); err != nil {
+		return nil, oe.WithMessage(err, "parse url")
+	}
+
+	if err = v.withContext(ctx, v.connect); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// Parse the RTMP url to tcUrl, app and stream, the last path is the stream,
+// for example, rtmp://localhost:1935/live/livestream?token=xxx is parsed to
+// tcUrl=rtmp://localhost:1935/live, app=live and stream=livestream?token=xxx
+func parseURL(rtmpURL string) (tcUrl, app, stream string, err error) {
+	var u *url.URL
+	if u, err = url.Parse(rtmpURL); err != nil {
+		return "", "", "", oe.Wrapf(err, "parse %v", rtmpURL)
+	}
+
+	if u.Scheme != "rtmp" {
+		return "", "", "", oe.Errorf("invalid scheme %v", u.Scheme)
+	}
+
+	path := strings.Trim(u.Path, "/")
+	pos := strings.LastIndex(path, "/")
+	if pos <= 0 || pos == len(path)-1 {
+		return "", "", "", oe.Errorf("no app or stream in %v", rtmpURL)
+	}
+
+	app, stream = path[:pos], path[pos+1:]
+	if u.RawQuery != "" {
+		stream += "?" + u.RawQuery
+	}
+	tcUrl = u.Scheme + "://" + u.Host + "/" + app
+
+	return
+}
+
+// Run the fn, the connection is interrupted by deadline when ctx is done.
+func (v *ClientConn) withContext(ctx context.Context, fn func() error) (err error) {
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	go func() {
+		defer close(quit)
+
+		select {
+		case <-ctx.Done():
+			v.conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	err = fn()
+
+	close(done)
+	<-quit
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return
+}
+
+// Close the underlayer connection.
+func (v *ClientConn) Close() error {
+	v.closeOnce.Do(func() {
+		close(v.closed)
+	})
+	return v.conn.Close()
+}
+
+func (v *ClientConn) nextTransactionID() amf0.Number {
+	v.tid++
+	return v.tid
+}
+
+func (v *ClientConn) connect() (err error) {
+	hs := NewComplexHandshake(rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err = hs.ClientHandshake(v.conn); err != nil {
+		return oe.WithMessage(err, "handshake")
+	}
+	v.SimpleHandshake = hs.Simple
+
+	// Read messages in goroutine, because the server may send many packets without waiting for us,
+	// for example, the onBWDone after connect app response.
+	go v.readCycle()
+
+	connectApp := NewConnectAppPacket()
+	connectApp.TransactionID = v.nextTransactionID()
+	connectApp.CommandObject.Set("app", amf0.NewString(v.App))
+	connectApp.CommandObject.Set("flashVer", amf0.NewString("LNX 9,0,124,2"))
+	connectApp.CommandObject.Set("tcUrl", amf0.NewString(v.TcURL))
+	connectApp.CommandObject.Set("fpad", amf0.NewBoolean(false))
+	connectApp.CommandObject.Set("capabilities", amf0.NewNumber(15))
+	connectApp.CommandObject.Set("audioCodecs", amf0.NewNumber(4071))
+	connectApp.CommandObject.Set("videoCodecs", amf0.NewNumber(252))
+	connectApp.CommandObject.Set("videoFunction", amf0.NewNumber(1))
+	if err = v.proto.WritePacket(connectApp, 0); err != nil {
+		return oe.WithMessage(err, "write connect app")
+	}
+
+	var connectAppRes *ConnectAppResPacket
+	if err = v.expectPacket(&connectAppRes); err != nil {
+		return oe.WithMessage(err, "expect connect app response")
+	}
+	if connectAppRes.CommandName == commandError {
+		return oe.Errorf("connect app failed, %v", statusCode(connectAppRes.Args))
+	}
+
+	createStream := NewCreateStreamPacket()
+	createStream.TransactionID = v.nextTransactionID()
+	if err = v.proto.WritePacket(createStream, 0); err != nil {
+		return oe.WithMessage(err, "write create stream")
+	}
+
+	var createStreamRes *CreateStreamResPacket
+	if err = v.expectPacket(&createStreamRes); err != nil {
+		return oe.WithMessage(err, "expect create stream response")
+	}
+	if createStreamRes.CommandName == commandError {
+		return oe.New("create stream failed")
+	}
+	v.StreamID = int(createStreamRes.StreamID)
+
+	return
+}
+
+// Read messages from server, response the ping request, deliver others to msgs.
+func (v *ClientConn) readCycle() {
+	defer close(v.msgs)
+
+	for {
+		m, err := v.proto.ReadMessage()
+		if err != nil {
+			v.err = err
+			return
+		}
+
+		if m.MessageType == MessageTypeUserControl {
+			if err = v.onUserControl(m); err != nil {
+				v.err = err
+				return
+			}
+			continue
+		}
+
+		select {
+		case v.msgs <- m:
+		case <-v.closed:
+			return
+		}
+	}
+}
+
+func (v *ClientConn) onUserControl(m *Message) (err error) {
+	var pkt Packet
+	if pkt, err = v.proto.DecodeMessage(m); err != nil {
+		return oe.WithMessage(err, "decode user control")
+	}
+
+	if uc, ok := pkt.(*UserControl); ok && uc.EventType == EventTypePingRequest {
+		res := NewUserControl()
+		res.EventType = EventTypePingResponse
+		res.EventData = uc.EventData
+		if err = v.proto.WritePacket(res, 0); err != nil {
+			return oe.WithMessage(err, "write ping response")
+		}
+	}
+
+	return
+}
+
+// Read the next message from server, return the read error when connection closed.
+func (v *ClientConn) readMessage() (m *Message, err error) {
+	var ok bool
+	if m, ok = <-v.msgs; !ok {
+		if v.err != nil {
+			return nil, v.err
+		}
+		return nil, io.EOF
+	}
+	return
+}
+
+// Expect the command packet, see Protocol.ExpectPacket, while the ppkt is a *CallPacket,
+// it matches any CallPacket such as onStatus.
+func (v *ClientConn) expectPacket(ppkt interface{}) (err error) {
+	for {
+		var m *Message
+		if m, err = v.readMessage(); err != nil {
+			return oe.WithMessage(err, "read message")
+		}
+
+		if m.MessageType != MessageTypeAMF0Command && m.MessageType != MessageTypeAMF3Command {
+			continue
+		}
+
+		var pkt Packet
+		if pkt, err = v.proto.DecodeMessage(m); err != nil {
+			return oe.WithMessage(err, "decode message")
+		}
+
+		switch ppkt := ppkt.(type) {
+		case **ConnectAppResPacket:
+			if p, ok := pkt.(*ConnectAppResPacket); ok {
+				*ppkt = p
+				return
+			}
+		case **CreateStreamResPacket:
+			if p, ok := pkt.(*CreateStreamResPacket); ok {
+				*ppkt = p
+				return
+			}
+		case **CallPacket:
+			if p, ok := pkt.(*CallPacket); ok {
+				*ppkt = p
+				return
+			}
+		default:
+			return oe.Errorf("unsupported %T", ppkt)
+		}
+	}
+}
+
+// Wait for the onStatus with code, return error when the level is error.
+func (v *ClientConn) expectStatus(code string) (err error) {
+	for {
+		var call *CallPacket
+		if err = v.expectPacket(&call); err != nil {
+			return err
+		}
+
+		if call.CommandName != commandOnStatus {
+			continue
+		}
+
+		if args, ok := call.Args.(*amf0.Object); ok {
+			if level, ok := args.Get("level").(*amf0.String); ok && string(*level) == "error" {
+				return oe.Errorf("status %v", statusCode(args))
+			}
+		}
+
+		if statusCode(call.Args) == code {
+			return
+		}
+	}
+}
+
+// Parse the code of status object, empty if not available.
+func statusCode(args amf0.Amf0) string {
+	if args, ok := args.(*amf0.Object); ok {
+		if code, ok := args.Get("code").(*amf0.String); ok {
+			return string(*code)
+		}
+	}
+	return ""
+}
+
+// Start to publish stream, the stream name is parsed from url.
+func (v *ClientConn) Publish(ctx context.Context) (Publisher, error) {
+	if err := v.withContext(ctx, v.publish); err != nil {
+		return nil, err
+	}
+
+	// Drop the messages from server, which is not used by publisher.
+	go func() {
+		for range v.msgs {
+		}
+	}()
+
+	return &publisher{conn: v}, nil
+}
+
+func (v *ClientConn) publish() (err error) {
+	// The FMLE start packets, the response is ignored.
+	for _, name := range []amf0.String{commandReleaseStream, commandFCPublish} {
+		call := NewCallPacket()
+		call.CommandName = name
+		call.TransactionID = v.nextTransactionID()
+		call.CommandObject = amf0.NewNull()
+		call.Args = amf0.NewString(v.Stream)
+		if err = v.proto.WritePacket(call, 0); err != nil {
+			return oe.WithMessage(err, string(name))
+		}
+	}
+
+	publish := NewPublishPacket()
+	publish.StreamName = amf0.String(v.Stream)
+	if err = v.proto.WritePacket(publish, v.StreamID); err != nil {
+		return oe.WithMessage(err, "write publish")
+	}
+
+	if err = v.expectStatus(statusCodePublishStart); err != nil {
+		return oe.WithMessage(err, "expect publish start")
+	}
+
+	return
+}
+
+// Start to play stream, the stream name is parsed from url.
+func (v *ClientConn) Play(ctx context.Context) (Player, error) {
+	if err := v.withContext(ctx, v.play); err != nil {
+		return nil, err
+	}
+
+	return &player{conn: v}, nil
+}
+
+func (v *ClientConn) play() (err error) {
+	bufferLength := NewUserControl()
+	bufferLength.EventType = EventTypeSetBufferLength
+	bufferLength.EventData = int32(v.StreamID)
+	bufferLength.ExtraData = defaultBufferLength
+	if err = v.proto.WritePacket(bufferLength, 0); err != nil {
+		return oe.WithMessage(err, "write buffer length")
+	}
+
+	play := NewPlayPacket()
+	play.StreamName = amf0.String(v.Stream)
+	if err = v.proto.WritePacket(play, v.StreamID); err != nil {
+		return oe.WithMessage(err, "write play")
+	}
+
+	if err = v.expectStatus(statusCodePlayStart); err != nil {
+		return oe.WithMessage(err, "expect play start")
+	}
+
+	return
+}
+
+type publisher struct {
+	conn *ClientConn
+}
+
+func (v *publisher) WriteTag(tagType flv.TagType, timestamp uint32, tag []byte) (err error) {
+	m := NewStreamMessage(v.conn.StreamID)
+	m.Timestamp = uint64(timestamp)
+	m.Payload = tag
+
+	switch tagType {
+	case flv.TagTypeAudio:
+		m.MessageType, m.betterCid = MessageTypeAudio, chunkIDAudio
+	case flv.TagTypeVideo:
+		m.MessageType, m.betterCid = MessageTypeVideo, chunkIDVideo
+	case flv.TagTypeScriptData:
+		m.MessageType = MessageTypeAMF0Data
+	default:
+		return oe.Errorf("invalid tag type %v", tagType)
+	}
+
+	return v.conn.proto.WriteMessage(m)
+}
+
+func (v *publisher) Close() error {
+	// Ignore the error, because we will close the connection.
+	unpublish := NewCallPacket()
+	unpublish.CommandName = commandFCUnpublish
+	unpublish.TransactionID = v.conn.nextTransactionID()
+	unpublish.CommandObject = amf0.NewNull()
+	unpublish.Args = amf0.NewString(v.conn.Stream)
+	if err := v.conn.proto.WritePacket(unpublish, 0); err == nil {
+		v.conn.proto.WritePacket(newDeleteStreamPacket(v.conn.StreamID), 0)
+	}
+
+	return v.conn.Close()
+}
+
+type player struct {
+	conn *ClientConn
+}
+
+func (v *player) ReadTag() (tagType flv.TagType, timestamp uint32, tag []byte, err error) {
+	for {
+		var m *Message
+		if m, err = v.conn.readMessage(); err != nil {
+			return
+		}
+
+		switch m.MessageType {
+		case MessageTypeAudio:
+			return flv.TagTypeAudio, uint32(m.Timestamp), m.Payload, nil
+		case MessageTypeVideo:
+			return flv.TagTypeVideo, uint32(m.Timestamp), m.Payload, nil
+		case MessageTypeAMF0Data, MessageTypeAMF3Data:
+			tag = m.Payload
+			if m.MessageType == MessageTypeAMF3Data && len(tag) > 0 {
+				tag = tag[1:]
+			}
+
+			// Drop the |RtmpSampleAccess, which is not a FLV script tag.
+			var name amf0.String
+			if err = name.UnmarshalBinary(tag); err == nil && name == commandRtmpSampleAccess {
+				continue
+			}
+
+			return flv.TagTypeScriptData, uint32(m.Timestamp), tag, nil
+		case MessageTypeAMF0Command, MessageTypeAMF3Command:
+			var pkt Packet
+			if pkt, err = v.conn.proto.DecodeMessage(m); err != nil {
+				return
+			}
+			if call, ok := pkt.(*CallPacket); ok && call.CommandName == commandOnStatus {
+				if statusCode(call.Args) == statusCodePlayStop {
+					return tagType, timestamp, nil, io.EOF
+				}
+			}
+		}
+	}
+}
+
+func (v *player) Close() error {
+	// Ignore the error, because we will close the connection.
+	v.conn.proto.WritePacket(newDeleteStreamPacket(v.conn.StreamID), 0)
+
+	return v.conn.Close()
+}
+
+// The deleteStream packet, to delete the stream by streamID.
+func newDeleteStreamPacket(streamID int) *CallPacket {
+	v := NewCallPacket()
+	v.CommandName = commandDeleteStream
+	v.CommandObject = amf0.NewNull()
+	v.Args = amf0.NewNumber(float64(streamID))
+	return v
+}
@@ -0,0 +1,269 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/https/net/context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHostWithPort(t *testing.T) {
+	for _, e := range []struct {
+		host, expect string
+	}{
+		{"localhost", "localhost:1935"},
+		{"localhost:19350", "localhost:19350"},
+		{"127.0.0.1", "127.0.0.1:1935"},
+		{"[::1]", "[::1]:1935"},
+		{"[::1]:19350", "[::1]:19350"},
+	} {
+		if v := hostWithPort(e.host); v != e.expect {
+			t.Errorf("invalid host %v of %v, expect %v", v, e.host, e.expect)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	for _, e := range []struct {
+		url, tcUrl, app, stream string
+	}{
+		{"rtmp://localhost/live/livestream", "rtmp://localhost/live", "live", "livestream"},
+		{"rtmp://localhost:19350/live/livestream", "rtmp://localhost:19350/live", "live", "livestream"},
+		{"rtmp://localhost/live/livestream?token=xxx", "rtmp://localhost/live", "live", "livestream?token=xxx"},
+		{"rtmp://localhost/a/b/livestream/", "rtmp://localhost/a/b", "a/b", "livestream"},
+	} {
+		tcUrl, app, stream, err := parseURL(e.url)
+		if err != nil {
+			t.Errorf("parse %v failed %+v", e.url, err)
+		} else if tcUrl != e.tcUrl || app != e.app || stream != e.stream {
+			t.Errorf("parse %v got %v, %v, %v", e.url, tcUrl, app, stream)
+		}
+	}
+
+	for _, u := range []string{"http://localhost/live/livestream", "rtmp://localhost/livestream", "rtmp://localhost/live/"} {
+		if _, _, _, err := parseURL(u); err == nil {
+			t.Errorf("parse %v should fail", u)
+		}
+	}
+}
+
+func startServer(t *testing.T, s net.Conn) (*ServerConn, <-chan Session) {
+	sc := NewServerConn(s)
+	sessions := make(chan Session, 1)
+	go func() {
+		sess, err := sc.Accept()
+		if err != nil {
+			t.Errorf("accept failed %+v", err)
+		}
+		sessions <- sess
+	}()
+	return sc, sessions
+}
+
+func TestClientConn_Publish(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	sc, sessions := startServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	client, err := NewClientConn(ctx, c, "rtmp://localhost/live/livestream?token=xxx")
+	if err != nil {
+		t.Fatalf("connect failed %+v", err)
+	}
+	if client.StreamID != defaultStreamID {
+		t.Errorf("invalid stream id %v", client.StreamID)
+	}
+
+	pub, err := client.Publish(ctx)
+	if err != nil {
+		t.Fatalf("publish failed %+v", err)
+	}
+
+	ps, ok := (<-sessions).(*PublishSession)
+	if !ok {
+		t.Fatal("should be publish session")
+	}
+	if sc.TcURL != "rtmp://localhost/live" || sc.App != "live" {
+		t.Errorf("invalid tcUrl=%v, app=%v", sc.TcURL, sc.App)
+	}
+	if ps.StreamName() != "livestream?token=xxx" {
+		t.Errorf("invalid stream %v", ps.StreamName())
+	}
+
+	video := bytes.Repeat([]byte{0x17, 0x01}, 200)
+	if err = pub.WriteTag(flv.TagTypeVideo, 40, video); err != nil {
+		t.Fatalf("write video failed %+v", err)
+	}
+	if err = pub.WriteTag(flv.TagTypeAudio, 41, []byte{0xaf, 0x01, 0x02}); err != nil {
+		t.Fatalf("write audio failed %+v", err)
+	}
+	if err = pub.WriteTag(flv.TagTypeForbidden, 42, nil); err == nil {
+		t.Error("should fail for invalid tag")
+	}
+
+	if m := <-ps.Messages; m.Timestamp != 40 || !bytes.Equal(m.Payload, video) {
+		t.Errorf("invalid video %v %vB", m.Timestamp, len(m.Payload))
+	}
+	if m := <-ps.Messages; m.Timestamp != 41 || !bytes.Equal(m.Payload, []byte{0xaf, 0x01, 0x02}) {
+		t.Errorf("invalid audio %v %v", m.Timestamp, m.Payload)
+	}
+
+	if err = pub.Close(); err != nil {
+		t.Errorf("close failed %+v", err)
+	}
+	for range ps.Messages {
+	}
+	if ps.Err() != io.EOF {
+		t.Errorf("invalid err %+v", ps.Err())
+	}
+}
+
+func TestClientConn_PublishNotConsumed(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	_, sessions := startServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	client, err := NewClientConn(ctx, c, "rtmp://localhost/live/livestream")
+	if err != nil {
+		t.Fatalf("connect failed %+v", err)
+	}
+
+	pub, err := client.Publish(ctx)
+	if err != nil {
+		t.Fatalf("publish failed %+v", err)
+	}
+	ps := (<-sessions).(*PublishSession)
+
+	// Publish more messages than the channel, which are not consumed.
+	go func() {
+		for i := 0; i < 2*sessionChannelSize; i++ {
+			if err := pub.WriteTag(flv.TagTypeAudio, uint32(i), []byte{0xaf, 0x01}); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The session should quit when closed, even the messages are not consumed.
+	for len(ps.Messages) < sessionChannelSize {
+		time.Sleep(time.Millisecond)
+	}
+	ps.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	var n int
+	for range ps.Messages {
+		n++
+	}
+	if n != sessionChannelSize || ps.Err() != io.EOF {
+		t.Errorf("invalid messages %v, err %+v", n, ps.Err())
+	}
+}
+
+func TestClientConn_Play(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	_, sessions := startServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	client, err := NewClientConn(ctx, c, "rtmp://localhost/live/livestream")
+	if err != nil {
+		t.Fatalf("connect failed %+v", err)
+	}
+
+	play, err := client.Play(ctx)
+	if err != nil {
+		t.Fatalf("play failed %+v", err)
+	}
+
+	ps, ok := (<-sessions).(*PlaySession)
+	if !ok {
+		t.Fatal("should be play session")
+	}
+
+	for _, mt := range []MessageType{MessageTypeAMF0Data, MessageTypeVideo, MessageTypeAudio} {
+		m := NewMessage()
+		m.MessageType = mt
+		m.Timestamp = 80
+		m.Payload = []byte{0x02, 0x00, 0x01, 'a'}
+		ps.Messages <- m
+
+		// The |RtmpSampleAccess is dropped, so the first tag is script data.
+		tagType, timestamp, tag, err := play.ReadTag()
+		if err != nil {
+			t.Fatalf("read tag failed %+v", err)
+		}
+		if tagType != tagTypeOf(mt) || timestamp != 80 || !bytes.Equal(tag, m.Payload) {
+			t.Errorf("invalid tag %v %v %v", tagType, timestamp, tag)
+		}
+	}
+
+	if err = play.Close(); err != nil {
+		t.Errorf("close failed %+v", err)
+	}
+	<-ps.Done()
+	if ps.Err() != io.EOF {
+		t.Errorf("invalid err %+v", ps.Err())
+	}
+}
+
+func tagTypeOf(mt MessageType) flv.TagType {
+	switch mt {
+	case MessageTypeAudio:
+		return flv.TagTypeAudio
+	case MessageTypeVideo:
+		return flv.TagTypeVideo
+	default:
+		return flv.TagTypeScriptData
+	}
+}
+
+func TestClientConn_Timeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	// The server never response.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := NewClientConn(ctx, c, "rtmp://localhost/live/livestream"); err != context.DeadlineExceeded {
+		t.Errorf("invalid err %+v", err)
+	}
+}
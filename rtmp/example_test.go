@@ -28,6 +28,7 @@ import (
 
 	"github.com/ossrs/go-oryx-lib/rtmp"
 	"github.com/ossrs/go-oryx-lib/amf0"
+	"github.com/ossrs/go-oryx-lib/https/net/context"
 )
 
 func ExampleRtmpClientHandshake() {
@@ -86,3 +87,31 @@ func ExampleRtmpClientConnect() {
 		panic(err)
 	}
 }
+
+func ExampleDial() {
+	// Dial to RTMP server, the ctx is used to cancel the dial, handshake and connect.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	client, err := rtmp.Dial(ctx, "rtmp://localhost/live/livestream")
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	// Start to play the stream, use client.Publish to publish stream.
+	player, err := client.Play(ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer player.Close()
+
+	for {
+		// Read the FLV tags from RTMP server, write to FLV muxer for example.
+		tagType, timestamp, tag, err := player.ReadTag()
+		if err != nil {
+			panic(err)
+		}
+		_, _, _ = tagType, timestamp, tag
+	}
+}
@@ -0,0 +1,330 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"math/big"
+	"math/rand"
+	"time"
+)
+
+// The size of c1s1 and c2s2 of RTMP handshake.
+const handshakeSize = 1536
+
+// The size of key and digest block in complex c1s1.
+const (
+	handshakeBlockSize  = 764
+	handshakeKeySize    = 128
+	handshakeDigestSize = 32
+)
+
+// The version in c1s1, Flash Player checks it to determine whether complex handshake.
+const (
+	handshakeClientVersion = uint32(0x80000702)
+	handshakeServerVersion = uint32(0x01000504)
+)
+
+// The key of FMS(Flash Media Server) to calculate the digest of s1 and s2,
+// the first 36 bytes is "Genuine Adobe Flash Media Server 001".
+var genuineFMSKey = []byte{
+	0x47, 0x65, 0x6e, 0x75, 0x69, 0x6e, 0x65, 0x20,
+	0x41, 0x64, 0x6f, 0x62, 0x65, 0x20, 0x46, 0x6c,
+	0x61, 0x73, 0x68, 0x20, 0x4d, 0x65, 0x64, 0x69,
+	0x61, 0x20, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72,
+	0x20, 0x30, 0x30, 0x31, // Genuine Adobe Flash Media Server 001
+	0xf0, 0xee, 0xc2, 0x4a, 0x80, 0x68, 0xbe, 0xe8,
+	0x2e, 0x00, 0xd0, 0xd1, 0x02, 0x9e, 0x7e, 0x57,
+	0x6e, 0xec, 0x5d, 0x2d, 0x29, 0x80, 0x6f, 0xab,
+	0x93, 0xb8, 0xe6, 0x36, 0xcf, 0xeb, 0x31, 0xae,
+} // 68
+
+// The key of FP(Flash Player) to calculate the digest of c1 and c2,
+// the first 30 bytes is "Genuine Adobe Flash Player 001".
+var genuineFPKey = []byte{
+	0x47, 0x65, 0x6E, 0x75, 0x69, 0x6E, 0x65, 0x20,
+	0x41, 0x64, 0x6F, 0x62, 0x65, 0x20, 0x46, 0x6C,
+	0x61, 0x73, 0x68, 0x20, 0x50, 0x6C, 0x61, 0x79,
+	0x65, 0x72, 0x20, 0x30, 0x30, 0x31, // Genuine Adobe Flash Player 001
+	0xF0, 0xEE, 0xC2, 0x4A, 0x80, 0x68, 0xBE, 0xE8,
+	0x2E, 0x00, 0xD0, 0xD1, 0x02, 0x9E, 0x7E, 0x57,
+	0x6E, 0xEC, 0x5D, 0x2D, 0x29, 0x80, 0x6F, 0xAB,
+	0x93, 0xB8, 0xE6, 0x36, 0xCF, 0xEB, 0x31, 0xAE,
+} // 62
+
+// The 1024 bits MODP group prime of RFC2409, generator is 2,
+// used to generate the DH public key in key block of c1s1.
+var handshakeDHPrime, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245"+
+		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381"+
+		"FFFFFFFFFFFFFFFF", 16)
+
+// The schema of complex handshake c1s1, which determines the order of key and digest block.
+// @see https://github.com/ossrs/srs/wiki/v1_CN_RTMPHandshake
+type handshakeSchema uint8
+
+const (
+	// The c1s1 is time(4B), version(4B), key(764B), digest(764B).
+	handshakeSchema0 handshakeSchema = iota
+	// The c1s1 is time(4B), version(4B), digest(764B), key(764B).
+	handshakeSchema1
+)
+
+// The position of digest in c1s1, the digest block is:
+//
+//	offset: 4bytes
+//	random-data: (offset)bytes
+//	digest-data: 32bytes
+//	random-data: (764-4-offset-32)bytes
+//
+// where the offset is the sum of 4 bytes, modulo 728.
+func (v handshakeSchema) digestPosition(c1s1 []byte) int {
+	base := 8
+	if v == handshakeSchema0 {
+		base += handshakeBlockSize
+	}
+
+	p := c1s1[base:]
+	offset := int(p[0]) + int(p[1]) + int(p[2]) + int(p[3])
+	offset %= handshakeBlockSize - handshakeDigestSize - 4
+
+	return base + 4 + offset
+}
+
+// The position of key in c1s1, the key block is:
+//
+//	random-data: (offset)bytes
+//	key-data: 128bytes
+//	random-data: (764-offset-128-4)bytes
+//	offset: 4bytes
+//
+// where the offset is the sum of 4 bytes, modulo 632.
+func (v handshakeSchema) keyPosition(c1s1 []byte) int {
+	base := 8
+	if v == handshakeSchema1 {
+		base += handshakeBlockSize
+	}
+
+	p := c1s1[base+handshakeBlockSize-4:]
+	offset := int(p[0]) + int(p[1]) + int(p[2]) + int(p[3])
+	offset %= handshakeBlockSize - handshakeKeySize - 4
+
+	return base + offset
+}
+
+// Calculate the digest of c1s1 by key, the 32bytes digest-data is excluded.
+func (v handshakeSchema) digest(c1s1, key []byte) []byte {
+	pos := v.digestPosition(c1s1)
+
+	h := hmac.New(sha256.New, key)
+	h.Write(c1s1[:pos])
+	h.Write(c1s1[pos+handshakeDigestSize:])
+	return h.Sum(nil)
+}
+
+// Validate the digest of c1s1 by key in both schemas,
+// return the schema and digest when matched.
+func validateC1S1(c1s1, key []byte) (schema handshakeSchema, digest []byte, ok bool) {
+	if len(c1s1) != handshakeSize {
+		return
+	}
+
+	for _, schema = range []handshakeSchema{handshakeSchema0, handshakeSchema1} {
+		pos := schema.digestPosition(c1s1)
+		if digest = schema.digest(c1s1, key); hmac.Equal(digest, c1s1[pos:pos+handshakeDigestSize]) {
+			return schema, digest, true
+		}
+	}
+
+	return handshakeSchema0, nil, false
+}
+
+// Create the complex c1s1 in schema, sign the digest by key.
+func createC1S1(r *rand.Rand, schema handshakeSchema, version uint32, key []byte) []byte {
+	p := make([]byte, handshakeSize)
+	for i := 8; i < len(p); i++ {
+		p[i] = byte(r.Int())
+	}
+
+	binary.BigEndian.PutUint32(p, uint32(time.Now().Unix()))
+	binary.BigEndian.PutUint32(p[4:], version)
+
+	pos := schema.keyPosition(p)
+	copy(p[pos:pos+handshakeKeySize], createDHPublicKey(r))
+
+	pos = schema.digestPosition(p)
+	copy(p[pos:pos+handshakeDigestSize], schema.digest(p, key))
+
+	return p
+}
+
+// Generate the 128bytes DH public key, that is 2^x mod p.
+// @remark The shared key is only used by RTMPE, so we never keep the private key.
+func createDHPublicKey(r *rand.Rand) []byte {
+	x := make([]byte, handshakeKeySize)
+	for i := range x {
+		x[i] = byte(r.Int())
+	}
+
+	y := new(big.Int).Exp(big.NewInt(2), new(big.Int).SetBytes(x), handshakeDHPrime).Bytes()
+
+	p := make([]byte, handshakeKeySize)
+	copy(p[handshakeKeySize-len(y):], y)
+	return p
+}
+
+// Calculate the digest of c2s2, the key is generated by the peer's c1s1 digest.
+//
+//	random-data: 1504bytes
+//	digest-data: 32bytes
+func c2s2Digest(c2s2, key, c1s1Digest []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(c1s1Digest)
+	tempKey := h.Sum(nil)
+
+	h = hmac.New(sha256.New, tempKey)
+	h.Write(c2s2[:handshakeSize-handshakeDigestSize])
+	return h.Sum(nil)
+}
+
+// Validate the c2s2 against the peer's c1s1 digest.
+func validateC2S2(c2s2, key, c1s1Digest []byte) bool {
+	if len(c2s2) != handshakeSize {
+		return false
+	}
+
+	digest := c2s2Digest(c2s2, key, c1s1Digest)
+	return hmac.Equal(digest, c2s2[handshakeSize-handshakeDigestSize:])
+}
+
+// Create the complex c2s2 for the peer's c1s1 digest.
+func createC2S2(r *rand.Rand, key, c1s1Digest []byte) []byte {
+	p := make([]byte, handshakeSize)
+	for i := 0; i < len(p); i++ {
+		p[i] = byte(r.Int())
+	}
+
+	copy(p[handshakeSize-handshakeDigestSize:], c2s2Digest(p, key, c1s1Digest))
+
+	return p
+}
+
+// The complex handshake, which uses HMAC-SHA256 digest and key blocks, is required by Flash Player
+// to play H.264/AAC stream, and by some encoders to publish stream.
+// It falls back to the simple handshake when the peer does not send a valid complex c1s1.
+// @see https://github.com/ossrs/srs/wiki/v1_CN_RTMPHandshake
+type ComplexHandshake struct {
+	Handshake
+	// Whether fallback to simple handshake, when the digest of c1 or s1 is invalid.
+	Simple bool
+}
+
+func NewComplexHandshake(r *rand.Rand) *ComplexHandshake {
+	return &ComplexHandshake{Handshake: Handshake{r: r}}
+}
+
+// Do the handshake as a server, read c0c1, write s0s1s2, then read c2.
+// @remark The c2 is not validated, because some clients never sign it.
+func (v *ComplexHandshake) ServerHandshake(rw io.ReadWriter) (err error) {
+	if _, err = v.ReadC0S0(rw); err != nil {
+		return oe.WithMessage(err, "read c0")
+	}
+
+	var c1 []byte
+	if c1, err = v.ReadC1S1(rw); err != nil {
+		return oe.WithMessage(err, "read c1")
+	}
+
+	schema, c1Digest, ok := validateC1S1(c1, genuineFPKey[:30])
+	if v.Simple = !ok; v.Simple {
+		if err = v.WriteC0S0(rw); err != nil {
+			return oe.WithMessage(err, "write s0")
+		}
+		if err = v.WriteC1S1(rw); err != nil {
+			return oe.WithMessage(err, "write s1")
+		}
+		if err = v.WriteC2S2(rw, c1); err != nil {
+			return oe.WithMessage(err, "write s2")
+		}
+	} else {
+		s1 := createC1S1(v.r, schema, handshakeServerVersion, genuineFMSKey[:36])
+		s2 := createC2S2(v.r, genuineFMSKey, c1Digest)
+
+		r := bytes.NewReader(append(append([]byte{0x03}, s1...), s2...))
+		if _, err = io.Copy(rw, r); err != nil {
+			return oe.Wrap(err, "write s0s1s2")
+		}
+	}
+
+	if _, err = v.ReadC2S2(rw); err != nil {
+		return oe.WithMessage(err, "read c2")
+	}
+
+	return
+}
+
+// Do the handshake as a client, write c0c1, read s0s1s2, then write c2.
+// @remark The s2 is not validated like librtmp, because some servers sign the s1 but never
+// sign the s2, for example, echo the c1 as s2.
+func (v *ComplexHandshake) ClientHandshake(rw io.ReadWriter) (err error) {
+	c1 := createC1S1(v.r, handshakeSchema1, handshakeClientVersion, genuineFPKey[:30])
+
+	r := bytes.NewReader(append([]byte{0x03}, c1...))
+	if _, err = io.Copy(rw, r); err != nil {
+		return oe.Wrap(err, "write c0c1")
+	}
+
+	if _, err = v.ReadC0S0(rw); err != nil {
+		return oe.WithMessage(err, "read s0")
+	}
+
+	var s1 []byte
+	if s1, err = v.ReadC1S1(rw); err != nil {
+		return oe.WithMessage(err, "read s1")
+	}
+	if _, err = v.ReadC2S2(rw); err != nil {
+		return oe.WithMessage(err, "read s2")
+	}
+
+	_, s1Digest, ok := validateC1S1(s1, genuineFMSKey[:36])
+	if v.Simple = !ok; v.Simple {
+		if err = v.WriteC2S2(rw, s1); err != nil {
+			return oe.WithMessage(err, "write c2")
+		}
+		return
+	}
+
+	c2 := createC2S2(v.r, genuineFPKey, s1Digest)
+	if err = v.WriteC2S2(rw, c2); err != nil {
+		return oe.WithMessage(err, "write c2")
+	}
+
+	return
+}
@@ -0,0 +1,498 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// The handshake captured from librtmp 2.4 of rtmpdump, with swfVfy to use the complex handshake.
+// The c0c1 is sent by the client, version 10.0.45.2, the digest is at 430 in schema1.
+// The s0s1s2 is the response of the server for the c0c1, the digest of s1 is at 580 in schema1.
+var (
+	librtmpC0C1 = mustDecodeHex(
+		"030097efb00a002d0267458b6bc6237b3269983c647348336651dcb074ff5c49194a94e82aec585562291f8e23cd7ce8" +
+			"46ba581b3dabd77e50f241b12efb1eb741e3a9e27946e145757c005f51c262d05b54082012f827b14d1b231602e8e916" +
+			"1fe7cd90118d43ef66760f0e145a2552332ef99c106372ed0d33c2dc7f9fd7ef1bc9c4a7419a07686b66fb6a4e325de4" +
+			"250d509b51b7d71b4331ba2d3f58e4837ca33071255ad9bb6225616c435d898c6205b13a3317a31d7258a84324e95a1d" +
+			"2d5e846367d4a8a275abbded08b28c8379cdd05343c6e0030b9b769a18b49ee4545424f3711186a82c0ec43608821d90" +
+			"0274f8953a4186130821f57f1e3dbd3d7cdc8d7b7387f0ea6c701a2222e9dd16453ec80630a1d44f6141c29a41e1f877" +
+			"55fcad0b44672307053e820438015f46777ec62477972a485ceab96324dc4a885e6bd3ea519677512d8fd70b5838a43e" +
+			"155c5855382a4ea670ec42236ab07c482a3bd44e1dfb065a72329ad82cafcce4573c8d6d7a548f584bec892254181be9" +
+			"6ddb7f43385ca4447602f9ff321a484a68fe78945743bb9a74fb40c23dfa26a01baadea1793ac3c675fb85e61229a552" +
+			"e443d17683a7f87665147cd546fb18917bde790592c16a166490817b2f4a82f11cbe15011861a85b23898c3947f9e94f" +
+			"355cafb515bb261274a8b6340d993c23100fb66a3f95405761b1570c7eeb35ae77f1e49b57b3500c31057ef85fef5d30" +
+			"2ff70ba72500bfba1de984d04aa1ea481f3a828113e50ab75dca8f0f100b709065cb4a0115d07f5e5f48318a0947029d" +
+			"796447b906bd96c2421f128e16235dba1e1e3f1e66a89ec75d1c470a547beed37b64c5d951c5fd3e61142bf70b737b44" +
+			"115a3e9642c582030a5eb1f2084b23321a79d30f3b632feb683b81624970dfb66064eea5062406331411caff7f9e7027" +
+			"1a0911ea71dc590f10aae0b77fd45beb06acd96d6ff21142091b5e880010212776afa8044c3b701617337ee114cde722" +
+			"32e30ede7450c5eb6848d6f62d47d4b74615c32a4a5c01ee39bb4ffc576f01c10c2284f1431901ef60ba24f3269b5701" +
+			"7f7d30da49f5a555700b37b85fe11e80501aac88041c01b85f7f8fa76a23bd7276f85ac76f29705f6af8185e7da43435" +
+			"5f1b82a1731377e67db5555c55ca2aa63f4ee7fc14e8d33d6a9812c97132f6da0938992953e0e8bf1f79ca92504d5c54" +
+			"1d3deaad59341a8f28bc5d152a5f6e9f1d4e1b7e0977820851fac5a01ccb4b58536c285e4105fd587cac6ad82386d4e6" +
+			"4521fe105c2bfa7f0eaa91593c1a59d84b556adf78a2aab739be8d0d2b70ec806cb5219e3773e369003b17272c04099b" +
+			"4c5cb7a76ad329f01d36ff75569450d13db312b03dafc90827e2ac255bf0fc5d17e4e3974f9e0a3b054f6bfd3432ff15" +
+			"59158d435649319e51fd4a6e2c82b5a1174e2ef74da9b54650088a885d702c082ad4afc65eb21be2198a85e075291aa6" +
+			"5754c699534813ee209a0627440ae8370bbcf65721d51d4e700ef1d25718aeff0ba8473e0e44f0482eacfed0495b5aee" +
+			"4bf3b951558eabf6244c574c63d79de9242db6312a9bc24918099dff7d42437500e5f3e76906e86d2ac4f816183322df" +
+			"37af9db47acd829f75a34ee761844d7b597f9e810f2dd4c757ad672131d4641b6376e7b578476e4875de4c536e32de0d" +
+			"1a1c8c9665ec3d26464a8c0d26c4d3d473302e6f74f68ade6f202ec33f23e8c0498536d5146c850f23fb85aa6eb2ec06" +
+			"3f0748593b0423aa6cf42f7c3fec3b41250b0b1817b9289357205e205dbaa8cc1186ab324dc3ac073f3ef6476b054ab4" +
+			"5cf180cf16ec5d691cd9aecf3f6768850f33ccb111b7fb222e9946932950584877a3394974e3d2a04f142c1d6bd367b8" +
+			"68d95d7f3f345ae02af74f79325e945454a0dfef4df2d5232110815b13a8274909f6f8cd0d05b1d75294638a2e0104e6" +
+			"24bed96a2ab4c1aa0bbcacb23644859d77786eb24afaa2fa2149cf515469ef8161e600643e237e2114d05707711acd15" +
+			"50da794442699e9a1a6a255e477eb38d364c713b6a7e517b32511b461f25cfba29b3ab5b5d486bbf5184630f7e538b4b" +
+			"2b3a41e37294e46a11fbb29434313ab1009995426490161f63323e9725576fad0e44d8c96eeeea495c9bf44a06bc467c" +
+			"39")
+
+	librtmpS0S1S2 = mustDecodeHex(
+		"030097efb003050101e98d447ee5c39c5a2536fe1acf8ea83c0842be6ef58d050ce95bbe0ce2bb02315e2ca02653811c" +
+			"54606f9067aa9ddb10d2d29706b28ad606d06c963a857ef363faf5955854d0a538d8093f0f3537794be8b4104ad4bcd3" +
+			"4366712a4c824a532e64d3f22698afc171d9b9003da8abbc15879a0b4e75ae4b4365f2384f7028504c5a72e81d8a2837" +
+			"6a3fb7f80862b4a60c80b63c762913b7154470a93ddee2dc1c7c94d369a5df39258980b82d4e676b70576a102c59ed4e" +
+			"68d3e55e545160a604adbdf420acef9d6386971f509572056b80ac7127ec084a1c17bd5819e47f644e85b80b0ef17659" +
+			"568c2b21640c53175c6625a519f11d5a337c7b6728c0978d377c46911dbb326031224c3444fcfccd13e445174766bcdd" +
+			"01dadfaa3061daea300b9c17276360635eaf41562162062853bc4db2468327b575b466ce57690ba7672f1753593afeed" +
+			"27ff7dac52afc3c40027073844163b056c9343294facbf435207b25e421f6f4a33b8125b2e6dd7035c118da466348ec2" +
+			"562d6f91138dd33504efc022084fbbc55789d00318d4063a4fb677a35963b0ae4835e12400c113bb00c7101227e4227b" +
+			"21241ae353835ec46d674a3017d880b12bed696b5596618370127f9f53ece71728452548713986d71702231d14d86871" +
+			"40e5451b6a0ad57b56f8d7bb739d58761877ac7f320965605ad1e6386fa51b11469638965ec1a75b77f4d6d61d1f099a" +
+			"7695ae9546aa4e7a7782b9483fca8fba466c62357849ca5a66aeb23568907c184ccd281f5416fd657f68fdc977ba928a" +
+			"29ac5ee96fde8355bcd780ccef67700284b43b04f9fe8db1d79711ae8b5915b80f42cb5cc9c2c45e1537a1d2652a1fbb" +
+			"6ecb29bf6f08880b55cf3acc346162554ec92f674cc311a352806bef445edefc126e601d4a03253804286eb759dac252" +
+			"424cef926ad720ed416a3f6b0e1918b23eed1d5341d23c3506d3aa3c68997c3c314cb99e517925df398b006e1200bcdf" +
+			"3422c39e1f56ed10349a043c02d435da5b18b26f49d1a50e68fe54954ae4db2e39d92d1a3dcd8f617f453e8407a35d81" +
+			"0991a10452c6a9734c013c7e1cff01221cc9ceab502aaa3576d9c4745e15be3e3b01cb22384304e06c2fd6f079eee875" +
+			"791541157302812d628765b22a61fab3447ca60c1c1366203d62b693799e69ab3b69533171fcbacf7b729f85178105a1" +
+			"3acd60de6371f41a6265e1cf73a68ef8203e847c61ab1f547b49ec792acf25813371c9c7474b28f846ce27a34f3a9873" +
+			"1875d22d3da7ec172e4f56b253769d5075eaf0f71a7e2ca34d6486c66eff310d0e81add02febeb7819612cc152fd53dd" +
+			"4bfe519956c3e2544c9bbd880767a5ca47bf9d24480d5d0e1fe9aa6b028cfe022c7e5129014e8c3b76328dfb4cbdd5a5" +
+			"62f9ab8f717c7975778cfb26166a755739c7a16d3e5b23ca65a40dcb513c749b7b0210e213f4637d25b211ec70ed00da" +
+			"2e729020731698b25fec32e73cf33df12201842b794d5fa80ff091ce6e00d6c44f1042fd5b8b4f5776677b8f17cfdf21" +
+			"2499ac65155026fb195bde245017fe8e169fb236108e6b201dd4d33479985ec6010ae5951461cf5b0f03d41d3bd18603" +
+			"53bcf22575a7e1e80c0dfb9e4ebe0208099b456632bf0c8b3fab03e2370ed68625d5a43d1f9836c97401147848d62869" +
+			"18e5957104f2a54637d6fe2d68f6d76e607df59d2d3e7abd7fc5b7900416a203438ea0b8192196b5542ea092592d53ef" +
+			"29af01d6710274c752c6b1b52bb9e66b0663432362c985d3668a6d6f591f3649577067bc7397680e28de3851600cad22" +
+			"2656759967893c33181a83a94b2b1ad7062173fc0c1b9721140143401f07096e110d3d684bd8416e07fde0dc718b3206" +
+			"7916bc2b07c2986d76a1d4093ca45ce420e32e234bcf749c15d2afd34a9230f93cd2e86368986189764b176543352c87" +
+			"4a61e75c5dd584d41c5562d021d14e19516cede244339b2102ddfb3b77c2627c2cbcd7541af77ee542ed7c5333de4a51" +
+			"2713160757efbf9352e553bf3820536f22c701025ae2349c2aab85751bddbd2d61a4cd09214d5a7f57811a120288fc2c" +
+			"6c1ccf1b6d53cae54c1a2d2629eeb77f55eb2b6f4366448b6c24e406204c13cc203bc95f097946d7411e62e571a8b642" +
+			"4e0097efb00a002d0267458b6bc6237b3269983c647348336651dcb074ff5c49194a94e82aec585562291f8e23cd7ce8" +
+			"46ba581b3dabd77e50f241b12efb1eb741e3a9e27946e145757c005f51c262d05b54082012f827b14d1b231602e8e916" +
+			"1fe7cd90118d43ef66760f0e145a2552332ef99c106372ed0d33c2dc7f9fd7ef1bc9c4a7419a07686b66fb6a4e325de4" +
+			"250d509b51b7d71b4331ba2d3f58e4837ca33071255ad9bb6225616c435d898c6205b13a3317a31d7258a84324e95a1d" +
+			"2d5e846367d4a8a275abbded08b28c8379cdd05343c6e0030b9b769a18b49ee4545424f3711186a82c0ec43608821d90" +
+			"0274f8953a4186130821f57f1e3dbd3d7cdc8d7b7387f0ea6c701a2222e9dd16453ec80630a1d44f6141c29a41e1f877" +
+			"55fcad0b44672307053e820438015f46777ec62477972a485ceab96324dc4a885e6bd3ea519677512d8fd70b5838a43e" +
+			"155c5855382a4ea670ec42236ab07c482a3bd44e1dfb065a72329ad82cafcce4573c8d6d7a548f584bec892254181be9" +
+			"6ddb7f43385ca4447602f9ff321a484a68fe78945743bb9a74fb40c23dfa26a01baadea1793ac3c675fb85e61229a552" +
+			"e443d17683a7f87665147cd546fb18917bde790592c16a166490817b2f4a82f11cbe15011861a85b23898c3947f9e94f" +
+			"355cafb515bb261274a8b6340d993c23100fb66a3f95405761b1570c7eeb35ae77f1e49b57b3500c31057ef85fef5d30" +
+			"2ff70ba72500bfba1de984d04aa1ea481f3a828113e50ab75dca8f0f100b709065cb4a0115d07f5e5f48318a0947029d" +
+			"796447b906bd96c2421f128e16235dba1e1e3f1e66a89ec75d1c470a547beed37b64c5d951c5fd3e61142bf70b737b44" +
+			"115a3e9642c582030a5eb1f2084b23321a79d30f3b632feb683b81624970dfb66064eea5062406331411caff7f9e7027" +
+			"1a0911ea71dc590f10aae0b77fd45beb06acd96d6ff21142091b5e880010212776afa8044c3b701617337ee114cde722" +
+			"32e30ede7450c5eb6848d6f62d47d4b74615c32a4a5c01ee39bb4ffc576f01c10c2284f1431901ef60ba24f3269b5701" +
+			"7f7d30da49f5a555700b37b85fe11e80501aac88041c01b85f7f8fa76a23bd7276f85ac76f29705f6af8185e7da43435" +
+			"5f1b82a1731377e67db5555c55ca2aa63f4ee7fc14e8d33d6a9812c97132f6da0938992953e0e8bf1f79ca92504d5c54" +
+			"1d3deaad59341a8f28bc5d152a5f6e9f1d4e1b7e0977820851fac5a01ccb4b58536c285e4105fd587cac6ad82386d4e6" +
+			"4521fe105c2bfa7f0eaa91593c1a59d84b556adf78a2aab739be8d0d2b70ec806cb5219e3773e369003b17272c04099b" +
+			"4c5cb7a76ad329f01d36ff75569450d13db312b03dafc90827e2ac255bf0fc5d17e4e3974f9e0a3b054f6bfd3432ff15" +
+			"59158d435649319e51fd4a6e2c82b5a1174e2ef74da9b54650088a885d702c082ad4afc65eb21be2198a85e075291aa6" +
+			"5754c699534813ee209a0627440ae8370bbcf65721d51d4e700ef1d25718aeff0ba8473e0e44f0482eacfed0495b5aee" +
+			"4bf3b951558eabf6244c574c63d79de9242db6312a9bc24918099dff7d42437500e5f3e76906e86d2ac4f816183322df" +
+			"37af9db47acd829f75a34ee761844d7b597f9e810f2dd4c757ad672131d4641b6376e7b578476e4875de4c536e32de0d" +
+			"1a1c8c9665ec3d26464a8c0d26c4d3d473302e6f74f68ade6f202ec33f23e8c0498536d5146c850f23fb85aa6eb2ec06" +
+			"3f0748593b0423aa6cf42f7c3fec3b41250b0b1817b9289357205e205dbaa8cc1186ab324dc3ac073f3ef6476b054ab4" +
+			"5cf180cf16ec5d691cd9aecf3f6768850f33ccb111b7fb222e9946932950584877a3394974e3d2a04f142c1d6bd367b8" +
+			"68d95d7f3f345ae02af74f79325e945454a0dfef4df2d5232110815b13a8274909f6f8cd0d05b1d75294638a2e0104e6" +
+			"24bed96a2ab4c1aa0bbcacb23644859d77786eb24afaa2fa2149cf515469ef8161e600643e237e2114d05707711acd15" +
+			"50da794442699e9a1a6a255e477eb38d364c713b6a7e517b32511b461f25cfba29b3ab5b5d486bbf5184630f7e538b4b" +
+			"2b3a41e37294e46a11fbb29434313ab1008f4f557f8051b8eb472e91fcdc88ecaf1c27ed9e9fb7b10981bb21575b247d" +
+			"b7")
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The peer which replays the captured bytes, and records the bytes written.
+type mockHandshakePeer struct {
+	io.Reader
+	bytes.Buffer
+}
+
+func (v *mockHandshakePeer) Read(p []byte) (int, error) {
+	return v.Reader.Read(p)
+}
+
+// Build a c1 like the Flash Player, in schema1 with fixed offsets:
+//
+//	time=0, version=0x80000702,
+//	digest offset bytes 0x00000010, so digest at 8+4+16=28,
+//	key offset bytes 0x00000020, so key at 8+764+32=804.
+func mockFlashPlayerC1() []byte {
+	p := make([]byte, handshakeSize)
+	for i := 8; i < len(p); i++ {
+		p[i] = byte(i * 7)
+	}
+	copy(p[4:], []byte{0x80, 0x00, 0x07, 0x02})
+	copy(p[8:], []byte{0x00, 0x00, 0x00, 0x10})
+	copy(p[8+handshakeBlockSize*2-4:], []byte{0x00, 0x00, 0x00, 0x20})
+
+	h := hmac.New(sha256.New, genuineFPKey[:30])
+	h.Write(p[:28])
+	h.Write(p[28+32:])
+	copy(p[28:], h.Sum(nil))
+
+	return p
+}
+
+func TestHandshakeSchema_Position(t *testing.T) {
+	c1 := mockFlashPlayerC1()
+
+	if v := handshakeSchema1.digestPosition(c1); v != 28 {
+		t.Errorf("invalid digest position %v", v)
+	}
+	if v := handshakeSchema1.keyPosition(c1); v != 804 {
+		t.Errorf("invalid key position %v", v)
+	}
+
+	// For schema0, the digest block follows the key block.
+	if v := handshakeSchema0.digestPosition(c1); v < 8+handshakeBlockSize+4 || v > handshakeSize-handshakeDigestSize {
+		t.Errorf("invalid digest position %v", v)
+	}
+	if v := handshakeSchema0.keyPosition(c1); v < 8 || v > 8+handshakeBlockSize-handshakeKeySize-4 {
+		t.Errorf("invalid key position %v", v)
+	}
+}
+
+func TestValidateC1S1(t *testing.T) {
+	c1 := mockFlashPlayerC1()
+
+	if schema, digest, ok := validateC1S1(c1, genuineFPKey[:30]); !ok {
+		t.Error("validate c1 failed")
+	} else if schema != handshakeSchema1 {
+		t.Errorf("invalid schema %v", schema)
+	} else if !bytes.Equal(digest, c1[28:28+32]) {
+		t.Errorf("invalid digest %x", digest)
+	}
+
+	// The s1 is signed by the FMS key, never matches the FP key.
+	if _, _, ok := validateC1S1(c1, genuineFMSKey[:36]); ok {
+		t.Error("should fail for FMS key")
+	}
+
+	// Any change of the random data must be detected.
+	c1[100] ^= 0xff
+	if _, _, ok := validateC1S1(c1, genuineFPKey[:30]); ok {
+		t.Error("should fail for corrupt c1")
+	}
+
+	if _, _, ok := validateC1S1(c1[:100], genuineFPKey[:30]); ok {
+		t.Error("should fail for short c1")
+	}
+
+	// The simple c1 is all zero.
+	if _, _, ok := validateC1S1(make([]byte, handshakeSize), genuineFPKey[:30]); ok {
+		t.Error("should fail for simple c1")
+	}
+}
+
+func TestCreateC1S1(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+
+	for _, schema := range []handshakeSchema{handshakeSchema0, handshakeSchema1} {
+		s1 := createC1S1(r, schema, handshakeServerVersion, genuineFMSKey[:36])
+		if v, _, ok := validateC1S1(s1, genuineFMSKey[:36]); !ok {
+			t.Errorf("validate schema %v failed", schema)
+		} else if v != schema {
+			t.Errorf("invalid schema %v, expect %v", v, schema)
+		}
+
+		if !bytes.Equal(s1[4:8], []byte{0x01, 0x00, 0x05, 0x04}) {
+			t.Errorf("invalid version %x", s1[4:8])
+		}
+	}
+}
+
+func TestCreateC2S2(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	c1 := mockFlashPlayerC1()
+
+	s2 := createC2S2(r, genuineFMSKey, c1[28:28+32])
+	if !validateC2S2(s2, genuineFMSKey, c1[28:28+32]) {
+		t.Error("validate s2 failed")
+	}
+	if validateC2S2(s2, genuineFPKey, c1[28:28+32]) {
+		t.Error("should fail for FP key")
+	}
+	if validateC2S2(c1, genuineFMSKey, c1[28:28+32]) {
+		t.Error("should fail for c1 echo")
+	}
+	if validateC2S2(s2[:100], genuineFMSKey, c1[28:28+32]) {
+		t.Error("should fail for short s2")
+	}
+}
+
+func TestValidateC1S1_Librtmp(t *testing.T) {
+	c1, s1, s2 := librtmpC0C1[1:], librtmpS0S1S2[1:1+handshakeSize], librtmpS0S1S2[1+handshakeSize:]
+
+	schema, c1Digest, ok := validateC1S1(c1, genuineFPKey[:30])
+	if !ok || schema != handshakeSchema1 || !bytes.Equal(c1Digest, c1[430:430+32]) {
+		t.Errorf("validate c1 failed, schema=%v, ok=%v", schema, ok)
+	}
+
+	if schema, s1Digest, ok := validateC1S1(s1, genuineFMSKey[:36]); !ok || schema != handshakeSchema1 {
+		t.Errorf("validate s1 failed, schema=%v, ok=%v", schema, ok)
+	} else if !bytes.Equal(s1Digest, s1[580:580+32]) {
+		t.Errorf("invalid s1 digest %x", s1Digest)
+	}
+
+	if !validateC2S2(s2, genuineFMSKey, c1Digest) {
+		t.Error("validate s2 failed")
+	}
+}
+
+func TestComplexHandshake_LibrtmpClient(t *testing.T) {
+	// The c2 is not validated by server.
+	peer := &mockHandshakePeer{Reader: io.MultiReader(
+		bytes.NewReader(librtmpC0C1), bytes.NewReader(make([]byte, handshakeSize)),
+	)}
+
+	server := NewComplexHandshake(rand.New(rand.NewSource(1)))
+	if err := server.ServerHandshake(peer); err != nil {
+		t.Fatalf("server handshake failed %+v", err)
+	}
+	if server.Simple {
+		t.Error("should be complex")
+	}
+
+	// The librtmp validates the s1 and s2.
+	s0s1s2 := peer.Bytes()
+	if len(s0s1s2) != 1+handshakeSize*2 || s0s1s2[0] != 0x03 {
+		t.Fatalf("invalid s0s1s2 %v", len(s0s1s2))
+	}
+	if _, _, ok := validateC1S1(s0s1s2[1:1+handshakeSize], genuineFMSKey[:36]); !ok {
+		t.Error("validate s1 failed")
+	}
+	if !validateC2S2(s0s1s2[1+handshakeSize:], genuineFMSKey, librtmpC0C1[1+430:1+430+32]) {
+		t.Error("validate s2 failed")
+	}
+}
+
+func TestComplexHandshake_LibrtmpServer(t *testing.T) {
+	// The s2 is signed for the captured c1, not for the c1 of client, which is accepted.
+	peer := &mockHandshakePeer{Reader: bytes.NewReader(librtmpS0S1S2)}
+
+	client := NewComplexHandshake(rand.New(rand.NewSource(1)))
+	if err := client.ClientHandshake(peer); err != nil {
+		t.Fatalf("client handshake failed %+v", err)
+	}
+	if client.Simple {
+		t.Error("should be complex")
+	}
+
+	// The c2 is signed for the s1 digest.
+	c0c1c2 := peer.Bytes()
+	if len(c0c1c2) != 1+handshakeSize*2 {
+		t.Fatalf("invalid c0c1c2 %v", len(c0c1c2))
+	}
+	if _, _, ok := validateC1S1(c0c1c2[1:1+handshakeSize], genuineFPKey[:30]); !ok {
+		t.Error("validate c1 failed")
+	}
+	if !validateC2S2(c0c1c2[1+handshakeSize:], genuineFPKey, librtmpS0S1S2[1+580:1+580+32]) {
+		t.Error("validate c2 failed")
+	}
+}
+
+func TestCreateDHPublicKey(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	if v := createDHPublicKey(r); len(v) != handshakeKeySize {
+		t.Errorf("invalid key size %v", len(v))
+	}
+}
+
+func TestComplexHandshake(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	server := NewComplexHandshake(rand.New(rand.NewSource(1)))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ServerHandshake(s)
+	}()
+
+	client := NewComplexHandshake(rand.New(rand.NewSource(2)))
+	if err := client.ClientHandshake(c); err != nil {
+		t.Errorf("client handshake failed %+v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("server handshake failed %+v", err)
+	}
+
+	if client.Simple || server.Simple {
+		t.Errorf("should be complex, client=%v, server=%v", client.Simple, server.Simple)
+	}
+}
+
+func TestComplexHandshake_FlashPlayer(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	server := NewComplexHandshake(rand.New(rand.NewSource(1)))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ServerHandshake(s)
+	}()
+
+	c1 := mockFlashPlayerC1()
+	if _, err := c.Write(append([]byte{0x03}, c1...)); err != nil {
+		t.Errorf("write c0c1 failed %+v", err)
+	}
+
+	hs := NewHandshake(rand.New(rand.NewSource(2)))
+	if _, err := hs.ReadC0S0(c); err != nil {
+		t.Errorf("read s0 failed %+v", err)
+	}
+	s1, err := hs.ReadC1S1(c)
+	if err != nil {
+		t.Errorf("read s1 failed %+v", err)
+	}
+	s2, err := hs.ReadC2S2(c)
+	if err != nil {
+		t.Errorf("read s2 failed %+v", err)
+	}
+
+	if _, _, ok := validateC1S1(s1, genuineFMSKey[:36]); !ok {
+		t.Error("validate s1 failed")
+	}
+	if !validateC2S2(s2, genuineFMSKey, c1[28:28+32]) {
+		t.Error("validate s2 failed")
+	}
+
+	if err := hs.WriteC2S2(c, s1); err != nil {
+		t.Errorf("write c2 failed %+v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("server handshake failed %+v", err)
+	}
+	if server.Simple {
+		t.Error("should be complex")
+	}
+}
+
+func TestComplexHandshake_SimpleClient(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	server := NewComplexHandshake(rand.New(rand.NewSource(1)))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ServerHandshake(s)
+	}()
+
+	hs := NewHandshake(rand.New(rand.NewSource(2)))
+	if err := hs.WriteC0S0(c); err != nil {
+		t.Errorf("write c0 failed %+v", err)
+	}
+	if err := hs.WriteC1S1(c); err != nil {
+		t.Errorf("write c1 failed %+v", err)
+	}
+	if _, err := hs.ReadC0S0(c); err != nil {
+		t.Errorf("read s0 failed %+v", err)
+	}
+	s1, err := hs.ReadC1S1(c)
+	if err != nil {
+		t.Errorf("read s1 failed %+v", err)
+	}
+	if _, err := hs.ReadC2S2(c); err != nil {
+		t.Errorf("read s2 failed %+v", err)
+	}
+	if err := hs.WriteC2S2(c, s1); err != nil {
+		t.Errorf("write c2 failed %+v", err)
+	}
+
+	if err := <-errs; err != nil {
+		t.Errorf("server handshake failed %+v", err)
+	}
+	if !server.Simple {
+		t.Error("should fallback to simple")
+	}
+}
+
+func TestComplexHandshake_SimpleServer(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- func() error {
+			hs := NewHandshake(rand.New(rand.NewSource(1)))
+			if _, err := hs.ReadC0S0(s); err != nil {
+				return err
+			}
+			c1, err := hs.ReadC1S1(s)
+			if err != nil {
+				return err
+			}
+			if err = hs.WriteC0S0(s); err != nil {
+				return err
+			}
+			if err = hs.WriteC1S1(s); err != nil {
+				return err
+			}
+			if err = hs.WriteC2S2(s, c1); err != nil {
+				return err
+			}
+			_, err = hs.ReadC2S2(s)
+			return err
+		}()
+	}()
+
+	client := NewComplexHandshake(rand.New(rand.NewSource(2)))
+	if err := client.ClientHandshake(c); err != nil {
+		t.Errorf("client handshake failed %+v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("server handshake failed %+v", err)
+	}
+	if !client.Simple {
+		t.Error("should fallback to simple")
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"math/rand"
 	"reflect"
 	"sync"
+	"sync/atomic"
 )
 
 // The handshake implements the RTMP handshake protocol.
@@ -150,27 +151,57 @@ func newChunkStream() *chunkStream {
 	return &chunkStream{}
 }
 
+// The read writer which counts the bytes, for acknowledgement.
+type bytesCounter struct {
+	// @remark Keep the 64bits fields first, to align for atomic on 32bits platform.
+	nread, nwrite uint64
+	rw            io.ReadWriter
+}
+
+func (v *bytesCounter) Read(p []byte) (n int, err error) {
+	n, err = v.rw.Read(p)
+	atomic.AddUint64(&v.nread, uint64(n))
+	return
+}
+
+func (v *bytesCounter) Write(p []byte) (n int, err error) {
+	n, err = v.rw.Write(p)
+	atomic.AddUint64(&v.nwrite, uint64(n))
+	return
+}
+
 // The protocol implements the RTMP command and chunk stack.
 type Protocol struct {
-	r     *bufio.Reader
-	w     *bufio.Writer
-	input struct {
+	r       *bufio.Reader
+	w       *bufio.Writer
+	counter *bytesCounter
+	input   struct {
 		opt    *settings
 		chunks map[chunkID]*chunkStream
 
 		transactions  map[amf0.Number]amf0.String
 		ltransactions sync.Mutex
+
+		// The window acknowledgement size set by peer, we must send acknowledgement
+		// when received bytes exceed it.
+		ackWindow uint32
+		// The received bytes when sent the last acknowledgement.
+		ackedBytes uint64
 	}
 	output struct {
 		opt *settings
+
+		// To protect writing, because the acknowledgement is sent when reading.
+		lock sync.Mutex
 	}
 }
 
 func NewProtocol(rw io.ReadWriter) *Protocol {
 	v := &Protocol{
-		r: bufio.NewReader(rw),
-		w: bufio.NewWriter(rw),
+		counter: &bytesCounter{rw: rw},
 	}
+	v.r = bufio.NewReader(v.counter)
+	v.w = bufio.NewWriter(v.counter)
 
 	v.input.opt = newSettings()
 	v.input.chunks = map[chunkID]*chunkStream{}
@@ -268,12 +299,20 @@ func (v *Protocol) parseAMFObject(p []byte) (pkt Packet, err error) {
 		case commandCreateStream:
 			return NewCreateStreamResPacket(transactionID), nil
 		default:
-			return nil, oe.Errorf("No request for %v", string(requestName))
+			return NewCallPacket(), nil
 		}
 	case commandConnect:
 		return NewConnectAppPacket(), nil
+	case commandCreateStream:
+		return NewCreateStreamPacket(), nil
 	case commandPublish:
 		return NewPublishPacket(), nil
+	case commandPlay:
+		return NewPlayPacket(), nil
+	case commandRtmpSampleAccess:
+		return NewSampleAccessPacket(), nil
+	case commandSetDataFrame, commandOnMetaData:
+		return NewMetadataPacket(), nil
 	default:
 		return NewCallPacket(), nil
 	}
@@ -285,8 +324,13 @@ func (v *Protocol) DecodeMessage(m *Message) (pkt Packet, err error) {
 		return nil, oe.New("Empty packet")
 	}
 
+	// For AMF3 command and data, the first byte is the format which is always 0, then the
+	// values in AMF0, which switch to AMF3 by the avmplus object marker, see amf0.AvmPlusObject.
 	switch m.MessageType {
 	case MessageTypeAMF3Command, MessageTypeAMF3Data:
+		if p[0] != 0 {
+			return nil, oe.Errorf("AMF3 format %v is not supported", p[0])
+		}
 		p = p[1:]
 	}
 
@@ -295,6 +339,10 @@ func (v *Protocol) DecodeMessage(m *Message) (pkt Packet, err error) {
 		pkt = NewSetChunkSize()
 	case MessageTypeWindowAcknowledgementSize:
 		pkt = NewWindowAcknowledgementSize()
+	case MessageTypeAcknowledgement:
+		pkt = NewAcknowledgement()
+	case MessageTypeAbort:
+		pkt = NewAbort()
 	case MessageTypeSetPeerBandwidth:
 		pkt = NewSetPeerBandwidth()
 	case MessageTypeAMF0Command, MessageTypeAMF3Command, MessageTypeAMF0Data, MessageTypeAMF3Data:
@@ -338,6 +386,11 @@ func (v *Protocol) ReadMessage() (m *Message, err error) {
 			return nil, oe.WithMessage(err, "read message payload")
 		}
 
+		// The message is incomplete, continue to read next chunk.
+		if m == nil {
+			continue
+		}
+
 		if err = v.onMessageArrivated(m); err != nil {
 			return nil, oe.WithMessage(err, "on message")
 		}
@@ -702,7 +755,7 @@ func (v *Protocol) WritePacket(pkt Packet, streamID int) (err error) {
 	m.streamID = uint32(streamID)
 	m.betterCid = pkt.BetterCid()
 
-	if err = v.WriteMessage(m); err != nil {
+	if err = v.writeMessage(m, pkt); err != nil {
 		return oe.WithMessage(err, "write message")
 	}
 
@@ -722,6 +775,11 @@ func (v *Protocol) onPacketWriten(m *Message, pkt Packet) (err error) {
 		tid, name = pkt.TransactionID, pkt.CommandName
 	case *CreateStreamPacket:
 		tid, name = pkt.TransactionID, pkt.CommandName
+	case *CallPacket:
+		// Ignore the response, only the request expects a response.
+		if pkt.CommandName != commandResult && pkt.CommandName != commandError {
+			tid, name = pkt.TransactionID, pkt.CommandName
+		}
 	}
 
 	if tid > 0 && len(name) > 0 {
@@ -737,7 +795,7 @@ func (v *Protocol) onPacketWriten(m *Message, pkt Packet) (err error) {
 func (v *Protocol) onMessageArrivated(m *Message) (err error) {
 	var pkt Packet
 	switch m.MessageType {
-	case MessageTypeSetChunkSize, MessageTypeUserControl, MessageTypeWindowAcknowledgementSize:
+	case MessageTypeSetChunkSize, MessageTypeAbort, MessageTypeUserControl, MessageTypeWindowAcknowledgementSize:
 		if pkt, err = v.DecodeMessage(m); err != nil {
 			return oe.Errorf("decode message %v", m.MessageType)
 		}
@@ -746,12 +804,52 @@ func (v *Protocol) onMessageArrivated(m *Message) (err error) {
 	switch pkt := pkt.(type) {
 	case *SetChunkSize:
 		v.input.opt.chunkSize = pkt.ChunkSize
+	case *Abort:
+		// Discard the partially received message of the chunk stream.
+		if chunk, ok := v.input.chunks[chunkID(pkt.ChunkStreamID)]; ok {
+			chunk.message = nil
+		}
+	case *WindowAcknowledgementSize:
+		v.input.ackWindow = pkt.AckSize
+	}
+
+	// Please read @doc rtmp_specification_1.0.pdf, @page 19, @section 5.3. Acknowledgement (3)
+	// The client or the server sends the acknowledgment to the peer after
+	// receiving bytes equal to the window size.
+	if v.input.ackWindow > 0 {
+		if nn := v.InBytes(); nn-v.input.ackedBytes >= uint64(v.input.ackWindow) {
+			ack := NewAcknowledgement()
+			ack.SequenceNumber = uint32(nn)
+			if err = v.WritePacket(ack, 0); err != nil {
+				return oe.WithMessage(err, "write acknowledgement")
+			}
+			v.input.ackedBytes = nn
+		}
 	}
 
 	return
 }
 
+// The total bytes received from peer, including the chunk headers.
+func (v *Protocol) InBytes() uint64 {
+	return atomic.LoadUint64(&v.counter.nread)
+}
+
+// The total bytes sent to peer, including the chunk headers.
+func (v *Protocol) OutBytes() uint64 {
+	return atomic.LoadUint64(&v.counter.nwrite)
+}
+
 func (v *Protocol) WriteMessage(m *Message) (err error) {
+	return v.writeMessage(m, nil)
+}
+
+// Write the message of pkt, the chunk size of SetChunkSize is applied in the same lock,
+// so the messages written by other goroutines after it always use the new chunk size.
+func (v *Protocol) writeMessage(m *Message, pkt Packet) (err error) {
+	v.output.lock.Lock()
+	defer v.output.lock.Unlock()
+
 	m.payloadLength = uint32(len(m.Payload))
 
 	var c0h, c3h []byte
@@ -791,6 +889,11 @@ func (v *Protocol) WriteMessage(m *Message) (err error) {
 		return oe.Wrapf(err, "flush writer")
 	}
 
+	// The chunk size takes effect for messages after this one.
+	if pkt, ok := pkt.(*SetChunkSize); ok {
+		v.output.opt.chunkSize = pkt.ChunkSize
+	}
+
 	return
 }
 
@@ -1003,8 +1106,13 @@ const (
 	commandReleaseStream    amf0.String = amf0.String("releaseStream")
 	commandFCPublish        amf0.String = amf0.String("FCPublish")
 	commandFCUnpublish      amf0.String = amf0.String("FCUnpublish")
+	commandOnFCPublish      amf0.String = amf0.String("onFCPublish")
+	commandOnFCUnpublish    amf0.String = amf0.String("onFCUnpublish")
 	commandPublish          amf0.String = amf0.String("publish")
+	commandDeleteStream     amf0.String = amf0.String("deleteStream")
 	commandRtmpSampleAccess amf0.String = amf0.String("|RtmpSampleAccess")
+	commandSetDataFrame     amf0.String = amf0.String("@setDataFrame")
+	commandOnMetaData       amf0.String = amf0.String("onMetaData")
 )
 
 // The RTMP packet, transport as payload of RTMP message.
@@ -1250,6 +1358,40 @@ func NewCloseStreamPacket() *CallPacket {
 	return v
 }
 
+// The onStatus packet, the args is an object with level, code and description,
+// for example, the code is NetStream.Publish.Start when server starts to accept the publisher.
+func NewOnStatusCallPacket(code, description string) *CallPacket {
+	v := NewCallPacket()
+	v.CommandName = commandOnStatus
+	v.CommandObject = amf0.NewNull()
+
+	args := amf0.NewObject()
+	args.Set("level", amf0.NewString("status"))
+	args.Set("code", amf0.NewString(code))
+	args.Set("description", amf0.NewString(description))
+	v.Args = args
+
+	return v
+}
+
+// The onBWDone packet, sent by server after connect app.
+func NewOnBWDonePacket() *CallPacket {
+	v := NewCallPacket()
+	v.CommandName = commandOnBWDone
+	v.CommandObject = amf0.NewNull()
+	return v
+}
+
+// The response for FMLE start packets, such as releaseStream and FCPublish.
+func NewFMLEStartResPacket(tid amf0.Number) *CallPacket {
+	v := NewCallPacket()
+	v.CommandName = commandResult
+	v.TransactionID = tid
+	v.CommandObject = amf0.NewNull()
+	v.Args = amf0.NewUndefined()
+	return v
+}
+
 func (v *CallPacket) Size() int {
 	size := v.variantCallPacket.Size()
 
@@ -1469,6 +1611,206 @@ func (v *PlayPacket) MarshalBinary() (data []byte, err error) {
 	return
 }
 
+// The |RtmpSampleAccess data message, sent by server when start to play,
+// to allow the Flash Player to access the audio and video sample.
+type SampleAccessPacket struct {
+	CommandName       amf0.String
+	VideoSampleAccess amf0.Boolean
+	AudioSampleAccess amf0.Boolean
+}
+
+func NewSampleAccessPacket() *SampleAccessPacket {
+	return &SampleAccessPacket{
+		CommandName: commandRtmpSampleAccess,
+	}
+}
+
+func (v *SampleAccessPacket) BetterCid() chunkID {
+	return chunkIDOverStream
+}
+
+func (v *SampleAccessPacket) Type() MessageType {
+	return MessageTypeAMF0Data
+}
+
+func (v *SampleAccessPacket) Size() int {
+	return v.CommandName.Size() + v.VideoSampleAccess.Size() + v.AudioSampleAccess.Size()
+}
+
+func (v *SampleAccessPacket) UnmarshalBinary(data []byte) (err error) {
+	p := data
+
+	if err = v.CommandName.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "unmarshal command name")
+	}
+	p = p[v.CommandName.Size():]
+
+	if err = v.VideoSampleAccess.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "unmarshal video sample access")
+	}
+	p = p[v.VideoSampleAccess.Size():]
+
+	if err = v.AudioSampleAccess.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "unmarshal audio sample access")
+	}
+
+	return
+}
+
+func (v *SampleAccessPacket) MarshalBinary() (data []byte, err error) {
+	var pb []byte
+	if pb, err = v.CommandName.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal command name")
+	}
+	data = append(data, pb...)
+
+	if pb, err = v.VideoSampleAccess.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal video sample access")
+	}
+	data = append(data, pb...)
+
+	if pb, err = v.AudioSampleAccess.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal audio sample access")
+	}
+	data = append(data, pb...)
+
+	return
+}
+
+// The metadata data message, the publisher sends it wrapped by @setDataFrame, while the player
+// receives the onMetaData only, please read @doc video_file_format_spec_v10_1.pdf, @page 80, @section onMetaData
+type MetadataPacket struct {
+	// Whether wrapped by @setDataFrame, sent by publisher.
+	SetDataFrame bool
+	// The name of data, generally onMetaData.
+	Name amf0.String
+	// The metadata, generally ECMA array or object.
+	Metadata amf0.Amf0
+}
+
+func NewMetadataPacket() *MetadataPacket {
+	return &MetadataPacket{
+		Name:     commandOnMetaData,
+		Metadata: amf0.NewEcmaArray(),
+	}
+}
+
+// Parse the metadata to typed stream metadata.
+func (v *MetadataPacket) StreamMetadata() (m *StreamMetadata, err error) {
+	m = &StreamMetadata{}
+	if err = amf0.Assign(v.Metadata, m); err != nil {
+		return nil, oe.WithMessage(err, "assign")
+	}
+	return
+}
+
+// Set the metadata to ECMA array of stream metadata m.
+func (v *MetadataPacket) SetStreamMetadata(m *StreamMetadata) (err error) {
+	var a amf0.Amf0
+	if a, err = amf0.ValueOf(m); err != nil {
+		return oe.WithMessage(err, "value")
+	}
+
+	o, _ := a.(*amf0.Object)
+	ecma := amf0.NewEcmaArray()
+	for _, key := range o.Keys() {
+		ecma.Set(key, o.Get(key))
+	}
+	v.Metadata = ecma
+
+	return
+}
+
+// Encode to the FLV script tag, the onMetaData without @setDataFrame, please read flv.Muxer.
+func (v *MetadataPacket) FlvTag() (tag []byte, err error) {
+	var pb []byte
+	if pb, err = v.Name.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal name")
+	}
+	tag = append(tag, pb...)
+
+	if pb, err = v.Metadata.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal metadata")
+	}
+	tag = append(tag, pb...)
+
+	return
+}
+
+func (v *MetadataPacket) BetterCid() chunkID {
+	return chunkIDOverStream
+}
+
+func (v *MetadataPacket) Type() MessageType {
+	return MessageTypeAMF0Data
+}
+
+func (v *MetadataPacket) Size() (size int) {
+	if v.SetDataFrame {
+		size += amf0.NewString(string(commandSetDataFrame)).Size()
+	}
+	return size + v.Name.Size() + v.Metadata.Size()
+}
+
+func (v *MetadataPacket) UnmarshalBinary(data []byte) (err error) {
+	p := data
+
+	if err = v.Name.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "unmarshal name")
+	}
+	p = p[v.Name.Size():]
+
+	if v.SetDataFrame = v.Name == commandSetDataFrame; v.SetDataFrame {
+		if err = v.Name.UnmarshalBinary(p); err != nil {
+			return oe.WithMessage(err, "unmarshal name")
+		}
+		p = p[v.Name.Size():]
+	}
+
+	if v.Metadata, err = amf0.Discovery(p); err != nil {
+		return oe.WithMessage(err, "discovery metadata")
+	}
+	if err = v.Metadata.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "unmarshal metadata")
+	}
+
+	return
+}
+
+func (v *MetadataPacket) MarshalBinary() (data []byte, err error) {
+	if v.SetDataFrame {
+		if data, err = amf0.NewString(string(commandSetDataFrame)).MarshalBinary(); err != nil {
+			return nil, oe.WithMessage(err, "marshal @setDataFrame")
+		}
+	}
+
+	var pb []byte
+	if pb, err = v.FlvTag(); err != nil {
+		return nil, oe.WithMessage(err, "marshal metadata")
+	}
+	data = append(data, pb...)
+
+	return
+}
+
+// The typed stream metadata, please read @doc video_file_format_spec_v10_1.pdf, @page 80, @section onMetaData
+// The codec id is Number generally, while some encoders use String, for example, avc1.
+type StreamMetadata struct {
+	Duration        float64     `amf0:"duration,omitempty"`
+	FileSize        float64     `amf0:"filesize,omitempty"`
+	Width           float64     `amf0:"width,omitempty"`
+	Height          float64     `amf0:"height,omitempty"`
+	VideoCodecID    interface{} `amf0:"videocodecid,omitempty"`
+	VideoDataRate   float64     `amf0:"videodatarate,omitempty"`
+	FrameRate       float64     `amf0:"framerate,omitempty"`
+	AudioCodecID    interface{} `amf0:"audiocodecid,omitempty"`
+	AudioDataRate   float64     `amf0:"audiodatarate,omitempty"`
+	AudioSampleRate float64     `amf0:"audiosamplerate,omitempty"`
+	AudioSampleSize float64     `amf0:"audiosamplesize,omitempty"`
+	Stereo          bool        `amf0:"stereo,omitempty"`
+	Encoder         string      `amf0:"encoder,omitempty"`
+}
+
 // Please read @doc rtmp_specification_1.0.pdf, @page 31, @section 5.1. Set Chunk Size
 // Protocol control message 1, Set Chunk Size, is used to notify the
 // peer about the new maximum chunk size.
@@ -1510,6 +1852,87 @@ func (v *SetChunkSize) MarshalBinary() (data []byte, err error) {
 	return
 }
 
+// Please read @doc rtmp_specification_1.0.pdf, @page 19, @section 5.2. Abort Message (2)
+// Protocol control message 2, Abort Message, is used to notify the peer
+// if it is waiting for chunks to complete a message, then to discard
+// the partially received message over a chunk stream.
+type Abort struct {
+	// This field holds the chunk stream ID, whose current message is to be discarded.
+	ChunkStreamID uint32
+}
+
+func NewAbort() *Abort {
+	return &Abort{}
+}
+
+func (v *Abort) BetterCid() chunkID {
+	return chunkIDProtocolControl
+}
+
+func (v *Abort) Type() MessageType {
+	return MessageTypeAbort
+}
+
+func (v *Abort) Size() int {
+	return 4
+}
+
+func (v *Abort) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 4 {
+		return oe.Errorf("requires 4 only %v bytes, %x", len(data), data)
+	}
+	v.ChunkStreamID = binary.BigEndian.Uint32(data)
+
+	return
+}
+
+func (v *Abort) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 4)
+	binary.BigEndian.PutUint32(data, v.ChunkStreamID)
+
+	return
+}
+
+// Please read @doc rtmp_specification_1.0.pdf, @page 19, @section 5.3. Acknowledgement (3)
+// The client or the server sends the acknowledgment to the peer after
+// receiving bytes equal to the window size.
+type Acknowledgement struct {
+	// This field holds the number of bytes received so far.
+	SequenceNumber uint32
+}
+
+func NewAcknowledgement() *Acknowledgement {
+	return &Acknowledgement{}
+}
+
+func (v *Acknowledgement) BetterCid() chunkID {
+	return chunkIDProtocolControl
+}
+
+func (v *Acknowledgement) Type() MessageType {
+	return MessageTypeAcknowledgement
+}
+
+func (v *Acknowledgement) Size() int {
+	return 4
+}
+
+func (v *Acknowledgement) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 4 {
+		return oe.Errorf("requires 4 only %v bytes, %x", len(data), data)
+	}
+	v.SequenceNumber = binary.BigEndian.Uint32(data)
+
+	return
+}
+
+func (v *Acknowledgement) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 4)
+	binary.BigEndian.PutUint32(data, v.SequenceNumber)
+
+	return
+}
+
 // Please read @doc rtmp_specification_1.0.pdf, @page 33, @section 5.5. Window Acknowledgement Size (5)
 // The client or the server sends this message to inform the peer which
 // window size to use when sending acknowledgment.
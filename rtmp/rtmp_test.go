@@ -0,0 +1,387 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	"github.com/ossrs/go-oryx-lib/amf3"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// The read writer over two buffers, read from r and write to w.
+type bufferReadWriter struct {
+	r io.Reader
+	w *bytes.Buffer
+}
+
+func (v *bufferReadWriter) Read(p []byte) (int, error) {
+	return v.r.Read(p)
+}
+
+func (v *bufferReadWriter) Write(p []byte) (int, error) {
+	return v.w.Write(p)
+}
+
+func TestAcknowledgement(t *testing.T) {
+	ack := NewAcknowledgement()
+	ack.SequenceNumber = 0x01020304
+
+	b, err := ack.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+	if !bytes.Equal(b, []byte{0x01, 0x02, 0x03, 0x04}) || ack.Size() != len(b) {
+		t.Errorf("invalid ack %x", b)
+	}
+
+	var v Acknowledgement
+	if err = v.UnmarshalBinary(b); err != nil || v.SequenceNumber != 0x01020304 {
+		t.Errorf("unmarshal failed %v, %+v", v.SequenceNumber, err)
+	}
+	if err = v.UnmarshalBinary(b[:3]); err == nil {
+		t.Error("should fail for short data")
+	}
+}
+
+func TestProtocol_Acknowledgement(t *testing.T) {
+	// The peer sets the window to 1000 bytes, then sends 3 video messages of 400 bytes.
+	in := &bytes.Buffer{}
+	peer := NewProtocol(&bufferReadWriter{w: in})
+
+	wasp := NewWindowAcknowledgementSize()
+	wasp.AckSize = 1000
+	if err := peer.WritePacket(wasp, 0); err != nil {
+		t.Fatalf("write failed %+v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		m := NewStreamMessage(1)
+		m.MessageType = MessageTypeVideo
+		m.betterCid = chunkIDVideo
+		m.Payload = make([]byte, 400)
+		if err := peer.WriteMessage(m); err != nil {
+			t.Fatalf("write failed %+v", err)
+		}
+	}
+	if peer.OutBytes() != uint64(in.Len()) {
+		t.Errorf("invalid out bytes %v, expect %v", peer.OutBytes(), in.Len())
+	}
+
+	// Read message one by one, to trigger the acknowledgement after window crossed.
+	out := &bytes.Buffer{}
+	p := NewProtocol(&bufferReadWriter{r: iotest.OneByteReader(in), w: out})
+	for i := 0; i < 4; i++ {
+		if _, err := p.ReadMessage(); err != nil {
+			t.Fatalf("read failed %+v", err)
+		}
+
+		if i < 3 && out.Len() != 0 {
+			t.Errorf("should not ack at %v, in %vB", i, p.InBytes())
+		}
+	}
+	if p.InBytes() < 1000 {
+		t.Errorf("invalid in bytes %v", p.InBytes())
+	}
+
+	// Peer should receive the acknowledgement.
+	r := NewProtocol(&bufferReadWriter{r: out, w: &bytes.Buffer{}})
+	m, err := r.ExpectMessage(MessageTypeAcknowledgement)
+	if err != nil {
+		t.Fatalf("expect ack failed %+v", err)
+	}
+	if pkt, err := r.DecodeMessage(m); err != nil {
+		t.Errorf("decode failed %+v", err)
+	} else if ack, ok := pkt.(*Acknowledgement); !ok || uint64(ack.SequenceNumber) != p.InBytes() {
+		t.Errorf("invalid ack %+v, expect %v", pkt, p.InBytes())
+	}
+}
+
+func TestProtocol_SetChunkSize(t *testing.T) {
+	w := &bytes.Buffer{}
+	p := NewProtocol(&bufferReadWriter{w: w})
+
+	// The size of message in bytes, the fmt0 header is 12 bytes, and fmt3 header is 1 byte.
+	messageSize := func(payload, chunkSize int) int {
+		return 12 + payload + (payload+chunkSize-1)/chunkSize - 1
+	}
+
+	var payloads [][]byte
+	var expect int
+	for i, e := range []struct {
+		chunkSize, payload int
+	}{
+		{128, 1000}, {4096, 10000}, {200, 5000}, {60000, 100000}, {128, 129},
+	} {
+		if e.chunkSize != defaultChunkSize {
+			pkt := NewSetChunkSize()
+			pkt.ChunkSize = uint32(e.chunkSize)
+			if err := p.WritePacket(pkt, 0); err != nil {
+				t.Fatalf("write failed %+v", err)
+			}
+			expect += messageSize(4, defaultChunkSize)
+		}
+
+		m := NewStreamMessage(1)
+		m.MessageType = MessageTypeVideo
+		m.betterCid = chunkIDVideo
+		m.Timestamp = uint64(i * 40)
+		m.Payload = bytes.Repeat([]byte{byte(i)}, e.payload)
+		if err := p.WriteMessage(m); err != nil {
+			t.Fatalf("write failed %+v", err)
+		}
+		payloads = append(payloads, m.Payload)
+		expect += messageSize(e.payload, e.chunkSize)
+
+		if w.Len() != expect {
+			t.Errorf("chunk size %v, payload %v, got %vB, expect %vB", e.chunkSize, e.payload, w.Len(), expect)
+		}
+
+		// Restore the chunk size, for the SetChunkSize is sent in the default chunk size.
+		pkt := NewSetChunkSize()
+		if err := p.WritePacket(pkt, 0); err != nil {
+			t.Fatalf("write failed %+v", err)
+		}
+		expect += messageSize(4, e.chunkSize)
+	}
+
+	// The peer must parse all messages in right chunk size.
+	r := NewProtocol(&bufferReadWriter{r: w, w: &bytes.Buffer{}})
+	for i, payload := range payloads {
+		m, err := r.ExpectMessage(MessageTypeVideo)
+		if err != nil {
+			t.Fatalf("read %v failed %+v", i, err)
+		}
+		if m.Timestamp != uint64(i*40) || !bytes.Equal(m.Payload, payload) {
+			t.Errorf("invalid message %v, timestamp=%v, %vB", i, m.Timestamp, len(m.Payload))
+		}
+	}
+}
+
+func TestProtocol_SetChunkSizeConcurrent(t *testing.T) {
+	w := &bytes.Buffer{}
+	p := NewProtocol(&bufferReadWriter{w: w})
+
+	// The messages written by other goroutine, must use the chunk size of the last SetChunkSize.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			m := NewStreamMessage(1)
+			m.MessageType = MessageTypeVideo
+			m.betterCid = chunkIDVideo
+			m.Timestamp = uint64(i)
+			m.Payload = bytes.Repeat([]byte{byte(i)}, 300)
+			if err := p.WriteMessage(m); err != nil {
+				t.Errorf("write failed %+v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		pkt := NewSetChunkSize()
+		if i%2 == 0 {
+			pkt.ChunkSize = 4096
+		}
+		if err := p.WritePacket(pkt, 0); err != nil {
+			t.Fatalf("write failed %+v", err)
+		}
+	}
+	<-done
+
+	r := NewProtocol(&bufferReadWriter{r: w, w: &bytes.Buffer{}})
+	for i := 0; i < 1000; i++ {
+		m, err := r.ExpectMessage(MessageTypeVideo)
+		if err != nil {
+			t.Fatalf("read %v failed %+v", i, err)
+		}
+		if m.Timestamp != uint64(i) || len(m.Payload) != 300 || m.Payload[0] != byte(i) {
+			t.Fatalf("invalid message %v, timestamp=%v, %vB", i, m.Timestamp, len(m.Payload))
+		}
+	}
+}
+
+func TestProtocol_Abort(t *testing.T) {
+	abort := NewAbort()
+	abort.ChunkStreamID = uint32(chunkIDVideo)
+	if b, err := abort.MarshalBinary(); err != nil || !bytes.Equal(b, []byte{0, 0, 0, byte(chunkIDVideo)}) {
+		t.Errorf("invalid abort %x, %+v", b, err)
+	}
+
+	// The first video is partially sent, then aborted.
+	partial := &bytes.Buffer{}
+	p := NewProtocol(&bufferReadWriter{w: partial})
+	m := NewStreamMessage(1)
+	m.MessageType = MessageTypeVideo
+	m.betterCid = chunkIDVideo
+	m.Payload = bytes.Repeat([]byte{0x01}, 300)
+	if err := p.WriteMessage(m); err != nil {
+		t.Fatalf("write failed %+v", err)
+	}
+
+	in := &bytes.Buffer{}
+	in.Write(partial.Bytes()[:12+defaultChunkSize])
+
+	p = NewProtocol(&bufferReadWriter{w: in})
+	if err := p.WritePacket(abort, 0); err != nil {
+		t.Fatalf("write failed %+v", err)
+	}
+
+	m.Timestamp = 40
+	m.Payload = bytes.Repeat([]byte{0x02}, 300)
+	if err := p.WriteMessage(m); err != nil {
+		t.Fatalf("write failed %+v", err)
+	}
+
+	r := NewProtocol(&bufferReadWriter{r: in, w: &bytes.Buffer{}})
+	if m, err := r.ReadMessage(); err != nil {
+		t.Fatalf("read failed %+v", err)
+	} else if m.MessageType != MessageTypeAbort {
+		t.Errorf("invalid message %v", m.MessageType)
+	}
+
+	if m, err := r.ReadMessage(); err != nil {
+		t.Fatalf("read failed %+v", err)
+	} else if m.Timestamp != 40 || !bytes.Equal(m.Payload, bytes.Repeat([]byte{0x02}, 300)) {
+		t.Errorf("invalid message %v, %v", m.Timestamp, m.Payload[:8])
+	}
+}
+
+func TestProtocol_DecodeAMF3Command(t *testing.T) {
+	obj := amf3.NewObject()
+	obj.Set("operation", amf3.NewInteger(5))
+	obj.Set("body", amf3.NewString("hello"))
+
+	call := NewCallPacket()
+	call.CommandName = "flexCall"
+	call.TransactionID = 3
+	call.CommandObject = amf0.NewNull()
+	call.Args = amf0.NewAvmPlusObject(obj)
+
+	b, err := call.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+
+	m := NewMessage()
+	m.MessageType = MessageTypeAMF3Command
+	m.Payload = append([]byte{0x00}, b...)
+
+	p := NewProtocol(&bufferReadWriter{w: &bytes.Buffer{}})
+	pkt, err := p.DecodeMessage(m)
+	if err != nil {
+		t.Fatalf("decode failed %+v", err)
+	}
+
+	if call, ok := pkt.(*CallPacket); !ok {
+		t.Errorf("invalid packet %T", pkt)
+	} else if args, ok := call.Args.(*amf0.AvmPlusObject); !ok {
+		t.Errorf("invalid args %T", call.Args)
+	} else if obj, ok := args.Value().(*amf3.Object); !ok {
+		t.Errorf("invalid value %T", args.Value())
+	} else if v, ok := obj.Get("body").(*amf3.String); !ok || string(*v) != "hello" {
+		t.Errorf("invalid body %v", obj.Get("body"))
+	} else if v, ok := obj.Get("operation").(*amf3.Integer); !ok || *v != 5 {
+		t.Errorf("invalid operation %v", obj.Get("operation"))
+	}
+
+	// The format must be 0.
+	m.Payload[0] = 0x01
+	if _, err = p.DecodeMessage(m); err == nil {
+		t.Error("should fail for format 1")
+	}
+}
+
+func TestProtocol_DecodeMetadata(t *testing.T) {
+	obj := amf0.NewObject()
+	obj.Set("width", amf0.NewNumber(1280))
+	obj.Set("height", amf0.NewNumber(720))
+	obj.Set("videocodecid", amf0.NewString("avc1"))
+	obj.Set("audiocodecid", amf0.NewNumber(10))
+	obj.Set("encoder", amf0.NewString("Lavf57.83.100"))
+	obj.Set("stereo", amf0.NewBoolean(true))
+
+	pub := NewMetadataPacket()
+	pub.SetDataFrame = true
+	pub.Metadata = obj
+
+	b, err := pub.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	} else if len(b) != pub.Size() {
+		t.Errorf("invalid size %v, expect %v", pub.Size(), len(b))
+	}
+
+	m := NewMessage()
+	m.MessageType = MessageTypeAMF0Data
+	m.Payload = b
+
+	p := NewProtocol(&bufferReadWriter{w: &bytes.Buffer{}})
+	pkt, err := p.DecodeMessage(m)
+	if err != nil {
+		t.Fatalf("decode failed %+v", err)
+	}
+
+	mp, ok := pkt.(*MetadataPacket)
+	if !ok {
+		t.Fatalf("invalid packet %T", pkt)
+	} else if !mp.SetDataFrame || mp.Name != commandOnMetaData {
+		t.Errorf("invalid packet %v %v", mp.SetDataFrame, mp.Name)
+	}
+
+	sm, err := mp.StreamMetadata()
+	if err != nil {
+		t.Fatalf("parse failed %+v", err)
+	}
+	if sm.Width != 1280 || sm.Height != 720 || sm.VideoCodecID != "avc1" || sm.AudioCodecID != float64(10) ||
+		sm.Encoder != "Lavf57.83.100" || !sm.Stereo {
+		t.Errorf("invalid metadata %+v", sm)
+	}
+
+	// The FLV script tag is onMetaData without @setDataFrame.
+	tag, err := mp.FlvTag()
+	if err != nil {
+		t.Fatalf("encode failed %+v", err)
+	}
+	m.Payload = tag
+	if pkt, err = p.DecodeMessage(m); err != nil {
+		t.Fatalf("decode failed %+v", err)
+	} else if mp, ok := pkt.(*MetadataPacket); !ok || mp.SetDataFrame {
+		t.Errorf("invalid packet %T", pkt)
+	}
+
+	// The stream metadata is set as ECMA array.
+	play := NewMetadataPacket()
+	if err = play.SetStreamMetadata(&StreamMetadata{Width: 1920, FrameRate: 25, VideoCodecID: 7}); err != nil {
+		t.Fatalf("set failed %+v", err)
+	}
+	if ecma, ok := play.Metadata.(*amf0.EcmaArray); !ok {
+		t.Errorf("invalid metadata %T", play.Metadata)
+	} else if keys := ecma.Keys(); len(keys) != 3 || keys[0] != "width" {
+		t.Errorf("invalid keys %v", keys)
+	} else if v, ok := ecma.Get("videocodecid").(*amf0.Number); !ok || *v != 7 {
+		t.Errorf("invalid codec %v", ecma.Get("videocodecid"))
+	}
+}
@@ -0,0 +1,461 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// The status code of NetConnection and NetStream, carried by the onStatus or _result.
+const (
+	statusCodeConnectSuccess   = "NetConnection.Connect.Success"
+	statusCodePublishStart     = "NetStream.Publish.Start"
+	statusCodeUnpublishSuccess = "NetStream.Unpublish.Success"
+	statusCodePlayReset        = "NetStream.Play.Reset"
+	statusCodePlayStart        = "NetStream.Play.Start"
+)
+
+// The default window acknowledgement size and peer bandwidth.
+const defaultWindowAckSize = 2500000
+
+// The chunk size for server to send messages, larger chunk size for better performance.
+const defaultServerChunkSize = 60000
+
+// The stream id for client to publish or play, we only support one stream for each connection.
+const defaultStreamID = 1
+
+// The buffer size of channels for session, in messages.
+const sessionChannelSize = 32
+
+// The session of RTMP stream, which is *PublishSession or *PlaySession.
+type Session interface {
+	// The stream name of publish or play, with the query string if any.
+	StreamName() string
+	// The error when session done, io.EOF if client quit normally.
+	Err() error
+	// Close the session and the connection.
+	Close() error
+}
+
+// The RTMP server connection, serves a client over net.Conn, which does the handshake,
+// responses the connect app, creates stream, then waits for the client to publish or play.
+type ServerConn struct {
+	// The underlayer connection.
+	conn net.Conn
+	// The RTMP protocol stack.
+	proto *Protocol
+
+	// Whether use simple handshake, the complex handshake is used if client support.
+	SimpleHandshake bool
+	// The connect app request of client.
+	ConnectApp *ConnectAppPacket
+	// The tcUrl and app of connect app request, for example, rtmp://localhost/live and live.
+	TcURL, App string
+}
+
+func NewServerConn(c net.Conn) *ServerConn {
+	return &ServerConn{
+		conn:  c,
+		proto: NewProtocol(c),
+	}
+}
+
+// Close the underlayer connection.
+func (v *ServerConn) Close() error {
+	return v.conn.Close()
+}
+
+// Accept the client, does the handshake and connect app, then return the *PublishSession
+// or *PlaySession when client starts to publish or play.
+func (v *ServerConn) Accept() (s Session, err error) {
+	hs := NewComplexHandshake(rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err = hs.ServerHandshake(v.conn); err != nil {
+		return nil, oe.WithMessage(err, "handshake")
+	}
+	v.SimpleHandshake = hs.Simple
+
+	if err = v.connectApp(); err != nil {
+		return nil, oe.WithMessage(err, "connect app")
+	}
+
+	if s, err = v.identify(); err != nil {
+		return nil, oe.WithMessage(err, "identify client")
+	}
+
+	return
+}
+
+func (v *ServerConn) connectApp() (err error) {
+	if _, err = v.proto.ExpectPacket(&v.ConnectApp); err != nil {
+		return oe.WithMessage(err, "expect connect app")
+	}
+
+	if tcUrl, ok := v.ConnectApp.CommandObject.Get("tcUrl").(*amf0.String); ok {
+		v.TcURL = string(*tcUrl)
+	}
+	if app, ok := v.ConnectApp.CommandObject.Get("app").(*amf0.String); ok {
+		v.App = string(*app)
+	}
+
+	ack := NewWindowAcknowledgementSize()
+	ack.AckSize = defaultWindowAckSize
+	if err = v.proto.WritePacket(ack, 0); err != nil {
+		return oe.WithMessage(err, "write window ack size")
+	}
+
+	bw := NewSetPeerBandwidth()
+	bw.Bandwidth = defaultWindowAckSize
+	bw.LimitType = LimitTypeDynamic
+	if err = v.proto.WritePacket(bw, 0); err != nil {
+		return oe.WithMessage(err, "write peer bandwidth")
+	}
+
+	chunkSize := NewSetChunkSize()
+	chunkSize.ChunkSize = defaultServerChunkSize
+	if err = v.proto.WritePacket(chunkSize, 0); err != nil {
+		return oe.WithMessage(err, "write chunk size")
+	}
+
+	res := NewConnectAppResPacket(v.ConnectApp.TransactionID)
+	res.CommandObject.Set("fmsVer", amf0.NewString("FMS/3,5,3,888"))
+	res.CommandObject.Set("capabilities", amf0.NewNumber(127))
+	res.CommandObject.Set("mode", amf0.NewNumber(1))
+	res.Args = amf0.NewObject()
+	res.Args.Set("level", amf0.NewString("status"))
+	res.Args.Set("code", amf0.NewString(statusCodeConnectSuccess))
+	res.Args.Set("description", amf0.NewString("Connection succeeded"))
+	// Response the object encoding of client, 3 for AMF3.
+	objectEncoding := amf0.NewNumber(0)
+	if n, ok := v.ConnectApp.CommandObject.Get("objectEncoding").(*amf0.Number); ok {
+		objectEncoding = n
+	}
+	res.Args.Set("objectEncoding", objectEncoding)
+	if err = v.proto.WritePacket(res, 0); err != nil {
+		return oe.WithMessage(err, "write connect app response")
+	}
+
+	if err = v.proto.WritePacket(NewOnBWDonePacket(), 0); err != nil {
+		return oe.WithMessage(err, "write onBWDone")
+	}
+
+	return
+}
+
+// Response the FMLE start packets and create stream, until client starts to publish or play.
+func (v *ServerConn) identify() (s Session, err error) {
+	for {
+		var m *Message
+		if m, err = v.proto.ExpectMessage(MessageTypeAMF0Command, MessageTypeAMF3Command); err != nil {
+			return nil, oe.WithMessage(err, "expect command")
+		}
+
+		var pkt Packet
+		if pkt, err = v.proto.DecodeMessage(m); err != nil {
+			return nil, oe.WithMessage(err, "decode command")
+		}
+
+		switch pkt := pkt.(type) {
+		case *CreateStreamPacket:
+			res := NewCreateStreamResPacket(pkt.TransactionID)
+			res.StreamID = amf0.Number(defaultStreamID)
+			if err = v.proto.WritePacket(res, 0); err != nil {
+				return nil, oe.WithMessage(err, "write create stream response")
+			}
+		case *PublishPacket:
+			return v.startPublish(pkt)
+		case *PlayPacket:
+			return v.startPlay(pkt)
+		case *CallPacket:
+			switch pkt.CommandName {
+			case commandReleaseStream, commandFCPublish:
+				if err = v.proto.WritePacket(NewFMLEStartResPacket(pkt.TransactionID), 0); err != nil {
+					return nil, oe.WithMessage(err, "write FMLE start response")
+				}
+			case commandDeleteStream, commandCloseStream:
+				return nil, oe.Errorf("Client %v stream", string(pkt.CommandName))
+			}
+		}
+	}
+}
+
+func (v *ServerConn) startPublish(pkt *PublishPacket) (s Session, err error) {
+	onFCPublish := NewOnStatusCallPacket(statusCodePublishStart, "Started publishing stream.")
+	onFCPublish.CommandName = commandOnFCPublish
+	if err = v.proto.WritePacket(onFCPublish, defaultStreamID); err != nil {
+		return nil, oe.WithMessage(err, "write onFCPublish")
+	}
+
+	onStatus := NewOnStatusCallPacket(statusCodePublishStart, "Started publishing stream.")
+	if err = v.proto.WritePacket(onStatus, defaultStreamID); err != nil {
+		return nil, oe.WithMessage(err, "write onStatus")
+	}
+
+	ps := newPublishSession(v, string(pkt.StreamName))
+	go ps.cycle()
+
+	return ps, nil
+}
+
+func (v *ServerConn) startPlay(pkt *PlayPacket) (s Session, err error) {
+	streamBegin := NewUserControl()
+	streamBegin.EventType = EventTypeStreamBegin
+	streamBegin.EventData = defaultStreamID
+	if err = v.proto.WritePacket(streamBegin, 0); err != nil {
+		return nil, oe.WithMessage(err, "write stream begin")
+	}
+
+	onStatus := NewOnStatusCallPacket(statusCodePlayReset, "Playing and resetting stream.")
+	if err = v.proto.WritePacket(onStatus, defaultStreamID); err != nil {
+		return nil, oe.WithMessage(err, "write onStatus reset")
+	}
+
+	onStatus = NewOnStatusCallPacket(statusCodePlayStart, "Started playing stream.")
+	if err = v.proto.WritePacket(onStatus, defaultStreamID); err != nil {
+		return nil, oe.WithMessage(err, "write onStatus start")
+	}
+
+	if err = v.proto.WritePacket(NewSampleAccessPacket(), defaultStreamID); err != nil {
+		return nil, oe.WithMessage(err, "write sample access")
+	}
+
+	ps := newPlaySession(v, string(pkt.StreamName))
+	go ps.readCycle()
+	go ps.writeCycle()
+
+	return ps, nil
+}
+
+// The publish session, user can consume the audio, video and data messages from publisher.
+type PublishSession struct {
+	conn       *ServerConn
+	streamName string
+	err        error
+
+	// The audio, video and data messages from publisher in order, closed when publisher quit.
+	// @remark User must consume the messages or close the session, or the publisher is blocked.
+	Messages <-chan *Message
+
+	msgs      chan *Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPublishSession(conn *ServerConn, streamName string) *PublishSession {
+	v := &PublishSession{conn: conn, streamName: streamName}
+
+	v.msgs = make(chan *Message, sessionChannelSize)
+	v.Messages = v.msgs
+	v.done = make(chan struct{})
+
+	return v
+}
+
+func (v *PublishSession) StreamName() string {
+	return v.streamName
+}
+
+// The error when publisher quit, which is available after messages closed.
+func (v *PublishSession) Err() error {
+	return v.err
+}
+
+func (v *PublishSession) Close() error {
+	v.closeOnce.Do(func() {
+		close(v.done)
+	})
+	return v.conn.Close()
+}
+
+func (v *PublishSession) cycle() {
+	defer close(v.msgs)
+
+	for {
+		m, err := v.conn.proto.ReadMessage()
+		if err != nil {
+			v.err = oe.WithMessage(err, "read message")
+			return
+		}
+
+		switch m.MessageType {
+		case MessageTypeAudio, MessageTypeVideo, MessageTypeAMF0Data, MessageTypeAMF3Data:
+			select {
+			case v.msgs <- m:
+			case <-v.done:
+				v.err = io.EOF
+				return
+			}
+		case MessageTypeAMF0Command, MessageTypeAMF3Command:
+			if quit, err := v.onCommand(m); err != nil || quit {
+				v.err = err
+				return
+			}
+		}
+	}
+}
+
+func (v *PublishSession) onCommand(m *Message) (quit bool, err error) {
+	var pkt Packet
+	if pkt, err = v.conn.proto.DecodeMessage(m); err != nil {
+		return true, oe.WithMessage(err, "decode command")
+	}
+
+	call, ok := pkt.(*CallPacket)
+	if !ok {
+		return
+	}
+
+	switch call.CommandName {
+	case commandFCUnpublish:
+		onFCUnpublish := NewOnStatusCallPacket(statusCodeUnpublishSuccess, "Stop publishing stream.")
+		onFCUnpublish.CommandName = commandOnFCUnpublish
+		if err = v.conn.proto.WritePacket(onFCUnpublish, defaultStreamID); err != nil {
+			return true, oe.WithMessage(err, "write onFCUnpublish")
+		}
+
+		if err = v.conn.proto.WritePacket(NewFMLEStartResPacket(call.TransactionID), defaultStreamID); err != nil {
+			return true, oe.WithMessage(err, "write FCUnpublish response")
+		}
+
+		onStatus := NewOnStatusCallPacket(statusCodeUnpublishSuccess, "Stream is now unpublished.")
+		if err = v.conn.proto.WritePacket(onStatus, defaultStreamID); err != nil {
+			return true, oe.WithMessage(err, "write onStatus")
+		}
+	case commandDeleteStream, commandCloseStream:
+		return true, io.EOF
+	}
+
+	return
+}
+
+// The play session, user can send the audio, video and data messages to player.
+type PlaySession struct {
+	conn       *ServerConn
+	streamName string
+
+	// The audio, video and data messages to send to player in order.
+	// @remark User should select with Done, which is closed when player quit.
+	// @remark The message is copied before sending, so it's ok to send one message to many players.
+	Messages chan<- *Message
+
+	msgs chan *Message
+	done chan struct{}
+
+	err      error
+	quitOnce sync.Once
+}
+
+func newPlaySession(conn *ServerConn, streamName string) *PlaySession {
+	v := &PlaySession{conn: conn, streamName: streamName}
+
+	v.msgs = make(chan *Message, sessionChannelSize)
+	v.Messages = v.msgs
+	v.done = make(chan struct{})
+
+	return v
+}
+
+func (v *PlaySession) StreamName() string {
+	return v.streamName
+}
+
+// The error when player quit, which is available after done.
+func (v *PlaySession) Err() error {
+	return v.err
+}
+
+// The done channel, closed when player quit.
+func (v *PlaySession) Done() <-chan struct{} {
+	return v.done
+}
+
+func (v *PlaySession) Close() error {
+	v.quit(io.EOF)
+	return v.conn.Close()
+}
+
+func (v *PlaySession) quit(err error) {
+	v.quitOnce.Do(func() {
+		v.err = err
+		close(v.done)
+	})
+}
+
+// Read messages from player, to detect the player quit.
+func (v *PlaySession) readCycle() {
+	for {
+		m, err := v.conn.proto.ExpectMessage(MessageTypeAMF0Command, MessageTypeAMF3Command)
+		if err != nil {
+			v.quit(oe.WithMessage(err, "read message"))
+			return
+		}
+
+		pkt, err := v.conn.proto.DecodeMessage(m)
+		if err != nil {
+			v.quit(oe.WithMessage(err, "decode command"))
+			return
+		}
+
+		if call, ok := pkt.(*CallPacket); ok {
+			switch call.CommandName {
+			case commandDeleteStream, commandCloseStream:
+				v.quit(io.EOF)
+				return
+			}
+		}
+	}
+}
+
+// Write the audio, video and data messages to player.
+func (v *PlaySession) writeCycle() {
+	for {
+		var m *Message
+		select {
+		case m = <-v.msgs:
+		case <-v.done:
+			return
+		}
+
+		cid := chunkIDOverStream
+		switch m.MessageType {
+		case MessageTypeAudio:
+			cid = chunkIDAudio
+		case MessageTypeVideo:
+			cid = chunkIDVideo
+		}
+
+		// Never modify the message, which may be shared by players.
+		msg := *m
+		msg.streamID = defaultStreamID
+		msg.betterCid = cid
+
+		if err := v.conn.proto.WriteMessage(&msg); err != nil {
+			v.quit(oe.WithMessage(err, "write message"))
+			return
+		}
+	}
+}
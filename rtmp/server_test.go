@@ -0,0 +1,281 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// The mock client, which reads messages in goroutine, because the net.Pipe is not buffered,
+// while the server writes many packets without waiting for the client.
+type mockClient struct {
+	t     *testing.T
+	conn  net.Conn
+	proto *Protocol
+	msgs  chan *Message
+}
+
+func newMockClient(t *testing.T, c net.Conn) *mockClient {
+	hs := NewComplexHandshake(rand.New(rand.NewSource(0)))
+	if err := hs.ClientHandshake(c); err != nil {
+		t.Fatalf("handshake failed %+v", err)
+	}
+
+	v := &mockClient{t: t, conn: c, proto: NewProtocol(c), msgs: make(chan *Message, 64)}
+	go func() {
+		defer close(v.msgs)
+		for {
+			m, err := v.proto.ReadMessage()
+			if err != nil {
+				return
+			}
+			v.msgs <- m
+		}
+	}()
+	return v
+}
+
+func (v *mockClient) write(pkt Packet, streamID int) {
+	if err := v.proto.WritePacket(pkt, streamID); err != nil {
+		v.t.Fatalf("write %T failed %+v", pkt, err)
+	}
+}
+
+func (v *mockClient) expectCall(name string) *CallPacket {
+	for m := range v.msgs {
+		if m.MessageType != MessageTypeAMF0Command {
+			continue
+		}
+		pkt, err := v.proto.DecodeMessage(m)
+		if err != nil {
+			v.t.Fatalf("decode failed %+v", err)
+		}
+		if call, ok := pkt.(*CallPacket); ok && string(call.CommandName) == name {
+			return call
+		}
+	}
+	v.t.Fatalf("no %v", name)
+	return nil
+}
+
+func (v *mockClient) expectStatus(code string) {
+	call := v.expectCall(string(commandOnStatus))
+	if args, ok := call.Args.(*amf0.Object); !ok {
+		v.t.Errorf("invalid args %v", call.Args)
+	} else if c, ok := args.Get("code").(*amf0.String); !ok || string(*c) != code {
+		v.t.Errorf("invalid code %v, expect %v", args.Get("code"), code)
+	}
+}
+
+func (v *mockClient) expectMessage(mt MessageType) *Message {
+	for m := range v.msgs {
+		if m.MessageType == mt {
+			return m
+		}
+	}
+	v.t.Fatalf("no message %v", mt)
+	return nil
+}
+
+func (v *mockClient) connect() {
+	connectApp := NewConnectAppPacket()
+	connectApp.CommandObject.Set("app", amf0.NewString("live"))
+	connectApp.CommandObject.Set("tcUrl", amf0.NewString("rtmp://localhost/live"))
+	v.write(connectApp, 0)
+
+	for m := range v.msgs {
+		if m.MessageType != MessageTypeAMF0Command {
+			continue
+		}
+		pkt, err := v.proto.DecodeMessage(m)
+		if err != nil {
+			v.t.Fatalf("decode failed %+v", err)
+		}
+		if _, ok := pkt.(*ConnectAppResPacket); ok {
+			break
+		}
+	}
+
+	createStream := NewCreateStreamPacket()
+	v.write(createStream, 0)
+	for m := range v.msgs {
+		if m.MessageType != MessageTypeAMF0Command {
+			continue
+		}
+		pkt, err := v.proto.DecodeMessage(m)
+		if err != nil {
+			v.t.Fatalf("decode failed %+v", err)
+		}
+		if res, ok := pkt.(*CreateStreamResPacket); ok {
+			if res.StreamID != defaultStreamID {
+				v.t.Errorf("invalid stream id %v", res.StreamID)
+			}
+			break
+		}
+	}
+}
+
+func TestServerConn_Publish(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	sc := NewServerConn(s)
+	sessions := make(chan Session, 1)
+	go func() {
+		sess, err := sc.Accept()
+		if err != nil {
+			t.Errorf("accept failed %+v", err)
+		}
+		sessions <- sess
+	}()
+
+	client := newMockClient(t, c)
+
+	// The FMLE start packets before create stream.
+	releaseStream := NewCallPacket()
+	releaseStream.CommandName = commandReleaseStream
+	releaseStream.TransactionID = 2
+	releaseStream.CommandObject = amf0.NewNull()
+	releaseStream.Args = amf0.NewString("livestream")
+	client.write(releaseStream, 0)
+
+	client.connect()
+
+	publish := NewPublishPacket()
+	publish.StreamName = "livestream"
+	client.write(publish, defaultStreamID)
+	client.expectCall(string(commandOnFCPublish))
+	client.expectStatus(statusCodePublishStart)
+
+	sess := <-sessions
+	ps, ok := sess.(*PublishSession)
+	if !ok {
+		t.Fatalf("invalid session %T", sess)
+	}
+	if sc.TcURL != "rtmp://localhost/live" || sc.App != "live" {
+		t.Errorf("invalid tcUrl=%v, app=%v", sc.TcURL, sc.App)
+	}
+	if ps.StreamName() != "livestream" {
+		t.Errorf("invalid stream %v", ps.StreamName())
+	}
+
+	for _, mt := range []MessageType{MessageTypeAMF0Data, MessageTypeVideo, MessageTypeAudio} {
+		m := NewStreamMessage(defaultStreamID)
+		m.MessageType = mt
+		m.Timestamp = 40
+		m.Payload = []byte{byte(mt), 0x01, 0x02}
+		if err := client.proto.WriteMessage(m); err != nil {
+			t.Fatalf("write message failed %+v", err)
+		}
+	}
+
+	// The messages are in the order of publisher.
+	for _, mt := range []MessageType{MessageTypeAMF0Data, MessageTypeVideo, MessageTypeAudio} {
+		m := <-ps.Messages
+		if m.MessageType != mt || m.Timestamp != 40 || len(m.Payload) != 3 || m.Payload[0] != byte(mt) {
+			t.Errorf("invalid message %v %v %v", m.MessageType, m.Timestamp, m.Payload)
+		}
+	}
+
+	deleteStream := NewCallPacket()
+	deleteStream.CommandName = commandDeleteStream
+	deleteStream.CommandObject = amf0.NewNull()
+	deleteStream.Args = amf0.NewNumber(defaultStreamID)
+	client.write(deleteStream, 0)
+
+	if _, ok := <-ps.Messages; ok {
+		t.Error("messages should be closed")
+	}
+	if ps.Err() != io.EOF {
+		t.Errorf("invalid err %+v", ps.Err())
+	}
+}
+
+func TestServerConn_Play(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	sc := NewServerConn(s)
+	sessions := make(chan Session, 1)
+	go func() {
+		sess, err := sc.Accept()
+		if err != nil {
+			t.Errorf("accept failed %+v", err)
+		}
+		sessions <- sess
+	}()
+
+	client := newMockClient(t, c)
+	client.connect()
+
+	play := NewPlayPacket()
+	play.StreamName = "livestream?token=xxx"
+	client.write(play, defaultStreamID)
+	client.expectStatus(statusCodePlayReset)
+	client.expectStatus(statusCodePlayStart)
+
+	sess := <-sessions
+	ps, ok := sess.(*PlaySession)
+	if !ok {
+		t.Fatalf("invalid session %T", sess)
+	}
+	if ps.StreamName() != "livestream?token=xxx" {
+		t.Errorf("invalid stream %v", ps.StreamName())
+	}
+
+	sampleAccess := client.expectMessage(MessageTypeAMF0Data)
+	if pkt, err := client.proto.DecodeMessage(sampleAccess); err != nil {
+		t.Errorf("decode failed %+v", err)
+	} else if _, ok := pkt.(*SampleAccessPacket); !ok {
+		t.Errorf("invalid packet %T", pkt)
+	}
+
+	video := NewMessage()
+	video.MessageType = MessageTypeVideo
+	video.Timestamp = 80
+	video.Payload = bytes.Repeat([]byte{0x17}, 300)
+	ps.Messages <- video
+
+	if m := client.expectMessage(MessageTypeVideo); m.Timestamp != 80 || !bytes.Equal(m.Payload, video.Payload) {
+		t.Errorf("invalid video %v %vB", m.Timestamp, len(m.Payload))
+	} else if m.streamID != defaultStreamID {
+		t.Errorf("invalid stream id %v", m.streamID)
+	}
+
+	c.Close()
+	select {
+	case <-ps.Done():
+	case <-time.After(3 * time.Second):
+		t.Error("play session should be done")
+	}
+	if ps.Err() == nil {
+		t.Error("should error")
+	}
+}
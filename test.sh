@@ -18,13 +18,21 @@ function coverage() {
 
 coverage github.com/ossrs/go-oryx-lib/aac
 coverage github.com/ossrs/go-oryx-lib/amf0
-coverage github.com/ossrs/go-oryx-lib/asprocess
+coverage github.com/ossrs/go-oryx-lib/amf3
+coverage github.com/ossrs/go-oryx-lib/av1
 coverage github.com/ossrs/go-oryx-lib/avc
+coverage github.com/ossrs/go-oryx-lib/errors
 coverage github.com/ossrs/go-oryx-lib/flv
+coverage github.com/ossrs/go-oryx-lib/hevc
 coverage github.com/ossrs/go-oryx-lib/http
 coverage github.com/ossrs/go-oryx-lib/https
 coverage github.com/ossrs/go-oryx-lib/json
 coverage github.com/ossrs/go-oryx-lib/kxps
 coverage github.com/ossrs/go-oryx-lib/logger
+coverage github.com/ossrs/go-oryx-lib/mp3
 coverage github.com/ossrs/go-oryx-lib/options
+coverage github.com/ossrs/go-oryx-lib/opus
 coverage github.com/ossrs/go-oryx-lib/rtmp
+coverage github.com/ossrs/go-oryx-lib/ts
+coverage github.com/ossrs/go-oryx-lib/vpx
+coverage github.com/ossrs/go-oryx-lib/websocket
@@ -0,0 +1,436 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"bytes"
+
+	"github.com/ossrs/go-oryx-lib/aac"
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/hevc"
+	"github.com/ossrs/go-oryx-lib/mp3"
+	"github.com/ossrs/go-oryx-lib/opus"
+)
+
+// The FLV tag converted from TS frame.
+type Tag struct {
+	Type flv.TagType
+	// The DTS in ms.
+	Timestamp uint32
+	Data      []byte
+}
+
+// The converter to convert the TS frames to FLV tags, for example, to bridge TS to RTMP.
+// The sequence header is generated when changed, from the SPS and PPS of AVC, the VPS, SPS
+// and PPS of HEVC, the ADTS header of AAC and the descriptor of Opus.
+// @remark The HEVC and Opus are converted to Enhanced RTMP.
+type FLVConverter interface {
+	// Convert the frame to FLV tags, a PES of audio may contains more than one frames.
+	// @remark The video frames before sequence header are dropped.
+	Convert(frame *Frame) (tags []*Tag, err error)
+}
+
+type flvConverter struct {
+	vp flv.VideoPackager
+	ap flv.AudioPackager
+
+	// The last DTS in 90kHz, unwrapped from 33bits.
+	hasLast bool
+	last    uint64
+
+	// The parameter sets of video sequence header, nil if not present.
+	vps, sps, pps []byte
+	// For AAC, to decode the ADTS, and the last ASC in sequence header.
+	adts aac.ADTS
+	asc  []byte
+	// For Opus, the channels in sequence header.
+	opusChannels uint8
+}
+
+func NewFLVConverter() (FLVConverter, error) {
+	vp, err := flv.NewVideoPackager()
+	if err != nil {
+		return nil, errors.WithMessage(err, "video packager")
+	}
+
+	ap, err := flv.NewAudioPackager()
+	if err != nil {
+		return nil, errors.WithMessage(err, "audio packager")
+	}
+
+	adts, err := aac.NewADTS()
+	if err != nil {
+		return nil, errors.WithMessage(err, "adts")
+	}
+
+	return &flvConverter{vp: vp, ap: ap, adts: adts}, nil
+}
+
+// Unwrap the 33bits timestamp, by the last one.
+func (v *flvConverter) unwrap(ts uint64) uint64 {
+	ts &= clockMask
+	if !v.hasLast {
+		v.hasLast, v.last = true, ts
+		return ts
+	}
+
+	// Guess the timestamp nearest to the last one.
+	ts |= v.last &^ clockMask
+	if ts+clockMask/2 < v.last {
+		ts += clockMask + 1
+	} else if ts > v.last+clockMask/2 && ts > clockMask {
+		ts -= clockMask + 1
+	}
+
+	v.last = ts
+	return ts
+}
+
+func (v *flvConverter) Convert(frame *Frame) (tags []*Tag, err error) {
+	dts := v.unwrap(frame.DTS)
+
+	// The CTS in 33bits, which maybe negative.
+	cts := int64((frame.PTS - frame.DTS) & clockMask)
+	if cts > int64(clockMask/2) {
+		cts -= int64(clockMask) + 1
+	}
+
+	switch t := frame.Stream.Type; t {
+	case StreamTypeH264, StreamTypeH265:
+		return v.convertVideo(frame, dts, int32(cts/msToClock))
+	case StreamTypeAAC:
+		return v.convertAAC(frame, dts)
+	case StreamTypeMPEG1Audio, StreamTypeMPEG2Audio:
+		return v.convertMP3(frame, dts)
+	case StreamTypePrivateData:
+		if _, ok := opusChannelConfig(frame.Stream); ok {
+			return v.convertOpus(frame, dts)
+		}
+		return nil, errors.Errorf("unsupported private data %v", frame.Stream.PID)
+	default:
+		return nil, errors.Errorf("unsupported %v", t)
+	}
+}
+
+func (v *flvConverter) videoTag(timestamp uint64, frame *flv.VideoFrame) (*Tag, error) {
+	// For HEVC, use the Enhanced RTMP.
+	if frame.CodecID == flv.VideoCodecHEVC {
+		frame.IsExHeader, frame.FourCC, frame.PacketType = true, flv.VideoFourCCHEVC, flv.VideoPacketTypeCodedFrames
+		if frame.Trait == flv.VideoFrameTraitSequenceHeader {
+			frame.PacketType = flv.VideoPacketTypeSequenceStart
+		}
+	}
+
+	b, err := v.vp.Encode(frame)
+	if err != nil {
+		return nil, errors.WithMessage(err, "encode video")
+	}
+	return &Tag{Type: flv.TagTypeVideo, Timestamp: uint32(timestamp / msToClock), Data: b}, nil
+}
+
+func (v *flvConverter) convertVideo(frame *Frame, dts uint64, cts int32) (tags []*Tag, err error) {
+	nalus, err := avc.SplitAnnexB(frame.Payload)
+	if err != nil {
+		return nil, errors.WithMessage(err, "split")
+	}
+
+	isHEVC := frame.Stream.Type == StreamTypeH265
+	codec := flv.VideoCodecAVC
+	if isHEVC {
+		codec = flv.VideoCodecHEVC
+	}
+
+	// Pick the AUD and parameter sets, and detect the keyframe by NALU.
+	var vps, sps, pps []byte
+	var units [][]byte
+	var keyframe bool
+	for _, nalu := range nalus {
+		if isHEVC {
+			if len(nalu) < 2 {
+				continue
+			}
+			switch t := hevc.NALUType((nalu[0] >> 1) & 0x3f); t {
+			case hevc.NALUType_AUD_NUT:
+			case hevc.NALUType_VPS_NUT:
+				vps = nalu
+			case hevc.NALUType_SPS_NUT:
+				sps = nalu
+			case hevc.NALUType_PPS_NUT:
+				pps = nalu
+			default:
+				keyframe = keyframe || (t >= hevc.NALUType_BLA_W_LP && t <= hevc.NALUType_RSV_IRAP_VCL23)
+				units = append(units, nalu)
+			}
+		} else {
+			switch t := avc.NALUType(nalu[0] & 0x1f); t {
+			case avc.NALUTypeAccessUnitDelimiter:
+			case avc.NALUTypeSPS:
+				sps = nalu
+			case avc.NALUTypePPS:
+				pps = nalu
+			default:
+				keyframe = keyframe || t == avc.NALUTypeIDR
+				units = append(units, nalu)
+			}
+		}
+	}
+
+	// Generate the sequence header when parameter sets changed.
+	if sps != nil && pps != nil && (!isHEVC || vps != nil) &&
+		(!bytes.Equal(vps, v.vps) || !bytes.Equal(sps, v.sps) || !bytes.Equal(pps, v.pps)) {
+		var r interface {
+			MarshalBinary() ([]byte, error)
+		}
+		if isHEVC {
+			r, err = hevc.NewHEVCDecoderConfigurationRecordFromNALUs(vps, sps, pps)
+		} else {
+			r, err = avc.NewAVCDecoderConfigurationRecordFromNALUs(sps, pps)
+		}
+		if err != nil {
+			return nil, errors.WithMessage(err, "sequence header")
+		}
+
+		b, err := r.MarshalBinary()
+		if err != nil {
+			return nil, errors.WithMessage(err, "marshal sequence header")
+		}
+
+		tag, err := v.videoTag(dts, &flv.VideoFrame{CodecID: codec, FrameType: flv.VideoFrameTypeKeyframe,
+			Trait: flv.VideoFrameTraitSequenceHeader, Raw: b,
+		})
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+
+		v.vps = append([]byte(nil), vps...)
+		v.sps = append([]byte(nil), sps...)
+		v.pps = append([]byte(nil), pps...)
+	}
+
+	// Drop the frames before sequence header, which is not decodable.
+	if len(units) == 0 || v.sps == nil {
+		return tags, nil
+	}
+
+	raw, err := avc.AnnexBToLengthPrefixed(avc.JoinAnnexB(units), 3)
+	if err != nil {
+		return nil, errors.WithMessage(err, "length prefixed")
+	}
+
+	frameType := flv.VideoFrameTypeInterframe
+	if keyframe {
+		frameType = flv.VideoFrameTypeKeyframe
+	}
+
+	tag, err := v.videoTag(dts, &flv.VideoFrame{CodecID: codec, FrameType: frameType,
+		Trait: flv.VideoFrameTraitNALU, CTS: cts, Raw: raw,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(tags, tag), nil
+}
+
+func (v *flvConverter) audioTag(timestamp uint64, frame *flv.AudioFrame) (*Tag, error) {
+	b, err := v.ap.Encode(frame)
+	if err != nil {
+		return nil, errors.WithMessage(err, "encode audio")
+	}
+	return &Tag{Type: flv.TagTypeAudio, Timestamp: uint32(timestamp / msToClock), Data: b}, nil
+}
+
+// Convert the ADTS frames to AAC raw frames, the timestamp is increased by samples.
+// @remark For AAC, the SoundRate is always 44kHz and SoundType is stereo.
+func (v *flvConverter) convertAAC(frame *Frame, dts uint64) (tags []*Tag, err error) {
+	var samples uint64
+	for b := frame.Payload; len(b) > 0; {
+		var raw []byte
+		if raw, b, err = v.adts.Decode(b); err != nil {
+			return nil, errors.WithMessage(err, "adts")
+		}
+
+		asc := v.adts.ASC()
+		if b, err := asc.MarshalBinary(); err != nil {
+			return nil, errors.WithMessage(err, "asc")
+		} else if !bytes.Equal(b, v.asc) {
+			tag, err := v.audioTag(dts, &flv.AudioFrame{SoundFormat: flv.AudioCodecAAC,
+				SoundRate: flv.AudioSamplingRate44kHz, SoundSize: flv.AudioSampleBits16bits, SoundType: flv.AudioChannelsStereo,
+				Trait: flv.AudioFrameTraitSequenceHeader, Raw: b,
+			})
+			if err != nil {
+				return nil, err
+			}
+			tags, v.asc = append(tags, tag), b
+		}
+
+		tag, err := v.audioTag(dts+samples*ClockRate/uint64(asc.SampleRateHz()), &flv.AudioFrame{SoundFormat: flv.AudioCodecAAC,
+			SoundRate: flv.AudioSamplingRate44kHz, SoundSize: flv.AudioSampleBits16bits, SoundType: flv.AudioChannelsStereo,
+			Trait: flv.AudioFrameTraitRaw, Raw: raw,
+		})
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+
+		if asc.FrameLengthFlag {
+			samples += 960
+		} else {
+			samples += 1024
+		}
+	}
+	return
+}
+
+// Convert the MP3 frames, the timestamp is increased by samples.
+func (v *flvConverter) convertMP3(frame *Frame, dts uint64) (tags []*Tag, err error) {
+	var elapsed uint64
+	for b := frame.Payload; len(b) > 0; {
+		h := &mp3.FrameHeader{}
+		if err = h.UnmarshalBinary(b); err != nil {
+			return nil, errors.WithMessage(err, "mp3")
+		}
+
+		size := h.FrameSize()
+		if size <= 0 || size > len(b) {
+			size = len(b)
+		}
+
+		f := &flv.AudioFrame{SoundFormat: flv.AudioCodecMP3, SoundSize: flv.AudioSampleBits16bits, Raw: b[:size]}
+		switch sr := h.SampleRate(); {
+		case sr >= 32000:
+			f.SoundRate = flv.AudioSamplingRate44kHz
+		case sr >= 16000:
+			f.SoundRate = flv.AudioSamplingRate22kHz
+		default:
+			f.SoundRate = flv.AudioSamplingRate11kHz
+		}
+		if h.ChannelMode != mp3.ChannelModeMono {
+			f.SoundType = flv.AudioChannelsStereo
+		}
+
+		tag, err := v.audioTag(dts+elapsed, f)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+
+		elapsed += uint64(h.Samples()) * ClockRate / uint64(h.SampleRate())
+		b = b[size:]
+	}
+	return
+}
+
+// Get the channel_config_code of Opus stream, by the registration and extension descriptor.
+func opusChannelConfig(s *Stream) (code uint8, ok bool) {
+	var isOpus bool
+	for _, d := range s.Descriptors {
+		if v, ok := d.FormatIdentifier(); ok && v == FormatIdentifierOpus {
+			isOpus = true
+		}
+		if v, ok := d.OpusChannelConfig(); ok {
+			code = v
+		}
+	}
+	return code, isOpus
+}
+
+// Convert the Opus access units to Enhanced RTMP, remove the control header.
+// Refer to @doc ETSI_TS_opus-v0.1.3-draft.pdf, @page 8, @section 6.1 Opus access unit
+func (v *flvConverter) convertOpus(frame *Frame, dts uint64) (tags []*Tag, err error) {
+	// Generate the OpusHead, only support mono and stereo, by the channel_config_code.
+	if code, _ := opusChannelConfig(frame.Stream); code != v.opusChannels {
+		if code != 1 && code != 2 {
+			return nil, errors.Errorf("unsupported opus channel config %#x", code)
+		}
+
+		h := opus.NewOpusHead()
+		h.ChannelCount, h.InputSampleRate = code, opus.SampleRate
+		b, err := h.MarshalBinary()
+		if err != nil {
+			return nil, errors.WithMessage(err, "opus head")
+		}
+
+		tag, err := v.audioTag(dts, &flv.AudioFrame{SoundFormat: flv.AudioCodecExHeader, IsExHeader: true,
+			FourCC: flv.AudioFourCCOpus, PacketType: flv.AudioPacketTypeSequenceStart, Raw: b,
+		})
+		if err != nil {
+			return nil, err
+		}
+		tags, v.opusChannels = append(tags, tag), code
+	}
+
+	var elapsed uint64
+	for b := frame.Payload; len(b) > 0; {
+		// The 11bits control_header_prefix 0x3ff, then the flags.
+		if len(b) < 2 || b[0] != 0x7f || (b[1]&0xe0) != 0xe0 {
+			return nil, errors.New("invalid opus control header")
+		}
+		flags := b[1]
+		b = b[2:]
+
+		// The au_size, by a sequence of 0xff.
+		var size int
+		for {
+			if len(b) < 1 {
+				return nil, errors.New("no opus au size")
+			}
+			c := b[0]
+			size, b = size+int(c), b[1:]
+			if c != 0xff {
+				break
+			}
+		}
+
+		// The trim_start, trim_end and the control extension.
+		var skip int
+		if (flags & 0x10) == 0x10 {
+			skip += 2
+		}
+		if (flags & 0x08) == 0x08 {
+			skip += 2
+		}
+		if (flags&0x04) == 0x04 && len(b) > skip {
+			skip += 1 + int(b[skip])
+		}
+		if len(b) < skip+size {
+			return nil, errors.Errorf("requires %v only %v bytes", skip+size, len(b))
+		}
+		au := b[skip : skip+size]
+		b = b[skip+size:]
+
+		tag, err := v.audioTag(dts+elapsed, &flv.AudioFrame{SoundFormat: flv.AudioCodecExHeader, IsExHeader: true,
+			FourCC: flv.AudioFourCCOpus, PacketType: flv.AudioPacketTypeCodedFrames, Raw: au,
+		})
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+
+		if n, err := opus.PacketSamples(au); err == nil {
+			elapsed += uint64(n) * ClockRate / opus.SampleRate
+		}
+	}
+	return
+}
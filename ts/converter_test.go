@@ -0,0 +1,258 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/hevc"
+	"github.com/ossrs/go-oryx-lib/opus"
+)
+
+// The parameter sets which are parsable, 1280x720 for AVC and 1920x1080 for HEVC.
+var (
+	testAVCSPS = []byte{0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xb9}
+	testAVCPPS = []byte{0x68, 0xee, 0x3c, 0x80}
+
+	testHEVCVPS = []byte{
+		0x40, 0x01, 0x0c, 0x03, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03,
+		0x00, 0x00, 0x03, 0x00, 0x78, 0x40, 0x00, 0x5a, 0x15, 0xc0, 0xc0, 0x00, 0x00, 0x03, 0x00, 0x40,
+		0x00, 0x00, 0x06, 0x54,
+	}
+	testHEVCSPS = []byte{
+		0x42, 0x01, 0x03, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
+		0x00, 0x78, 0x40, 0x00, 0x5a, 0xa0, 0x03, 0xc0, 0x80, 0x11, 0x07, 0xcb, 0x96, 0x57, 0x2b, 0xc9,
+		0x22, 0x5a, 0xaa, 0xaa, 0xac, 0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xea, 0xaa, 0xe6,
+		0xd6, 0xbf, 0x9d, 0x02, 0xfc, 0x05, 0xa8, 0x08, 0x08, 0x08, 0x7e, 0x00, 0x00, 0x03, 0x00, 0x02,
+		0x00, 0x00, 0x03, 0x00, 0x32, 0xc0, 0x0b, 0xde, 0xfc, 0x01, 0xf4, 0x00, 0x1f, 0x41, 0xc0, 0x1f,
+		0x40, 0x01, 0xf4, 0x16, 0x03, 0x25, 0xa0, 0x80, 0x41,
+	}
+	testHEVCPPS = []byte{0x44, 0x01, 0xc0, 0xf2, 0x8a, 0x40, 0x92, 0x0a, 0x37, 0x13, 0x19}
+)
+
+// Mux the FLV tags to TS, then demux and convert to FLV tags.
+func convertTestTags(t *testing.T, tags []*Tag) (video, audio []*Tag) {
+	var w bytes.Buffer
+	m, _ := NewMuxer(&w)
+	for _, tag := range tags {
+		if err := m.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	d, _ := NewDemuxer(&w)
+	c, err := NewFLVConverter()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for _, frame := range readTestFrames(t, d) {
+		tags, err := c.Convert(frame)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		for _, tag := range tags {
+			if tag.Type == flv.TagTypeVideo {
+				video = append(video, tag)
+			} else {
+				audio = append(audio, tag)
+			}
+		}
+	}
+	return
+}
+
+func compareTestTags(t *testing.T, tags, expect []*Tag) {
+	if len(tags) != len(expect) {
+		t.Fatalf("invalid tags %v, expect %v", len(tags), len(expect))
+	}
+	for i, tag := range tags {
+		if tag.Type != expect[i].Type || tag.Timestamp != expect[i].Timestamp || !bytes.Equal(tag.Data, expect[i].Data) {
+			t.Errorf("invalid tag %v, %v %v %#x, expect %v %#x", i, tag.Type, tag.Timestamp, tag.Data, expect[i].Timestamp, expect[i].Data)
+		}
+	}
+}
+
+func TestFLVConverter_AVCAAC(t *testing.T) {
+	vp, _ := flv.NewVideoPackager()
+	ap, _ := flv.NewAudioPackager()
+
+	r, err := avc.NewAVCDecoderConfigurationRecordFromNALUs(testAVCSPS, testAVCPPS)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var video, audio []*Tag
+	tag, _ := vp.Encode(&flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitSequenceHeader, Raw: mustMarshal(t, r)})
+	video = append(video, &Tag{Type: flv.TagTypeVideo, Data: tag})
+
+	tag, _ = ap.Encode(&flv.AudioFrame{SoundFormat: flv.AudioCodecAAC, SoundRate: flv.AudioSamplingRate44kHz,
+		SoundSize: flv.AudioSampleBits16bits, SoundType: flv.AudioChannelsStereo,
+		Trait: flv.AudioFrameTraitSequenceHeader, Raw: []byte{0x12, 0x10}})
+	audio = append(audio, &Tag{Type: flv.TagTypeAudio, Data: tag})
+
+	for i := 0; i < 30; i++ {
+		frame := &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeInterframe,
+			Trait: flv.VideoFrameTraitNALU, CTS: int32(i%3) * 40, Raw: newTestNALU([]byte{0x41, 0x9a}, 50)}
+		if i%10 == 0 {
+			frame.FrameType, frame.Raw = flv.VideoFrameTypeKeyframe, newTestNALU([]byte{0x65, 0x88}, 1000)
+		}
+		tag, _ = vp.Encode(frame)
+		video = append(video, &Tag{Type: flv.TagTypeVideo, Timestamp: uint32(i * 40), Data: tag})
+
+		tag, _ = ap.Encode(&flv.AudioFrame{SoundFormat: flv.AudioCodecAAC, SoundRate: flv.AudioSamplingRate44kHz,
+			SoundSize: flv.AudioSampleBits16bits, SoundType: flv.AudioChannelsStereo,
+			Trait: flv.AudioFrameTraitRaw, Raw: []byte{0x21, 0x10, 0x04, 0x60, byte(i)}})
+		audio = append(audio, &Tag{Type: flv.TagTypeAudio, Timestamp: uint32(i * 23), Data: tag})
+	}
+
+	// The tags are interleaved by timestamp.
+	var tags []*Tag
+	tags = append(tags, video[0], audio[0])
+	for i := 1; i < len(video); i++ {
+		tags = append(tags, video[i], audio[i])
+	}
+
+	// The converted tags are same to the source.
+	v, a := convertTestTags(t, tags)
+	compareTestTags(t, v, video)
+	compareTestTags(t, a, audio)
+}
+
+func TestFLVConverter_HEVC(t *testing.T) {
+	vp, _ := flv.NewVideoPackager()
+
+	r, err := hevc.NewHEVCDecoderConfigurationRecordFromNALUs(testHEVCVPS, testHEVCSPS, testHEVCPPS)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var video []*Tag
+	for i, frame := range []*flv.VideoFrame{
+		{PacketType: flv.VideoPacketTypeSequenceStart, FrameType: flv.VideoFrameTypeKeyframe, Raw: mustMarshal(t, r)},
+		{PacketType: flv.VideoPacketTypeCodedFrames, FrameType: flv.VideoFrameTypeKeyframe, CTS: 40, Raw: newTestNALU([]byte{0x26, 0x01}, 300)},
+		{PacketType: flv.VideoPacketTypeCodedFrames, FrameType: flv.VideoFrameTypeInterframe, CTS: -40, Raw: newTestNALU([]byte{0x02, 0x01}, 30)},
+	} {
+		frame.IsExHeader, frame.FourCC = true, flv.VideoFourCCHEVC
+		tag, err := vp.Encode(frame)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		video = append(video, &Tag{Type: flv.TagTypeVideo, Timestamp: uint32(i * 40), Data: tag})
+	}
+	video[1].Timestamp = 0
+
+	v, _ := convertTestTags(t, video)
+	compareTestTags(t, v, video)
+}
+
+func TestFLVConverter_Audio(t *testing.T) {
+	c, _ := NewFLVConverter()
+
+	// The two ADTS frames in a PES, the timestamp of second frame is 1024/44100s.
+	adts := []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x3f, 0xfc, 0x21, 0x10}
+	tags, err := c.Convert(&Frame{Stream: &Stream{Type: StreamTypeAAC}, PTS: 9000, DTS: 9000, Payload: append(adts, adts...)})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(tags) != 3 || tags[0].Data[1] != 0x00 || tags[1].Timestamp != 100 || tags[2].Timestamp != 123 {
+		t.Errorf("invalid tags %v", tags)
+	}
+	if !bytes.Equal(tags[0].Data, []byte{0xaf, 0x00, 0x12, 0x10}) || !bytes.Equal(tags[2].Data, []byte{0xaf, 0x01, 0x21, 0x10}) {
+		t.Errorf("invalid tags %#x %#x", tags[0].Data, tags[2].Data)
+	}
+
+	// The two MP3 frames in a PES, 1152 samples in 44.1kHz.
+	mp3 := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+	if tags, err = c.Convert(&Frame{Stream: &Stream{Type: StreamTypeMPEG1Audio}, Payload: append(mp3, mp3...)}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(tags) != 2 || tags[1].Timestamp != 26 || !bytes.Equal(tags[0].Data[1:], mp3) || tags[0].Data[0] != 0x2f {
+		t.Errorf("invalid tags %v", tags)
+	}
+
+	// The two Opus access units in a PES, with trim and extension, 20ms each.
+	stream := newOpusStream(2)
+	au := []byte{0xfc, 0x01, 0x02}
+	payload := append([]byte{0x7f, 0xe0, 3}, au...)
+	payload = append(payload, 0x7f, 0xfc, 3, 0x00, 0x01, 0x00, 0x02, 0x01, 0xaa)
+	payload = append(payload, au...)
+	if tags, err = c.Convert(&Frame{Stream: stream, PTS: 90, DTS: 90, Payload: payload}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(tags) != 3 || tags[1].Timestamp != 1 || tags[2].Timestamp != 21 {
+		t.Fatalf("invalid tags %v", tags)
+	}
+
+	ap, _ := flv.NewAudioPackager()
+	if frame, err := ap.Decode(tags[0].Data); err != nil || frame.PacketType != flv.AudioPacketTypeSequenceStart {
+		t.Errorf("invalid opus head %v %+v", frame, err)
+	} else if h := opus.NewOpusHead(); h.UnmarshalBinary(frame.Raw) != nil || h.ChannelCount != 2 {
+		t.Errorf("invalid opus head %v", h)
+	}
+	if frame, err := ap.Decode(tags[2].Data); err != nil || frame.FourCC != flv.AudioFourCCOpus || !bytes.Equal(frame.Raw, au) {
+		t.Errorf("invalid opus %v %+v", frame, err)
+	}
+
+	// The invalid Opus control header, and unsupported stream.
+	if _, err = c.Convert(&Frame{Stream: stream, Payload: []byte{0x7f, 0x00, 0x01, 0xfc}}); err == nil {
+		t.Error("should fail")
+	}
+	if _, err = c.Convert(&Frame{Stream: &Stream{Type: StreamTypeLATM}, Payload: []byte{0x56}}); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestFLVConverter_Timestamp(t *testing.T) {
+	c, _ := NewFLVConverter()
+
+	// The timestamp wraps at 33bits, about 26.5 hours.
+	var last uint32
+	for i, dts := range []uint64{clockMask - 2*ClockRate, clockMask, 0, 2 * ClockRate, clockMask - ClockRate, 3 * ClockRate} {
+		tags, err := c.Convert(&Frame{Stream: &Stream{Type: StreamTypeMPEG1Audio}, PTS: dts, DTS: dts,
+			Payload: append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...),
+		})
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		// The timestamp in ms of 33bits is 95443717.
+		if i > 0 && tags[0].Timestamp < last && i != 4 {
+			t.Errorf("invalid timestamp %v, last %v", tags[0].Timestamp, last)
+		}
+		last = tags[0].Timestamp
+	}
+	if last != 95443717+3000 {
+		t.Errorf("invalid timestamp %v", last)
+	}
+
+	// The frames before video sequence header are dropped.
+	tags, err := c.Convert(&Frame{Stream: &Stream{Type: StreamTypeH264}, Payload: avc.JoinAnnexB([][]byte{{0x65, 0x88}})})
+	if err != nil || len(tags) != 0 {
+		t.Errorf("invalid tags %v %+v", tags, err)
+	}
+}
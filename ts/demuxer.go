@@ -0,0 +1,484 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The options for demuxer.
+type DemuxerOptions struct {
+	// Callback when the stream is corrupt, for example, the continuity counter error, the
+	// sync byte lost or the PSI CRC32 mismatch, the corrupt data is dropped.
+	OnCorrupt func(err *CorruptError)
+}
+
+// The corrupt data in TS, reported by DemuxerOptions.OnCorrupt.
+type CorruptError struct {
+	// The offset of packet in stream.
+	Offset int64
+	PID    PID
+	Reason string
+	// The bytes skipped to resync, when sync byte lost.
+	Skipped int64
+}
+
+func (v *CorruptError) Error() string {
+	if v.Skipped > 0 {
+		return fmt.Sprintf("%v at %v, skip %v bytes", v.Reason, v.Offset, v.Skipped)
+	}
+	return fmt.Sprintf("PID %v %v at %v", v.PID, v.Reason, v.Offset)
+}
+
+// The elementary stream frame, the payload of PES.
+type Frame struct {
+	// The stream in PMT, with the stream type and descriptors.
+	Stream   *Stream
+	StreamID StreamID
+	// The PTS and DTS in 90kHz, DTS equals to PTS if absent.
+	HasPTS bool
+	PTS    uint64
+	DTS    uint64
+	// The random_access_indicator of the first packet, for example, the keyframe.
+	RandomAccess bool
+	// Whether any discontinuity before the frame, for example, the discontinuity_indicator or
+	// the continuity counter error, the timestamp may jump.
+	Discontinuity bool
+	// The elementary stream data.
+	Payload []byte
+}
+
+func (v *Frame) String() string {
+	return fmt.Sprintf("%v PID=%v, pts=%v, dts=%v, payload=%vB", v.Stream.Type, v.Stream.PID, v.PTS, v.DTS, len(v.Payload))
+}
+
+// The demuxer to demux TS to elementary stream frames, for example, from a file,
+// UDP multicast or SRT. The PAT and PMT are parsed, and the PES is reassembled.
+type Demuxer interface {
+	// Read the next frame of elementary streams in PMT.
+	// @remark Return io.EOF when there is no more frame.
+	ReadFrame() (frame *Frame, err error)
+	// The PAT, nil if not parsed.
+	PAT() *PAT
+	// The PMT of programs in PAT, ignore the PMT not parsed.
+	PMTs() []*PMT
+	// Close the demuxer.
+	Close() error
+}
+
+// The state of PID, for PSI section or PES.
+type pidState struct {
+	// The last continuity counter.
+	hasCounter bool
+	counter    uint8
+	// Whether the last packet is duplicated, which is allowed once.
+	duplicated bool
+	// Whether discontinuity before the next PES.
+	discontinuity bool
+
+	// Whether got the start of PSI section or PES.
+	started bool
+	buf     []byte
+	// The random access of PES.
+	randomAccess bool
+}
+
+// Drop the data of PSI section or PES.
+func (v *pidState) reset() {
+	v.started, v.buf, v.randomAccess = false, nil, false
+}
+
+type demuxer struct {
+	r    *bufio.Reader
+	opts *DemuxerOptions
+	// The offset of next packet.
+	offset int64
+	eof    bool
+
+	pat *PAT
+	// The PMT of each PMT PID.
+	pmts map[PID]*PMT
+	// The elementary stream of each PID.
+	streams map[PID]*Stream
+	pids    map[PID]*pidState
+	frames  []*Frame
+}
+
+func NewDemuxer(r io.Reader) (Demuxer, error) {
+	return NewDemuxerWithOptions(r, nil)
+}
+
+func NewDemuxerWithOptions(r io.Reader, opts *DemuxerOptions) (Demuxer, error) {
+	if opts == nil {
+		opts = &DemuxerOptions{}
+	}
+
+	return &demuxer{
+		r: bufio.NewReader(r), opts: opts,
+		pmts: make(map[PID]*PMT), streams: make(map[PID]*Stream), pids: make(map[PID]*pidState),
+	}, nil
+}
+
+func (v *demuxer) Close() error {
+	return nil
+}
+
+func (v *demuxer) PAT() *PAT {
+	return v.pat
+}
+
+func (v *demuxer) PMTs() (pmts []*PMT) {
+	if v.pat == nil {
+		return
+	}
+
+	for _, p := range v.pat.Programs {
+		if pmt, ok := v.pmts[p.PID]; ok && p.Number != 0 {
+			pmts = append(pmts, pmt)
+		}
+	}
+	return
+}
+
+func (v *demuxer) ReadFrame() (frame *Frame, err error) {
+	for len(v.frames) == 0 {
+		if v.eof {
+			return nil, io.EOF
+		}
+
+		var b []byte
+		if b, err = v.readPacket(); err == io.EOF {
+			v.eof = true
+			v.flushAll()
+			continue
+		} else if err != nil {
+			return
+		}
+
+		v.onPacket(b)
+		v.offset += PacketSize
+	}
+
+	frame, v.frames = v.frames[0], v.frames[1:]
+	return
+}
+
+func (v *demuxer) notifyCorrupt(err *CorruptError) {
+	if v.opts.OnCorrupt != nil {
+		v.opts.OnCorrupt(err)
+	}
+}
+
+// Read a packet, resync if the sync byte lost, by the sync byte of next packet.
+func (v *demuxer) readPacket() ([]byte, error) {
+	var skipped int64
+	defer func() {
+		if skipped > 0 {
+			v.notifyCorrupt(&CorruptError{Offset: v.offset - skipped, Reason: "sync byte lost", Skipped: skipped})
+		}
+	}()
+
+	for {
+		b, err := v.r.Peek(2 * PacketSize)
+		if len(b) < PacketSize {
+			if err == io.EOF {
+				// Skip the partial packet at the end.
+				if len(b) > 0 {
+					skipped += int64(len(b))
+					v.offset += int64(len(b))
+				}
+				return nil, io.EOF
+			}
+			return nil, errors.Wrap(err, "peek")
+		}
+
+		// Near the end of stream, there is no next packet to confirm.
+		if b[0] == SyncByte && (len(b) < 2*PacketSize || b[PacketSize] == SyncByte) {
+			p := make([]byte, PacketSize)
+			if _, err = io.ReadFull(v.r, p); err != nil {
+				return nil, errors.Wrap(err, "read packet")
+			}
+			return p, nil
+		}
+
+		// Skip the byte not sync, and find the next sync byte.
+		if _, err = v.r.ReadByte(); err != nil {
+			return nil, errors.Wrap(err, "skip byte")
+		}
+		skipped++
+		v.offset++
+	}
+}
+
+func (v *demuxer) state(pid PID) *pidState {
+	s, ok := v.pids[pid]
+	if !ok {
+		s = &pidState{}
+		v.pids[pid] = s
+	}
+	return s
+}
+
+// Whether the PID is PSI, the PAT or PMT.
+func (v *demuxer) isPSI(pid PID) bool {
+	if pid == PIDPAT {
+		return true
+	}
+	if v.pat != nil {
+		for _, p := range v.pat.Programs {
+			if p.PID == pid && p.Number != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *demuxer) onPacket(b []byte) {
+	p := NewPacket()
+	if err := p.UnmarshalBinary(b); err != nil {
+		v.notifyCorrupt(&CorruptError{Offset: v.offset, PID: PID(b[1]&0x1f)<<8 | PID(b[2]), Reason: err.Error()})
+		return
+	}
+
+	// Ignore the null, error and scrambled packets.
+	if p.PID == PIDNull || p.TransportError || p.ScramblingControl != 0 {
+		return
+	}
+
+	isPSI, stream := v.isPSI(p.PID), v.streams[p.PID]
+	if !isPSI && stream == nil {
+		return
+	}
+
+	// Check the continuity counter, only for packets with payload.
+	s := v.state(p.PID)
+	discontinuity := p.AdaptationField != nil && p.AdaptationField.Discontinuity
+	if p.Payload != nil {
+		if s.hasCounter && !discontinuity {
+			if p.ContinuityCounter == s.counter && !s.duplicated {
+				s.duplicated = true
+				return
+			}
+
+			if expect := (s.counter + 1) & 0x0f; p.ContinuityCounter != expect {
+				v.notifyCorrupt(&CorruptError{Offset: v.offset, PID: p.PID,
+					Reason: fmt.Sprintf("continuity counter %v, expect %v", p.ContinuityCounter, expect),
+				})
+				s.reset()
+				s.discontinuity = true
+			}
+		}
+		s.hasCounter, s.counter, s.duplicated = true, p.ContinuityCounter, false
+	}
+	if discontinuity {
+		s.discontinuity = true
+	}
+
+	if p.Payload == nil {
+		return
+	}
+
+	if isPSI {
+		v.onPSI(p, s)
+	} else {
+		v.onPES(p, s, stream)
+	}
+}
+
+// Reassemble the PSI sections, which may across packets, or multiple in a packet.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 57, @section 2.4.4.2 Semantics definition of fields in pointer syntax
+func (v *demuxer) onPSI(p *Packet, s *pidState) {
+	b := p.Payload
+	if p.PayloadUnitStart {
+		// The adaptation field may fill the packet, without the pointer field.
+		if len(b) == 0 {
+			v.notifyCorrupt(&CorruptError{Offset: v.offset, PID: p.PID, Reason: "no pointer field"})
+			s.reset()
+			return
+		}
+
+		pointer := int(b[0])
+		if b = b[1:]; pointer > len(b) {
+			v.notifyCorrupt(&CorruptError{Offset: v.offset, PID: p.PID, Reason: fmt.Sprintf("invalid pointer %v", pointer)})
+			s.reset()
+			return
+		}
+
+		// The bytes before pointer, is the end of previous section.
+		if s.started {
+			s.buf = append(s.buf, b[:pointer]...)
+			v.parseSections(p.PID, s)
+		}
+
+		s.reset()
+		s.started, b = true, b[pointer:]
+	}
+
+	if s.started {
+		s.buf = append(s.buf, b...)
+		v.parseSections(p.PID, s)
+	}
+}
+
+func (v *demuxer) parseSections(pid PID, s *pidState) {
+	for s.started && len(s.buf) >= 3 {
+		// The stuffing bytes after sections.
+		if s.buf[0] == 0xff {
+			s.reset()
+			return
+		}
+
+		size := 3 + (int(s.buf[1]&0x0f)<<8 | int(s.buf[2]))
+		if len(s.buf) < size {
+			return
+		}
+
+		section := s.buf[:size]
+		s.buf = s.buf[size:]
+
+		if err := v.onSection(pid, section); err != nil {
+			v.notifyCorrupt(&CorruptError{Offset: v.offset, PID: pid, Reason: err.Error()})
+		}
+	}
+}
+
+func (v *demuxer) onSection(pid PID, section []byte) error {
+	tableID := TableID(section[0])
+
+	if pid == PIDPAT && tableID == TableIDPAT {
+		pat := NewPAT()
+		if err := pat.UnmarshalBinary(section); err != nil {
+			return errors.WithMessage(err, "pat")
+		}
+		v.pat = pat
+
+		// Remove the PMT not in PAT.
+		for p := range v.pmts {
+			if !v.isPSI(p) {
+				delete(v.pmts, p)
+			}
+		}
+		v.updateStreams()
+		return nil
+	}
+
+	// Ignore other tables, for example, the SCTE-35.
+	if pid == PIDPAT || tableID != TableIDPMT {
+		return nil
+	}
+
+	pmt := NewPMT()
+	if err := pmt.UnmarshalBinary(section); err != nil {
+		return errors.WithMessage(err, "pmt")
+	}
+
+	if o, ok := v.pmts[pid]; ok && o.Version == pmt.Version {
+		return nil
+	}
+	v.pmts[pid] = pmt
+	v.updateStreams()
+	return nil
+}
+
+// Update the elementary streams by PMTs, flush the PES of removed streams.
+func (v *demuxer) updateStreams() {
+	streams := make(map[PID]*Stream)
+	for _, pmt := range v.pmts {
+		for _, s := range pmt.Streams {
+			streams[s.PID] = s
+		}
+	}
+
+	for pid, s := range v.streams {
+		if _, ok := streams[pid]; !ok {
+			if state, ok := v.pids[pid]; ok {
+				v.flushPES(s, state)
+				delete(v.pids, pid)
+			}
+		}
+	}
+	v.streams = streams
+}
+
+// Reassemble the PES, which ends at the start of next PES, or by the PES_packet_length.
+func (v *demuxer) onPES(p *Packet, s *pidState, stream *Stream) {
+	if p.PayloadUnitStart {
+		v.flushPES(stream, s)
+		s.started = true
+		s.randomAccess = p.AdaptationField != nil && p.AdaptationField.RandomAccess
+	}
+
+	// Ignore the packets before the first PES.
+	if !s.started {
+		return
+	}
+	s.buf = append(s.buf, p.Payload...)
+
+	if len(s.buf) >= 6 {
+		if size := int(s.buf[4])<<8 | int(s.buf[5]); size > 0 && len(s.buf) >= 6+size {
+			v.flushPES(stream, s)
+		}
+	}
+}
+
+func (v *demuxer) flushPES(stream *Stream, s *pidState) {
+	if !s.started || len(s.buf) == 0 {
+		s.reset()
+		return
+	}
+
+	b, randomAccess := s.buf, s.randomAccess
+	s.reset()
+
+	pes := NewPES()
+	if err := pes.UnmarshalBinary(b); err != nil {
+		v.notifyCorrupt(&CorruptError{Offset: v.offset, PID: stream.PID, Reason: err.Error()})
+		return
+	}
+
+	v.frames = append(v.frames, &Frame{
+		Stream: stream, StreamID: pes.StreamID, HasPTS: pes.HasPTS, PTS: pes.PTS, DTS: pes.DTS,
+		RandomAccess: randomAccess, Discontinuity: s.discontinuity, Payload: pes.Payload,
+	})
+	s.discontinuity = false
+}
+
+// Flush the PES of all streams, in the order of PID.
+func (v *demuxer) flushAll() {
+	var pids []int
+	for pid := range v.streams {
+		pids = append(pids, int(pid))
+	}
+	sort.Ints(pids)
+
+	for _, pid := range pids {
+		if s, ok := v.pids[PID(pid)]; ok {
+			v.flushPES(v.streams[PID(pid)], s)
+		}
+	}
+}
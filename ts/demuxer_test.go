@@ -0,0 +1,291 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ossrs/go-oryx-lib/flv"
+)
+
+// Mux the AVC and AAC frames to TS, the keyframe is 1000 bytes, which is 6 packets.
+func newTestTS(t *testing.T) []byte {
+	var w bytes.Buffer
+	m, _ := NewMuxer(&w)
+
+	if err := m.WriteVideo(0, &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitSequenceHeader, Raw: newTestAVCSequenceHeader(t)}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := m.WriteAudio(0, &flv.AudioFrame{SoundFormat: flv.AudioCodecAAC, Trait: flv.AudioFrameTraitSequenceHeader,
+		Raw: []byte{0x12, 0x10}}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		frame := &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeInterframe,
+			Trait: flv.VideoFrameTraitNALU, CTS: 40, Raw: newTestNALU([]byte{0x41, 0x9a}, 50)}
+		if i%2 == 0 {
+			frame.FrameType, frame.Raw = flv.VideoFrameTypeKeyframe, newTestNALU([]byte{0x65, 0x88}, 1000)
+		}
+		if err := m.WriteVideo(uint32(i*40), frame); err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		if err := m.WriteAudio(uint32(i*23), &flv.AudioFrame{SoundFormat: flv.AudioCodecAAC,
+			Trait: flv.AudioFrameTraitRaw, Raw: []byte{0x21, 0x10, 0x04, 0x60, 0x8c, 0x1c}}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	return w.Bytes()
+}
+
+func readTestFrames(t *testing.T, d Demuxer) (frames []*Frame) {
+	for {
+		frame, err := d.ReadFrame()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestDemuxer(t *testing.T) {
+	d, err := NewDemuxer(bytes.NewReader(newTestTS(t)))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer d.Close()
+
+	frames := readTestFrames(t, d)
+	if len(frames) != 8 {
+		t.Fatalf("invalid frames %v", len(frames))
+	}
+
+	if pat := d.PAT(); pat == nil || len(pat.Programs) != 1 || pat.Programs[0].PID != PIDPMT {
+		t.Errorf("invalid pat %v", pat)
+	}
+	if pmts := d.PMTs(); len(pmts) != 1 || len(pmts[0].Streams) != 2 || pmts[0].PCRPID != PIDVideo {
+		t.Errorf("invalid pmts %v", pmts)
+	}
+
+	for i, f := range frames {
+		n := i / 2
+		if i%2 == 0 {
+			if f.Stream.Type != StreamTypeH264 || f.StreamID != StreamIDVideo || f.DTS != uint64(n*40*90) ||
+				f.PTS != uint64((n*40+40)*90) || f.RandomAccess != (n%2 == 0) || f.Discontinuity {
+				t.Errorf("invalid video %v", f)
+			}
+			if !bytes.HasPrefix(f.Payload, []byte{0, 0, 0, 1, 0x09, 0xf0}) {
+				t.Errorf("invalid video payload %#x", f.Payload[:8])
+			}
+		} else {
+			if f.Stream.Type != StreamTypeAAC || f.StreamID != StreamIDAudio || f.PTS != uint64(n*23*90) ||
+				f.DTS != f.PTS || len(f.Payload) != 13 || f.RandomAccess {
+				t.Errorf("invalid audio %v", f)
+			}
+		}
+	}
+}
+
+func TestDemuxer_Continuity(t *testing.T) {
+	b := newTestTS(t)
+
+	// The PAT, PMT, then 6 packets of keyframe, drop the second one.
+	lost := append(append([]byte(nil), b[:3*PacketSize]...), b[4*PacketSize:]...)
+
+	var errs []*CorruptError
+	d, _ := NewDemuxerWithOptions(bytes.NewReader(lost), &DemuxerOptions{
+		OnCorrupt: func(err *CorruptError) {
+			errs = append(errs, err)
+		},
+	})
+
+	frames := readTestFrames(t, d)
+	if len(errs) != 1 || errs[0].PID != PIDVideo || errs[0].Offset != 3*PacketSize ||
+		!strings.Contains(errs[0].Error(), "continuity counter 2, expect 1") {
+		t.Fatalf("invalid errors %v", errs)
+	}
+
+	// The first keyframe is dropped, and the next video is discontinuity.
+	if len(frames) != 7 || frames[0].Stream.PID != PIDAudio || frames[1].Stream.PID != PIDVideo {
+		t.Fatalf("invalid frames %v", len(frames))
+	}
+	if !frames[1].Discontinuity || frames[0].Discontinuity || frames[3].Discontinuity {
+		t.Errorf("invalid discontinuity %v %v %v", frames[0], frames[1], frames[3])
+	}
+
+	// The duplicated packet is allowed once.
+	dup := append(append([]byte(nil), b[:4*PacketSize]...), b[3*PacketSize:]...)
+	errs = nil
+	d, _ = NewDemuxerWithOptions(bytes.NewReader(dup), &DemuxerOptions{
+		OnCorrupt: func(err *CorruptError) {
+			errs = append(errs, err)
+		},
+	})
+	if frames = readTestFrames(t, d); len(frames) != 8 || len(errs) != 0 {
+		t.Errorf("invalid frames %v, errors %v", len(frames), errs)
+	}
+}
+
+func TestDemuxer_DiscontinuityIndicator(t *testing.T) {
+	var w bytes.Buffer
+	m := &muxer{w: &w, counters: make(map[PID]uint8)}
+	m.setStream(&m.audio, &Stream{Type: StreamTypeAAC, PID: PIDAudio})
+	if err := m.writePSI(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for i, e := range []struct {
+		cc uint8
+		af *AdaptationField
+	}{
+		{0, nil}, {1, nil}, {5, &AdaptationField{Discontinuity: true}}, {6, nil},
+	} {
+		pes, _ := (&PES{StreamID: StreamIDAudio, HasPTS: true, PTS: uint64(i * 1000), Payload: []byte{0xff, 0xf1}}).MarshalBinary()
+		p := &Packet{PayloadUnitStart: true, PID: PIDAudio, ContinuityCounter: e.cc, AdaptationField: e.af, Payload: pes}
+		w.Write(mustMarshal(t, p))
+	}
+
+	var errs []*CorruptError
+	d, _ := NewDemuxerWithOptions(&w, &DemuxerOptions{
+		OnCorrupt: func(err *CorruptError) {
+			errs = append(errs, err)
+		},
+	})
+
+	frames := readTestFrames(t, d)
+	if len(frames) != 4 || len(errs) != 0 {
+		t.Fatalf("invalid frames %v, errors %v", len(frames), errs)
+	}
+	if frames[1].Discontinuity || !frames[2].Discontinuity || frames[3].Discontinuity {
+		t.Errorf("invalid discontinuity")
+	}
+}
+
+func TestDemuxer_Resync(t *testing.T) {
+	b := newTestTS(t)
+
+	// Insert garbage after PAT, and a partial packet at the end.
+	var corrupt []byte
+	corrupt = append(corrupt, b[:PacketSize]...)
+	corrupt = append(corrupt, SyncByte, 0x01, 0x02, SyncByte, 0x03)
+	corrupt = append(corrupt, b[PacketSize:]...)
+	corrupt = append(corrupt, SyncByte, 0x00)
+
+	var errs []*CorruptError
+	d, _ := NewDemuxerWithOptions(bytes.NewReader(corrupt), &DemuxerOptions{
+		OnCorrupt: func(err *CorruptError) {
+			errs = append(errs, err)
+		},
+	})
+
+	if frames := readTestFrames(t, d); len(frames) != 8 {
+		t.Errorf("invalid frames %v", len(frames))
+	}
+	if len(errs) != 2 || errs[0].Offset != PacketSize || errs[0].Skipped != 5 || errs[1].Skipped != 2 {
+		t.Errorf("invalid errors %v", errs)
+	}
+}
+
+func TestDemuxer_EmptyPayload(t *testing.T) {
+	// The PAT with payload unit start, but the adaptation field of 183 bytes fills the packet, the
+	// continuity counter is 15, so the next PAT is continuous.
+	empty := []byte{SyncByte, 0x40, 0x00, 0x3f, 183, 0x00}
+	empty = append(empty, bytes.Repeat([]byte{0xff}, PacketSize-len(empty))...)
+
+	var errs []*CorruptError
+	d, _ := NewDemuxerWithOptions(bytes.NewReader(append(empty, newTestTS(t)...)), &DemuxerOptions{
+		OnCorrupt: func(err *CorruptError) {
+			errs = append(errs, err)
+		},
+	})
+
+	if frames := readTestFrames(t, d); len(frames) != 8 {
+		t.Errorf("invalid frames %v", len(frames))
+	}
+	if len(errs) != 1 || errs[0].PID != PIDPAT || errs[0].Offset != 0 {
+		t.Errorf("invalid errors %v", errs)
+	}
+}
+
+func TestDemuxer_PSI(t *testing.T) {
+	var w bytes.Buffer
+	m := &muxer{w: &w, counters: make(map[PID]uint8)}
+
+	// The PMT across packets, with a large descriptor.
+	pmt := &PMT{ProgramNumber: 1, PCRPID: PIDAudio, Streams: []*Stream{{Type: StreamTypeAAC, PID: PIDAudio,
+		Descriptors: []*Descriptor{{Tag: DescriptorTagISO639, Data: []byte("eng\x00")}, {Tag: 0xf0, Data: make([]byte, 200)}},
+	}}}
+	pat := &PAT{TransportStreamID: 1, Programs: []*Program{{Number: 0, PID: 0x10}, {Number: 1, PID: PIDPMT}}}
+
+	// The corrupt PMT, version 1, is ignored.
+	pmt1 := mustMarshal(t, &PMT{ProgramNumber: 1, Version: 1, PCRPID: PIDAudio})
+	pmt1[len(pmt1)-1]++
+
+	for _, e := range []struct {
+		pid     PID
+		payload []byte
+	}{
+		{PIDPAT, append([]byte{0x00}, mustMarshal(t, pat)...)},
+		{PIDPMT, append([]byte{0x00}, mustMarshal(t, pmt)...)},
+		{PIDPMT, append([]byte{0x00}, pmt1...)},
+	} {
+		if err := m.writePackets(e.pid, e.payload, nil, true); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	// The audio PES, and a PES of unknown PID.
+	for _, pid := range []PID{PIDAudio, 0x200} {
+		pes, _ := (&PES{StreamID: StreamIDAudio, HasPTS: true, Payload: []byte{0xff, 0xf1}}).MarshalBinary()
+		w.Write(mustMarshal(t, &Packet{PayloadUnitStart: true, PID: pid, Payload: pes}))
+	}
+
+	var errs []*CorruptError
+	d, _ := NewDemuxerWithOptions(&w, &DemuxerOptions{
+		OnCorrupt: func(err *CorruptError) {
+			errs = append(errs, err)
+		},
+	})
+
+	frames := readTestFrames(t, d)
+	if len(frames) != 1 || frames[0].Stream.PID != PIDAudio {
+		t.Fatalf("invalid frames %v", frames)
+	}
+	if len(errs) != 1 || errs[0].PID != PIDPMT || !strings.Contains(errs[0].Reason, "crc32") {
+		t.Errorf("invalid errors %v", errs)
+	}
+
+	pmts := d.PMTs()
+	if len(pmts) != 1 || pmts[0].Version != 0 || len(pmts[0].Streams) != 1 {
+		t.Fatalf("invalid pmts %v", pmts)
+	}
+	if s := pmts[0].Streams[0]; len(s.Descriptors) != 2 || string(s.Descriptors[0].Data) != "eng\x00" || len(s.Descriptors[1].Data) != 200 {
+		t.Errorf("invalid descriptors %v", s.Descriptors)
+	}
+}
@@ -0,0 +1,139 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts_test
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/ts"
+)
+
+func ExampleMuxer() {
+	// To open a flv file, or http flv stream.
+	var r io.Reader
+	// To write the ts file, or to UDP or SRT.
+	var w io.Writer
+
+	var err error
+	var d flv.Demuxer
+	if d, err = flv.NewDemuxer(r); err != nil {
+		return
+	}
+	defer d.Close()
+
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		return
+	}
+
+	var m ts.Muxer
+	if m, err = ts.NewMuxer(w); err != nil {
+		return
+	}
+	defer m.Close()
+
+	for {
+		var tagType flv.TagType
+		var tagSize, timestamp uint32
+		if tagType, tagSize, timestamp, err = d.ReadTagHeader(); err != nil {
+			return
+		}
+
+		var tag []byte
+		if tag, err = d.ReadTag(tagSize); err != nil {
+			return
+		}
+
+		// The AVC, HEVC, AAC, MP3 and Opus are muxed to TS.
+		if err = m.WriteTag(tagType, timestamp, tag); err != nil {
+			return
+		}
+	}
+}
+
+func ExampleDemuxer() {
+	// To open a ts file, or from UDP or SRT.
+	var r io.Reader
+	// To write the flv file, or http flv stream.
+	var w io.Writer
+
+	var err error
+	var d ts.Demuxer
+	if d, err = ts.NewDemuxerWithOptions(r, &ts.DemuxerOptions{
+		OnCorrupt: func(err *ts.CorruptError) {
+			fmt.Println("Corrupt", err)
+		},
+	}); err != nil {
+		return
+	}
+	defer d.Close()
+
+	var m flv.Muxer
+	if m, err = flv.NewMuxer(w); err != nil {
+		return
+	}
+	defer m.Close()
+
+	if err = m.WriteHeader(true, true); err != nil {
+		return
+	}
+
+	var c ts.FLVConverter
+	if c, err = ts.NewFLVConverter(); err != nil {
+		return
+	}
+
+	for {
+		var frame *ts.Frame
+		if frame, err = d.ReadFrame(); err != nil {
+			return
+		}
+
+		// The AVC, HEVC, AAC, MP3 and Opus are converted to FLV tags.
+		var tags []*ts.Tag
+		if tags, err = c.Convert(frame); err != nil {
+			return
+		}
+
+		for _, tag := range tags {
+			if err = m.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func ExamplePacket() {
+	p := &ts.Packet{PayloadUnitStart: true, PID: ts.PIDVideo, AdaptationField: &ts.AdaptationField{
+		RandomAccess: true, HasPCR: true, PCR: 90000 * 300,
+	}}
+
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return
+	}
+	fmt.Println(len(b), fmt.Sprintf("%#x", b[:12]))
+
+	// Output:
+	// 188 0x47410020b7500000afc87e00
+}
@@ -0,0 +1,528 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"io"
+
+	"github.com/ossrs/go-oryx-lib/aac"
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/hevc"
+	"github.com/ossrs/go-oryx-lib/mp3"
+	"github.com/ossrs/go-oryx-lib/opus"
+)
+
+// The program number and transport stream id used by muxer.
+const (
+	programNumber     = 1
+	transportStreamID = 1
+)
+
+// The ratio of 90kHz clock to ms.
+const msToClock = ClockRate / 1000
+
+// For stream without video, the interval to write the PAT and PMT, in 90kHz.
+const psiInterval = ClockRate
+
+// The AUD(access unit delimiter) NALU, which starts each access unit in TS.
+var (
+	avcAUD  = []byte{0x09, 0xf0}
+	hevcAUD = []byte{0x46, 0x01, 0x50}
+)
+
+// The muxer to mux the FLV frames to TS, the PAT and PMT is written before the first PES,
+// and every video keyframe, the PCR is carried by video, or audio if no video.
+type Muxer interface {
+	// Write the FLV tag, decode by flv.VideoPackager or flv.AudioPackager, ignore the script data.
+	WriteTag(tagType flv.TagType, timestamp uint32, tag []byte) error
+	// Write the FLV video frame, AVC or HEVC, the timestamp is DTS in ms.
+	// @remark The sequence header is required before frames.
+	WriteVideo(timestamp uint32, frame *flv.VideoFrame) error
+	// Write the FLV audio frame, AAC, MP3 or Opus, the timestamp is in ms.
+	// @remark For AAC, the sequence header is required before frames.
+	WriteAudio(timestamp uint32, frame *flv.AudioFrame) error
+	// Close the muxer.
+	Close() error
+}
+
+type muxer struct {
+	w  io.Writer
+	vp flv.VideoPackager
+	ap flv.AudioPackager
+
+	// The video and audio stream in PMT, nil if not present.
+	video *Stream
+	audio *Stream
+	// Whether the PMT changed, or never written.
+	pmtChanged bool
+	pmtWritten bool
+	pmtVersion uint8
+	// The DTS of last PSI, for stream without video.
+	lastPSI uint64
+	// The continuity counter of each PID.
+	counters map[PID]uint8
+
+	// For AVC and HEVC, the codec and parameter sets from sequence header.
+	videoCodec         flv.VideoCodec
+	lengthSizeMinusOne uint8
+	parameterSets      [][]byte
+	// For AAC, to encode the raw to ADTS.
+	adts aac.ADTS
+	// For Opus, the channels from OpusHead.
+	opusChannels uint8
+}
+
+func NewMuxer(w io.Writer) (Muxer, error) {
+	vp, err := flv.NewVideoPackager()
+	if err != nil {
+		return nil, errors.WithMessage(err, "video packager")
+	}
+
+	ap, err := flv.NewAudioPackager()
+	if err != nil {
+		return nil, errors.WithMessage(err, "audio packager")
+	}
+
+	adts, err := aac.NewADTS()
+	if err != nil {
+		return nil, errors.WithMessage(err, "adts")
+	}
+
+	return &muxer{w: w, vp: vp, ap: ap, adts: adts, counters: make(map[PID]uint8)}, nil
+}
+
+func (v *muxer) Close() error {
+	return nil
+}
+
+func (v *muxer) WriteTag(tagType flv.TagType, timestamp uint32, tag []byte) error {
+	switch tagType {
+	case flv.TagTypeVideo:
+		frame, err := v.vp.Decode(tag)
+		if err != nil {
+			return errors.WithMessage(err, "decode video")
+		}
+		return v.WriteVideo(timestamp, frame)
+	case flv.TagTypeAudio:
+		frame, err := v.ap.Decode(tag)
+		if err != nil {
+			return errors.WithMessage(err, "decode audio")
+		}
+		return v.WriteAudio(timestamp, frame)
+	default:
+		return nil
+	}
+}
+
+func (v *muxer) WriteVideo(timestamp uint32, frame *flv.VideoFrame) error {
+	// Ignore the video info or command frame.
+	if frame.FrameType == flv.VideoFrameTypeInfo {
+		return nil
+	}
+
+	if frame.CodecID != flv.VideoCodecAVC && frame.CodecID != flv.VideoCodecHEVC {
+		if frame.IsExHeader {
+			return errors.Errorf("unsupported video %v", frame.FourCC)
+		}
+		return errors.Errorf("unsupported video %v", frame.CodecID)
+	}
+
+	if frame.Trait == flv.VideoFrameTraitSequenceHeader {
+		return v.setVideoSequenceHeader(frame)
+	}
+	// Ignore the end of sequence.
+	if frame.Trait != flv.VideoFrameTraitNALU {
+		return nil
+	}
+
+	if v.video == nil || v.videoCodec != frame.CodecID {
+		return errors.Errorf("no %v sequence header", frame.CodecID)
+	}
+
+	annexb, err := avc.LengthPrefixedToAnnexB(frame.Raw, v.lengthSizeMinusOne)
+	if err != nil {
+		return errors.WithMessage(err, "annexb")
+	}
+	if len(annexb) == 0 {
+		return nil
+	}
+
+	nalus, err := avc.SplitAnnexB(annexb)
+	if err != nil {
+		return errors.WithMessage(err, "split")
+	}
+
+	keyframe := frame.FrameType == flv.VideoFrameTypeKeyframe
+	es := v.videoAccessUnit(nalus, keyframe)
+
+	// The negative CTS near the start makes PTS negative, clamp to 0 rather than wrap.
+	dts, pts := uint64(timestamp)*msToClock, uint64(0)
+	if cts := int64(timestamp) + int64(frame.CTS); cts > 0 {
+		pts = uint64(cts) * msToClock
+	}
+	return v.writePES(v.video, pts, dts, keyframe, es)
+}
+
+func (v *muxer) setVideoSequenceHeader(frame *flv.VideoFrame) error {
+	var sets [][]byte
+	var streamType StreamType
+
+	if frame.CodecID == flv.VideoCodecAVC {
+		r := avc.NewAVCDecoderConfigurationRecord()
+		if err := r.UnmarshalBinary(frame.Raw); err != nil {
+			return errors.WithMessage(err, "avc sequence header")
+		}
+
+		for _, nalu := range append(r.SequenceParameterSetNALUnits, r.PictureParameterSetNALUnits...) {
+			b, err := nalu.MarshalBinary()
+			if err != nil {
+				return errors.WithMessage(err, "marshal")
+			}
+			sets = append(sets, b)
+		}
+		v.lengthSizeMinusOne, streamType = r.LengthSizeMinusOne, StreamTypeH264
+	} else {
+		r := hevc.NewHEVCDecoderConfigurationRecord()
+		if err := r.UnmarshalBinary(frame.Raw); err != nil {
+			return errors.WithMessage(err, "hevc sequence header")
+		}
+
+		nalus := append(r.VideoParameterSetNALUnits, r.SequenceParameterSetNALUnits...)
+		for _, nalu := range append(nalus, r.PictureParameterSetNALUnits...) {
+			b, err := nalu.MarshalBinary()
+			if err != nil {
+				return errors.WithMessage(err, "marshal")
+			}
+			sets = append(sets, b)
+		}
+		v.lengthSizeMinusOne, streamType = r.LengthSizeMinusOne, StreamTypeH265
+	}
+
+	v.videoCodec, v.parameterSets = frame.CodecID, sets
+	v.setStream(&v.video, &Stream{Type: streamType, PID: PIDVideo})
+	return nil
+}
+
+// Build the access unit in Annex B, starts with the AUD, and the parameter sets for keyframe.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 150, @section 2.14.1 Carriage of AVC in TS
+func (v *muxer) videoAccessUnit(nalus [][]byte, keyframe bool) []byte {
+	var hasAUD, hasParameterSets bool
+	for _, nalu := range nalus {
+		if v.videoCodec == flv.VideoCodecAVC {
+			switch avc.NALUType(nalu[0] & 0x1f) {
+			case avc.NALUTypeAccessUnitDelimiter:
+				hasAUD = true
+			case avc.NALUTypeSPS:
+				hasParameterSets = true
+			}
+		} else {
+			switch hevc.NALUType((nalu[0] >> 1) & 0x3f) {
+			case hevc.NALUType_AUD_NUT:
+				hasAUD = true
+			case hevc.NALUType_VPS_NUT, hevc.NALUType_SPS_NUT:
+				hasParameterSets = true
+			}
+		}
+	}
+
+	var units [][]byte
+	if !hasAUD {
+		if v.videoCodec == flv.VideoCodecAVC {
+			units = append(units, avcAUD)
+		} else {
+			units = append(units, hevcAUD)
+		}
+	}
+	if keyframe && !hasParameterSets {
+		units = append(units, v.parameterSets...)
+	}
+	return avc.JoinAnnexB(append(units, nalus...))
+}
+
+// Get the audio codec of frame, for Enhanced RTMP, by the FourCC.
+func audioCodecOf(frame *flv.AudioFrame) flv.AudioCodec {
+	if !frame.IsExHeader {
+		return frame.SoundFormat
+	}
+
+	switch frame.FourCC {
+	case flv.AudioFourCCAAC:
+		return flv.AudioCodecAAC
+	case flv.AudioFourCCMP3:
+		return flv.AudioCodecMP3
+	case flv.AudioFourCCOpus:
+		return flv.AudioCodecOpus
+	default:
+		return flv.AudioCodecExHeader
+	}
+}
+
+func (v *muxer) WriteAudio(timestamp uint32, frame *flv.AudioFrame) (err error) {
+	var es []byte
+
+	switch codec := audioCodecOf(frame); codec {
+	case flv.AudioCodecAAC:
+		if frame.Trait == flv.AudioFrameTraitSequenceHeader {
+			if err = v.adts.SetASC(frame.Raw); err != nil {
+				return errors.WithMessage(err, "aac sequence header")
+			}
+			v.setStream(&v.audio, &Stream{Type: StreamTypeAAC, PID: PIDAudio})
+			return nil
+		}
+		if frame.Trait != flv.AudioFrameTraitRaw {
+			return nil
+		}
+
+		if v.audio == nil || v.audio.Type != StreamTypeAAC {
+			return errors.New("no aac sequence header")
+		}
+		if es, err = v.adts.Encode(frame.Raw); err != nil {
+			return errors.WithMessage(err, "adts")
+		}
+	case flv.AudioCodecMP3, flv.AudioCodecMP3In8kHz:
+		if frame.IsExHeader && frame.Trait != flv.AudioFrameTraitRaw {
+			return nil
+		}
+
+		h := &mp3.FrameHeader{}
+		if err = h.UnmarshalBinary(frame.Raw); err != nil {
+			return errors.WithMessage(err, "mp3")
+		}
+
+		streamType := StreamTypeMPEG2Audio
+		if h.Version == mp3.Version1 {
+			streamType = StreamTypeMPEG1Audio
+		}
+		v.setStream(&v.audio, &Stream{Type: streamType, PID: PIDAudio})
+		es = frame.Raw
+	case flv.AudioCodecOpus:
+		if es, err = v.opusAccessUnit(frame); err != nil || es == nil {
+			return
+		}
+	default:
+		if frame.IsExHeader {
+			return errors.Errorf("unsupported audio %v", frame.FourCC)
+		}
+		return errors.Errorf("unsupported audio %v", codec)
+	}
+
+	pts := uint64(timestamp) * msToClock
+	return v.writePES(v.audio, pts, pts, v.video == nil, es)
+}
+
+// Build the Opus access unit, with the control header.
+// Refer to @doc ETSI_TS_opus-v0.1.3-draft.pdf, @page 8, @section 6.1 Opus access unit
+func (v *muxer) opusAccessUnit(frame *flv.AudioFrame) ([]byte, error) {
+	if frame.IsExHeader && frame.Trait == flv.AudioFrameTraitSequenceHeader {
+		h := opus.NewOpusHead()
+		if err := h.UnmarshalBinary(frame.Raw); err != nil {
+			return nil, errors.WithMessage(err, "opus head")
+		}
+		v.opusChannels = h.ChannelCount
+		v.setStream(&v.audio, newOpusStream(v.opusChannels))
+		return nil, nil
+	}
+
+	// For legacy Opus, the trait is flags of data.
+	if frame.IsExHeader && frame.Trait != flv.AudioFrameTraitRaw {
+		return nil, nil
+	}
+	if !frame.IsExHeader && (frame.Trait&flv.AudioFrameTraitOpusRaw) != flv.AudioFrameTraitOpusRaw {
+		return nil, nil
+	}
+
+	// Without the OpusHead, use the channels of TOC.
+	if v.opusChannels == 0 {
+		toc := &opus.TOC{}
+		if err := toc.UnmarshalBinary(frame.Raw); err != nil {
+			return nil, errors.WithMessage(err, "opus")
+		}
+
+		channels := uint8(1)
+		if toc.Stereo {
+			channels = 2
+		}
+		v.setStream(&v.audio, newOpusStream(channels))
+	}
+
+	// The 11bits prefix 0x3ff, and the flags of trim and extension are zero.
+	es := []byte{0x7f, 0xe0}
+	// The au_size, by a sequence of 0xff.
+	for n := len(frame.Raw); n >= 0; n -= 0xff {
+		if n < 0xff {
+			es = append(es, byte(n))
+		} else {
+			es = append(es, 0xff)
+		}
+	}
+	return append(es, frame.Raw...), nil
+}
+
+// The Opus stream, with the registration and extension descriptor.
+// Refer to @doc ETSI_TS_opus-v0.1.3-draft.pdf, @page 5, @section 5 Opus descriptors
+func newOpusStream(channels uint8) *Stream {
+	// The channel_config_code, 0xff for unknown.
+	code := channels
+	if channels > 8 {
+		code = 0xff
+	}
+
+	return &Stream{Type: StreamTypePrivateData, PID: PIDAudio, Descriptors: []*Descriptor{
+		{Tag: DescriptorTagRegistration, Data: []byte{'O', 'p', 'u', 's'}},
+		{Tag: DescriptorTagExtension, Data: []byte{descriptorTagExtensionOpus, code}},
+	}}
+}
+
+// Update the stream, increase the PMT version if changed.
+func (v *muxer) setStream(p **Stream, s *Stream) {
+	if o := *p; o != nil && o.Type == s.Type && equalDescriptors(o.Descriptors, s.Descriptors) {
+		return
+	}
+
+	*p = s
+	if v.pmtWritten {
+		v.pmtVersion = (v.pmtVersion + 1) & 0x1f
+	}
+	v.pmtChanged = true
+}
+
+func equalDescriptors(a, b []*Descriptor) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Tag != b[i].Tag || string(a[i].Data) != string(b[i].Data) {
+			return false
+		}
+	}
+	return true
+}
+
+// The PCR is carried by video, or audio if no video.
+func (v *muxer) pcrPID() PID {
+	if v.video != nil {
+		return v.video.PID
+	}
+	return v.audio.PID
+}
+
+func (v *muxer) writePSI() error {
+	pat := &PAT{TransportStreamID: transportStreamID, Programs: []*Program{
+		{Number: programNumber, PID: PIDPMT},
+	}}
+
+	pmt := &PMT{ProgramNumber: programNumber, Version: v.pmtVersion, PCRPID: v.pcrPID()}
+	for _, s := range []*Stream{v.video, v.audio} {
+		if s != nil {
+			pmt.Streams = append(pmt.Streams, s)
+		}
+	}
+
+	for _, e := range []struct {
+		pid PID
+		m   interface {
+			MarshalBinary() ([]byte, error)
+		}
+	}{
+		{PIDPAT, pat}, {PIDPMT, pmt},
+	} {
+		b, err := e.m.MarshalBinary()
+		if err != nil {
+			return errors.WithMessage(err, "marshal")
+		}
+
+		// The pointer_field, then the section.
+		if err = v.writePackets(e.pid, append([]byte{0x00}, b...), nil, true); err != nil {
+			return errors.WithMessage(err, "write")
+		}
+	}
+
+	v.pmtChanged, v.pmtWritten = false, true
+	return nil
+}
+
+// Write the PES of stream, the PSI is written before if required.
+func (v *muxer) writePES(s *Stream, pts, dts uint64, randomAccess bool, es []byte) error {
+	isVideo := s == v.video
+	if !v.pmtWritten || v.pmtChanged || (isVideo && randomAccess) || (v.video == nil && dts-v.lastPSI >= psiInterval) {
+		if err := v.writePSI(); err != nil {
+			return errors.WithMessage(err, "psi")
+		}
+		v.lastPSI = dts
+	}
+
+	pes := &PES{StreamID: StreamIDAudio, DataAlignment: true, HasPTS: true, PTS: pts, DTS: dts, Payload: es}
+	if isVideo {
+		pes.StreamID = StreamIDVideo
+	} else if s.Type == StreamTypePrivateData {
+		pes.StreamID = StreamIDPrivateStream1
+	}
+
+	b, err := pes.MarshalBinary()
+	if err != nil {
+		return errors.WithMessage(err, "marshal pes")
+	}
+
+	var af *AdaptationField
+	if hasPCR := s.PID == v.pcrPID(); randomAccess || hasPCR {
+		af = &AdaptationField{RandomAccess: randomAccess, HasPCR: hasPCR, PCR: dts * pcrRate}
+	}
+	return v.writePackets(s.PID, b, af, false)
+}
+
+// Write the payload in packets, the adaptation field is in the first packet.
+// For PSI, the last packet is stuffing by 0xff in payload, while by adaptation field for PES.
+func (v *muxer) writePackets(pid PID, b []byte, af *AdaptationField, isPSI bool) error {
+	for first := true; len(b) > 0; first = false {
+		p := &Packet{PID: pid, PayloadUnitStart: first, ContinuityCounter: v.counters[pid]}
+		v.counters[pid] = (v.counters[pid] + 1) & 0x0f
+
+		size := packetPayloadSize
+		if first && af != nil {
+			p.AdaptationField = af
+			size -= af.size()
+		}
+		if size > len(b) {
+			size = len(b)
+		}
+		p.Payload, b = b[:size], b[size:]
+
+		if isPSI && len(p.Payload) < packetPayloadSize {
+			stuffing := make([]byte, packetPayloadSize)
+			for i := copy(stuffing, p.Payload); i < len(stuffing); i++ {
+				stuffing[i] = 0xff
+			}
+			p.Payload = stuffing
+		}
+
+		data, err := p.MarshalBinary()
+		if err != nil {
+			return errors.WithMessage(err, "marshal packet")
+		}
+		if _, err = v.w.Write(data); err != nil {
+			return errors.Wrap(err, "write packet")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,467 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/hevc"
+	"github.com/ossrs/go-oryx-lib/opus"
+)
+
+// Demux the TS by the demuxer, any corrupt data is an error, the frames are grouped by PID.
+func demuxTestFrames(t *testing.T, b []byte) (Demuxer, map[PID][]*Frame) {
+	if len(b)%PacketSize != 0 {
+		t.Fatalf("invalid size %v", len(b))
+	}
+
+	d, err := NewDemuxerWithOptions(bytes.NewReader(b), &DemuxerOptions{
+		OnCorrupt: func(err *CorruptError) {
+			t.Errorf("%+v", err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	frames := make(map[PID][]*Frame)
+	for _, frame := range readTestFrames(t, d) {
+		frames[frame.Stream.PID] = append(frames[frame.Stream.PID], frame)
+	}
+	return d, frames
+}
+
+// The packets start a PES or PSI of PID, for the PSI repeating and PCR not exposed by the demuxer.
+func scanTestPackets(t *testing.T, b []byte, pid PID) (packets []*Packet) {
+	for ; len(b) >= PacketSize; b = b[PacketSize:] {
+		p := NewPacket()
+		if err := p.UnmarshalBinary(b[:PacketSize]); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if p.PID == pid && p.PayloadUnitStart {
+			packets = append(packets, p)
+		}
+	}
+	return
+}
+
+func newTestAVCSequenceHeader(t *testing.T) []byte {
+	r := avc.NewAVCDecoderConfigurationRecord()
+	r.LengthSizeMinusOne = 3
+	for _, e := range []struct {
+		b     []byte
+		units *[]*avc.NALU
+	}{
+		{[]byte{0x67, 0x42, 0x00, 0x1e}, &r.SequenceParameterSetNALUnits},
+		{[]byte{0x68, 0xce, 0x38, 0x80}, &r.PictureParameterSetNALUnits},
+	} {
+		nalu := avc.NewNALU()
+		if err := nalu.UnmarshalBinary(e.b); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		*e.units = append(*e.units, nalu)
+	}
+	return mustMarshal(t, r)
+}
+
+func newTestHEVCSequenceHeader(t *testing.T) []byte {
+	r := hevc.NewHEVCDecoderConfigurationRecord()
+	r.LengthSizeMinusOne = 3
+	for _, e := range []struct {
+		b     []byte
+		units *[]*hevc.NALU
+	}{
+		{[]byte{0x40, 0x01, 0x0c}, &r.VideoParameterSetNALUnits},
+		{[]byte{0x42, 0x01, 0x01}, &r.SequenceParameterSetNALUnits},
+		{[]byte{0x44, 0x01, 0xc1}, &r.PictureParameterSetNALUnits},
+	} {
+		nalu := hevc.NewNALU()
+		if err := nalu.UnmarshalBinary(e.b); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		*e.units = append(*e.units, nalu)
+	}
+	return mustMarshal(t, r)
+}
+
+// Build the NALU with 4 bytes length.
+func newTestNALU(header []byte, size int) []byte {
+	nalu := append(header, bytes.Repeat([]byte{0xab}, size-len(header))...)
+	return append([]byte{byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size)}, nalu...)
+}
+
+func TestMuxer_AVCAAC(t *testing.T) {
+	vp, _ := flv.NewVideoPackager()
+	ap, _ := flv.NewAudioPackager()
+
+	var w bytes.Buffer
+	m, err := NewMuxer(&w)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	write := func(tagType flv.TagType, timestamp uint32, tag []byte, err error) {
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err = m.WriteTag(tagType, timestamp, tag); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	tag, err := vp.Encode(&flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitSequenceHeader, Raw: newTestAVCSequenceHeader(t)})
+	write(flv.TagTypeVideo, 0, tag, err)
+
+	tag, err = ap.Encode(&flv.AudioFrame{SoundFormat: flv.AudioCodecAAC, SoundRate: flv.AudioSamplingRate44kHz,
+		SoundSize: flv.AudioSampleBits16bits, SoundType: flv.AudioChannelsStereo,
+		Trait: flv.AudioFrameTraitSequenceHeader, Raw: []byte{0x12, 0x10}})
+	write(flv.TagTypeAudio, 0, tag, err)
+
+	// The script data is ignored.
+	write(flv.TagTypeScriptData, 0, []byte{0x02, 0x00, 0x00}, nil)
+
+	for i := 0; i < 50; i++ {
+		frame := &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeInterframe,
+			Trait: flv.VideoFrameTraitNALU, CTS: 80, Raw: newTestNALU([]byte{0x41, 0x9a}, 50)}
+		if i%25 == 0 {
+			frame.FrameType, frame.Raw = flv.VideoFrameTypeKeyframe, newTestNALU([]byte{0x65, 0x88}, 1000)
+		}
+		tag, err = vp.Encode(frame)
+		write(flv.TagTypeVideo, uint32(i*40), tag, err)
+
+		tag, err = ap.Encode(&flv.AudioFrame{SoundFormat: flv.AudioCodecAAC, SoundRate: flv.AudioSamplingRate44kHz,
+			SoundSize: flv.AudioSampleBits16bits, SoundType: flv.AudioChannelsStereo,
+			Trait: flv.AudioFrameTraitRaw, Raw: []byte{0x21, 0x10, 0x04, 0x60, 0x8c, 0x1c}})
+		write(flv.TagTypeAudio, uint32(i*23), tag, err)
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	d, frames := demuxTestFrames(t, w.Bytes())
+
+	// The PSI before the first PES, and each keyframe.
+	if pats, pmts := scanTestPackets(t, w.Bytes(), PIDPAT), scanTestPackets(t, w.Bytes(), PIDPMT); len(pats) != 2 || len(pmts) != 2 {
+		t.Fatalf("invalid psi %v %v", len(pats), len(pmts))
+	}
+	if pat := d.PAT(); pat == nil || len(pat.Programs) != 1 || pat.Programs[0].PID != PIDPMT {
+		t.Errorf("invalid pat %v", pat)
+	}
+	if b := w.Bytes(); PID(b[1]&0x1f)<<8|PID(b[2]) != PIDPAT {
+		t.Error("PAT should be the first packet")
+	}
+
+	pmts := d.PMTs()
+	if len(pmts) != 1 {
+		t.Fatalf("invalid pmts %v", pmts)
+	}
+	pmt := pmts[0]
+	if pmt.Version != 0 || pmt.PCRPID != PIDVideo || len(pmt.Streams) != 2 {
+		t.Fatalf("invalid pmt %v", pmt)
+	}
+	if s := pmt.Streams[0]; s.Type != StreamTypeH264 || s.PID != PIDVideo {
+		t.Errorf("invalid video %v", s)
+	}
+	if s := pmt.Streams[1]; s.Type != StreamTypeAAC || s.PID != PIDAudio {
+		t.Errorf("invalid audio %v", s)
+	}
+
+	videos, audios := frames[PIDVideo], frames[PIDAudio]
+	if len(videos) != 50 || len(audios) != 50 {
+		t.Fatalf("invalid frames %v %v", len(videos), len(audios))
+	}
+
+	starts := scanTestPackets(t, w.Bytes(), PIDVideo)
+	for i, frame := range videos {
+		if frame.StreamID != StreamIDVideo || frame.DTS != uint64(i*40*90) || frame.PTS != uint64((i*40+80)*90) {
+			t.Errorf("invalid video %v", frame)
+		}
+
+		// The AUD, and SPS and PPS for keyframe.
+		expect := avc.JoinAnnexB([][]byte{avcAUD, newTestNALU([]byte{0x41, 0x9a}, 50)[4:]})
+		if i%25 == 0 {
+			expect = avc.JoinAnnexB([][]byte{
+				avcAUD, {0x67, 0x42, 0x00, 0x1e}, {0x68, 0xce, 0x38, 0x80}, newTestNALU([]byte{0x65, 0x88}, 1000)[4:],
+			})
+		}
+		if !bytes.Equal(frame.Payload, expect) {
+			t.Errorf("invalid video payload %v", i)
+		}
+
+		// The PCR in each video PES, and random access for keyframe.
+		if frame.RandomAccess != (i%25 == 0) {
+			t.Errorf("invalid random access %v of %v", frame.RandomAccess, i)
+		}
+		if af := starts[i].AdaptationField; af == nil || !af.HasPCR || af.PCR != frame.DTS*300 {
+			t.Errorf("invalid adaptation field %v of %v", af, i)
+		}
+	}
+
+	starts = scanTestPackets(t, w.Bytes(), PIDAudio)
+	for i, frame := range audios {
+		if frame.StreamID != StreamIDAudio || frame.PTS != uint64(i*23*90) || frame.DTS != frame.PTS {
+			t.Errorf("invalid audio %v", frame)
+		}
+		// The ADTS of 6 bytes raw.
+		if len(frame.Payload) != 13 || frame.Payload[0] != 0xff || frame.Payload[1] != 0xf1 {
+			t.Errorf("invalid audio payload %#x", frame.Payload)
+		}
+		if af := starts[i].AdaptationField; frame.RandomAccess || af != nil && af.HasPCR {
+			t.Errorf("invalid adaptation field %v", af)
+		}
+	}
+}
+
+func TestMuxer_HEVC(t *testing.T) {
+	var w bytes.Buffer
+	m, _ := NewMuxer(&w)
+
+	// The Enhanced RTMP HEVC frames.
+	for _, e := range []struct {
+		timestamp uint32
+		frame     *flv.VideoFrame
+	}{
+		{0, &flv.VideoFrame{IsExHeader: true, FourCC: flv.VideoFourCCHEVC, CodecID: flv.VideoCodecHEVC,
+			FrameType: flv.VideoFrameTypeKeyframe, Trait: flv.VideoFrameTraitSequenceHeader, Raw: newTestHEVCSequenceHeader(t)}},
+		{0, &flv.VideoFrame{IsExHeader: true, FourCC: flv.VideoFourCCHEVC, CodecID: flv.VideoCodecHEVC,
+			FrameType: flv.VideoFrameTypeKeyframe, Trait: flv.VideoFrameTraitNALU, Raw: newTestNALU([]byte{0x26, 0x01}, 300)}},
+		{40, &flv.VideoFrame{IsExHeader: true, FourCC: flv.VideoFourCCHEVC, CodecID: flv.VideoCodecHEVC,
+			FrameType: flv.VideoFrameTypeInterframe, Trait: flv.VideoFrameTraitNALU, Raw: newTestNALU([]byte{0x02, 0x01}, 30)}},
+		// The end of sequence is ignored.
+		{80, &flv.VideoFrame{IsExHeader: true, FourCC: flv.VideoFourCCHEVC, CodecID: flv.VideoCodecHEVC,
+			FrameType: flv.VideoFrameTypeKeyframe, Trait: flv.VideoFrameTraitSequenceEOF}},
+	} {
+		if err := m.WriteVideo(e.timestamp, e.frame); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	d, frames := demuxTestFrames(t, w.Bytes())
+	if pmts := d.PMTs(); len(pmts) != 1 || len(pmts[0].Streams) != 1 || pmts[0].Streams[0].Type != StreamTypeH265 {
+		t.Fatalf("invalid pmt %v", pmts)
+	}
+
+	videos := frames[PIDVideo]
+	if len(videos) != 2 {
+		t.Fatalf("invalid frames %v", len(videos))
+	}
+	if expect := avc.JoinAnnexB([][]byte{
+		hevcAUD, {0x40, 0x01, 0x0c}, {0x42, 0x01, 0x01}, {0x44, 0x01, 0xc1}, newTestNALU([]byte{0x26, 0x01}, 300)[4:],
+	}); !bytes.Equal(videos[0].Payload, expect) {
+		t.Errorf("invalid keyframe %#x", videos[0].Payload)
+	}
+	if expect := avc.JoinAnnexB([][]byte{hevcAUD, newTestNALU([]byte{0x02, 0x01}, 30)[4:]}); !bytes.Equal(videos[1].Payload, expect) {
+		t.Errorf("invalid frame %#x", videos[1].Payload)
+	}
+	// Without CTS, the PTS equals to DTS.
+	if videos[1].PTS != 40*90 || videos[1].DTS != 40*90 {
+		t.Errorf("invalid timestamp %v", videos[1])
+	}
+}
+
+func TestMuxer_NegativeCTS(t *testing.T) {
+	var w bytes.Buffer
+	m, _ := NewMuxer(&w)
+
+	if err := m.WriteVideo(0, &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitSequenceHeader, Raw: newTestAVCSequenceHeader(t)}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The PTS before 0 is clamped, while the others keep the CTS.
+	cases := []struct {
+		timestamp uint32
+		cts       int32
+		pts       uint64
+	}{
+		{0, -40, 0},
+		{20, -40, 0},
+		{80, -40, 40 * 90},
+	}
+	for _, e := range cases {
+		if err := m.WriteVideo(e.timestamp, &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+			Trait: flv.VideoFrameTraitNALU, CTS: e.cts, Raw: newTestNALU([]byte{0x65, 0x88}, 100)}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	_, frames := demuxTestFrames(t, w.Bytes())
+	videos := frames[PIDVideo]
+	if len(videos) != len(cases) {
+		t.Fatalf("invalid frames %v", len(videos))
+	}
+	for i, e := range cases {
+		if videos[i].PTS != e.pts || videos[i].DTS != uint64(e.timestamp)*90 {
+			t.Errorf("invalid timestamp %v of %v", videos[i], i)
+		}
+	}
+}
+
+func TestMuxer_MP3(t *testing.T) {
+	var w bytes.Buffer
+	m, _ := NewMuxer(&w)
+
+	if err := m.WriteVideo(0, &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitSequenceHeader, Raw: newTestAVCSequenceHeader(t)}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := m.WriteVideo(0, &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitNALU, Raw: newTestNALU([]byte{0x65, 0x88}, 100)}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The MPEG1 LayerIII 128kbps 44.1kHz frame, 417 bytes.
+	raw := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+	for i := 0; i < 3; i++ {
+		if err := m.WriteAudio(uint32(i*26), &flv.AudioFrame{SoundFormat: flv.AudioCodecMP3, Raw: raw}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	// The MPEG2 LayerIII frame in Enhanced RTMP, changes the stream type.
+	raw = append([]byte{0xff, 0xf3, 0x90, 0x64}, make([]byte, 200)...)
+	if err := m.WriteAudio(100, &flv.AudioFrame{SoundFormat: flv.AudioCodecExHeader, IsExHeader: true,
+		FourCC: flv.AudioFourCCMP3, Trait: flv.AudioFrameTraitRaw, Raw: raw}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The PMT is updated when the audio is present and changed.
+	d, frames := demuxTestFrames(t, w.Bytes())
+	if pmts := scanTestPackets(t, w.Bytes(), PIDPMT); len(pmts) != 3 {
+		t.Fatalf("invalid pmt %v", len(pmts))
+	}
+	if pmts := d.PMTs(); len(pmts) != 1 || pmts[0].Version != 2 || len(pmts[0].Streams) != 2 {
+		t.Fatalf("invalid pmt %v", pmts)
+	}
+
+	// The stream type of frame is from the PMT when demuxed.
+	audios := frames[PIDAudio]
+	if len(audios) != 4 || len(audios[0].Payload) != 417 || audios[2].PTS != 52*90 {
+		t.Fatalf("invalid audio %v", audios)
+	}
+	if audios[0].Stream.Type != StreamTypeMPEG1Audio || audios[3].Stream.Type != StreamTypeMPEG2Audio {
+		t.Errorf("invalid stream %v %v", audios[0].Stream, audios[3].Stream)
+	}
+}
+
+func TestMuxer_Opus(t *testing.T) {
+	var w bytes.Buffer
+	m, _ := NewMuxer(&w)
+
+	h := opus.NewOpusHead()
+	h.ChannelCount, h.PreSkip, h.InputSampleRate = 2, 312, 48000
+	if err := m.WriteAudio(0, &flv.AudioFrame{SoundFormat: flv.AudioCodecExHeader, IsExHeader: true,
+		FourCC: flv.AudioFourCCOpus, Trait: flv.AudioFrameTraitSequenceHeader, Raw: mustMarshal(t, h)}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The audio only stream for 2.5s, with a large frame.
+	for i := 0; i < 125; i++ {
+		raw := bytes.Repeat([]byte{0xfc}, 80)
+		if i == 1 {
+			raw = bytes.Repeat([]byte{0xfc}, 300)
+		}
+		if err := m.WriteAudio(uint32(i*20), &flv.AudioFrame{SoundFormat: flv.AudioCodecExHeader, IsExHeader: true,
+			FourCC: flv.AudioFourCCOpus, Trait: flv.AudioFrameTraitRaw, Raw: raw}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	d, frames := demuxTestFrames(t, w.Bytes())
+
+	// The PSI every 1s for audio only stream.
+	if pats, pmts := scanTestPackets(t, w.Bytes(), PIDPAT), scanTestPackets(t, w.Bytes(), PIDPMT); len(pats) != 3 || len(pmts) != 3 {
+		t.Errorf("invalid psi %v %v", len(pats), len(pmts))
+	}
+
+	pmts := d.PMTs()
+	if len(pmts) != 1 {
+		t.Fatalf("invalid pmts %v", pmts)
+	}
+	pmt := pmts[0]
+	if pmt.PCRPID != PIDAudio || len(pmt.Streams) != 1 || pmt.Streams[0].Type != StreamTypePrivateData {
+		t.Fatalf("invalid pmt %v", pmt)
+	}
+	if s := pmt.Streams[0]; len(s.Descriptors) != 2 {
+		t.Errorf("invalid descriptors %v", s.Descriptors)
+	} else if v, ok := s.Descriptors[1].OpusChannelConfig(); !ok || v != 2 {
+		t.Errorf("invalid channels %v", v)
+	}
+
+	audios := frames[PIDAudio]
+	if len(audios) != 125 {
+		t.Fatalf("invalid audio %v", len(audios))
+	}
+	if frame := audios[0]; frame.StreamID != StreamIDPrivateStream1 || !bytes.Equal(frame.Payload[:3], []byte{0x7f, 0xe0, 80}) {
+		t.Errorf("invalid audio %v", frame)
+	}
+	if frame := audios[1]; !bytes.Equal(frame.Payload[:4], []byte{0x7f, 0xe0, 0xff, 45}) || len(frame.Payload) != 304 {
+		t.Errorf("invalid audio %v", frame)
+	}
+
+	// The PCR and random access in audio, for audio only stream.
+	if !audios[10].RandomAccess {
+		t.Errorf("invalid random access %v", audios[10])
+	}
+	if af := scanTestPackets(t, w.Bytes(), PIDAudio)[10].AdaptationField; af == nil || !af.HasPCR || af.PCR != 200*90*300 {
+		t.Errorf("invalid adaptation field %v", af)
+	}
+}
+
+func TestMuxer_Errors(t *testing.T) {
+	m, _ := NewMuxer(&bytes.Buffer{})
+
+	// The frame without sequence header.
+	if err := m.WriteVideo(0, &flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitNALU, Raw: newTestNALU([]byte{0x65}, 10)}); err == nil {
+		t.Error("should fail")
+	}
+	if err := m.WriteAudio(0, &flv.AudioFrame{SoundFormat: flv.AudioCodecAAC, Trait: flv.AudioFrameTraitRaw,
+		Raw: []byte{0x21}}); err == nil {
+		t.Error("should fail")
+	}
+
+	// The unsupported codecs.
+	if err := m.WriteVideo(0, &flv.VideoFrame{IsExHeader: true, FourCC: flv.VideoFourCCAV1, CodecID: flv.VideoCodecForbidden,
+		FrameType: flv.VideoFrameTypeKeyframe, Trait: flv.VideoFrameTraitNALU, Raw: []byte{0x12, 0x00}}); err == nil {
+		t.Error("should fail")
+	}
+	if err := m.WriteAudio(0, &flv.AudioFrame{SoundFormat: flv.AudioCodecSpeex, Raw: []byte{0x01}}); err == nil {
+		t.Error("should fail")
+	}
+
+	// The invalid sequence header.
+	if err := m.WriteVideo(0, &flv.VideoFrame{CodecID: flv.VideoCodecHEVC, FrameType: flv.VideoFrameTypeKeyframe,
+		Trait: flv.VideoFrameTraitSequenceHeader, Raw: []byte{0x01}}); err == nil {
+		t.Error("should fail")
+	}
+
+	// The video info frame is ignored.
+	if err := m.WriteVideo(0, &flv.VideoFrame{FrameType: flv.VideoFrameTypeInfo, Raw: []byte{0x00}}); err != nil {
+		t.Errorf("%+v", err)
+	}
+}
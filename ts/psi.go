@@ -0,0 +1,330 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The table id of PSI section.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 57, @section Table 2-31 – table_id assignment values
+type TableID uint8
+
+const (
+	TableIDPAT TableID = 0x00 // The program_association_section.
+	TableIDCAT TableID = 0x01 // The conditional_access_section.
+	TableIDPMT TableID = 0x02 // The TS_program_map_section.
+)
+
+// The max section_length of PAT and PMT.
+const maxSectionLength = 1021
+
+// The CRC32 table of MPEG-2, the polynomial 0x04c11db7 without reflection.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 121, @section Annex A – CRC Decoder Model
+var crc32Table = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if (c & 0x80000000) != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return
+}()
+
+func crc32MPEG2(b []byte) uint32 {
+	c := uint32(0xffffffff)
+	for _, v := range b {
+		c = c<<8 ^ crc32Table[byte(c>>24)^v]
+	}
+	return c
+}
+
+// The descriptor, in PMT for program or elementary stream.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 68, @section 2.6 Program and program element descriptors
+type Descriptor struct {
+	Tag  uint8
+	Data []byte
+}
+
+// The descriptor tags.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 69, @section Table 2-45 – Program and program element descriptors
+const (
+	DescriptorTagRegistration uint8 = 0x05 // The registration_descriptor, with the format_identifier.
+	DescriptorTagISO639       uint8 = 0x0a // The ISO_639_language_descriptor.
+	DescriptorTagExtension    uint8 = 0x7f // The DVB extension descriptor, for example, Opus.
+)
+
+// The format_identifier of Opus in registration_descriptor.
+// Refer to @doc ETSI_TS_opus-v0.1.3-draft.pdf, @page 5, @section 5.1 Opus registration descriptor
+const FormatIdentifierOpus = 'O'<<24 | 'p'<<16 | 'u'<<8 | 's'
+
+// The descriptor_tag_extension of Opus in extension descriptor.
+const descriptorTagExtensionOpus = 0x80
+
+func (v *Descriptor) String() string {
+	return fmt.Sprintf("tag=%#x, size=%vB", v.Tag, len(v.Data))
+}
+
+// Get the format_identifier of registration_descriptor.
+func (v *Descriptor) FormatIdentifier() (uint32, bool) {
+	if v.Tag != DescriptorTagRegistration || len(v.Data) < 4 {
+		return 0, false
+	}
+	return uint32(v.Data[0])<<24 | uint32(v.Data[1])<<16 | uint32(v.Data[2])<<8 | uint32(v.Data[3]), true
+}
+
+// Get the channel_config_code of Opus in extension descriptor.
+// Refer to @doc ETSI_TS_opus-v0.1.3-draft.pdf, @page 6, @section 5.2 Opus_audio_descriptor
+func (v *Descriptor) OpusChannelConfig() (uint8, bool) {
+	if v.Tag != DescriptorTagExtension || len(v.Data) < 2 || v.Data[0] != descriptorTagExtensionOpus {
+		return 0, false
+	}
+	return v.Data[1], true
+}
+
+func marshalDescriptors(descriptors []*Descriptor) (b []byte, err error) {
+	for _, d := range descriptors {
+		if len(d.Data) > 0xff {
+			return nil, errors.Errorf("descriptor %vB exceed %vB", len(d.Data), 0xff)
+		}
+		b = append(b, d.Tag, byte(len(d.Data)))
+		b = append(b, d.Data...)
+	}
+	return
+}
+
+func unmarshalDescriptors(b []byte) (descriptors []*Descriptor, err error) {
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, errors.Errorf("requires %v+ only %v bytes", 2, len(b))
+		}
+		descriptors = append(descriptors, &Descriptor{Tag: b[0], Data: append([]byte(nil), b[2:2+int(b[1])]...)})
+		b = b[2+int(b[1]):]
+	}
+	return
+}
+
+// Write the long form section, with the header before and CRC32 after the data.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 61, @section 2.4.4.11 Private section
+func marshalSection(tableID TableID, extension uint16, version uint8, data []byte) ([]byte, error) {
+	// The section_length, from the table_id_extension to the CRC32.
+	size := 5 + len(data) + 4
+	if size > maxSectionLength {
+		return nil, errors.Errorf("section %vB exceed %vB", size, maxSectionLength)
+	}
+
+	b := []byte{
+		byte(tableID),
+		// The section_syntax_indicator 1, the '0' and reserved 2bits.
+		0xb0 | byte(size>>8)&0x0f, byte(size),
+		byte(extension >> 8), byte(extension),
+		// The reserved 2bits, version_number 5bits and current_next_indicator.
+		0xc0 | (version&0x1f)<<1 | 0x01,
+		// The section_number and last_section_number.
+		0x00, 0x00,
+	}
+	b = append(b, data...)
+
+	crc := crc32MPEG2(b)
+	return append(b, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc)), nil
+}
+
+// Parse the long form section, return the data between the header and CRC32.
+func unmarshalSection(b []byte, tableID TableID) (extension uint16, version uint8, data []byte, err error) {
+	if len(b) < 3 {
+		return 0, 0, nil, errors.Errorf("requires %v+ only %v bytes", 3, len(b))
+	}
+	if TableID(b[0]) != tableID {
+		return 0, 0, nil, errors.Errorf("invalid table id %#x", b[0])
+	}
+	if (b[1] & 0x80) != 0x80 {
+		return 0, 0, nil, errors.New("no section syntax")
+	}
+
+	size := int(b[1]&0x0f)<<8 | int(b[2])
+	if size < 9 || len(b) < 3+size {
+		return 0, 0, nil, errors.Errorf("invalid section length %v, only %v bytes", size, len(b))
+	}
+	b = b[:3+size]
+
+	if crc := crc32MPEG2(b); crc != 0 {
+		return 0, 0, nil, errors.Errorf("invalid crc32 %#x", crc)
+	}
+
+	extension = uint16(b[3])<<8 | uint16(b[4])
+	version = (b[5] >> 1) & 0x1f
+	data = b[8 : len(b)-4]
+	return
+}
+
+// The program in PAT.
+type Program struct {
+	// The program_number, 0 for network PID.
+	Number uint16
+	// The PID of PMT, or network PID if number is 0.
+	PID PID
+}
+
+// The program association table, map the program number to PMT PID.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 58, @section 2.4.4.3 Program association Table
+type PAT struct {
+	TransportStreamID uint16
+	// The 5bits version_number.
+	Version  uint8
+	Programs []*Program
+}
+
+func NewPAT() *PAT {
+	return &PAT{}
+}
+
+func (v *PAT) String() string {
+	return fmt.Sprintf("PAT tsid=%v, version=%v, programs=%v", v.TransportStreamID, v.Version, len(v.Programs))
+}
+
+// Marshal the section, without the pointer_field.
+func (v *PAT) MarshalBinary() ([]byte, error) {
+	var b []byte
+	for _, p := range v.Programs {
+		// The reserved 3bits and 13bits PID.
+		b = append(b, byte(p.Number>>8), byte(p.Number), 0xe0|byte(p.PID>>8)&0x1f, byte(p.PID))
+	}
+	return marshalSection(TableIDPAT, v.TransportStreamID, v.Version, b)
+}
+
+// Unmarshal the section, without the pointer_field.
+func (v *PAT) UnmarshalBinary(data []byte) error {
+	tsid, version, b, err := unmarshalSection(data, TableIDPAT)
+	if err != nil {
+		return errors.WithMessage(err, "section")
+	}
+
+	*v = PAT{TransportStreamID: tsid, Version: version}
+	for ; len(b) >= 4; b = b[4:] {
+		v.Programs = append(v.Programs, &Program{
+			Number: uint16(b[0])<<8 | uint16(b[1]),
+			PID:    PID(b[2]&0x1f)<<8 | PID(b[3]),
+		})
+	}
+	return nil
+}
+
+// The elementary stream in PMT.
+type Stream struct {
+	Type StreamType
+	PID  PID
+	// The descriptors of elementary stream, in ES_info.
+	Descriptors []*Descriptor
+}
+
+// The program map table, the PIDs and types of elementary streams.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 64, @section 2.4.4.8 Program Map Table
+type PMT struct {
+	ProgramNumber uint16
+	// The 5bits version_number.
+	Version uint8
+	// The PID which carries the PCR.
+	PCRPID PID
+	// The descriptors of program, in program_info.
+	Descriptors []*Descriptor
+	Streams     []*Stream
+}
+
+func NewPMT() *PMT {
+	return &PMT{}
+}
+
+func (v *PMT) String() string {
+	return fmt.Sprintf("PMT program=%v, version=%v, pcr=%v, streams=%v", v.ProgramNumber, v.Version, v.PCRPID, len(v.Streams))
+}
+
+// Marshal the section, without the pointer_field.
+func (v *PMT) MarshalBinary() ([]byte, error) {
+	info, err := marshalDescriptors(v.Descriptors)
+	if err != nil {
+		return nil, errors.WithMessage(err, "program info")
+	}
+
+	// The reserved 3bits and PCR_PID, the reserved 4bits and program_info_length.
+	b := []byte{0xe0 | byte(v.PCRPID>>8)&0x1f, byte(v.PCRPID), 0xf0 | byte(len(info)>>8)&0x0f, byte(len(info))}
+	b = append(b, info...)
+
+	for _, s := range v.Streams {
+		if info, err = marshalDescriptors(s.Descriptors); err != nil {
+			return nil, errors.WithMessage(err, "ES info")
+		}
+
+		// The reserved 3bits and elementary_PID, the reserved 4bits and ES_info_length.
+		b = append(b, byte(s.Type), 0xe0|byte(s.PID>>8)&0x1f, byte(s.PID), 0xf0|byte(len(info)>>8)&0x0f, byte(len(info)))
+		b = append(b, info...)
+	}
+
+	return marshalSection(TableIDPMT, v.ProgramNumber, v.Version, b)
+}
+
+// Unmarshal the section, without the pointer_field.
+func (v *PMT) UnmarshalBinary(data []byte) error {
+	program, version, b, err := unmarshalSection(data, TableIDPMT)
+	if err != nil {
+		return errors.WithMessage(err, "section")
+	}
+
+	if len(b) < 4 {
+		return errors.Errorf("requires %v+ only %v bytes", 4, len(b))
+	}
+	*v = PMT{ProgramNumber: program, Version: version}
+	v.PCRPID = PID(b[0]&0x1f)<<8 | PID(b[1])
+
+	size := int(b[2]&0x0f)<<8 | int(b[3])
+	if b = b[4:]; len(b) < size {
+		return errors.Errorf("requires %v only %v bytes", size, len(b))
+	}
+	if v.Descriptors, err = unmarshalDescriptors(b[:size]); err != nil {
+		return errors.WithMessage(err, "program info")
+	}
+
+	for b = b[size:]; len(b) > 0; {
+		if len(b) < 5 {
+			return errors.Errorf("requires %v+ only %v bytes", 5, len(b))
+		}
+		s := &Stream{Type: StreamType(b[0]), PID: PID(b[1]&0x1f)<<8 | PID(b[2])}
+
+		size = int(b[3]&0x0f)<<8 | int(b[4])
+		if b = b[5:]; len(b) < size {
+			return errors.Errorf("requires %v only %v bytes", size, len(b))
+		}
+		if s.Descriptors, err = unmarshalDescriptors(b[:size]); err != nil {
+			return errors.WithMessage(err, "ES info")
+		}
+
+		v.Streams = append(v.Streams, s)
+		b = b[size:]
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+// The oryx TS package includes some utilites for MPEG-2 transport stream.
+// The TS stream is a sequence of 188 bytes packets, each packet carries a piece of PSI,
+// for example, the PAT and PMT, or a piece of PES which is the elementary stream frame
+// with the PTS and DTS, identified by the PID in packet header.
+//
+//	@note MPEG-2 TS, please read ISO_IEC_13818-1-TS-2007.pdf, 2.4 Transport stream bitstream requirements
+//		and ETSI_TS_opus-v0.1.3-draft.pdf for Opus in TS.
+package ts
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The size of TS packet, and the sync byte at the start of packet.
+const (
+	PacketSize = 188
+	SyncByte   = 0x47
+)
+
+// The size of TS packet header, and the max size of payload.
+const (
+	packetHeaderSize  = 4
+	packetPayloadSize = PacketSize - packetHeaderSize
+)
+
+// The PTS, DTS and PCR base is 90kHz, in 33bits.
+const (
+	ClockRate = 90000
+	clockMask = uint64(1)<<33 - 1
+)
+
+// The PCR is 27MHz, the base in 90kHz and extension in 27MHz.
+const pcrRate = 300
+
+// The packet id, 13bits.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 37, @section 2.4.3.3 Semantic definition of fields in Transport Stream packet layer
+type PID uint16
+
+const (
+	PIDPAT  PID = 0x0000 // The program association table.
+	PIDCAT  PID = 0x0001 // The conditional access table.
+	PIDSDT  PID = 0x0011 // The service description table of DVB.
+	PIDNull PID = 0x1fff // The null packet.
+)
+
+// The PIDs used by muxer, same to SRS.
+const (
+	PIDPMT   PID = 0x1001
+	PIDVideo PID = 0x0100
+	PIDAudio PID = 0x0101
+)
+
+func (v PID) String() string {
+	switch v {
+	case PIDPAT:
+		return "PAT"
+	case PIDCAT:
+		return "CAT"
+	case PIDNull:
+		return "Null"
+	default:
+		return fmt.Sprintf("%#x", uint16(v))
+	}
+}
+
+// The stream type in PMT.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 66, @section Table 2-34 – Stream type assignments
+type StreamType uint8
+
+const (
+	StreamTypeMPEG1Audio  StreamType = 0x03 // ISO/IEC 11172-3 Audio, the MP3.
+	StreamTypeMPEG2Audio  StreamType = 0x04 // ISO/IEC 13818-3 Audio, the MP3 in LSF.
+	StreamTypePrivateData StreamType = 0x06 // PES packets containing private data, for example, Opus.
+	StreamTypeAAC         StreamType = 0x0f // ISO/IEC 13818-7 Audio with ADTS transport syntax.
+	StreamTypeLATM        StreamType = 0x11 // ISO/IEC 14496-3 Audio with the LATM transport syntax.
+	StreamTypeH264        StreamType = 0x1b // AVC video stream as defined in ITU-T Rec. H.264.
+	StreamTypeH265        StreamType = 0x24 // HEVC video stream as defined in ITU-T Rec. H.265.
+)
+
+func (v StreamType) String() string {
+	switch v {
+	case StreamTypeMPEG1Audio:
+		return "MPEG1Audio"
+	case StreamTypeMPEG2Audio:
+		return "MPEG2Audio"
+	case StreamTypePrivateData:
+		return "PrivateData"
+	case StreamTypeAAC:
+		return "AAC"
+	case StreamTypeLATM:
+		return "LATM"
+	case StreamTypeH264:
+		return "H.264"
+	case StreamTypeH265:
+		return "H.265"
+	default:
+		return fmt.Sprintf("StreamType/%#x", uint8(v))
+	}
+}
+
+// Whether the stream type is video.
+func (v StreamType) IsVideo() bool {
+	return v == StreamTypeH264 || v == StreamTypeH265
+}
+
+// The stream id in PES header.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 53, @section Table 2-22 – Stream_id assignments
+type StreamID uint8
+
+const (
+	StreamIDPrivateStream1 StreamID = 0xbd // The private_stream_1, for example, Opus.
+	StreamIDPadding        StreamID = 0xbe
+	StreamIDPrivateStream2 StreamID = 0xbf
+	StreamIDAudio          StreamID = 0xc0 // The first of ISO/IEC 13818-3 or ISO/IEC 11172-3 or ISO/IEC 13818-7 or ISO/IEC 14496-3 audio stream.
+	StreamIDVideo          StreamID = 0xe0 // The first of ITU-T Rec. H.262 | ISO/IEC 13818-2, ISO/IEC 11172-2, ISO/IEC 14496-2 or ITU-T Rec. H.264 | ISO/IEC 14496-10 video stream.
+)
+
+// Whether the stream is video, the 0xe0 to 0xef.
+func (v StreamID) IsVideo() bool {
+	return v >= StreamIDVideo && v <= StreamIDVideo+0x0f
+}
+
+// Whether the PES packet has the optional PES header, for example, the PTS and DTS.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 49, @section Table 2-21 – PES packet
+func (v StreamID) hasOptionalHeader() bool {
+	switch v {
+	case 0xbc, StreamIDPadding, StreamIDPrivateStream2, 0xf0, 0xf1, 0xf2, 0xf8, 0xff:
+		return false
+	default:
+		return true
+	}
+}
+
+// The adaptation field, after the TS packet header.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 40, @section 2.4.3.4 Adaptation field
+// @remark We ignore the OPCR, splicing point, private data and extension.
+type AdaptationField struct {
+	// The discontinuity_indicator, the continuity counter or time base is discontinuous.
+	Discontinuity bool
+	// The random_access_indicator, the PES starts with a random access point, for example, a keyframe.
+	RandomAccess bool
+	// The elementary_stream_priority_indicator.
+	ESPriority bool
+	// Whether has the PCR, in 27MHz, that is base*300+extension.
+	HasPCR bool
+	PCR    uint64
+}
+
+// The size of adaptation field, with the adaptation_field_length, without stuffing.
+func (v *AdaptationField) size() int {
+	if v.HasPCR {
+		return 8
+	}
+	return 2
+}
+
+func (v *AdaptationField) marshal(b []byte) {
+	b[0] = byte(len(b) - 1)
+	if len(b) == 1 {
+		return
+	}
+
+	var flags byte
+	if v.Discontinuity {
+		flags |= 0x80
+	}
+	if v.RandomAccess {
+		flags |= 0x40
+	}
+	if v.ESPriority {
+		flags |= 0x20
+	}
+	if v.HasPCR {
+		flags |= 0x10
+	}
+	b[1] = flags
+
+	p := b[2:]
+	if v.HasPCR {
+		base, ext := (v.PCR/pcrRate)&clockMask, v.PCR%pcrRate
+		// The 33bits base, 6bits reserved and 9bits extension.
+		p[0] = byte(base >> 25)
+		p[1] = byte(base >> 17)
+		p[2] = byte(base >> 9)
+		p[3] = byte(base >> 1)
+		p[4] = byte(base<<7) | 0x7e | byte(ext>>8)&0x01
+		p[5] = byte(ext)
+		p = p[6:]
+	}
+
+	// The stuffing_byte.
+	for i := range p {
+		p[i] = 0xff
+	}
+}
+
+// Unmarshal the adaptation field, from the adaptation_field_length.
+func (v *AdaptationField) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return errors.Errorf("requires %v+ only %v bytes", 1, len(data))
+	}
+	b := data[1 : 1+int(data[0])]
+
+	*v = AdaptationField{}
+	if len(b) == 0 {
+		return nil
+	}
+
+	v.Discontinuity = (b[0] & 0x80) == 0x80
+	v.RandomAccess = (b[0] & 0x40) == 0x40
+	v.ESPriority = (b[0] & 0x20) == 0x20
+	v.HasPCR = (b[0] & 0x10) == 0x10
+
+	if v.HasPCR {
+		if len(b) < 7 {
+			return errors.Errorf("requires %v+ only %v bytes", 7, len(b))
+		}
+		p := b[1:]
+		base := uint64(p[0])<<25 | uint64(p[1])<<17 | uint64(p[2])<<9 | uint64(p[3])<<1 | uint64(p[4]>>7)
+		ext := uint64(p[4]&0x01)<<8 | uint64(p[5])
+		v.PCR = base*pcrRate + ext
+	}
+	return nil
+}
+
+// The TS packet, 188 bytes.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 36, @section 2.4.3.2 Transport Stream packet layer
+type Packet struct {
+	// The transport_error_indicator.
+	TransportError bool
+	// The payload_unit_start_indicator, the payload starts a PES, or a PSI with the pointer_field.
+	PayloadUnitStart bool
+	// The transport_priority.
+	Priority bool
+	// The 13bits PID.
+	PID PID
+	// The 2bits transport_scrambling_control.
+	ScramblingControl uint8
+	// The 4bits continuity_counter, increased for each packet with payload of the PID.
+	ContinuityCounter uint8
+	// The adaptation field, nil if not present.
+	AdaptationField *AdaptationField
+	// The payload, nil if not present.
+	Payload []byte
+}
+
+func NewPacket() *Packet {
+	return &Packet{}
+}
+
+func (v *Packet) String() string {
+	return fmt.Sprintf("PID=%v, PUSI=%v, CC=%v, payload=%vB", v.PID, v.PayloadUnitStart, v.ContinuityCounter, len(v.Payload))
+}
+
+// Marshal the packet to 188 bytes, stuffing by the adaptation field if the payload is not enough.
+// @remark For PSI, user should stuffing the payload by 0xff, to avoid the adaptation field.
+func (v *Packet) MarshalBinary() ([]byte, error) {
+	if len(v.Payload) > packetPayloadSize {
+		return nil, errors.Errorf("payload %vB exceed %vB", len(v.Payload), packetPayloadSize)
+	}
+
+	// The size of adaptation field, which is stuffing to fill the packet.
+	var afSize int
+	if nn := packetPayloadSize - len(v.Payload); nn > 0 || v.AdaptationField != nil {
+		afSize = nn
+		if v.AdaptationField != nil && afSize < v.AdaptationField.size() {
+			return nil, errors.Errorf("payload %vB exceed %vB", len(v.Payload), packetPayloadSize-v.AdaptationField.size())
+		}
+	}
+
+	b := make([]byte, PacketSize)
+	b[0] = SyncByte
+
+	if v.TransportError {
+		b[1] |= 0x80
+	}
+	if v.PayloadUnitStart {
+		b[1] |= 0x40
+	}
+	if v.Priority {
+		b[1] |= 0x20
+	}
+	b[1] |= byte(v.PID>>8) & 0x1f
+	b[2] = byte(v.PID)
+
+	// The adaptation_field_control, 01 for payload only, 10 for adaptation field only, 11 for both.
+	var afc byte
+	if afSize > 0 {
+		afc |= 0x02
+	}
+	if len(v.Payload) > 0 {
+		afc |= 0x01
+	}
+	b[3] = (v.ScramblingControl&0x03)<<6 | afc<<4 | v.ContinuityCounter&0x0f
+
+	if afSize > 0 {
+		af := v.AdaptationField
+		if af == nil {
+			af = &AdaptationField{}
+		}
+		af.marshal(b[packetHeaderSize : packetHeaderSize+afSize])
+	}
+	copy(b[packetHeaderSize+afSize:], v.Payload)
+
+	return b, nil
+}
+
+// Unmarshal the packet from 188 bytes, the payload refer to the data.
+func (v *Packet) UnmarshalBinary(data []byte) error {
+	if len(data) < PacketSize {
+		return errors.Errorf("requires %v only %v bytes", PacketSize, len(data))
+	}
+	if data[0] != SyncByte {
+		return errors.Errorf("invalid sync byte %#x", data[0])
+	}
+
+	*v = Packet{}
+	v.TransportError = (data[1] & 0x80) == 0x80
+	v.PayloadUnitStart = (data[1] & 0x40) == 0x40
+	v.Priority = (data[1] & 0x20) == 0x20
+	v.PID = PID(data[1]&0x1f)<<8 | PID(data[2])
+	v.ScramblingControl = (data[3] >> 6) & 0x03
+	afc := (data[3] >> 4) & 0x03
+	v.ContinuityCounter = data[3] & 0x0f
+
+	if afc == 0 {
+		return errors.New("reserved adaptation_field_control")
+	}
+
+	p := data[packetHeaderSize:PacketSize]
+	if (afc & 0x02) == 0x02 {
+		af := &AdaptationField{}
+		if err := af.UnmarshalBinary(p); err != nil {
+			return errors.WithMessage(err, "adaptation field")
+		}
+		v.AdaptationField = af
+		p = p[1+int(p[0]):]
+	}
+
+	if (afc & 0x01) == 0x01 {
+		v.Payload = p
+	}
+	return nil
+}
+
+// Write the PTS or DTS in 5 bytes, with the 4bits prefix.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 50, @section 2.4.3.7 Semantic definition of fields in PES packet
+func marshalTimestamp(b []byte, prefix uint8, ts uint64) {
+	ts &= clockMask
+	b[0] = prefix<<4 | byte(ts>>29)&0x0e | 0x01
+	b[1] = byte(ts >> 22)
+	b[2] = byte(ts>>14) | 0x01
+	b[3] = byte(ts >> 7)
+	b[4] = byte(ts<<1) | 0x01
+}
+
+func unmarshalTimestamp(b []byte) uint64 {
+	return uint64(b[0]>>1&0x07)<<30 | uint64(b[1])<<22 | uint64(b[2]>>1)<<15 | uint64(b[3])<<7 | uint64(b[4]>>1)
+}
+
+// The PES packet, the header and payload of elementary stream frame.
+// Refer to @doc ISO_IEC_13818-1-TS-2007.pdf, @page 49, @section 2.4.3.6 PES packet
+// @remark We ignore the ESCR, ES rate, trick mode, copy info, CRC and extension.
+type PES struct {
+	StreamID StreamID
+	// The data_alignment_indicator, the payload starts with a video start code or audio sync word.
+	DataAlignment bool
+	// The PTS and DTS in 90kHz, DTS equals to PTS if absent.
+	HasPTS bool
+	PTS    uint64
+	DTS    uint64
+	// The elementary stream data.
+	Payload []byte
+}
+
+func NewPES() *PES {
+	return &PES{}
+}
+
+func (v *PES) String() string {
+	return fmt.Sprintf("stream=%#x, pts=%v, dts=%v, payload=%vB", uint8(v.StreamID), v.PTS, v.DTS, len(v.Payload))
+}
+
+// Marshal the PES packet, the PES_packet_length is 0 if video exceed 64KB.
+func (v *PES) MarshalBinary() ([]byte, error) {
+	var header []byte
+	if v.StreamID.hasOptionalHeader() {
+		header = []byte{0x80, 0x00, 0x00}
+		if v.DataAlignment {
+			header[0] |= 0x04
+		}
+
+		if v.HasPTS && (v.PTS&clockMask) != (v.DTS&clockMask) {
+			// The PTS_DTS_flags is 11, both PTS and DTS.
+			header[1], header[2] = 0xc0, 10
+			header = append(header, make([]byte, 10)...)
+			marshalTimestamp(header[3:], 0x03, v.PTS)
+			marshalTimestamp(header[8:], 0x01, v.DTS)
+		} else if v.HasPTS {
+			// The PTS_DTS_flags is 10, only PTS.
+			header[1], header[2] = 0x80, 5
+			header = append(header, make([]byte, 5)...)
+			marshalTimestamp(header[3:], 0x02, v.PTS)
+		}
+	}
+
+	size := len(header) + len(v.Payload)
+	if size > 0xffff {
+		if !v.StreamID.IsVideo() {
+			return nil, errors.Errorf("PES %vB exceed %vB", size, 0xffff)
+		}
+		// It's only allowed for video, the PES_packet_length is 0, unbounded.
+		size = 0
+	}
+
+	b := make([]byte, 6, 6+len(header)+len(v.Payload))
+	b[2] = 0x01
+	b[3] = byte(v.StreamID)
+	b[4], b[5] = byte(size>>8), byte(size)
+	b = append(b, header...)
+	return append(b, v.Payload...), nil
+}
+
+// Unmarshal the PES packet, the payload refer to the data.
+func (v *PES) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return errors.Errorf("requires %v+ only %v bytes", 6, len(data))
+	}
+	if data[0] != 0x00 || data[1] != 0x00 || data[2] != 0x01 {
+		return errors.Errorf("invalid start code %#x", data[:3])
+	}
+
+	*v = PES{StreamID: StreamID(data[3])}
+	p := data[6:]
+	if size := int(data[4])<<8 | int(data[5]); size > 0 {
+		if len(p) < size {
+			return errors.Errorf("requires %v only %v bytes", size, len(p))
+		}
+		p = p[:size]
+	}
+
+	if !v.StreamID.hasOptionalHeader() {
+		v.Payload = p
+		return nil
+	}
+
+	if len(p) < 3 || len(p) < 3+int(p[2]) {
+		return errors.Errorf("requires %v+ only %v bytes", 3, len(p))
+	}
+	if (p[0] & 0xc0) != 0x80 {
+		return errors.Errorf("invalid PES header %#x", p[0])
+	}
+	v.DataAlignment = (p[0] & 0x04) == 0x04
+
+	flags, header := p[1]>>6, p[3:3+int(p[2])]
+	if flags == 0x01 {
+		return errors.New("forbidden PTS_DTS_flags")
+	}
+	if flags&0x02 == 0x02 {
+		if len(header) < 5 {
+			return errors.Errorf("requires %v+ only %v bytes", 5, len(header))
+		}
+		v.HasPTS = true
+		v.PTS = unmarshalTimestamp(header)
+		v.DTS = v.PTS
+	}
+	if flags == 0x03 {
+		if len(header) < 10 {
+			return errors.Errorf("requires %v+ only %v bytes", 10, len(header))
+		}
+		v.DTS = unmarshalTimestamp(header[5:])
+	}
+
+	v.Payload = p[3+int(p[2]):]
+	return nil
+}
@@ -0,0 +1,213 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ts
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCRC32MPEG2(t *testing.T) {
+	if v := crc32MPEG2([]byte("123456789")); v != 0x0376e6e7 {
+		t.Errorf("invalid crc32 %#x", v)
+	}
+}
+
+func TestPacket(t *testing.T) {
+	for _, c := range []struct {
+		payload int
+		af      *AdaptationField
+		expect  int
+	}{
+		{184, nil, 0},
+		{183, nil, 1},
+		{182, nil, 2},
+		{10, nil, 174},
+		{0, &AdaptationField{RandomAccess: true}, 184},
+		{100, &AdaptationField{HasPCR: true, PCR: 0x1ffffffff*300 + 299}, 84},
+		{176, &AdaptationField{Discontinuity: true, HasPCR: true, PCR: 27000000}, 8},
+	} {
+		p := &Packet{PayloadUnitStart: true, PID: 0x100, ContinuityCounter: 15, AdaptationField: c.af}
+		p.Payload = bytes.Repeat([]byte{0xab}, c.payload)
+
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if len(b) != PacketSize {
+			t.Fatalf("invalid size %v", len(b))
+		}
+
+		r := NewPacket()
+		if err = r.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if !r.PayloadUnitStart || r.PID != 0x100 || r.ContinuityCounter != 15 || !bytes.Equal(r.Payload, p.Payload) {
+			t.Errorf("invalid packet %v", r)
+		}
+		if (r.AdaptationField != nil) != (c.expect > 0) {
+			t.Errorf("invalid adaptation field %v", r.AdaptationField)
+		} else if r.AdaptationField != nil && c.af != nil && *r.AdaptationField != *c.af {
+			t.Errorf("invalid adaptation field %v, expect %v", r.AdaptationField, c.af)
+		}
+		if nn := PacketSize - packetHeaderSize - len(r.Payload); nn != c.expect {
+			t.Errorf("invalid stuffing %v, expect %v", nn, c.expect)
+		}
+	}
+
+	// The payload overflow.
+	if _, err := (&Packet{Payload: make([]byte, 185)}).MarshalBinary(); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := (&Packet{Payload: make([]byte, 183), AdaptationField: &AdaptationField{}}).MarshalBinary(); err == nil {
+		t.Error("should fail")
+	}
+
+	// The invalid packet.
+	if err := NewPacket().UnmarshalBinary(make([]byte, PacketSize)); err == nil {
+		t.Error("should fail")
+	}
+	if err := NewPacket().UnmarshalBinary([]byte{SyncByte}); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestPES(t *testing.T) {
+	for _, c := range []struct {
+		pes    *PES
+		header int
+		size   int
+	}{
+		{&PES{StreamID: StreamIDVideo, DataAlignment: true, HasPTS: true, PTS: 3600, DTS: 0, Payload: []byte{1, 2, 3}}, 19, 16},
+		{&PES{StreamID: StreamIDAudio, HasPTS: true, PTS: 0x1ffffffff, DTS: 0x1ffffffff, Payload: []byte{1, 2, 3}}, 14, 11},
+		{&PES{StreamID: StreamIDVideo, HasPTS: true, PTS: 1, DTS: 1, Payload: make([]byte, 0xffff)}, 14, 0},
+		{&PES{StreamID: StreamIDPrivateStream2, Payload: []byte{1, 2, 3}}, 6, 3},
+	} {
+		b, err := c.pes.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if len(b) != c.header+len(c.pes.Payload) {
+			t.Errorf("invalid header %v", len(b)-len(c.pes.Payload))
+		}
+		if size := int(b[4])<<8 | int(b[5]); size != c.size {
+			t.Errorf("invalid size %v, expect %v", size, c.size)
+		}
+
+		r := NewPES()
+		if err = r.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if r.StreamID != c.pes.StreamID || r.DataAlignment != c.pes.DataAlignment || r.HasPTS != c.pes.HasPTS ||
+			r.PTS != c.pes.PTS || r.DTS != c.pes.DTS || !bytes.Equal(r.Payload, c.pes.Payload) {
+			t.Errorf("invalid pes %v, expect %v", r, c.pes)
+		}
+	}
+
+	// The audio PES exceed 64KB.
+	if _, err := (&PES{StreamID: StreamIDAudio, Payload: make([]byte, 0xffff)}).MarshalBinary(); err == nil {
+		t.Error("should fail")
+	}
+	// The invalid start code and PTS_DTS_flags.
+	if err := NewPES().UnmarshalBinary([]byte{0, 0, 2, 0xe0, 0, 0}); err == nil {
+		t.Error("should fail")
+	}
+	if err := NewPES().UnmarshalBinary([]byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x40, 0}); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestPSI(t *testing.T) {
+	pat := &PAT{TransportStreamID: 1, Version: 3, Programs: []*Program{{Number: 0, PID: 0x10}, {Number: 1, PID: PIDPMT}}}
+	b, err := pat.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	// Generated by ffmpeg, for PAT of tsid=1 and program 1 at PID 0x1000.
+	if b, err := (&PAT{TransportStreamID: 1, Programs: []*Program{{Number: 1, PID: 0x1000}}}).MarshalBinary(); err != nil {
+		t.Fatalf("%+v", err)
+	} else if expect := []byte{
+		0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xf0, 0x00, 0x2a, 0xb1, 0x04, 0xb2,
+	}; !bytes.Equal(b, expect) {
+		t.Errorf("invalid pat %#x", b)
+	}
+
+	rpat := NewPAT()
+	if err = rpat.UnmarshalBinary(b); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if rpat.TransportStreamID != 1 || rpat.Version != 3 || len(rpat.Programs) != 2 || *rpat.Programs[1] != *pat.Programs[1] {
+		t.Errorf("invalid pat %v", rpat)
+	}
+
+	// The CRC32 mismatch.
+	b[len(b)-1]++
+	if err = NewPAT().UnmarshalBinary(b); err == nil {
+		t.Error("should fail")
+	}
+
+	pmt := &PMT{ProgramNumber: 1, Version: 1, PCRPID: PIDVideo,
+		Descriptors: []*Descriptor{{Tag: 0x1d, Data: []byte{0x01, 0x02}}},
+		Streams: []*Stream{
+			{Type: StreamTypeH264, PID: PIDVideo},
+			{Type: StreamTypePrivateData, PID: PIDAudio, Descriptors: newOpusStream(2).Descriptors},
+		},
+	}
+	if b, err = pmt.MarshalBinary(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	rpmt := NewPMT()
+	if err = rpmt.UnmarshalBinary(b); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if rpmt.ProgramNumber != 1 || rpmt.Version != 1 || rpmt.PCRPID != PIDVideo || len(rpmt.Descriptors) != 1 ||
+		len(rpmt.Streams) != 2 || rpmt.Streams[0].Type != StreamTypeH264 || rpmt.Streams[1].PID != PIDAudio {
+		t.Errorf("invalid pmt %v", rpmt)
+	}
+
+	s := rpmt.Streams[1]
+	if len(s.Descriptors) != 2 {
+		t.Fatalf("invalid descriptors %v", s.Descriptors)
+	}
+	if v, ok := s.Descriptors[0].FormatIdentifier(); !ok || v != FormatIdentifierOpus {
+		t.Errorf("invalid format identifier %#x", v)
+	}
+	if v, ok := s.Descriptors[1].OpusChannelConfig(); !ok || v != 2 {
+		t.Errorf("invalid channel config %v", v)
+	}
+
+	// Not PMT.
+	if err = NewPMT().UnmarshalBinary(mustMarshal(t, pat)); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func mustMarshal(t *testing.T, v interface {
+	MarshalBinary() ([]byte, error)
+}) []byte {
+	b, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return b
+}
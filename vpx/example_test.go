@@ -0,0 +1,69 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vpx_test
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/vpx"
+)
+
+func ExampleVP9FrameHeader() {
+	p, err := flv.NewVideoPackager()
+	if err != nil {
+		return
+	}
+
+	// The Enhanced RTMP video tag of VP9 keyframe, 1280x720.
+	tag := []byte{
+		0x91, 'v', 'p', '0', '9',
+		0x82, 0x49, 0x83, 0x42, 0x40, 0x4f, 0xf0, 0x2c, 0xf0,
+	}
+
+	frame, err := p.Decode(tag)
+	if err != nil || frame.FourCC != flv.VideoFourCCVP9 {
+		return
+	}
+
+	// The frame may be a superframe, which contains hidden frames.
+	frames, err := vpx.SplitSuperframe(frame.Raw)
+	if err != nil {
+		return
+	}
+
+	h := vpx.NewVP9FrameHeader()
+	if err = h.UnmarshalBinary(frames[0]); err != nil {
+		return
+	}
+	fmt.Println(h)
+
+	r, err := vpx.NewVPCodecConfigurationRecordFromVP9(h)
+	if err != nil {
+		return
+	}
+	fmt.Println("level", r.Level)
+
+	// Output:
+	// VP9 profile=0, keyframe=true, 1280x720, 8bits
+	// level 31
+}
@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vpx
+
+import (
+	"bytes"
+
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The chromaSubsampling of vpcC.
+// @doc vp-codec-iso-media-file-format-binding.pdf, 2.3 Semantics
+type ChromaSubsampling uint8
+
+const (
+	ChromaSubsampling420Vertical  ChromaSubsampling = 0
+	ChromaSubsampling420Colocated ChromaSubsampling = 1
+	ChromaSubsampling422          ChromaSubsampling = 2
+	ChromaSubsampling444          ChromaSubsampling = 3
+)
+
+// The colour primaries, transfer characteristics and matrix coefficients, for unspecified.
+// @doc ISO/IEC 23001-8, 7.1 Colour primaries
+const ColourUnspecified = 2
+
+// The VPCodecConfigurationRecord, the sequence header of VP8 and VP9 in MP4 and FLV.
+// @remark The record is prefixed by the version(1) and flags(0) of the vpcC FullBox, as FFmpeg.
+// @doc vp-codec-iso-media-file-format-binding.pdf, 2.2 VP Codec Configuration Box
+type VPCodecConfigurationRecord struct {
+	// The version of FullBox, must be 1.
+	version uint8
+	flags   uint32
+
+	Profile uint8
+	// The level, for example, 10 for level 1, 41 for level 4.1.
+	Level uint8
+	// The 4-bits bitDepth, 8, 10 or 12.
+	BitDepth uint8
+	// The 3-bits chromaSubsampling.
+	ChromaSubsampling       ChromaSubsampling
+	VideoFullRangeFlag      bool
+	ColourPrimaries         uint8
+	TransferCharacteristics uint8
+	MatrixCoefficients      uint8
+	// The codecIntializationData, must be empty for VP8 and VP9.
+	CodecInitializationData []byte
+}
+
+func NewVPCodecConfigurationRecord() *VPCodecConfigurationRecord {
+	return &VPCodecConfigurationRecord{
+		version:                 1,
+		ColourPrimaries:         ColourUnspecified,
+		TransferCharacteristics: ColourUnspecified,
+		MatrixCoefficients:      ColourUnspecified,
+	}
+}
+
+// The max luma picture size of VP9 levels.
+// @doc https://www.webmproject.org/vp9/levels
+var vp9Levels = []struct {
+	level       uint8
+	pictureSize int
+}{
+	{10, 36864}, {11, 73728}, {20, 122880}, {21, 245760}, {30, 552960}, {31, 983040},
+	{40, 2228224}, {50, 8912896}, {60, 35651584},
+}
+
+// Create the record from the VP9 keyframe header.
+// @remark The level is guessed by the picture size, for we don't know the bitrate and frame rate.
+func NewVPCodecConfigurationRecordFromVP9(h *VP9FrameHeader) (*VPCodecConfigurationRecord, error) {
+	if h.Width == 0 || h.Height == 0 {
+		return nil, errors.New("no frame size, should be keyframe")
+	}
+
+	v := NewVPCodecConfigurationRecord()
+	v.Profile = h.Profile
+	v.BitDepth = uint8(h.BitDepth)
+	v.VideoFullRangeFlag = h.ColorRange
+
+	switch {
+	case h.SubsamplingX && h.SubsamplingY:
+		v.ChromaSubsampling = ChromaSubsampling420Vertical
+	case h.SubsamplingX:
+		v.ChromaSubsampling = ChromaSubsampling422
+	case !h.SubsamplingY:
+		v.ChromaSubsampling = ChromaSubsampling444
+	default:
+		return nil, errors.New("4:4:0 subsampling not supported")
+	}
+
+	// @doc ISO/IEC 23001-8, 7.3 Matrix coefficients
+	switch h.ColorSpace {
+	case VP9ColorSpaceBT601, VP9ColorSpaceSMPTE170:
+		v.MatrixCoefficients = 6
+	case VP9ColorSpaceBT709:
+		v.MatrixCoefficients = 1
+	case VP9ColorSpaceSMPTE240:
+		v.MatrixCoefficients = 7
+	case VP9ColorSpaceBT2020:
+		v.MatrixCoefficients = 9
+	case VP9ColorSpaceSRGB:
+		v.MatrixCoefficients = 0
+	}
+
+	pictureSize := h.Width * h.Height
+	for _, l := range vp9Levels {
+		if v.Level = l.level; pictureSize <= l.pictureSize {
+			break
+		}
+	}
+
+	return v, nil
+}
+
+func (v *VPCodecConfigurationRecord) MarshalBinary() ([]byte, error) {
+	if len(v.CodecInitializationData) > 0xffff {
+		return nil, errors.Errorf("codec initialization data %vB overflow", len(v.CodecInitializationData))
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{byte(v.version), byte(v.flags >> 16), byte(v.flags >> 8), byte(v.flags)})
+	buf.WriteByte(byte(v.Profile))
+	buf.WriteByte(byte(v.Level))
+
+	b := byte(v.BitDepth&0x0f)<<4 | byte(v.ChromaSubsampling&0x07)<<1
+	if v.VideoFullRangeFlag {
+		b |= 0x01
+	}
+	buf.WriteByte(b)
+
+	buf.WriteByte(byte(v.ColourPrimaries))
+	buf.WriteByte(byte(v.TransferCharacteristics))
+	buf.WriteByte(byte(v.MatrixCoefficients))
+	buf.WriteByte(byte(len(v.CodecInitializationData) >> 8))
+	buf.WriteByte(byte(len(v.CodecInitializationData)))
+	buf.Write(v.CodecInitializationData)
+
+	return buf.Bytes(), nil
+}
+
+func (v *VPCodecConfigurationRecord) UnmarshalBinary(data []byte) error {
+	b := data
+	if len(b) < 12 {
+		return errors.Errorf("requires 12+ only %v bytes", len(b))
+	}
+
+	if v.version = uint8(b[0]); v.version != 1 {
+		return errors.Errorf("invalid version %v", v.version)
+	}
+	v.flags = uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	v.Profile = uint8(b[4])
+	v.Level = uint8(b[5])
+	v.BitDepth = uint8(b[6] >> 4)
+	v.ChromaSubsampling = ChromaSubsampling(b[6]>>1) & 0x07
+	v.VideoFullRangeFlag = b[6]&0x01 == 0x01
+	v.ColourPrimaries = uint8(b[7])
+	v.TransferCharacteristics = uint8(b[8])
+	v.MatrixCoefficients = uint8(b[9])
+
+	size := int(uint16(b[10])<<8 | uint16(b[11]))
+	if b = b[12:]; len(b) < size {
+		return errors.Errorf("requires %v only %v bytes", size, len(b))
+	}
+	v.CodecInitializationData = b[:size]
+
+	return nil
+}
@@ -0,0 +1,378 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx VPX package includes some utilites for VP8 and VP9.
+// The VP8 and VP9 frame is not split to units like NALU, the frame starts with a header
+// which indicates the keyframe and resolution, while the codec information of VP9 is
+// carried by VPCodecConfigurationRecord(vpcC) in MP4 and FLV(Enhanced RTMP).
+//
+//	@note VP8 frame header, please read rfc6386.txt, 9.1 Uncompressed Data Chunk.
+//	@note VP9 uncompressed header, please read vp9-bitstream-specification-v0.6-20160331-draft.pdf,
+//		6.2 Uncompressed header syntax.
+//	@note The vpcC, please read vp-codec-iso-media-file-format-binding.pdf, 2.2 VP Codec
+//		Configuration Box.
+package vpx
+
+import (
+	"fmt"
+
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The start code of VP8 keyframe.
+var vp8StartCode = []byte{0x9d, 0x01, 0x2a}
+
+// The VP8 frame header, the frame tag and the keyframe start code and resolution.
+// @doc rfc6386.txt, 9.1 Uncompressed Data Chunk
+type VP8FrameHeader struct {
+	KeyFrame bool
+	// The 3-bits version, determines the reconstruction filter and loop filter.
+	Version   uint8
+	ShowFrame bool
+	// The 19-bits size of first data partition, without the uncompressed data chunk.
+	FirstPartSize uint32
+	// The 14-bits width and height, 2-bits scale, for keyframe only.
+	Width           uint16
+	HorizontalScale uint8
+	Height          uint16
+	VerticalScale   uint8
+}
+
+func NewVP8FrameHeader() *VP8FrameHeader {
+	return &VP8FrameHeader{}
+}
+
+func (v *VP8FrameHeader) String() string {
+	if v.KeyFrame {
+		return fmt.Sprintf("VP8 keyframe %vx%v, version=%v", v.Width, v.Height, v.Version)
+	}
+	return fmt.Sprintf("VP8 interframe, version=%v", v.Version)
+}
+
+// The size of header, 10 bytes for keyframe, 3 bytes for interframe.
+func (v *VP8FrameHeader) Size() int {
+	if v.KeyFrame {
+		return 10
+	}
+	return 3
+}
+
+func (v *VP8FrameHeader) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return errors.Errorf("requires 3+ only %v bytes", len(data))
+	}
+
+	// The frame tag is little-endian, and the key_frame is 0 for keyframe.
+	tag := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+	v.KeyFrame = tag&0x01 == 0
+	v.Version = uint8(tag>>1) & 0x07
+	v.ShowFrame = (tag>>4)&0x01 == 0x01
+	v.FirstPartSize = (tag >> 5) & 0x7ffff
+
+	if !v.KeyFrame {
+		return nil
+	}
+
+	if len(data) < 10 {
+		return errors.Errorf("keyframe requires 10+ only %v bytes", len(data))
+	}
+	if data[3] != vp8StartCode[0] || data[4] != vp8StartCode[1] || data[5] != vp8StartCode[2] {
+		return errors.Errorf("invalid start code %x", data[3:6])
+	}
+
+	v.Width = (uint16(data[6]) | uint16(data[7])<<8) & 0x3fff
+	v.HorizontalScale = uint8(data[7] >> 6)
+	v.Height = (uint16(data[8]) | uint16(data[9])<<8) & 0x3fff
+	v.VerticalScale = uint8(data[9] >> 6)
+	return nil
+}
+
+func (v *VP8FrameHeader) MarshalBinary() ([]byte, error) {
+	tag := (v.FirstPartSize&0x7ffff)<<5 | uint32(v.Version&0x07)<<1
+	if !v.KeyFrame {
+		tag |= 0x01
+	}
+	if v.ShowFrame {
+		tag |= 0x10
+	}
+
+	b := []byte{byte(tag), byte(tag >> 8), byte(tag >> 16)}
+	if !v.KeyFrame {
+		return b, nil
+	}
+
+	b = append(b, vp8StartCode...)
+	width := v.Width&0x3fff | uint16(v.HorizontalScale&0x03)<<14
+	height := v.Height&0x3fff | uint16(v.VerticalScale&0x03)<<14
+	return append(b, byte(width), byte(width>>8), byte(height), byte(height>>8)), nil
+}
+
+// The frame_type of VP9.
+type VP9FrameType uint8
+
+const (
+	VP9FrameTypeKeyFrame    VP9FrameType = 0
+	VP9FrameTypeNonKeyFrame VP9FrameType = 1
+)
+
+// The color_space of VP9.
+// @doc vp9-bitstream-specification-v0.6-20160331-draft.pdf, 7.2.2 Color config semantics
+type VP9ColorSpace uint8
+
+const (
+	VP9ColorSpaceUnknown  VP9ColorSpace = 0
+	VP9ColorSpaceBT601    VP9ColorSpace = 1
+	VP9ColorSpaceBT709    VP9ColorSpace = 2
+	VP9ColorSpaceSMPTE170 VP9ColorSpace = 3
+	VP9ColorSpaceSMPTE240 VP9ColorSpace = 4
+	VP9ColorSpaceBT2020   VP9ColorSpace = 5
+	VP9ColorSpaceReserved VP9ColorSpace = 6
+	VP9ColorSpaceSRGB     VP9ColorSpace = 7
+)
+
+// The frame_marker and frame_sync_code of VP9.
+const (
+	vp9FrameMarker   = 2
+	vp9FrameSyncCode = 0x498342
+)
+
+// The VP9 uncompressed header, we only parse the fields before the loop filter params,
+// for the keyframe and intra-only frame, which carries the resolution.
+// @remark For the inter frame, the size is from the reference frame, so the Width and Height is 0.
+// @doc vp9-bitstream-specification-v0.6-20160331-draft.pdf, 6.2 Uncompressed header syntax
+type VP9FrameHeader struct {
+	// The Profile in [0, 3].
+	Profile           uint8
+	ShowExistingFrame bool
+	FrameToShowMapIdx uint8
+
+	FrameType          VP9FrameType
+	ShowFrame          bool
+	ErrorResilientMode bool
+	IntraOnly          bool
+	ResetFrameContext  uint8
+
+	// The color_config, for keyframe and intra-only frame.
+	BitDepth     int
+	ColorSpace   VP9ColorSpace
+	ColorRange   bool
+	SubsamplingX bool
+	SubsamplingY bool
+
+	RefreshFrameFlags uint8
+	// The frame_size and render_size, for keyframe and intra-only frame.
+	Width        int
+	Height       int
+	RenderWidth  int
+	RenderHeight int
+}
+
+func NewVP9FrameHeader() *VP9FrameHeader {
+	return &VP9FrameHeader{}
+}
+
+func (v *VP9FrameHeader) String() string {
+	if v.ShowExistingFrame {
+		return fmt.Sprintf("VP9 show existing frame %v", v.FrameToShowMapIdx)
+	}
+	if v.Width > 0 {
+		return fmt.Sprintf("VP9 profile=%v, keyframe=%v, %vx%v, %vbits", v.Profile, v.KeyFrame(), v.Width, v.Height, v.BitDepth)
+	}
+	return fmt.Sprintf("VP9 profile=%v, keyframe=%v", v.Profile, v.KeyFrame())
+}
+
+// Whether the frame is keyframe.
+func (v *VP9FrameHeader) KeyFrame() bool {
+	return !v.ShowExistingFrame && v.FrameType == VP9FrameTypeKeyFrame
+}
+
+func (v *VP9FrameHeader) UnmarshalBinary(data []byte) error {
+	p := avc.NewBitParser(data)
+
+	if marker := p.U(2); p.Err() == nil && marker != vp9FrameMarker {
+		return errors.Errorf("invalid frame marker %v", marker)
+	}
+	profileLowBit := p.U(1)
+	v.Profile = uint8(p.U(1)<<1 | profileLowBit)
+	if v.Profile == 3 {
+		p.U(1) // reserved_zero
+	}
+
+	if v.ShowExistingFrame = p.Flag(); v.ShowExistingFrame {
+		v.FrameToShowMapIdx = uint8(p.U(3))
+		if p.Err() != nil {
+			return errors.WithMessage(p.Err(), "uncompressed header")
+		}
+		return nil
+	}
+
+	v.FrameType = VP9FrameType(p.U(1))
+	v.ShowFrame = p.Flag()
+	v.ErrorResilientMode = p.Flag()
+
+	// The default color config of profile 0 for intra-only frame, the color space is BT.601.
+	v.BitDepth, v.SubsamplingX, v.SubsamplingY = 8, true, true
+
+	if v.FrameType == VP9FrameTypeKeyFrame {
+		if err := v.parseSyncCode(p); err != nil {
+			return err
+		}
+		v.parseColorConfig(p)
+		v.parseFrameSize(p)
+		v.RefreshFrameFlags = 0xff
+	} else {
+		if !v.ShowFrame {
+			v.IntraOnly = p.Flag()
+		}
+		if !v.ErrorResilientMode {
+			v.ResetFrameContext = uint8(p.U(2))
+		}
+
+		if v.IntraOnly {
+			if err := v.parseSyncCode(p); err != nil {
+				return err
+			}
+			if v.Profile > 0 {
+				v.parseColorConfig(p)
+			} else {
+				v.ColorSpace = VP9ColorSpaceBT601
+			}
+			v.RefreshFrameFlags = uint8(p.U(8))
+			v.parseFrameSize(p)
+		} else {
+			v.RefreshFrameFlags = uint8(p.U(8))
+		}
+	}
+
+	if p.Err() != nil {
+		return errors.WithMessage(p.Err(), "uncompressed header")
+	}
+	return nil
+}
+
+func (v *VP9FrameHeader) parseSyncCode(p *avc.BitParser) error {
+	if code := p.U(24); p.Err() == nil && code != vp9FrameSyncCode {
+		return errors.Errorf("invalid frame sync code %x", code)
+	}
+	return nil
+}
+
+// @doc vp9-bitstream-specification-v0.6-20160331-draft.pdf, 6.2.2 Color config syntax
+func (v *VP9FrameHeader) parseColorConfig(p *avc.BitParser) {
+	if v.Profile >= 2 {
+		if p.Flag() {
+			v.BitDepth = 12
+		} else {
+			v.BitDepth = 10
+		}
+	}
+
+	if v.ColorSpace = VP9ColorSpace(p.U(3)); v.ColorSpace != VP9ColorSpaceSRGB {
+		v.ColorRange = p.Flag()
+		if v.Profile == 1 || v.Profile == 3 {
+			v.SubsamplingX = p.Flag()
+			v.SubsamplingY = p.Flag()
+			p.U(1) // reserved_zero
+		}
+	} else {
+		v.ColorRange = true
+		if v.Profile == 1 || v.Profile == 3 {
+			v.SubsamplingX, v.SubsamplingY = false, false
+			p.U(1) // reserved_zero
+		}
+	}
+}
+
+// Parse the frame_size and render_size.
+func (v *VP9FrameHeader) parseFrameSize(p *avc.BitParser) {
+	v.Width = int(p.U(16)) + 1
+	v.Height = int(p.U(16)) + 1
+
+	v.RenderWidth, v.RenderHeight = v.Width, v.Height
+	if p.Flag() {
+		v.RenderWidth = int(p.U(16)) + 1
+		v.RenderHeight = int(p.U(16)) + 1
+	}
+}
+
+// Split the VP9 superframe to frames by the superframe index, or return the data as a frame
+// if no index. The frames refer to the data.
+// @doc vp9-bitstream-specification-v0.6-20160331-draft.pdf, Annex B Superframes
+func SplitSuperframe(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty frame")
+	}
+
+	// The superframe_marker is 0b110 in the last byte.
+	marker := data[len(data)-1]
+	if marker&0xe0 != 0xc0 {
+		return [][]byte{data}, nil
+	}
+
+	framesInSuperframe := int(marker&0x07) + 1
+	bytesPerFramesize := int(marker>>3&0x03) + 1
+	indexSize := 2 + bytesPerFramesize*framesInSuperframe
+	if len(data) < indexSize || data[len(data)-indexSize] != marker {
+		// Not a superframe index, it's part of the frame.
+		return [][]byte{data}, nil
+	}
+
+	var frames [][]byte
+	index, b := data[len(data)-indexSize+1:], data[:len(data)-indexSize]
+	for i := 0; i < framesInSuperframe; i++ {
+		var size int
+		for j := 0; j < bytesPerFramesize; j++ {
+			size |= int(index[j]) << uint(8*j)
+		}
+		index = index[bytesPerFramesize:]
+
+		if len(b) < size {
+			return nil, errors.Errorf("frame %v requires %v only %v bytes", i, size, len(b))
+		}
+		frames, b = append(frames, b[:size]), b[size:]
+	}
+
+	if len(b) != 0 {
+		return nil, errors.Errorf("superframe %vB left", len(b))
+	}
+	return frames, nil
+}
+
+// Join the VP9 frames to a superframe with index, use 4 bytes frame size.
+func JoinSuperframe(frames [][]byte) ([]byte, error) {
+	if len(frames) == 0 || len(frames) > 8 {
+		return nil, errors.Errorf("invalid %v frames", len(frames))
+	}
+
+	var b []byte
+	for _, frame := range frames {
+		b = append(b, frame...)
+	}
+
+	marker := byte(0xc0 | 0x03<<3 | byte(len(frames)-1))
+	b = append(b, marker)
+	for _, frame := range frames {
+		size := uint32(len(frame))
+		b = append(b, byte(size), byte(size>>8), byte(size>>16), byte(size>>24))
+	}
+	return append(b, marker), nil
+}
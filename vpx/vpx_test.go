@@ -0,0 +1,221 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vpx
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVP8FrameHeader(t *testing.T) {
+	data := []byte{0x50, 0x9a, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x41, 0xff}
+
+	h := NewVP8FrameHeader()
+	if err := h.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if !h.KeyFrame || !h.ShowFrame || h.Version != 0 || h.FirstPartSize != 1234 || h.Size() != 10 {
+		t.Errorf("invalid header %+v", h)
+	}
+	if h.Width != 640 || h.Height != 480 || h.HorizontalScale != 0 || h.VerticalScale != 1 {
+		t.Errorf("invalid size %+v", h)
+	}
+	if b, err := h.MarshalBinary(); err != nil || !bytes.Equal(b, data[:10]) {
+		t.Errorf("invalid header %x, err %+v", b, err)
+	}
+
+	// The interframe, without start code.
+	h = NewVP8FrameHeader()
+	if err := h.UnmarshalBinary([]byte{0x51, 0x9a, 0x00}); err != nil || h.KeyFrame || h.Width != 0 || h.Size() != 3 {
+		t.Errorf("invalid header %+v, err %+v", h, err)
+	}
+
+	if err := NewVP8FrameHeader().UnmarshalBinary(data[:9]); err == nil {
+		t.Error("should error for not enough")
+	}
+	if err := NewVP8FrameHeader().UnmarshalBinary([]byte{0x50, 0x9a, 0x00, 0x9d, 0x01, 0x2b, 0x80, 0x02, 0xe0, 0x01}); err == nil {
+		t.Error("should error for start code")
+	}
+}
+
+func TestVP9FrameHeader(t *testing.T) {
+	// The keyframe of profile 0, 1920x804 with unknown color space, captured from Chrome WebRTC, from the vp9 tests of
+	// github.com/bluenviron/mediacommon.
+	data := []byte{
+		0x82, 0x49, 0x83, 0x42, 0x00, 0x77, 0xf0, 0x32, 0x34, 0x30, 0x38, 0x24,
+		0x1c, 0x19, 0x40, 0x18, 0x03, 0x40, 0x5f, 0xb4,
+	}
+	h := NewVP9FrameHeader()
+	if err := h.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if !h.KeyFrame() || !h.ShowFrame || h.Profile != 0 || h.BitDepth != 8 || h.ColorSpace != VP9ColorSpaceUnknown ||
+		h.ColorRange || !h.SubsamplingX || !h.SubsamplingY {
+		t.Errorf("invalid header %+v", h)
+	}
+	if h.Width != 1920 || h.Height != 804 || h.RenderWidth != 1920 || h.RenderHeight != 804 || h.RefreshFrameFlags != 0xff {
+		t.Errorf("invalid size %+v", h)
+	}
+
+	// The keyframe of profile 0, 3840x2160 BT.709, from the vp9 tests of github.com/bluenviron/mediacommon.
+	h = NewVP9FrameHeader()
+	if err := h.UnmarshalBinary([]byte{
+		0x82, 0x49, 0x83, 0x42, 0x40, 0xef, 0xf0, 0x86, 0xf4, 0x04, 0x21, 0xa0,
+		0xe0, 0x00, 0x30, 0x70, 0x00, 0x00, 0x00, 0x01,
+	}); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if !h.KeyFrame() || h.Profile != 0 || h.BitDepth != 8 || h.ColorSpace != VP9ColorSpaceBT709 || h.Width != 3840 ||
+		h.Height != 2160 {
+		t.Errorf("invalid header %+v", h)
+	}
+
+	// The keyframe of profile 2, 10bits 3840x2160, with render size 1920x1080.
+	h = NewVP9FrameHeader()
+	if err := h.UnmarshalBinary([]byte{
+		0x92, 0x49, 0x83, 0x42, 0x58, 0x77, 0xf8, 0x43, 0x7c, 0x1d, 0xfc, 0x10, 0xdc,
+	}); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if h.Profile != 2 || h.BitDepth != 10 || !h.ColorRange || h.Width != 3840 || h.RenderHeight != 1080 {
+		t.Errorf("invalid header %+v", h)
+	}
+
+	// The keyframe of profile 1, 640x480 4:4:4.
+	h = NewVP9FrameHeader()
+	if err := h.UnmarshalBinary([]byte{0xa2, 0x49, 0x83, 0x42, 0x30, 0x04, 0xfe, 0x03, 0xbe}); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if h.Profile != 1 || h.SubsamplingX || h.SubsamplingY || h.Width != 640 {
+		t.Errorf("invalid header %+v", h)
+	}
+
+	// The inter frame, without size.
+	h = NewVP9FrameHeader()
+	if err := h.UnmarshalBinary([]byte{0x86, 0x01, 0x00}); err != nil || h.KeyFrame() || h.Width != 0 ||
+		h.RefreshFrameFlags != 0x04 {
+		t.Errorf("invalid header %+v, err %+v", h, err)
+	}
+
+	// The intra-only frame of profile 0, not shown, 320x240.
+	h = NewVP9FrameHeader()
+	if err := h.UnmarshalBinary([]byte{0x84, 0x89, 0x30, 0x68, 0x40, 0x20, 0x27, 0xe0, 0x1d, 0xe0}); err != nil ||
+		h.KeyFrame() || !h.IntraOnly || h.Width != 320 || h.BitDepth != 8 || h.ColorSpace != VP9ColorSpaceBT601 {
+		t.Errorf("invalid header %+v, err %+v", h, err)
+	}
+
+	// The uncompressed header is 69 bits, to the render_and_frame_size_different.
+	for i := 1; i < 9; i++ {
+		if err := NewVP9FrameHeader().UnmarshalBinary(data[:i]); err == nil {
+			t.Errorf("should error for %vB", i)
+		}
+	}
+
+	// The show existing frame.
+	h = NewVP9FrameHeader()
+	if err := h.UnmarshalBinary([]byte{0x8d}); err != nil || !h.ShowExistingFrame || h.FrameToShowMapIdx != 5 || h.KeyFrame() {
+		t.Errorf("invalid header %+v, err %+v", h, err)
+	}
+
+	for _, b := range [][]byte{{0x40}, {0x80, 0x00, 0x00, 0x00}, {0x82, 0x49, 0x83, 0x42}} {
+		if err := NewVP9FrameHeader().UnmarshalBinary(b); err == nil {
+			t.Errorf("should error for %x", b)
+		}
+	}
+}
+
+func TestSuperframe(t *testing.T) {
+	frames := [][]byte{{0x86, 0x00, 0x40}, bytes.Repeat([]byte{0x87}, 300)}
+
+	data, err := JoinSuperframe(frames)
+	if err != nil {
+		t.Fatalf("join failed %+v", err)
+	}
+	if len(data) != 303+10 || data[len(data)-1] != 0xd9 {
+		t.Errorf("invalid superframe %x", data[len(data)-10:])
+	}
+
+	v, err := SplitSuperframe(data)
+	if err != nil || len(v) != 2 || !bytes.Equal(v[0], frames[0]) || !bytes.Equal(v[1], frames[1]) {
+		t.Errorf("invalid frames %x, err %+v", v, err)
+	}
+
+	// The superframe with 1 byte size, generated by libvpx.
+	v, err = SplitSuperframe([]byte{0x86, 0x00, 0x87, 0x00, 0xc1, 0x02, 0x02, 0xc1})
+	if err != nil || len(v) != 2 || v[1][0] != 0x87 {
+		t.Errorf("invalid frames %x, err %+v", v, err)
+	}
+
+	// Not a superframe.
+	if v, err = SplitSuperframe(frames[0]); err != nil || len(v) != 1 {
+		t.Errorf("invalid frames %x, err %+v", v, err)
+	}
+
+	if _, err = SplitSuperframe([]byte{0x86, 0x00, 0x87, 0xc1, 0x03, 0x02, 0xc1}); err == nil {
+		t.Error("should error for size")
+	}
+	if _, err = SplitSuperframe(nil); err == nil {
+		t.Error("should error for empty")
+	}
+}
+
+func TestVPCodecConfigurationRecord(t *testing.T) {
+	h := &VP9FrameHeader{Profile: 2, BitDepth: 10, ColorSpace: VP9ColorSpaceBT2020, SubsamplingX: true, SubsamplingY: true,
+		Width: 1920, Height: 1080}
+
+	r, err := NewVPCodecConfigurationRecordFromVP9(h)
+	if err != nil {
+		t.Fatalf("create failed %+v", err)
+	}
+	if r.Level != 40 || r.MatrixCoefficients != 9 || r.ChromaSubsampling != ChromaSubsampling420Vertical {
+		t.Errorf("invalid record %+v", r)
+	}
+
+	b, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed %+v", err)
+	}
+	if expect := []byte{0x01, 0x00, 0x00, 0x00, 0x02, 40, 0xa0, 0x02, 0x02, 0x09, 0x00, 0x00}; !bytes.Equal(b, expect) {
+		t.Errorf("invalid record %x, expect %x", b, expect)
+	}
+
+	v := NewVPCodecConfigurationRecord()
+	if err := v.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if v.Profile != 2 || v.Level != 40 || v.BitDepth != 10 || v.VideoFullRangeFlag || len(v.CodecInitializationData) != 0 {
+		t.Errorf("invalid record %+v", v)
+	}
+
+	if err := NewVPCodecConfigurationRecord().UnmarshalBinary(append([]byte{0x00}, b[1:]...)); err == nil {
+		t.Error("should error for version 0")
+	}
+	if err := NewVPCodecConfigurationRecord().UnmarshalBinary(append(b[:11], 0x01)); err == nil {
+		t.Error("should error for not enough")
+	}
+	if _, err := NewVPCodecConfigurationRecordFromVP9(&VP9FrameHeader{}); err == nil {
+		t.Error("should error for no size")
+	}
+	if _, err := NewVPCodecConfigurationRecordFromVP9(&VP9FrameHeader{Width: 1, Height: 1, SubsamplingY: true}); err == nil {
+		t.Error("should error for 4:4:0")
+	}
+}